@@ -75,6 +75,12 @@ type RegisterReq struct {
 	Hostname      string                 `protobuf:"bytes,1,opt,name=hostname,proto3" json:"hostname,omitempty"`
 	Ip            string                 `protobuf:"bytes,2,opt,name=ip,proto3" json:"ip,omitempty"`
 	Tags          []string               `protobuf:"bytes,3,rep,name=tags,proto3" json:"tags,omitempty"`
+	Os            string                 `protobuf:"bytes,4,opt,name=os,proto3" json:"os,omitempty"`         // runtime.GOOS
+	Arch          string                 `protobuf:"bytes,5,opt,name=arch,proto3" json:"arch,omitempty"`     // runtime.GOARCH
+	Kernel        string                 `protobuf:"bytes,6,opt,name=kernel,proto3" json:"kernel,omitempty"` // 内核版本
+	AgentVersion  string                 `protobuf:"bytes,7,opt,name=agent_version,json=agentVersion,proto3" json:"agent_version,omitempty"`
+	Capabilities  []string               `protobuf:"bytes,8,rep,name=capabilities,proto3" json:"capabilities,omitempty"` // Agent 能执行的任务类型
+	Facts         *AgentFacts            `protobuf:"bytes,9,opt,name=facts,proto3" json:"facts,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -130,29 +136,846 @@ func (x *RegisterReq) GetTags() []string {
 	return nil
 }
 
+func (x *RegisterReq) GetOs() string {
+	if x != nil {
+		return x.Os
+	}
+	return ""
+}
+
+func (x *RegisterReq) GetArch() string {
+	if x != nil {
+		return x.Arch
+	}
+	return ""
+}
+
+func (x *RegisterReq) GetKernel() string {
+	if x != nil {
+		return x.Kernel
+	}
+	return ""
+}
+
+func (x *RegisterReq) GetAgentVersion() string {
+	if x != nil {
+		return x.AgentVersion
+	}
+	return ""
+}
+
+func (x *RegisterReq) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *RegisterReq) GetFacts() *AgentFacts {
+	if x != nil {
+		return x.Facts
+	}
+	return nil
+}
+
+// AgentFacts Agent 启动时自动采集的主机信息，可用于任务的 selector
+type AgentFacts struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ips           []string               `protobuf:"bytes,1,rep,name=ips,proto3" json:"ips,omitempty"`                              // 所有网卡上的地址 (不含回环)
+	OsRelease     string                 `protobuf:"bytes,2,opt,name=os_release,json=osRelease,proto3" json:"os_release,omitempty"` // /etc/os-release 里的 PRETTY_NAME
+	CpuCount      int32                  `protobuf:"varint,3,opt,name=cpu_count,json=cpuCount,proto3" json:"cpu_count,omitempty"`
+	CpuModel      string                 `protobuf:"bytes,4,opt,name=cpu_model,json=cpuModel,proto3" json:"cpu_model,omitempty"`
+	MemoryTotal   int64                  `protobuf:"varint,5,opt,name=memory_total,json=memoryTotal,proto3" json:"memory_total,omitempty"` // 字节
+	DiskTotal     int64                  `protobuf:"varint,6,opt,name=disk_total,json=diskTotal,proto3" json:"disk_total,omitempty"`       // 根分区，字节
+	DiskFree      int64                  `protobuf:"varint,7,opt,name=disk_free,json=diskFree,proto3" json:"disk_free,omitempty"`
+	BuildCommit   string                 `protobuf:"bytes,8,opt,name=build_commit,json=buildCommit,proto3" json:"build_commit,omitempty"`
+	Container     string                 `protobuf:"bytes,9,opt,name=container,proto3" json:"container,omitempty"`    // docker / podman / kubernetes / lxc，空表示不在容器里
+	Hypervisor    string                 `protobuf:"bytes,10,opt,name=hypervisor,proto3" json:"hypervisor,omitempty"` // kvm / vmware / ...，空表示物理机或无法识别
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentFacts) Reset() {
+	*x = AgentFacts{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentFacts) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentFacts) ProtoMessage() {}
+
+func (x *AgentFacts) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentFacts.ProtoReflect.Descriptor instead.
+func (*AgentFacts) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AgentFacts) GetIps() []string {
+	if x != nil {
+		return x.Ips
+	}
+	return nil
+}
+
+func (x *AgentFacts) GetOsRelease() string {
+	if x != nil {
+		return x.OsRelease
+	}
+	return ""
+}
+
+func (x *AgentFacts) GetCpuCount() int32 {
+	if x != nil {
+		return x.CpuCount
+	}
+	return 0
+}
+
+func (x *AgentFacts) GetCpuModel() string {
+	if x != nil {
+		return x.CpuModel
+	}
+	return ""
+}
+
+func (x *AgentFacts) GetMemoryTotal() int64 {
+	if x != nil {
+		return x.MemoryTotal
+	}
+	return 0
+}
+
+func (x *AgentFacts) GetDiskTotal() int64 {
+	if x != nil {
+		return x.DiskTotal
+	}
+	return 0
+}
+
+func (x *AgentFacts) GetDiskFree() int64 {
+	if x != nil {
+		return x.DiskFree
+	}
+	return 0
+}
+
+func (x *AgentFacts) GetBuildCommit() string {
+	if x != nil {
+		return x.BuildCommit
+	}
+	return ""
+}
+
+func (x *AgentFacts) GetContainer() string {
+	if x != nil {
+		return x.Container
+	}
+	return ""
+}
+
+func (x *AgentFacts) GetHypervisor() string {
+	if x != nil {
+		return x.Hypervisor
+	}
+	return ""
+}
+
 type RegisterResp struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
-	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	Success       bool                   `protobuf:"varint,2,opt,name=success,proto3" json:"success,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterResp) Reset() {
+	*x = RegisterResp{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterResp) ProtoMessage() {}
+
+func (x *RegisterResp) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterResp.ProtoReflect.Descriptor instead.
+func (*RegisterResp) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RegisterResp) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *RegisterResp) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+type HeartbeatReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	CpuUsage      float64                `protobuf:"fixed64,3,opt,name=cpu_usage,json=cpuUsage,proto3" json:"cpu_usage,omitempty"`
+	MemUsage      float64                `protobuf:"fixed64,4,opt,name=mem_usage,json=memUsage,proto3" json:"mem_usage,omitempty"`
+	RunningJobs   int32                  `protobuf:"varint,5,opt,name=running_jobs,json=runningJobs,proto3" json:"running_jobs,omitempty"`      // 已占用的并发槽位 (含已收到、还在等槽位的任务)
+	MaxJobs       int32                  `protobuf:"varint,6,opt,name=max_jobs,json=maxJobs,proto3" json:"max_jobs,omitempty"`                  // 并发上限 (max_concurrent_jobs)
+	State         string                 `protobuf:"bytes,7,opt,name=state,proto3" json:"state,omitempty"`                                      // Active / Draining / Drained
+	ConfigVersion string                 `protobuf:"bytes,8,opt,name=config_version,json=configVersion,proto3" json:"config_version,omitempty"` // 当前生效的配置版本，和 Server 不一致时会收到 config_outdated
+	Seq           int64                  `protobuf:"varint,9,opt,name=seq,proto3" json:"seq,omitempty"`                                         // 心跳序号，每条递增，Server 在响应的 ack 里回传
+	Ack           int64                  `protobuf:"varint,10,opt,name=ack,proto3" json:"ack,omitempty"`                                        // 已处理的 Server 消息的最大 seq
+	Accepted      []*JobAccepted         `protobuf:"bytes,11,rep,name=accepted,proto3" json:"accepted,omitempty"`                               // 确认收到的任务，没有确认的任务在重连后会重新派发
+	Ping          bool                   `protobuf:"varint,12,opt,name=ping,proto3" json:"ping,omitempty"`                                      // 要求 Server 立即回复 (带上 ack)，Agent 用来测量心跳往返时间
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatReq) Reset() {
+	*x = HeartbeatReq{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatReq) ProtoMessage() {}
+
+func (x *HeartbeatReq) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatReq.ProtoReflect.Descriptor instead.
+func (*HeartbeatReq) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *HeartbeatReq) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *HeartbeatReq) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *HeartbeatReq) GetCpuUsage() float64 {
+	if x != nil {
+		return x.CpuUsage
+	}
+	return 0
+}
+
+func (x *HeartbeatReq) GetMemUsage() float64 {
+	if x != nil {
+		return x.MemUsage
+	}
+	return 0
+}
+
+func (x *HeartbeatReq) GetRunningJobs() int32 {
+	if x != nil {
+		return x.RunningJobs
+	}
+	return 0
+}
+
+func (x *HeartbeatReq) GetMaxJobs() int32 {
+	if x != nil {
+		return x.MaxJobs
+	}
+	return 0
+}
+
+func (x *HeartbeatReq) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *HeartbeatReq) GetConfigVersion() string {
+	if x != nil {
+		return x.ConfigVersion
+	}
+	return ""
+}
+
+func (x *HeartbeatReq) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *HeartbeatReq) GetAck() int64 {
+	if x != nil {
+		return x.Ack
+	}
+	return 0
+}
+
+func (x *HeartbeatReq) GetAccepted() []*JobAccepted {
+	if x != nil {
+		return x.Accepted
+	}
+	return nil
+}
+
+func (x *HeartbeatReq) GetPing() bool {
+	if x != nil {
+		return x.Ping
+	}
+	return false
+}
+
+// JobAccepted Agent 收到 Server 下发的任务后回传的确认
+type JobAccepted struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Duplicate     bool                   `protobuf:"varint,2,opt,name=duplicate,proto3" json:"duplicate,omitempty"` // 之前已经收到过 (确认在断线时丢了)，这次没有重复执行
+	Rejected      bool                   `protobuf:"varint,3,opt,name=rejected,proto3" json:"rejected,omitempty"`   // 收到时已经在排空，没有接收：任务保持 Assigned，由 Server 重新安排
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobAccepted) Reset() {
+	*x = JobAccepted{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobAccepted) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobAccepted) ProtoMessage() {}
+
+func (x *JobAccepted) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobAccepted.ProtoReflect.Descriptor instead.
+func (*JobAccepted) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *JobAccepted) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *JobAccepted) GetDuplicate() bool {
+	if x != nil {
+		return x.Duplicate
+	}
+	return false
+}
+
+func (x *JobAccepted) GetRejected() bool {
+	if x != nil {
+		return x.Rejected
+	}
+	return false
+}
+
+type Job struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Type          JobType                `protobuf:"varint,2,opt,name=type,proto3,enum=sentinel.JobType" json:"type,omitempty"`
+	Payload       string                 `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Artifacts     []string               `protobuf:"bytes,4,rep,name=artifacts,proto3" json:"artifacts,omitempty"`                                                               // 执行结束后要上传的产物文件 (glob，如 "out/*.log")
+	Files         []*InputFile           `protobuf:"bytes,5,rep,name=files,proto3" json:"files,omitempty"`                                                                       // 执行前要下载到工作目录的输入文件
+	Env           map[string]string      `protobuf:"bytes,6,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // 额外的环境变量
+	Workdir       string                 `protobuf:"bytes,7,opt,name=workdir,proto3" json:"workdir,omitempty"`                                                                   // 工作目录：相对路径在任务的临时工作区内，绝对路径原样使用
+	User          string                 `protobuf:"bytes,8,opt,name=user,proto3" json:"user,omitempty"`                                                                         // 以哪个系统用户执行，为空表示和 Agent 相同
+	Attempt       int32                  `protobuf:"varint,9,opt,name=attempt,proto3" json:"attempt,omitempty"`                                                                  // 第几次下发，从 1 开始
+	SecretEnv     []string               `protobuf:"bytes,10,rep,name=secret_env,json=secretEnv,proto3" json:"secret_env,omitempty"`                                             // 要注入秘密值的环境变量名，执行前通过 GetJobSecrets 获取
+	Traceparent   string                 `protobuf:"bytes,11,opt,name=traceparent,proto3" json:"traceparent,omitempty"`                                                          // W3C trace context，心跳流是长连接，没法用 gRPC metadata 逐个任务传递
+	RequestId     string                 `protobuf:"bytes,12,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`                                             // 提交任务的请求 ID，Agent 执行任务的日志都带上它
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Job) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *Job) GetType() JobType {
+	if x != nil {
+		return x.Type
+	}
+	return JobType_PING
+}
+
+func (x *Job) GetPayload() string {
+	if x != nil {
+		return x.Payload
+	}
+	return ""
+}
+
+func (x *Job) GetArtifacts() []string {
+	if x != nil {
+		return x.Artifacts
+	}
+	return nil
+}
+
+func (x *Job) GetFiles() []*InputFile {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+func (x *Job) GetEnv() map[string]string {
+	if x != nil {
+		return x.Env
+	}
+	return nil
+}
+
+func (x *Job) GetWorkdir() string {
+	if x != nil {
+		return x.Workdir
+	}
+	return ""
+}
+
+func (x *Job) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *Job) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *Job) GetSecretEnv() []string {
+	if x != nil {
+		return x.SecretEnv
+	}
+	return nil
+}
+
+func (x *Job) GetTraceparent() string {
+	if x != nil {
+		return x.Traceparent
+	}
+	return ""
+}
+
+func (x *Job) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+// InputFile 通过 POST /files 上传的文件，Agent 按 sha256 校验并缓存
+type InputFile struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FileId        string                 `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	Path          string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"` // 工作目录下的相对路径
+	Sha256        string                 `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	Size          int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InputFile) Reset() {
+	*x = InputFile{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InputFile) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InputFile) ProtoMessage() {}
+
+func (x *InputFile) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InputFile.ProtoReflect.Descriptor instead.
+func (*InputFile) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *InputFile) GetFileId() string {
+	if x != nil {
+		return x.FileId
+	}
+	return ""
+}
+
+func (x *InputFile) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *InputFile) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *InputFile) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type ReportJobReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	JobId         string                 `protobuf:"bytes,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	Status        string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
+	Result        string                 `protobuf:"bytes,4,opt,name=result,proto3" json:"result,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportJobReq) Reset() {
+	*x = ReportJobReq{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportJobReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportJobReq) ProtoMessage() {}
+
+func (x *ReportJobReq) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportJobReq.ProtoReflect.Descriptor instead.
+func (*ReportJobReq) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ReportJobReq) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *ReportJobReq) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+func (x *ReportJobReq) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ReportJobReq) GetResult() string {
+	if x != nil {
+		return x.Result
+	}
+	return ""
+}
+
+type ReportJobResp struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Received      bool                   `protobuf:"varint,1,opt,name=received,proto3" json:"received,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportJobResp) Reset() {
+	*x = ReportJobResp{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportJobResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportJobResp) ProtoMessage() {}
+
+func (x *ReportJobResp) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportJobResp.ProtoReflect.Descriptor instead.
+func (*ReportJobResp) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ReportJobResp) GetReceived() bool {
+	if x != nil {
+		return x.Received
+	}
+	return false
+}
+
+type HeartbeatResp struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ConfigOutdated bool                   `protobuf:"varint,1,opt,name=config_outdated,json=configOutdated,proto3" json:"config_outdated,omitempty"` // 为 true 时 Agent 调用 GetAgentConfig 拉取新配置
+	Job            *Job                   `protobuf:"bytes,2,opt,name=job,proto3" json:"job,omitempty"`
+	Drain          bool                   `protobuf:"varint,3,opt,name=drain,proto3" json:"drain,omitempty"` // 维护模式：停止接收新任务，等在途任务结束
+	// Server 不再逐条回复心跳，只在有消息要下发时才发送 (任务、取消、drain、配置变化、间隔调整)
+	Seq           int64    `protobuf:"varint,4,opt,name=seq,proto3" json:"seq,omitempty"`                                        // 需要 Agent 确认的消息 (带任务或取消) 才有，否则为 0
+	Ack           int64    `protobuf:"varint,5,opt,name=ack,proto3" json:"ack,omitempty"`                                        // 已收到的最新心跳 seq
+	IntervalMs    int32    `protobuf:"varint,6,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`        // 心跳间隔，0 表示沿用上一次的值
+	JitterMs      int32    `protobuf:"varint,7,opt,name=jitter_ms,json=jitterMs,proto3" json:"jitter_ms,omitempty"`              // 每次心跳额外随机等待 [0, jitter_ms)，避免所有节点同时心跳
+	CancelJobIds  []string `protobuf:"bytes,8,rep,name=cancel_job_ids,json=cancelJobIds,proto3" json:"cancel_job_ids,omitempty"` // 需要中止的在途任务
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatResp) Reset() {
+	*x = HeartbeatResp{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatResp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatResp) ProtoMessage() {}
+
+func (x *HeartbeatResp) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatResp.ProtoReflect.Descriptor instead.
+func (*HeartbeatResp) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *HeartbeatResp) GetConfigOutdated() bool {
+	if x != nil {
+		return x.ConfigOutdated
+	}
+	return false
+}
+
+func (x *HeartbeatResp) GetJob() *Job {
+	if x != nil {
+		return x.Job
+	}
+	return nil
+}
+
+func (x *HeartbeatResp) GetDrain() bool {
+	if x != nil {
+		return x.Drain
+	}
+	return false
+}
+
+func (x *HeartbeatResp) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *HeartbeatResp) GetAck() int64 {
+	if x != nil {
+		return x.Ack
+	}
+	return 0
+}
+
+func (x *HeartbeatResp) GetIntervalMs() int32 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+func (x *HeartbeatResp) GetJitterMs() int32 {
+	if x != nil {
+		return x.JitterMs
+	}
+	return 0
+}
+
+func (x *HeartbeatResp) GetCancelJobIds() []string {
+	if x != nil {
+		return x.CancelJobIds
+	}
+	return nil
+}
+
+type GetAgentConfigReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *RegisterResp) Reset() {
-	*x = RegisterResp{}
-	mi := &file_api_proto_sentinel_proto_msgTypes[1]
+func (x *GetAgentConfigReq) Reset() {
+	*x = GetAgentConfigReq{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *RegisterResp) String() string {
+func (x *GetAgentConfigReq) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*RegisterResp) ProtoMessage() {}
+func (*GetAgentConfigReq) ProtoMessage() {}
 
-func (x *RegisterResp) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_sentinel_proto_msgTypes[1]
+func (x *GetAgentConfigReq) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -163,50 +986,47 @@ func (x *RegisterResp) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use RegisterResp.ProtoReflect.Descriptor instead.
-func (*RegisterResp) Descriptor() ([]byte, []int) {
-	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{1}
+// Deprecated: Use GetAgentConfigReq.ProtoReflect.Descriptor instead.
+func (*GetAgentConfigReq) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{10}
 }
 
-func (x *RegisterResp) GetAgentId() string {
+func (x *GetAgentConfigReq) GetAgentId() string {
 	if x != nil {
 		return x.AgentId
 	}
 	return ""
 }
 
-func (x *RegisterResp) GetSuccess() bool {
-	if x != nil {
-		return x.Success
-	}
-	return false
-}
-
-type HeartbeatReq struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
-	Timestamp     int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	CpuUsage      float64                `protobuf:"fixed64,3,opt,name=cpu_usage,json=cpuUsage,proto3" json:"cpu_usage,omitempty"`
-	MemUsage      float64                `protobuf:"fixed64,4,opt,name=mem_usage,json=memUsage,proto3" json:"mem_usage,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+// AgentConfig 由 Server 按标签匹配的配置档 (profile) 下发，Agent 收到后立即生效
+type AgentConfig struct {
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	Version                  string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`                                                                      // 配置版本，Agent 在心跳里回传
+	Profile                  string                 `protobuf:"bytes,2,opt,name=profile,proto3" json:"profile,omitempty"`                                                                      // 命中的配置档，空表示没有匹配的配置档
+	HeartbeatIntervalSeconds int32                  `protobuf:"varint,3,opt,name=heartbeat_interval_seconds,json=heartbeatIntervalSeconds,proto3" json:"heartbeat_interval_seconds,omitempty"` // 0 表示使用 Agent 默认值
+	MaxConcurrentJobs        int32                  `protobuf:"varint,4,opt,name=max_concurrent_jobs,json=maxConcurrentJobs,proto3" json:"max_concurrent_jobs,omitempty"`                      // 0 表示使用 Agent 本地配置
+	AllowedExecutors         []string               `protobuf:"bytes,5,rep,name=allowed_executors,json=allowedExecutors,proto3" json:"allowed_executors,omitempty"`                            // 允许执行的任务类型，空表示不限制
+	DenyPatterns             []string               `protobuf:"bytes,6,rep,name=deny_patterns,json=denyPatterns,proto3" json:"deny_patterns,omitempty"`                                        // 执行策略：命令匹配任一正则即拒绝执行
+	LogLevel                 string                 `protobuf:"bytes,7,opt,name=log_level,json=logLevel,proto3" json:"log_level,omitempty"`                                                    // debug / info / warn / error
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
 }
 
-func (x *HeartbeatReq) Reset() {
-	*x = HeartbeatReq{}
-	mi := &file_api_proto_sentinel_proto_msgTypes[2]
+func (x *AgentConfig) Reset() {
+	*x = AgentConfig{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *HeartbeatReq) String() string {
+func (x *AgentConfig) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*HeartbeatReq) ProtoMessage() {}
+func (*AgentConfig) ProtoMessage() {}
 
-func (x *HeartbeatReq) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_sentinel_proto_msgTypes[2]
+func (x *AgentConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -217,63 +1037,87 @@ func (x *HeartbeatReq) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use HeartbeatReq.ProtoReflect.Descriptor instead.
-func (*HeartbeatReq) Descriptor() ([]byte, []int) {
-	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{2}
+// Deprecated: Use AgentConfig.ProtoReflect.Descriptor instead.
+func (*AgentConfig) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{11}
 }
 
-func (x *HeartbeatReq) GetAgentId() string {
+func (x *AgentConfig) GetVersion() string {
 	if x != nil {
-		return x.AgentId
+		return x.Version
 	}
 	return ""
 }
 
-func (x *HeartbeatReq) GetTimestamp() int64 {
+func (x *AgentConfig) GetProfile() string {
 	if x != nil {
-		return x.Timestamp
+		return x.Profile
 	}
-	return 0
+	return ""
 }
 
-func (x *HeartbeatReq) GetCpuUsage() float64 {
+func (x *AgentConfig) GetHeartbeatIntervalSeconds() int32 {
 	if x != nil {
-		return x.CpuUsage
+		return x.HeartbeatIntervalSeconds
 	}
 	return 0
 }
 
-func (x *HeartbeatReq) GetMemUsage() float64 {
+func (x *AgentConfig) GetMaxConcurrentJobs() int32 {
 	if x != nil {
-		return x.MemUsage
+		return x.MaxConcurrentJobs
 	}
 	return 0
 }
 
-type Job struct {
+func (x *AgentConfig) GetAllowedExecutors() []string {
+	if x != nil {
+		return x.AllowedExecutors
+	}
+	return nil
+}
+
+func (x *AgentConfig) GetDenyPatterns() []string {
+	if x != nil {
+		return x.DenyPatterns
+	}
+	return nil
+}
+
+func (x *AgentConfig) GetLogLevel() string {
+	if x != nil {
+		return x.LogLevel
+	}
+	return ""
+}
+
+// ArtifactChunk 产物分片，一个文件一条 UploadArtifact 流
+// job_id / agent_id / name 只需要在第一片里填
+type ArtifactChunk struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
-	Type          JobType                `protobuf:"varint,2,opt,name=type,proto3,enum=sentinel.JobType" json:"type,omitempty"`
-	Payload       string                 `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	AgentId       string                 `protobuf:"bytes,2,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Name          string                 `protobuf:"bytes,3,opt,name=name,proto3" json:"name,omitempty"` // 相对路径，如 "out/result.json"
+	Data          []byte                 `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Job) Reset() {
-	*x = Job{}
-	mi := &file_api_proto_sentinel_proto_msgTypes[3]
+func (x *ArtifactChunk) Reset() {
+	*x = ArtifactChunk{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[12]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Job) String() string {
+func (x *ArtifactChunk) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Job) ProtoMessage() {}
+func (*ArtifactChunk) ProtoMessage() {}
 
-func (x *Job) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_sentinel_proto_msgTypes[3]
+func (x *ArtifactChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[12]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -284,57 +1128,63 @@ func (x *Job) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Job.ProtoReflect.Descriptor instead.
-func (*Job) Descriptor() ([]byte, []int) {
-	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{3}
+// Deprecated: Use ArtifactChunk.ProtoReflect.Descriptor instead.
+func (*ArtifactChunk) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{12}
 }
 
-func (x *Job) GetJobId() string {
+func (x *ArtifactChunk) GetJobId() string {
 	if x != nil {
 		return x.JobId
 	}
 	return ""
 }
 
-func (x *Job) GetType() JobType {
+func (x *ArtifactChunk) GetAgentId() string {
 	if x != nil {
-		return x.Type
+		return x.AgentId
 	}
-	return JobType_PING
+	return ""
 }
 
-func (x *Job) GetPayload() string {
+func (x *ArtifactChunk) GetName() string {
 	if x != nil {
-		return x.Payload
+		return x.Name
 	}
 	return ""
 }
 
-type ReportJobReq struct {
+func (x *ArtifactChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type UploadArtifactResp struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
-	JobId         string                 `protobuf:"bytes,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
-	Status        string                 `protobuf:"bytes,3,opt,name=status,proto3" json:"status,omitempty"`
-	Result        string                 `protobuf:"bytes,4,opt,name=result,proto3" json:"result,omitempty"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Size          int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Sha256        string                 `protobuf:"bytes,3,opt,name=sha256,proto3" json:"sha256,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ReportJobReq) Reset() {
-	*x = ReportJobReq{}
-	mi := &file_api_proto_sentinel_proto_msgTypes[4]
+func (x *UploadArtifactResp) Reset() {
+	*x = UploadArtifactResp{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ReportJobReq) String() string {
+func (x *UploadArtifactResp) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ReportJobReq) ProtoMessage() {}
+func (*UploadArtifactResp) ProtoMessage() {}
 
-func (x *ReportJobReq) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_sentinel_proto_msgTypes[4]
+func (x *UploadArtifactResp) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -345,61 +1195,106 @@ func (x *ReportJobReq) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ReportJobReq.ProtoReflect.Descriptor instead.
-func (*ReportJobReq) Descriptor() ([]byte, []int) {
-	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{4}
+// Deprecated: Use UploadArtifactResp.ProtoReflect.Descriptor instead.
+func (*UploadArtifactResp) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{13}
 }
 
-func (x *ReportJobReq) GetAgentId() string {
+func (x *UploadArtifactResp) GetName() string {
 	if x != nil {
-		return x.AgentId
+		return x.Name
 	}
 	return ""
 }
 
-func (x *ReportJobReq) GetJobId() string {
+func (x *UploadArtifactResp) GetSize() int64 {
 	if x != nil {
-		return x.JobId
+		return x.Size
+	}
+	return 0
+}
+
+func (x *UploadArtifactResp) GetSha256() string {
+	if x != nil {
+		return x.Sha256
 	}
 	return ""
 }
 
-func (x *ReportJobReq) GetStatus() string {
+type DownloadFileReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FileId        string                 `protobuf:"bytes,1,opt,name=file_id,json=fileId,proto3" json:"file_id,omitempty"`
+	AgentId       string                 `protobuf:"bytes,2,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DownloadFileReq) Reset() {
+	*x = DownloadFileReq{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DownloadFileReq) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DownloadFileReq) ProtoMessage() {}
+
+func (x *DownloadFileReq) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[14]
 	if x != nil {
-		return x.Status
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DownloadFileReq.ProtoReflect.Descriptor instead.
+func (*DownloadFileReq) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *DownloadFileReq) GetFileId() string {
+	if x != nil {
+		return x.FileId
 	}
 	return ""
 }
 
-func (x *ReportJobReq) GetResult() string {
+func (x *DownloadFileReq) GetAgentId() string {
 	if x != nil {
-		return x.Result
+		return x.AgentId
 	}
 	return ""
 }
 
-type ReportJobResp struct {
+type FileChunk struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Received      bool                   `protobuf:"varint,1,opt,name=received,proto3" json:"received,omitempty"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *ReportJobResp) Reset() {
-	*x = ReportJobResp{}
-	mi := &file_api_proto_sentinel_proto_msgTypes[5]
+func (x *FileChunk) Reset() {
+	*x = FileChunk{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[15]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *ReportJobResp) String() string {
+func (x *FileChunk) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ReportJobResp) ProtoMessage() {}
+func (*FileChunk) ProtoMessage() {}
 
-func (x *ReportJobResp) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_sentinel_proto_msgTypes[5]
+func (x *FileChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[15]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -410,41 +1305,42 @@ func (x *ReportJobResp) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ReportJobResp.ProtoReflect.Descriptor instead.
-func (*ReportJobResp) Descriptor() ([]byte, []int) {
-	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{5}
+// Deprecated: Use FileChunk.ProtoReflect.Descriptor instead.
+func (*FileChunk) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{15}
 }
 
-func (x *ReportJobResp) GetReceived() bool {
+func (x *FileChunk) GetData() []byte {
 	if x != nil {
-		return x.Received
+		return x.Data
 	}
-	return false
+	return nil
 }
 
-type HeartbeatResp struct {
-	state          protoimpl.MessageState `protogen:"open.v1"`
-	ConfigOutdated bool                   `protobuf:"varint,1,opt,name=config_outdated,json=configOutdated,proto3" json:"config_outdated,omitempty"`
-	Job            *Job                   `protobuf:"bytes,2,opt,name=job,proto3" json:"job,omitempty"`
-	unknownFields  protoimpl.UnknownFields
-	sizeCache      protoimpl.SizeCache
+// GetJobSecretsReq 只有正在执行该任务的 Agent 才能取到秘密值
+type GetJobSecretsReq struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	AgentId       string                 `protobuf:"bytes,2,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (x *HeartbeatResp) Reset() {
-	*x = HeartbeatResp{}
-	mi := &file_api_proto_sentinel_proto_msgTypes[6]
+func (x *GetJobSecretsReq) Reset() {
+	*x = GetJobSecretsReq{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[16]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *HeartbeatResp) String() string {
+func (x *GetJobSecretsReq) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*HeartbeatResp) ProtoMessage() {}
+func (*GetJobSecretsReq) ProtoMessage() {}
 
-func (x *HeartbeatResp) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_sentinel_proto_msgTypes[6]
+func (x *GetJobSecretsReq) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[16]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -455,21 +1351,65 @@ func (x *HeartbeatResp) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use HeartbeatResp.ProtoReflect.Descriptor instead.
-func (*HeartbeatResp) Descriptor() ([]byte, []int) {
-	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{6}
+// Deprecated: Use GetJobSecretsReq.ProtoReflect.Descriptor instead.
+func (*GetJobSecretsReq) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{16}
 }
 
-func (x *HeartbeatResp) GetConfigOutdated() bool {
+func (x *GetJobSecretsReq) GetJobId() string {
 	if x != nil {
-		return x.ConfigOutdated
+		return x.JobId
 	}
-	return false
+	return ""
 }
 
-func (x *HeartbeatResp) GetJob() *Job {
+func (x *GetJobSecretsReq) GetAgentId() string {
 	if x != nil {
-		return x.Job
+		return x.AgentId
+	}
+	return ""
+}
+
+type JobSecrets struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Env           map[string]string      `protobuf:"bytes,1,rep,name=env,proto3" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // 环境变量名 -> 秘密值
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *JobSecrets) Reset() {
+	*x = JobSecrets{}
+	mi := &file_api_proto_sentinel_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *JobSecrets) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobSecrets) ProtoMessage() {}
+
+func (x *JobSecrets) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_sentinel_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobSecrets.ProtoReflect.Descriptor instead.
+func (*JobSecrets) Descriptor() ([]byte, []int) {
+	return file_api_proto_sentinel_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *JobSecrets) GetEnv() map[string]string {
+	if x != nil {
+		return x.Env
 	}
 	return nil
 }
@@ -478,41 +1418,141 @@ var File_api_proto_sentinel_proto protoreflect.FileDescriptor
 
 const file_api_proto_sentinel_proto_rawDesc = "" +
 	"\n" +
-	"\x18api/proto/sentinel.proto\x12\bsentinel\"M\n" +
+	"\x18api/proto/sentinel.proto\x12\bsentinel\"\xfe\x01\n" +
 	"\vRegisterReq\x12\x1a\n" +
 	"\bhostname\x18\x01 \x01(\tR\bhostname\x12\x0e\n" +
 	"\x02ip\x18\x02 \x01(\tR\x02ip\x12\x12\n" +
-	"\x04tags\x18\x03 \x03(\tR\x04tags\"C\n" +
+	"\x04tags\x18\x03 \x03(\tR\x04tags\x12\x0e\n" +
+	"\x02os\x18\x04 \x01(\tR\x02os\x12\x12\n" +
+	"\x04arch\x18\x05 \x01(\tR\x04arch\x12\x16\n" +
+	"\x06kernel\x18\x06 \x01(\tR\x06kernel\x12#\n" +
+	"\ragent_version\x18\a \x01(\tR\fagentVersion\x12\"\n" +
+	"\fcapabilities\x18\b \x03(\tR\fcapabilities\x12*\n" +
+	"\x05facts\x18\t \x01(\v2\x14.sentinel.AgentFactsR\x05facts\"\xb7\x02\n" +
+	"\n" +
+	"AgentFacts\x12\x10\n" +
+	"\x03ips\x18\x01 \x03(\tR\x03ips\x12\x1d\n" +
+	"\n" +
+	"os_release\x18\x02 \x01(\tR\tosRelease\x12\x1b\n" +
+	"\tcpu_count\x18\x03 \x01(\x05R\bcpuCount\x12\x1b\n" +
+	"\tcpu_model\x18\x04 \x01(\tR\bcpuModel\x12!\n" +
+	"\fmemory_total\x18\x05 \x01(\x03R\vmemoryTotal\x12\x1d\n" +
+	"\n" +
+	"disk_total\x18\x06 \x01(\x03R\tdiskTotal\x12\x1b\n" +
+	"\tdisk_free\x18\a \x01(\x03R\bdiskFree\x12!\n" +
+	"\fbuild_commit\x18\b \x01(\tR\vbuildCommit\x12\x1c\n" +
+	"\tcontainer\x18\t \x01(\tR\tcontainer\x12\x1e\n" +
+	"\n" +
+	"hypervisor\x18\n" +
+	" \x01(\tR\n" +
+	"hypervisor\"C\n" +
 	"\fRegisterResp\x12\x19\n" +
 	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x18\n" +
-	"\asuccess\x18\x02 \x01(\bR\asuccess\"\x81\x01\n" +
+	"\asuccess\x18\x02 \x01(\bR\asuccess\"\xe7\x02\n" +
 	"\fHeartbeatReq\x12\x19\n" +
 	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1c\n" +
 	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12\x1b\n" +
 	"\tcpu_usage\x18\x03 \x01(\x01R\bcpuUsage\x12\x1b\n" +
-	"\tmem_usage\x18\x04 \x01(\x01R\bmemUsage\"]\n" +
+	"\tmem_usage\x18\x04 \x01(\x01R\bmemUsage\x12!\n" +
+	"\frunning_jobs\x18\x05 \x01(\x05R\vrunningJobs\x12\x19\n" +
+	"\bmax_jobs\x18\x06 \x01(\x05R\amaxJobs\x12\x14\n" +
+	"\x05state\x18\a \x01(\tR\x05state\x12%\n" +
+	"\x0econfig_version\x18\b \x01(\tR\rconfigVersion\x12\x10\n" +
+	"\x03seq\x18\t \x01(\x03R\x03seq\x12\x10\n" +
+	"\x03ack\x18\n" +
+	" \x01(\x03R\x03ack\x121\n" +
+	"\baccepted\x18\v \x03(\v2\x15.sentinel.JobAcceptedR\baccepted\x12\x12\n" +
+	"\x04ping\x18\f \x01(\bR\x04ping\"^\n" +
+	"\vJobAccepted\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x1c\n" +
+	"\tduplicate\x18\x02 \x01(\bR\tduplicate\x12\x1a\n" +
+	"\brejected\x18\x03 \x01(\bR\brejected\"\xb0\x03\n" +
 	"\x03Job\x12\x15\n" +
 	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12%\n" +
 	"\x04type\x18\x02 \x01(\x0e2\x11.sentinel.JobTypeR\x04type\x12\x18\n" +
-	"\apayload\x18\x03 \x01(\tR\apayload\"p\n" +
+	"\apayload\x18\x03 \x01(\tR\apayload\x12\x1c\n" +
+	"\tartifacts\x18\x04 \x03(\tR\tartifacts\x12)\n" +
+	"\x05files\x18\x05 \x03(\v2\x13.sentinel.InputFileR\x05files\x12(\n" +
+	"\x03env\x18\x06 \x03(\v2\x16.sentinel.Job.EnvEntryR\x03env\x12\x18\n" +
+	"\aworkdir\x18\a \x01(\tR\aworkdir\x12\x12\n" +
+	"\x04user\x18\b \x01(\tR\x04user\x12\x18\n" +
+	"\aattempt\x18\t \x01(\x05R\aattempt\x12\x1d\n" +
+	"\n" +
+	"secret_env\x18\n" +
+	" \x03(\tR\tsecretEnv\x12 \n" +
+	"\vtraceparent\x18\v \x01(\tR\vtraceparent\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\f \x01(\tR\trequestId\x1a6\n" +
+	"\bEnvEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"d\n" +
+	"\tInputFile\x12\x17\n" +
+	"\afile_id\x18\x01 \x01(\tR\x06fileId\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x16\n" +
+	"\x06sha256\x18\x03 \x01(\tR\x06sha256\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\"p\n" +
 	"\fReportJobReq\x12\x19\n" +
 	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x15\n" +
 	"\x06job_id\x18\x02 \x01(\tR\x05jobId\x12\x16\n" +
 	"\x06status\x18\x03 \x01(\tR\x06status\x12\x16\n" +
 	"\x06result\x18\x04 \x01(\tR\x06result\"+\n" +
 	"\rReportJobResp\x12\x1a\n" +
-	"\breceived\x18\x01 \x01(\bR\breceived\"Y\n" +
+	"\breceived\x18\x01 \x01(\bR\breceived\"\xf7\x01\n" +
 	"\rHeartbeatResp\x12'\n" +
 	"\x0fconfig_outdated\x18\x01 \x01(\bR\x0econfigOutdated\x12\x1f\n" +
-	"\x03job\x18\x02 \x01(\v2\r.sentinel.JobR\x03job*(\n" +
+	"\x03job\x18\x02 \x01(\v2\r.sentinel.JobR\x03job\x12\x14\n" +
+	"\x05drain\x18\x03 \x01(\bR\x05drain\x12\x10\n" +
+	"\x03seq\x18\x04 \x01(\x03R\x03seq\x12\x10\n" +
+	"\x03ack\x18\x05 \x01(\x03R\x03ack\x12\x1f\n" +
+	"\vinterval_ms\x18\x06 \x01(\x05R\n" +
+	"intervalMs\x12\x1b\n" +
+	"\tjitter_ms\x18\a \x01(\x05R\bjitterMs\x12$\n" +
+	"\x0ecancel_job_ids\x18\b \x03(\tR\fcancelJobIds\".\n" +
+	"\x11GetAgentConfigReq\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\"\x9e\x02\n" +
+	"\vAgentConfig\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12\x18\n" +
+	"\aprofile\x18\x02 \x01(\tR\aprofile\x12<\n" +
+	"\x1aheartbeat_interval_seconds\x18\x03 \x01(\x05R\x18heartbeatIntervalSeconds\x12.\n" +
+	"\x13max_concurrent_jobs\x18\x04 \x01(\x05R\x11maxConcurrentJobs\x12+\n" +
+	"\x11allowed_executors\x18\x05 \x03(\tR\x10allowedExecutors\x12#\n" +
+	"\rdeny_patterns\x18\x06 \x03(\tR\fdenyPatterns\x12\x1b\n" +
+	"\tlog_level\x18\a \x01(\tR\blogLevel\"i\n" +
+	"\rArtifactChunk\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x19\n" +
+	"\bagent_id\x18\x02 \x01(\tR\aagentId\x12\x12\n" +
+	"\x04name\x18\x03 \x01(\tR\x04name\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04data\"T\n" +
+	"\x12UploadArtifactResp\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\x16\n" +
+	"\x06sha256\x18\x03 \x01(\tR\x06sha256\"E\n" +
+	"\x0fDownloadFileReq\x12\x17\n" +
+	"\afile_id\x18\x01 \x01(\tR\x06fileId\x12\x19\n" +
+	"\bagent_id\x18\x02 \x01(\tR\aagentId\"\x1f\n" +
+	"\tFileChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"D\n" +
+	"\x10GetJobSecretsReq\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\x12\x19\n" +
+	"\bagent_id\x18\x02 \x01(\tR\aagentId\"u\n" +
+	"\n" +
+	"JobSecrets\x12/\n" +
+	"\x03env\x18\x01 \x03(\v2\x1d.sentinel.JobSecrets.EnvEntryR\x03env\x1a6\n" +
+	"\bEnvEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01*(\n" +
 	"\aJobType\x12\b\n" +
 	"\x04PING\x10\x00\x12\t\n" +
 	"\x05SHELL\x10\x01\x12\b\n" +
-	"\x04SCAN\x10\x022\xd2\x01\n" +
+	"\x04SCAN\x10\x022\xe8\x03\n" +
 	"\x0fSentinelService\x129\n" +
 	"\bRegister\x12\x15.sentinel.RegisterReq\x1a\x16.sentinel.RegisterResp\x12@\n" +
 	"\tHeartbeat\x12\x16.sentinel.HeartbeatReq\x1a\x17.sentinel.HeartbeatResp(\x010\x01\x12B\n" +
-	"\x0fReportJobStatus\x12\x16.sentinel.ReportJobReq\x1a\x17.sentinel.ReportJobRespB\aZ\x05./;pbb\x06proto3"
+	"\x0fReportJobStatus\x12\x16.sentinel.ReportJobReq\x1a\x17.sentinel.ReportJobResp\x12D\n" +
+	"\x0eGetAgentConfig\x12\x1b.sentinel.GetAgentConfigReq\x1a\x15.sentinel.AgentConfig\x12I\n" +
+	"\x0eUploadArtifact\x12\x17.sentinel.ArtifactChunk\x1a\x1c.sentinel.UploadArtifactResp(\x01\x12@\n" +
+	"\fDownloadFile\x12\x19.sentinel.DownloadFileReq\x1a\x13.sentinel.FileChunk0\x01\x12A\n" +
+	"\rGetJobSecrets\x12\x1a.sentinel.GetJobSecretsReq\x1a\x14.sentinel.JobSecretsB\aZ\x05./;pbb\x06proto3"
 
 var (
 	file_api_proto_sentinel_proto_rawDescOnce sync.Once
@@ -527,31 +1567,57 @@ func file_api_proto_sentinel_proto_rawDescGZIP() []byte {
 }
 
 var file_api_proto_sentinel_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_api_proto_sentinel_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_api_proto_sentinel_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
 var file_api_proto_sentinel_proto_goTypes = []any{
-	(JobType)(0),          // 0: sentinel.JobType
-	(*RegisterReq)(nil),   // 1: sentinel.RegisterReq
-	(*RegisterResp)(nil),  // 2: sentinel.RegisterResp
-	(*HeartbeatReq)(nil),  // 3: sentinel.HeartbeatReq
-	(*Job)(nil),           // 4: sentinel.Job
-	(*ReportJobReq)(nil),  // 5: sentinel.ReportJobReq
-	(*ReportJobResp)(nil), // 6: sentinel.ReportJobResp
-	(*HeartbeatResp)(nil), // 7: sentinel.HeartbeatResp
+	(JobType)(0),               // 0: sentinel.JobType
+	(*RegisterReq)(nil),        // 1: sentinel.RegisterReq
+	(*AgentFacts)(nil),         // 2: sentinel.AgentFacts
+	(*RegisterResp)(nil),       // 3: sentinel.RegisterResp
+	(*HeartbeatReq)(nil),       // 4: sentinel.HeartbeatReq
+	(*JobAccepted)(nil),        // 5: sentinel.JobAccepted
+	(*Job)(nil),                // 6: sentinel.Job
+	(*InputFile)(nil),          // 7: sentinel.InputFile
+	(*ReportJobReq)(nil),       // 8: sentinel.ReportJobReq
+	(*ReportJobResp)(nil),      // 9: sentinel.ReportJobResp
+	(*HeartbeatResp)(nil),      // 10: sentinel.HeartbeatResp
+	(*GetAgentConfigReq)(nil),  // 11: sentinel.GetAgentConfigReq
+	(*AgentConfig)(nil),        // 12: sentinel.AgentConfig
+	(*ArtifactChunk)(nil),      // 13: sentinel.ArtifactChunk
+	(*UploadArtifactResp)(nil), // 14: sentinel.UploadArtifactResp
+	(*DownloadFileReq)(nil),    // 15: sentinel.DownloadFileReq
+	(*FileChunk)(nil),          // 16: sentinel.FileChunk
+	(*GetJobSecretsReq)(nil),   // 17: sentinel.GetJobSecretsReq
+	(*JobSecrets)(nil),         // 18: sentinel.JobSecrets
+	nil,                        // 19: sentinel.Job.EnvEntry
+	nil,                        // 20: sentinel.JobSecrets.EnvEntry
 }
 var file_api_proto_sentinel_proto_depIdxs = []int32{
-	0, // 0: sentinel.Job.type:type_name -> sentinel.JobType
-	4, // 1: sentinel.HeartbeatResp.job:type_name -> sentinel.Job
-	1, // 2: sentinel.SentinelService.Register:input_type -> sentinel.RegisterReq
-	3, // 3: sentinel.SentinelService.Heartbeat:input_type -> sentinel.HeartbeatReq
-	5, // 4: sentinel.SentinelService.ReportJobStatus:input_type -> sentinel.ReportJobReq
-	2, // 5: sentinel.SentinelService.Register:output_type -> sentinel.RegisterResp
-	7, // 6: sentinel.SentinelService.Heartbeat:output_type -> sentinel.HeartbeatResp
-	6, // 7: sentinel.SentinelService.ReportJobStatus:output_type -> sentinel.ReportJobResp
-	5, // [5:8] is the sub-list for method output_type
-	2, // [2:5] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	2,  // 0: sentinel.RegisterReq.facts:type_name -> sentinel.AgentFacts
+	5,  // 1: sentinel.HeartbeatReq.accepted:type_name -> sentinel.JobAccepted
+	0,  // 2: sentinel.Job.type:type_name -> sentinel.JobType
+	7,  // 3: sentinel.Job.files:type_name -> sentinel.InputFile
+	19, // 4: sentinel.Job.env:type_name -> sentinel.Job.EnvEntry
+	6,  // 5: sentinel.HeartbeatResp.job:type_name -> sentinel.Job
+	20, // 6: sentinel.JobSecrets.env:type_name -> sentinel.JobSecrets.EnvEntry
+	1,  // 7: sentinel.SentinelService.Register:input_type -> sentinel.RegisterReq
+	4,  // 8: sentinel.SentinelService.Heartbeat:input_type -> sentinel.HeartbeatReq
+	8,  // 9: sentinel.SentinelService.ReportJobStatus:input_type -> sentinel.ReportJobReq
+	11, // 10: sentinel.SentinelService.GetAgentConfig:input_type -> sentinel.GetAgentConfigReq
+	13, // 11: sentinel.SentinelService.UploadArtifact:input_type -> sentinel.ArtifactChunk
+	15, // 12: sentinel.SentinelService.DownloadFile:input_type -> sentinel.DownloadFileReq
+	17, // 13: sentinel.SentinelService.GetJobSecrets:input_type -> sentinel.GetJobSecretsReq
+	3,  // 14: sentinel.SentinelService.Register:output_type -> sentinel.RegisterResp
+	10, // 15: sentinel.SentinelService.Heartbeat:output_type -> sentinel.HeartbeatResp
+	9,  // 16: sentinel.SentinelService.ReportJobStatus:output_type -> sentinel.ReportJobResp
+	12, // 17: sentinel.SentinelService.GetAgentConfig:output_type -> sentinel.AgentConfig
+	14, // 18: sentinel.SentinelService.UploadArtifact:output_type -> sentinel.UploadArtifactResp
+	16, // 19: sentinel.SentinelService.DownloadFile:output_type -> sentinel.FileChunk
+	18, // 20: sentinel.SentinelService.GetJobSecrets:output_type -> sentinel.JobSecrets
+	14, // [14:21] is the sub-list for method output_type
+	7,  // [7:14] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
 }
 
 func init() { file_api_proto_sentinel_proto_init() }
@@ -565,7 +1631,7 @@ func file_api_proto_sentinel_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_proto_sentinel_proto_rawDesc), len(file_api_proto_sentinel_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   7,
+			NumMessages:   20,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
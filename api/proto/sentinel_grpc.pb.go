@@ -22,6 +22,10 @@ const (
 	SentinelService_Register_FullMethodName        = "/sentinel.SentinelService/Register"
 	SentinelService_Heartbeat_FullMethodName       = "/sentinel.SentinelService/Heartbeat"
 	SentinelService_ReportJobStatus_FullMethodName = "/sentinel.SentinelService/ReportJobStatus"
+	SentinelService_GetAgentConfig_FullMethodName  = "/sentinel.SentinelService/GetAgentConfig"
+	SentinelService_UploadArtifact_FullMethodName  = "/sentinel.SentinelService/UploadArtifact"
+	SentinelService_DownloadFile_FullMethodName    = "/sentinel.SentinelService/DownloadFile"
+	SentinelService_GetJobSecrets_FullMethodName   = "/sentinel.SentinelService/GetJobSecrets"
 )
 
 // SentinelServiceClient is the client API for SentinelService service.
@@ -31,6 +35,10 @@ type SentinelServiceClient interface {
 	Register(ctx context.Context, in *RegisterReq, opts ...grpc.CallOption) (*RegisterResp, error)
 	Heartbeat(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[HeartbeatReq, HeartbeatResp], error)
 	ReportJobStatus(ctx context.Context, in *ReportJobReq, opts ...grpc.CallOption) (*ReportJobResp, error)
+	GetAgentConfig(ctx context.Context, in *GetAgentConfigReq, opts ...grpc.CallOption) (*AgentConfig, error)
+	UploadArtifact(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ArtifactChunk, UploadArtifactResp], error)
+	DownloadFile(ctx context.Context, in *DownloadFileReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChunk], error)
+	GetJobSecrets(ctx context.Context, in *GetJobSecretsReq, opts ...grpc.CallOption) (*JobSecrets, error)
 }
 
 type sentinelServiceClient struct {
@@ -74,6 +82,58 @@ func (c *sentinelServiceClient) ReportJobStatus(ctx context.Context, in *ReportJ
 	return out, nil
 }
 
+func (c *sentinelServiceClient) GetAgentConfig(ctx context.Context, in *GetAgentConfigReq, opts ...grpc.CallOption) (*AgentConfig, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AgentConfig)
+	err := c.cc.Invoke(ctx, SentinelService_GetAgentConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sentinelServiceClient) UploadArtifact(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ArtifactChunk, UploadArtifactResp], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SentinelService_ServiceDesc.Streams[1], SentinelService_UploadArtifact_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ArtifactChunk, UploadArtifactResp]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SentinelService_UploadArtifactClient = grpc.ClientStreamingClient[ArtifactChunk, UploadArtifactResp]
+
+func (c *sentinelServiceClient) DownloadFile(ctx context.Context, in *DownloadFileReq, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SentinelService_ServiceDesc.Streams[2], SentinelService_DownloadFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DownloadFileReq, FileChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SentinelService_DownloadFileClient = grpc.ServerStreamingClient[FileChunk]
+
+func (c *sentinelServiceClient) GetJobSecrets(ctx context.Context, in *GetJobSecretsReq, opts ...grpc.CallOption) (*JobSecrets, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(JobSecrets)
+	err := c.cc.Invoke(ctx, SentinelService_GetJobSecrets_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SentinelServiceServer is the server API for SentinelService service.
 // All implementations must embed UnimplementedSentinelServiceServer
 // for forward compatibility.
@@ -81,6 +141,10 @@ type SentinelServiceServer interface {
 	Register(context.Context, *RegisterReq) (*RegisterResp, error)
 	Heartbeat(grpc.BidiStreamingServer[HeartbeatReq, HeartbeatResp]) error
 	ReportJobStatus(context.Context, *ReportJobReq) (*ReportJobResp, error)
+	GetAgentConfig(context.Context, *GetAgentConfigReq) (*AgentConfig, error)
+	UploadArtifact(grpc.ClientStreamingServer[ArtifactChunk, UploadArtifactResp]) error
+	DownloadFile(*DownloadFileReq, grpc.ServerStreamingServer[FileChunk]) error
+	GetJobSecrets(context.Context, *GetJobSecretsReq) (*JobSecrets, error)
 	mustEmbedUnimplementedSentinelServiceServer()
 }
 
@@ -100,6 +164,18 @@ func (UnimplementedSentinelServiceServer) Heartbeat(grpc.BidiStreamingServer[Hea
 func (UnimplementedSentinelServiceServer) ReportJobStatus(context.Context, *ReportJobReq) (*ReportJobResp, error) {
 	return nil, status.Error(codes.Unimplemented, "method ReportJobStatus not implemented")
 }
+func (UnimplementedSentinelServiceServer) GetAgentConfig(context.Context, *GetAgentConfigReq) (*AgentConfig, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetAgentConfig not implemented")
+}
+func (UnimplementedSentinelServiceServer) UploadArtifact(grpc.ClientStreamingServer[ArtifactChunk, UploadArtifactResp]) error {
+	return status.Error(codes.Unimplemented, "method UploadArtifact not implemented")
+}
+func (UnimplementedSentinelServiceServer) DownloadFile(*DownloadFileReq, grpc.ServerStreamingServer[FileChunk]) error {
+	return status.Error(codes.Unimplemented, "method DownloadFile not implemented")
+}
+func (UnimplementedSentinelServiceServer) GetJobSecrets(context.Context, *GetJobSecretsReq) (*JobSecrets, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetJobSecrets not implemented")
+}
 func (UnimplementedSentinelServiceServer) mustEmbedUnimplementedSentinelServiceServer() {}
 func (UnimplementedSentinelServiceServer) testEmbeddedByValue()                         {}
 
@@ -164,6 +240,60 @@ func _SentinelService_ReportJobStatus_Handler(srv interface{}, ctx context.Conte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SentinelService_GetAgentConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAgentConfigReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SentinelServiceServer).GetAgentConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SentinelService_GetAgentConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SentinelServiceServer).GetAgentConfig(ctx, req.(*GetAgentConfigReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SentinelService_UploadArtifact_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SentinelServiceServer).UploadArtifact(&grpc.GenericServerStream[ArtifactChunk, UploadArtifactResp]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SentinelService_UploadArtifactServer = grpc.ClientStreamingServer[ArtifactChunk, UploadArtifactResp]
+
+func _SentinelService_DownloadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadFileReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SentinelServiceServer).DownloadFile(m, &grpc.GenericServerStream[DownloadFileReq, FileChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SentinelService_DownloadFileServer = grpc.ServerStreamingServer[FileChunk]
+
+func _SentinelService_GetJobSecrets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobSecretsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SentinelServiceServer).GetJobSecrets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SentinelService_GetJobSecrets_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SentinelServiceServer).GetJobSecrets(ctx, req.(*GetJobSecretsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // SentinelService_ServiceDesc is the grpc.ServiceDesc for SentinelService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -179,6 +309,14 @@ var SentinelService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ReportJobStatus",
 			Handler:    _SentinelService_ReportJobStatus_Handler,
 		},
+		{
+			MethodName: "GetAgentConfig",
+			Handler:    _SentinelService_GetAgentConfig_Handler,
+		},
+		{
+			MethodName: "GetJobSecrets",
+			Handler:    _SentinelService_GetJobSecrets_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -187,6 +325,16 @@ var SentinelService_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "UploadArtifact",
+			Handler:       _SentinelService_UploadArtifact_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadFile",
+			Handler:       _SentinelService_DownloadFile_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "api/proto/sentinel.proto",
 }
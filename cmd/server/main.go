@@ -2,8 +2,7 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http" // 👈 引入标准 http 包
 	"os"
@@ -12,10 +11,16 @@ import (
 	"time"
 
 	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+	gcdb "github.com/stywzn/Go-Cloud-Compute/pkg/db"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/metrics"
 	"github.com/stywzn/Go-Cloud-Compute/pkg/mq"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/secrets"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/storage"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/tracing"
 	"google.golang.org/grpc"
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
+	"google.golang.org/grpc/keepalive"
+	grpcstatus "google.golang.org/grpc/status"
 
 	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
 	"github.com/stywzn/Go-Cloud-Compute/internal/server"
@@ -34,14 +39,14 @@ func UnaryServerInterceptor(
 
 	duration := time.Since(start) // 3. 结束
 
-	// 4. 打印日志
-	// 例子: [gRPC] /api.proto.SentinelService/Heartbeat | 2ms | Success
-	status := "✅ Success"
+	// 4. 打印日志 (请求 ID 由 logging.UnaryServerInterceptor 放进 ctx)
+	code := grpcstatus.Code(err)
 	if err != nil {
-		status = fmt.Sprintf("❌ Error: %v", err)
+		slog.WarnContext(ctx, "gRPC 请求失败", "method", info.FullMethod, "code", code.String(), "duration_ms", duration.Milliseconds(), "err", err)
+	} else {
+		slog.InfoContext(ctx, "gRPC 请求", "method", info.FullMethod, "code", code.String(), "duration_ms", duration.Milliseconds())
 	}
-
-	log.Printf("🔗 [gRPC] %s | ⏳ %v | %s", info.FullMethod, duration, status)
+	metrics.GRPCRequestDuration.WithLabelValues(info.FullMethod, code.String()).Observe(duration.Seconds())
 
 	return resp, err
 }
@@ -49,51 +54,128 @@ func UnaryServerInterceptor(
 func main() {
 	// 1. 配置加载 (建议以后用 viper，现在先用 env 顶一下)
 	config.LoadConfig() // 1. 先加载配置
-	mq.Init()
-	dbHost := os.Getenv("DB_HOST")
-	if dbHost == "" {
-		dbHost = "127.0.0.1"
+	if err := logging.Init(config.GlobalConfig.Log, "gcc-server"); err != nil {
+		logging.Fatal("初始化日志失败", "err", err)
 	}
-	dbUser := os.Getenv("DB_USER")
-	if dbUser == "" {
-		dbUser = "root"
+	// server migrate up|down|status 只处理表结构迁移，不启动服务
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
 	}
-	dbPass := os.Getenv("DB_PASS")
-	if dbPass == "" {
-		dbPass = "root"
-	} // 👈 密码别写死，从环境变量读
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:3306)/cloud_compute?charset=utf8mb4&parseTime=True&loc=Local", dbUser, dbPass, dbHost)
+	shutdownTracing, err := tracing.Init(config.GlobalConfig.Tracing, "gcc-server")
+	if err != nil {
+		logging.Fatal("初始化链路追踪失败", "err", err)
+	}
+	mq.Init()
 
-	// 2. 数据库初始化
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	// 2. 数据库初始化：database.driver 选择 MySQL 或 SQLite (本地运行、测试不需要外部数据库)
+	db, err := gcdb.Open(config.GlobalConfig.Database)
 	if err != nil {
-		log.Fatalf("❌ 无法连接数据库: %v", err)
+		logging.Fatal("无法连接数据库", "driver", config.GlobalConfig.Database.Driver, "err", err)
 	}
-	log.Println("✅ 数据库连接成功!")
+	slog.Info("数据库连接成功", "driver", config.GlobalConfig.Database.Driver)
 
-	if err := db.AutoMigrate(&server.AgentModel{}, &server.JobRecord{}); err != nil {
-		log.Fatalf("❌ 自动建表失败: %v", err)
+	// 表结构比当前版本新 (被更新版本的 Server 迁移过) 时拒绝启动，避免按旧结构读写
+	migrator, err := gcdb.NewMigrator(db)
+	if err != nil {
+		logging.Fatal("加载表结构迁移失败", "err", err)
+	}
+	applied, err := migrator.Prepare(context.Background(), config.GlobalConfig.Database.AutoMigrate)
+	if err != nil {
+		logging.Fatal("表结构检查失败", "err", err)
+	}
+	for _, m := range applied {
+		slog.Info("已执行表结构迁移", "version", m.Version, "name", m.Name)
 	}
 
 	// 3. 准备 gRPC 服务
 	lis, err := net.Listen("tcp", ":9090")
 	if err != nil {
-		log.Fatalf("❌ gRPC 端口监听失败: %v", err)
+		logging.Fatal("gRPC 端口监听失败", "err", err)
 	}
 
 	grpcServer := grpc.NewServer()
-	srv := &server.SentinelServer{DB: db}
+	store, err := storage.New(config.GlobalConfig)
+	if err != nil {
+		logging.Fatal("初始化产物存储失败", "err", err)
+	}
+	var box *secrets.Box
+	if key := config.GlobalConfig.Server.SecretKey; key != "" {
+		if box, err = secrets.NewBox(key); err != nil {
+			logging.Fatal("server.secret_key 无效", "err", err)
+		}
+	} else {
+		slog.Warn("未配置 server.secret_key，/secrets 不可用")
+	}
+	outbox := server.NewOutboxRelay(db,
+		config.GlobalConfig.Server.OutboxInterval,
+		config.GlobalConfig.Server.OutboxRetention)
+	dbStore := server.NewGormStore(db)
+	srv := &server.SentinelServer{
+		Store:  dbStore,
+		Outbox: outbox,
+		HeartbeatPolicy: server.HeartbeatPolicy{
+			Interval:   config.GlobalConfig.Server.HeartbeatInterval,
+			Jitter:     config.GlobalConfig.Server.HeartbeatJitter,
+			TargetRate: config.GlobalConfig.Server.HeartbeatRate,
+			Max:        config.GlobalConfig.Server.AgentOfflineAfter / 3,
+		},
+		Storage:         store,
+		MaxArtifactSize: config.GlobalConfig.Server.MaxSize,
+		Secrets:         box,
+		Events:          server.NewEventBus(db, config.GlobalConfig.Server.EventRetention),
+		Results:         server.NewResultArchiver(dbStore, config.GlobalConfig.Server.StoragePath, config.GlobalConfig.Server.ResultRetention),
+	}
+	metrics.RegisterServer(server.NewMetricsCollector(srv))
 	grpcServer = grpc.NewServer(
-		grpc.UnaryInterceptor(UnaryServerInterceptor),
+		// 先恢复 trace context 和请求 ID，日志和指标拦截器里就能拿到；
+		// panic 恢复放在最里层，恢复后的 Internal 错误照常计入日志和统计
+		grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor, logging.UnaryServerInterceptor, UnaryServerInterceptor,
+			srv.UnaryStatsInterceptor, server.RecoveryUnaryInterceptor),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor, srv.StreamStatsInterceptor, server.RecoveryStreamInterceptor),
+		// keepalive 用来发现半开连接 (Agent 断电、网络中断)，不必等心跳超时
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    30 * time.Second,
+			Timeout: 10 * time.Second,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
 	)
 
 	pb.RegisterSentinelServiceServer(grpcServer, srv)
 
+	// 后台任务 (延时调度、发件箱投递等) 共用一个 context，停机时统一取消
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	scheduler := &server.DelayScheduler{
+		Store:    srv.Store,
+		Interval: config.GlobalConfig.Server.SchedulerInterval,
+		Outbox:   outbox,
+	}
+	go scheduler.Run(bgCtx)
+	go outbox.Run(bgCtx)
+	go srv.Events.Run(bgCtx)
+	go srv.Results.Run(bgCtx)
+
+	// Webhook 投递 (订阅事件总线) 和节点失联检测 (agent.lost 事件)
+	webhooks := server.NewWebhookWorker(srv,
+		config.GlobalConfig.Server.WebhookTimeout,
+		config.GlobalConfig.Server.WebhookMaxAttempts,
+		config.GlobalConfig.Server.WebhookRetention)
+	srv.Webhooks = webhooks
+	go webhooks.Run(bgCtx)
+	watcher := &server.AgentWatcher{
+		Srv:          srv,
+		OfflineAfter: config.GlobalConfig.Server.AgentOfflineAfter,
+	}
+	go watcher.Run(bgCtx)
+
 	// 4. 准备 HTTP 服务
 	// 注意：这里我们需要拿到原生 http.Server 对象，以便后面执行 Shutdown
 	// 假设 server.NewHttpServer 返回的是一个 http.Handler (如 Gin Engine)
-	httpHandler := server.NewHttpServer(db, srv)
+	httpHandler := server.NewHttpServer(srv)
 
 	httpServer := &http.Server{
 		Addr:    ":8080",
@@ -105,17 +187,17 @@ func main() {
 
 	// 启动 gRPC
 	go func() {
-		log.Println("🚀 Sentinel Control Plane 已启动 | gRPC :9090")
+		slog.Info("Sentinel Control Plane 已启动", "grpc_addr", ":9090")
 		if err := grpcServer.Serve(lis); err != nil {
-			log.Fatalf("❌ gRPC 服务崩溃: %v", err)
+			logging.Fatal("gRPC 服务崩溃", "err", err)
 		}
 	}()
 
 	// 启动 HTTP
 	go func() {
-		log.Println("🚀 HTTP Management API 已启动 | HTTP :8080")
+		slog.Info("HTTP Management API 已启动", "http_addr", httpServer.Addr)
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("❌ HTTP 服务崩溃: %v", err)
+			logging.Fatal("HTTP 服务崩溃", "err", err)
 		}
 	}()
 
@@ -129,30 +211,39 @@ func main() {
 
 	// 2. 阻塞直到收到信号
 	sig := <-quit
-	log.Printf("🛑 收到信号 [%s]，开始优雅停机...", sig)
+	slog.Info("收到信号，开始优雅停机", "signal", sig.String())
 
 	// 3. 创建超时上下文 (给程序 10秒 时间善后，超时强制杀)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// 4. 先关 HTTP (入口网关)：停止接收新用户的任务
-	log.Println("⏳ 正在停止 HTTP 服务...")
+	slog.Info("正在停止 HTTP 服务")
 	if err := httpServer.Shutdown(ctx); err != nil {
-		log.Printf("⚠️ HTTP 关闭报错: %v", err)
+		slog.Warn("HTTP 关闭报错", "err", err)
 	} else {
-		log.Println("✅ HTTP 服务已安全停止")
+		slog.Info("HTTP 服务已安全停止")
 	}
 
+	// 停止延时调度、发件箱投递等后台任务，再断开 MQ
+	stopBackground()
+	mq.Close()
+
 	// 5. 再关 gRPC (内部通信)：停止接收 Agent 汇报
 	// GracefulStop 会等待当前正在处理的 RPC 请求结束
-	log.Println("⏳ 正在停止 gRPC 服务...")
+	slog.Info("正在停止 gRPC 服务")
 	grpcServer.GracefulStop()
-	log.Println("✅ gRPC 服务已安全停止")
+	slog.Info("gRPC 服务已安全停止")
+
+	// 把缓冲的 span 发给 Collector
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("导出剩余 span 失败", "err", err)
+	}
 
 	// 6. (可选) 关闭数据库连接
 	sqlDB, _ := db.DB()
 	sqlDB.Close()
-	log.Println("✅ 数据库连接已关闭")
+	slog.Info("数据库连接已关闭")
 
-	log.Println("👋 Server 安全退出")
+	slog.Info("Server 安全退出")
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+	gcdb "github.com/stywzn/Go-Cloud-Compute/pkg/db"
+)
+
+const migrateUsage = `用法: server migrate <命令>
+
+  up [版本]     执行还没执行的迁移，指定版本时只执行到这个版本
+  down [个数]   从最新的版本开始回滚，默认回滚 1 个
+  status        查看每个版本的执行情况
+`
+
+// runMigrate 处理 server migrate 子命令，返回进程退出码
+func runMigrate(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	var n int64
+	if len(args) == 2 {
+		v, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || v <= 0 {
+			fmt.Fprintf(os.Stderr, "参数必须是正整数: %s\n", args[1])
+			return 2
+		}
+		n = v
+	}
+
+	db, err := gcdb.Open(config.GlobalConfig.Database)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "无法连接数据库:", err)
+		return 1
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	migrator, err := gcdb.NewMigrator(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "加载表结构迁移失败:", err)
+		return 1
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx, n)
+		for _, m := range done {
+			fmt.Printf("up   %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "迁移失败:", err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("没有需要执行的迁移")
+		}
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		done, err := migrator.Down(ctx, int(n))
+		for _, m := range done {
+			fmt.Printf("down %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "回滚失败:", err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("没有可以回滚的迁移")
+		}
+	case "status":
+		if len(args) > 1 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "查询迁移状态失败:", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format(time.DateTime)
+			}
+			if s.Unknown {
+				applied += " (unknown to this server)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		w.Flush()
+		fmt.Printf("driver: %s, latest: %04d\n", db.Dialector.Name(), migrator.Latest())
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
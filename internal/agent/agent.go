@@ -0,0 +1,642 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/metrics"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/mq"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/secrets"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/tracing"
+)
+
+// Agent 数据面节点：通过 MQ 抢占式消费任务，通过 gRPC 心跳接收下发任务并汇报结果
+type Agent struct {
+	cfg config.AgentConfig
+
+	// slots 是 MQ 和 gRPC 两条路径共享的并发槽位
+	slots *Limiter
+	// wg 追踪正在执行的任务，退出前等待它们结束
+	wg sync.WaitGroup
+	// current 保存当前的 gRPC 连接，MQ 消费协程通过它回报任务结果
+	current atomic.Pointer[session]
+	// draining 为 true 时处于维护模式，不再接收新任务
+	draining atomic.Bool
+	// remote 是 Server 下发的配置 (见 config.go)，refreshing 保证同一时间只拉取一次
+	remote     atomic.Pointer[remoteConfig]
+	refreshing atomic.Bool
+	// jobs 正在执行的任务 jobID -> context.CancelFunc，用于响应 Server 的取消指令
+	jobs sync.Map
+	// Server 在心跳响应里下发的心跳间隔和抖动
+	serverInterval atomic.Int64
+	serverJitter   atomic.Int64
+	// acceptor 汇总要回传的 JobAccepted 并对重新下发的任务去重
+	acceptor *acceptor
+	// waiting 已确认收到、还在等槽位的 gRPC 任务数，计入上报的占用数，避免 Server 多派
+	waiting atomic.Int32
+}
+
+// Agent 在心跳里上报的自身状态
+const (
+	StateActive   = "Active"
+	StateDraining = "Draining" // 维护模式，还有在途任务
+	StateDrained  = "Drained"  // 维护模式，在途任务已清空
+)
+
+type session struct {
+	client  pb.SentinelServiceClient
+	agentID string
+}
+
+func New(cfg config.AgentConfig) *Agent {
+	return &Agent{
+		cfg:      cfg,
+		slots:    NewLimiter(cfg.MaxConcurrentJobs),
+		acceptor: newAcceptor(),
+	}
+}
+
+// Run 阻塞运行直到 ctx 被取消，然后等待所有在途任务结束
+func (a *Agent) Run(ctx context.Context) {
+	// 🚀 启动 MQ 消费者 (独立于 gRPC 连接运行)
+	go a.consumeMQ(ctx)
+	go a.workspaceJanitor(ctx)
+	if a.cfg.MetricsAddr != "" {
+		go a.serveMetrics(ctx)
+	}
+
+	// 🔄 gRPC 主循环 (负责心跳和汇报)
+	a.serve(ctx)
+
+	slog.Info("等待所有后台任务完成")
+	a.wg.Wait()
+}
+
+// consumeMQ 从 MQ 抢任务；先拿到并发槽位再启动执行协程，槽位用满时自然形成背压
+func (a *Agent) consumeMQ(ctx context.Context) {
+	msgs, err := mq.Consume()
+	if err != nil {
+		slog.Error("无法启动 MQ 消费者", "err", err)
+		return
+	}
+
+	// 断线重连由 mq 包负责，这个通道在重连后依然有效
+	slog.Info("MQ 消费者已启动，等待任务")
+
+	for {
+		var d amqp.Delivery
+		select {
+		case <-ctx.Done():
+			return
+		case d = <-msgs:
+		}
+
+		// 如果正在关机或处于维护模式，退回消息；等槽位时收到关机信号也一样
+		// (暂停订阅前已经推到本地的消息也会走到这里)
+		if ctx.Err() != nil || a.draining.Load() || a.slots.Acquire(ctx) != nil {
+			d.Nack(false, true)
+			continue
+		}
+
+		a.wg.Add(1) // 任务 +1
+
+		go func(delivery amqp.Delivery) {
+			defer a.wg.Done() // 任务 -1
+			defer a.slots.Release()
+
+			job := mq.DecodeJob(delivery)
+			// 接上 Server 投递时放在消息头里的 trace context
+			spanCtx, span := startDequeueSpan(tracing.Extract(context.Background(), tracing.AMQPCarrier(delivery.Headers)), job.JobID, "mq")
+			defer span.End()
+			spanCtx = jobLogContext(spanCtx, job.RequestID, job.JobID)
+
+			// ✅ 【修复】幂等性检查日志放在这里 (只有这里才有 job 数据)
+			slog.DebugContext(spanCtx, "幂等性检查", "source", "mq", "payload", job.Payload)
+			// TODO: 这里将来加 Redis 查重逻辑
+			// if redis.Exists(jobID) { d.Ack(false); return }
+
+			// 配置档不允许执行的任务直接判失败，不退回队列，免得在节点之间来回打转
+			if err := a.checkPolicy(job.Type, job.Payload); err != nil {
+				slog.WarnContext(spanCtx, "拒绝执行任务", "source", "mq", "err", err)
+				if job.JobID != "" {
+					a.report(spanCtx, job.JobID, StatusFailed, "rejected: "+err.Error())
+				}
+				delivery.Ack(false)
+				return
+			}
+
+			jobCtx, done := a.track(job.JobID)
+			defer done()
+			jobCtx = jobLogContext(trace.ContextWithSpan(jobCtx, span), job.RequestID, job.JobID)
+
+			// 旧格式的消息没有 JobID，无从汇报
+			if job.JobID != "" {
+				a.report(jobCtx, job.JobID, StatusRunning, "")
+			}
+
+			slog.InfoContext(jobCtx, "开始执行任务", "source", "mq", "payload", job.Payload)
+			status, output := a.runJob(jobCtx, jobRunFromMQ(job, delivery.Redelivered))
+
+			if job.JobID != "" {
+				a.report(jobCtx, job.JobID, status, output)
+			}
+
+			if status == StatusSuccess {
+				slog.InfoContext(jobCtx, "任务执行成功", "source", "mq")
+			} else {
+				slog.WarnContext(jobCtx, "任务执行失败", "source", "mq", "status", status, "output", output)
+			}
+			// 成功失败都 ACK (或者 Nack 重试，看策略)
+			if err := delivery.Ack(false); err != nil {
+				slog.WarnContext(jobCtx, "Ack 失败", "err", err)
+			}
+		}(d)
+	}
+}
+
+// runDispatched 执行 gRPC 下发的任务，和 MQ 任务共用并发槽位
+func (a *Agent) runDispatched(ctx context.Context, j *pb.Job) {
+	if a.draining.Load() && a.acceptor.reject(j.JobId) {
+		// 和 drain 指令擦肩而过的任务：退回给 Server 重新安排，任务保持 Assigned，不能当成失败
+		slog.Warn("维护模式中，退回任务", "job_id", j.JobId, "request_id", j.RequestId)
+		return
+	}
+	// 不管能不能执行都先确认收到，否则 Server 会在重连后重新下发
+	if !a.acceptor.accept(j.JobId) {
+		slog.Info("任务之前已经收到过，不再重复执行", "job_id", j.JobId, "request_id", j.RequestId)
+		return
+	}
+
+	// 心跳流是长连接，trace context 和请求 ID 随任务消息下发
+	spanCtx, span := startDequeueSpan(tracing.WithTraceParent(context.Background(), j.Traceparent), j.JobId, "grpc")
+	spanCtx = jobLogContext(spanCtx, j.RequestId, j.JobId)
+	if err := a.checkPolicy(j.Type.String(), j.Payload); err != nil {
+		slog.WarnContext(spanCtx, "拒绝执行任务", "source", "grpc", "err", err)
+		a.report(spanCtx, j.JobId, StatusFailed, "rejected: "+err.Error())
+		span.End()
+		return
+	}
+
+	// 等槽位期间也可以被取消，所以先登记
+	jobCtx, done := a.track(j.JobId)
+	jobCtx = jobLogContext(trace.ContextWithSpan(jobCtx, span), j.RequestId, j.JobId)
+	a.waiting.Add(1)
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		defer span.End()
+		defer done()
+		err := a.slots.Acquire(ctx)
+		a.waiting.Add(-1)
+		if err != nil {
+			slog.WarnContext(jobCtx, "正在退出，放弃任务", "source", "grpc")
+			return
+		}
+		defer a.slots.Release()
+		if jobCtx.Err() != nil {
+			a.report(jobCtx, j.JobId, StatusCancelled, "cancelled by server before start")
+			return
+		}
+
+		// ✅ 【修复】这里也有一个幂等性检查点
+		slog.DebugContext(jobCtx, "幂等性检查", "source", "grpc")
+
+		a.report(jobCtx, j.JobId, StatusRunning, "")
+		slog.InfoContext(jobCtx, "开始执行任务", "source", "grpc", "payload", j.Payload)
+		status, output := a.runJob(jobCtx, jobRunFromProto(j))
+
+		// 汇报
+		a.report(jobCtx, j.JobId, status, output)
+	}()
+}
+
+// jobRun 一次任务执行需要的信息，MQ 和 gRPC 下发的任务都转换成它
+type jobRun struct {
+	ID        string
+	Payload   string
+	Attempt   int32
+	Files     []*pb.InputFile
+	Artifacts []string
+	Env       map[string]string
+	Workdir   string
+	User      string
+	SecretEnv []string // 要注入秘密值的环境变量名
+}
+
+func jobRunFromProto(j *pb.Job) jobRun {
+	return jobRun{
+		ID:        j.JobId,
+		Payload:   j.Payload,
+		Attempt:   j.Attempt,
+		Files:     j.Files,
+		Artifacts: j.Artifacts,
+		Env:       j.Env,
+		Workdir:   j.Workdir,
+		User:      j.User,
+		SecretEnv: j.SecretEnv,
+	}
+}
+
+// jobRunFromMQ MQ 不记录投递次数，只能区分首次投递和重新投递
+func jobRunFromMQ(job mq.JobMessage, redelivered bool) jobRun {
+	attempt := int32(1)
+	if redelivered {
+		attempt = 2
+	}
+	return jobRun{
+		ID:        job.JobID,
+		Payload:   job.Payload,
+		Attempt:   attempt,
+		Files:     protoFiles(job.Files),
+		Artifacts: job.Artifacts,
+		Env:       job.Env,
+		Workdir:   job.Workdir,
+		User:      job.User,
+		SecretEnv: job.SecretEnv,
+	}
+}
+
+// runJob 在独立的工作区里执行任务：准备输入文件 -> 执行命令 -> 上传产物，返回要汇报的状态和输出
+// 产物在汇报之前上传，任务结束时产物已经可以下载；工作区按 workspace_keep 删除或保留
+func (a *Agent) runJob(ctx context.Context, job jobRun) (status, output string) {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "job.execute", trace.WithAttributes(
+		attribute.String("job.id", job.ID),
+		attribute.Int("job.attempt", int(job.Attempt)),
+	))
+	defer func() {
+		metrics.AgentJobDuration.WithLabelValues(status).Observe(time.Since(start).Seconds())
+		span.SetAttributes(attribute.String("job.status", status))
+		if status != StatusSuccess {
+			span.SetStatus(codes.Error, status)
+		}
+		span.End()
+	}()
+
+	ws, err := a.newWorkspace(job.ID)
+	if err != nil {
+		return executorError("workspace", "create workspace: "+err.Error())
+	}
+	defer func() { a.releaseWorkspace(ws, status) }()
+
+	if err := a.stageFiles(ctx, ws, job.Files); err != nil {
+		if ctx.Err() != nil {
+			return StatusCancelled, "cancelled by server while staging files"
+		}
+		return executorError("stage_files", "stage files: "+err.Error())
+	}
+	dir, err := jobDir(ws, job.Workdir)
+	if err != nil {
+		return executorError("workdir", "workdir: "+err.Error())
+	}
+	if job.User != "" {
+		if err := chownWorkspace(ws, job.User); err != nil {
+			return executorError("user", "prepare workspace for user "+job.User+": "+err.Error())
+		}
+	}
+
+	secretEnv, err := a.fetchSecrets(ctx, job)
+	if err != nil {
+		return executorError("secrets", "fetch secrets: "+err.Error())
+	}
+
+	output, success := RunLocalCommand(ctx, job.Payload, ExecSpec{
+		Dir:  dir,
+		Env:  a.jobEnv(job, ws, secretEnv),
+		User: job.User,
+	})
+	// 秘密值不能出现在汇报的输出和本地日志里
+	output = secrets.Mask(output, values(secretEnv))
+	status = resultStatus(success)
+	if ctx.Err() != nil {
+		status, output = StatusCancelled, "cancelled by server\n"+output
+	}
+	if job.ID != "" {
+		a.uploadArtifacts(job.ID, dir, job.Artifacts)
+	}
+	return status, output
+}
+
+// startDequeueSpan Agent 收到任务时开启的 span，执行和汇报都挂在它下面
+func startDequeueSpan(ctx context.Context, jobID, source string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "job.dequeue",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("job.id", jobID),
+			attribute.String("job.source", source),
+		))
+}
+
+// jobLogContext 任务相关日志的 ctx：带上提交任务时的请求 ID 和任务 ID，汇报时请求 ID 也会传回 Server
+func jobLogContext(ctx context.Context, requestID, jobID string) context.Context {
+	return logging.With(logging.WithRequestID(ctx, requestID), "job_id", jobID)
+}
+
+// executorError 执行器自身出错 (不是命令失败)，计入指标后按 Failed 汇报
+func executorError(stage, output string) (string, string) {
+	metrics.AgentExecutorErrors.WithLabelValues(stage).Inc()
+	return StatusFailed, output
+}
+
+// track 登记正在执行的任务，返回的 ctx 在收到取消指令时被取消；任务结束后调用 done
+// 任务不跟随 Agent 的 ctx 退出：停机时等在途任务自然结束
+func (a *Agent) track(jobID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if jobID == "" {
+		return ctx, cancel
+	}
+	a.jobs.Store(jobID, cancel)
+	return ctx, func() {
+		a.jobs.CompareAndDelete(jobID, cancel)
+		cancel()
+	}
+}
+
+// cancelJob 响应 Server 推送的取消指令
+func (a *Agent) cancelJob(jobID string) {
+	cancel, ok := a.jobs.Load(jobID)
+	if !ok {
+		slog.Warn("任务不在执行中，忽略取消指令", "job_id", jobID)
+		return
+	}
+	slog.Info("收到取消指令，中止任务", "job_id", jobID)
+	cancel.(context.CancelFunc)()
+}
+
+// setDrain 根据 Server 下发的指令进入或退出维护模式
+func (a *Agent) setDrain(drain bool) {
+	if a.draining.Swap(drain) == drain {
+		return
+	}
+	if drain {
+		slog.Info("收到 drain 指令：停止消费 MQ，等待在途任务结束")
+		mq.PauseConsume()
+	} else {
+		slog.Info("收到 undrain 指令：恢复接收任务")
+		mq.ResumeConsume()
+	}
+}
+
+// state 计算心跳里上报的状态
+func (a *Agent) state() string {
+	if !a.draining.Load() {
+		return StateActive
+	}
+	if used, _ := a.slots.Usage(); used > 0 || a.waiting.Load() > 0 {
+		return StateDraining
+	}
+	return StateDrained
+}
+
+// 汇报给 Server 的任务状态
+const (
+	StatusRunning   = "Running"
+	StatusSuccess   = "Success"
+	StatusFailed    = "Failed"
+	StatusCancelled = "Cancelled"
+)
+
+func resultStatus(success bool) string {
+	if success {
+		return StatusSuccess
+	}
+	return StatusFailed
+}
+
+// report 通过 gRPC 汇报任务状态；断线期间的结果只能记日志
+// ctx 只用来携带 trace context 和日志属性，任务被取消后也要能汇报
+func (a *Agent) report(ctx context.Context, jobID, status, output string) {
+	sess := a.current.Load()
+	if sess == nil {
+		slog.WarnContext(ctx, "尚未连接服务器，任务状态无法汇报", "job_id", jobID, "status", status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	_, err := sess.client.ReportJobStatus(ctx, &pb.ReportJobReq{
+		AgentId: sess.agentID,
+		JobId:   jobID,
+		Status:  status,
+		Result:  output,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "任务状态汇报失败", "job_id", jobID, "status", status, "err", err)
+	}
+}
+
+// capabilities 上报 Agent 能执行的任务类型
+func capabilities() []string {
+	caps := make([]string, 0, len(pb.JobType_name))
+	for _, name := range pb.JobType_name {
+		caps = append(caps, name)
+	}
+	sort.Strings(caps)
+	return caps
+}
+
+// serve 维持与 Server 的 gRPC 连接：注册 -> 心跳，断开后 3 秒重连
+func (a *Agent) serve(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			break
+		}
+
+		customDialer := func(ctx context.Context, addr string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, "tcp4", addr)
+		}
+		opts := []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(customDialer),
+			// 汇报、获取秘密等调用把任务的 trace context 和请求 ID 放进 metadata
+			grpc.WithChainUnaryInterceptor(tracing.UnaryClientInterceptor, logging.UnaryClientInterceptor),
+			// 主动探测半开连接：Server 宕机或网络中断时尽快重连，而不是一直卡在 Recv 上
+			grpc.WithKeepaliveParams(keepalive.ClientParameters{
+				Time:                20 * time.Second,
+				Timeout:             10 * time.Second,
+				PermitWithoutStream: true,
+			}),
+		}
+
+		conn, err := grpc.NewClient(a.cfg.ServerAddr, opts...)
+		if err != nil {
+			slog.Error("无法连接服务器", "addr", a.cfg.ServerAddr, "err", err)
+			time.Sleep(3 * time.Second)
+			continue
+		}
+
+		a.runSession(ctx, conn)
+
+		a.current.Store(nil)
+		conn.Close()
+		if ctx.Err() != nil {
+			break
+		}
+		time.Sleep(3 * time.Second)
+	}
+}
+
+// runSession 在一条 gRPC 连接上完成注册和心跳，连接断开或 ctx 取消时返回
+func (a *Agent) runSession(ctx context.Context, conn *grpc.ClientConn) {
+	client := pb.NewSentinelServiceClient(conn)
+
+	// 注册 (每次重连都重新采集一遍，网卡地址和磁盘余量可能已经变了)
+	hostname, _ := os.Hostname()
+	facts := collectFacts()
+	regResp, err := client.Register(context.Background(), &pb.RegisterReq{
+		Hostname:     hostname,
+		Ip:           primaryIP(facts.Ips),
+		Tags:         a.cfg.Tags,
+		Os:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		Kernel:       kernelVersion(),
+		AgentVersion: Version,
+		Capabilities: capabilities(),
+		Facts:        facts,
+	})
+	if err != nil {
+		slog.Warn("注册失败", "err", err)
+		return
+	}
+	agentID := regResp.AgentId
+	a.current.Store(&session{client: client, agentID: agentID})
+
+	// 心跳
+	stream, err := client.Heartbeat(context.Background())
+	if err != nil {
+		return
+	}
+
+	// 心跳管理通道
+	waitc := make(chan struct{})
+	// 接收协程退出说明连接已断 (包括 keepalive 探测到的半开连接)
+	recvDone := make(chan struct{})
+	// 收到需要确认的消息时立即发一次心跳把 ack 带回去，不等下一个周期
+	ackNow := make(chan struct{}, 1)
+	// 已处理的 Server 消息的最大 seq，每条心跳流从 0 开始
+	var acked atomic.Int64
+	// 测量往返时间的那条心跳 (ping) 的序号和发送时间
+	var pingSeq, pingAt atomic.Int64
+	measureRTT := a.cfg.MetricsAddr != ""
+
+	// 发送心跳协程：顺带上报槽位占用和配置版本，Server 据此决定是否继续下发、是否需要刷新配置
+	go func() {
+		defer close(waitc)
+		var seq int64
+		for {
+			seq++
+			used, limit := a.slots.Usage()
+			accepted := a.acceptor.take()
+			ping := measureRTT && seq%heartbeatPingEvery == 1 && pingSeq.Load() == 0
+			if ping {
+				pingAt.Store(time.Now().UnixNano())
+				pingSeq.Store(seq)
+			}
+			err := stream.Send(&pb.HeartbeatReq{
+				AgentId:       agentID,
+				Timestamp:     time.Now().Unix(),
+				RunningJobs:   int32(used) + a.waiting.Load(),
+				MaxJobs:       int32(limit),
+				State:         a.state(),
+				ConfigVersion: a.configVersion(),
+				Seq:           seq,
+				Ack:           acked.Load(),
+				Accepted:      accepted,
+				Ping:          ping,
+			})
+			if err != nil {
+				a.acceptor.putBack(accepted)
+				return // 发送失败，触发重连
+			}
+			slog.Debug("心跳已发送", "seq", seq, "slots_used", used, "slots_limit", limit)
+
+			timer := time.NewTimer(a.nextHeartbeat())
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-recvDone:
+				timer.Stop()
+				return
+			case <-ackNow:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+
+	// 接收协程：Server 只在有消息时才推送 (任务、取消、drain、配置变化、心跳间隔)
+	go func() {
+		defer close(recvDone)
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			resp, err := stream.Recv()
+			if err != nil {
+				return
+			} // 断开连接
+
+			if p := pingSeq.Load(); p > 0 && resp.Ack >= p {
+				if resp.Ack == p {
+					metrics.AgentHeartbeatRTT.Observe(time.Since(time.Unix(0, pingAt.Load())).Seconds())
+				}
+				pingSeq.Store(0) // 旧版 Server 不认 ping，收到更新的 ack 就放弃这一次
+			}
+
+			if resp.IntervalMs > 0 {
+				a.serverInterval.Store(int64(resp.IntervalMs) * int64(time.Millisecond))
+				a.serverJitter.Store(int64(resp.JitterMs) * int64(time.Millisecond))
+				slog.Debug("心跳间隔已调整", "interval", time.Duration(a.serverInterval.Load()), "jitter", time.Duration(a.serverJitter.Load()))
+			}
+			a.setDrain(resp.Drain)
+			if resp.ConfigOutdated {
+				go a.refreshConfig(client, agentID)
+			}
+			for _, jobID := range resp.CancelJobIds {
+				a.cancelJob(jobID)
+			}
+			if resp.Job != nil {
+				a.runDispatched(ctx, resp.Job)
+			}
+			if resp.Seq > 0 {
+				acked.Store(resp.Seq)
+				select {
+				case ackNow <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	// 阻塞等待断开
+	select {
+	case <-waitc:
+		slog.Warn("连接断开，3 秒后重连")
+	case <-recvDone:
+		slog.Warn("连接断开，3 秒后重连")
+	case <-ctx.Done():
+		slog.Info("主循环停止连接")
+	}
+}
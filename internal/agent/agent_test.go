@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+)
+
+// 维护模式下有在途任务 (含等槽位的下发任务) 时上报 Draining，清空后上报 Drained
+func TestAgentDrainState(t *testing.T) {
+	a := New(config.AgentConfig{MaxConcurrentJobs: 2})
+	if s := a.state(); s != StateActive {
+		t.Fatalf("state = %s, want %s", s, StateActive)
+	}
+	if err := a.slots.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	a.setDrain(true)
+	if s := a.state(); s != StateDraining {
+		t.Fatalf("state with a running job = %s, want %s", s, StateDraining)
+	}
+	a.slots.Release()
+	a.waiting.Add(1)
+	if s := a.state(); s != StateDraining {
+		t.Fatalf("state with a waiting job = %s, want %s", s, StateDraining)
+	}
+	a.waiting.Add(-1)
+	if s := a.state(); s != StateDrained {
+		t.Fatalf("state after jobs finished = %s, want %s", s, StateDrained)
+	}
+
+	// 重复的 drain 指令不改变状态
+	a.setDrain(true)
+	if s := a.state(); s != StateDrained {
+		t.Fatalf("state after repeated drain = %s, want %s", s, StateDrained)
+	}
+	a.setDrain(false)
+	if s := a.state(); s != StateActive {
+		t.Fatalf("state after undrain = %s, want %s", s, StateActive)
+	}
+}
+
+// 优先使用 Server 下发的心跳间隔，抖动只会拉长间隔
+func TestNextHeartbeat(t *testing.T) {
+	a := New(config.AgentConfig{})
+	if d := a.nextHeartbeat(); d != defaultHeartbeatInterval {
+		t.Fatalf("nextHeartbeat = %s, want default %s", d, defaultHeartbeatInterval)
+	}
+	a.serverInterval.Store(int64(2 * time.Second))
+	a.serverJitter.Store(int64(500 * time.Millisecond))
+	for range 100 {
+		if d := a.nextHeartbeat(); d < 2*time.Second || d >= 2500*time.Millisecond {
+			t.Fatalf("nextHeartbeat = %s, want within [2s, 2.5s)", d)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/metrics"
+)
+
+const (
+	artifactChunkSize = 64 << 10 // 每个分片 64KiB
+	maxArtifactFiles  = 100      // 一个任务最多上传多少个文件，防止 glob 写太宽把整个目录传上去
+)
+
+// uploadArtifacts 任务结束后按 glob 上传产物，成功失败都要上传 (失败时的日志往往更有用)
+// 相对路径的 glob 以工作目录 dir 为准；单个文件上传失败只记日志，不影响任务结果
+func (a *Agent) uploadArtifacts(jobID, dir string, globs []string) {
+	if len(globs) == 0 {
+		return
+	}
+	sess := a.current.Load()
+	if sess == nil {
+		slog.Warn("尚未连接服务器，任务产物无法上传", "job_id", jobID)
+		return
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	for _, g := range globs {
+		if dir != "" && !filepath.IsAbs(g) {
+			g = filepath.Join(dir, g)
+		}
+		matches, err := filepath.Glob(g)
+		if err != nil {
+			slog.Warn("产物 glob 格式错误", "job_id", jobID, "glob", g, "err", err)
+			continue
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || !info.Mode().IsRegular() || seen[m] {
+				continue
+			}
+			seen[m] = true
+			files = append(files, m)
+		}
+	}
+	if len(files) > maxArtifactFiles {
+		slog.Warn("产物文件过多，只上传前一部分", "job_id", jobID, "matched", len(files), "limit", maxArtifactFiles)
+		files = files[:maxArtifactFiles]
+	}
+
+	for _, f := range files {
+		if err := uploadArtifact(sess, jobID, artifactName(dir, f), f); err != nil {
+			metrics.AgentExecutorErrors.WithLabelValues("upload_artifact").Inc()
+			slog.Warn("产物上传失败", "job_id", jobID, "file", f, "err", err)
+		}
+	}
+}
+
+// artifactName 产物在 Server 上的名字：工作目录下的文件用相对于工作目录的路径，
+// 其他绝对路径去掉开头的 "/"，工作目录之外的相对路径去掉开头的 "../"
+func artifactName(dir, file string) string {
+	if dir != "" {
+		if rel, err := filepath.Rel(dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+	}
+	name := filepath.ToSlash(filepath.Clean(file))
+	if vol := filepath.VolumeName(file); vol != "" {
+		name = strings.TrimPrefix(name, filepath.ToSlash(vol))
+	}
+	for strings.HasPrefix(name, "../") {
+		name = name[3:]
+	}
+	return strings.TrimLeft(name, "/")
+}
+
+func uploadArtifact(sess *session, jobID, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	stream, err := sess.client.UploadArtifact(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 第一个分片带上任务和文件信息，后面的只带数据；空文件也要发一个分片
+	chunk := &pb.ArtifactChunk{JobId: jobID, AgentId: sess.agentID, Name: name}
+	buf := make([]byte, artifactChunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 || chunk.Name != "" {
+			chunk.Data = buf[:n]
+			if err := stream.Send(chunk); err != nil {
+				if errors.Is(err, io.EOF) {
+					break // Server 提前结束了流，真正的错误在 CloseAndRecv 里
+				}
+				return err
+			}
+			chunk = &pb.ArtifactChunk{}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	slog.Info("产物已上传", "job_id", jobID, "name", resp.Name, "size", resp.Size, "sha256", resp.Sha256)
+	return nil
+}
@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"time"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/mq"
+)
+
+// Server 没有下发心跳间隔时的默认值
+const defaultHeartbeatInterval = 5 * time.Second
+
+// remoteConfig 是 Server 下发配置编译后的结果，整体替换，读取时不用加锁
+type remoteConfig struct {
+	version  string
+	profile  string
+	interval time.Duration
+	allowed  map[string]bool // 为空表示不限制任务类型
+	deny     []*regexp.Regexp
+	logLevel string // 为空表示沿用本地 log.level
+	maxJobs  int
+}
+
+// compileConfig 把下发的配置转换成 remoteConfig，字段为零值时回落到本地默认
+func compileConfig(c *pb.AgentConfig, local int) (*remoteConfig, error) {
+	rc := &remoteConfig{
+		version:  c.Version,
+		profile:  c.Profile,
+		interval: defaultHeartbeatInterval,
+		logLevel: c.LogLevel,
+		maxJobs:  local,
+	}
+	if c.HeartbeatIntervalSeconds > 0 {
+		rc.interval = time.Duration(c.HeartbeatIntervalSeconds) * time.Second
+	}
+	if c.MaxConcurrentJobs > 0 {
+		rc.maxJobs = int(c.MaxConcurrentJobs)
+	}
+	if len(c.AllowedExecutors) > 0 {
+		rc.allowed = make(map[string]bool, len(c.AllowedExecutors))
+		for _, e := range c.AllowedExecutors {
+			rc.allowed[strings.ToUpper(e)] = true
+		}
+	}
+	for _, p := range c.DenyPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("deny pattern %q: %w", p, err)
+		}
+		rc.deny = append(rc.deny, re)
+	}
+	return rc, nil
+}
+
+// refreshConfig 拉取并应用最新配置；心跳收到 config_outdated 时调用，同一时间只跑一个
+func (a *Agent) refreshConfig(client pb.SentinelServiceClient, agentID string) {
+	if !a.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	defer a.refreshing.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := client.GetAgentConfig(ctx, &pb.GetAgentConfigReq{AgentId: agentID})
+	if err != nil {
+		slog.Warn("拉取配置失败", "err", err)
+		return
+	}
+	a.applyConfig(c)
+}
+
+// applyConfig 立即生效：心跳间隔在下一轮心跳生效，并发上限直接调整槽位和 MQ 预取数
+func (a *Agent) applyConfig(c *pb.AgentConfig) {
+	rc, err := compileConfig(c, a.cfg.MaxConcurrentJobs)
+	if err != nil {
+		// 版本不更新，下一次心跳还会提示过期，Server 那边修正后自然恢复
+		slog.Error("配置无效，保持原配置", "version", c.Version, "err", err)
+		return
+	}
+
+	old := a.remote.Swap(rc)
+	if old == nil || old.maxJobs != rc.maxJobs {
+		a.slots.SetLimit(rc.maxJobs)
+		if err := mq.UpdatePrefetch(rc.maxJobs); err != nil {
+			slog.Warn("调整 MQ 预取数量失败，重连后生效", "err", err)
+		}
+	}
+	if rc.logLevel != "" {
+		if err := logging.SetLevel(rc.logLevel); err != nil {
+			slog.Warn("配置档的日志级别无效，忽略", "err", err)
+		}
+	}
+
+	profile := rc.profile
+	if profile == "" {
+		profile = "(本地配置)"
+	}
+	slog.Info("已应用配置", "version", rc.version, "profile", profile, "heartbeat", rc.interval, "max_jobs", rc.maxJobs, "log_level", logging.Level())
+}
+
+// config 当前生效的配置，还没拉取过时返回 nil
+func (a *Agent) config() *remoteConfig {
+	return a.remote.Load()
+}
+
+func (a *Agent) configVersion() string {
+	if rc := a.config(); rc != nil {
+		return rc.version
+	}
+	return ""
+}
+
+// heartbeatInterval 优先使用 Server 在心跳响应里下发的间隔，旧版 Server 不下发时用配置档或默认值
+func (a *Agent) heartbeatInterval() time.Duration {
+	if d := time.Duration(a.serverInterval.Load()); d > 0 {
+		return d
+	}
+	if rc := a.config(); rc != nil {
+		return rc.interval
+	}
+	return defaultHeartbeatInterval
+}
+
+// nextHeartbeat 下一次心跳前等待的时间，加上随机抖动避免所有节点同时心跳
+func (a *Agent) nextHeartbeat() time.Duration {
+	d := a.heartbeatInterval()
+	if j := a.serverJitter.Load(); j > 0 {
+		d += time.Duration(rand.Int64N(j))
+	}
+	return d
+}
+
+// checkPolicy 按当前配置检查任务能否执行，不能执行时返回原因
+func (a *Agent) checkPolicy(jobType, payload string) error {
+	rc := a.config()
+	if rc == nil {
+		return nil
+	}
+	if jobType == "" {
+		jobType = pb.JobType_SHELL.String() // 旧格式的消息只有命令
+	}
+	if rc.allowed != nil && !rc.allowed[strings.ToUpper(jobType)] {
+		return fmt.Errorf("executor %s is not allowed by profile %s", jobType, rc.profile)
+	}
+	for _, re := range rc.deny {
+		if re.MatchString(payload) {
+			return fmt.Errorf("command denied by policy %q", re.String())
+		}
+	}
+	return nil
+}
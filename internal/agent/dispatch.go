@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"sync"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+// 记住最近收到的多少个任务，用于识别重新下发的重复任务
+const recentJobsSize = 1024
+
+// acceptor 汇总要在下一条心跳里回传的 JobAccepted，
+// 并记住最近收到的任务：Server 在确认丢失后会重新下发，同一个任务不能执行两次
+// (只在进程内去重，Agent 重启后无法识别)
+type acceptor struct {
+	mu      sync.Mutex
+	pending []*pb.JobAccepted
+	seen    map[string]bool
+	order   []string // 环形缓冲，seen 满了以后淘汰最早的
+	next    int
+}
+
+func newAcceptor() *acceptor {
+	return &acceptor{seen: make(map[string]bool, recentJobsSize)}
+}
+
+// accept 登记收到的任务，返回 false 表示之前已经收到过
+func (c *acceptor) accept(jobID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dup := c.seen[jobID]
+	c.pending = append(c.pending, &pb.JobAccepted{JobId: jobID, Duplicate: dup})
+	if dup {
+		return false
+	}
+
+	if len(c.order) < recentJobsSize {
+		c.order = append(c.order, jobID)
+	} else {
+		delete(c.seen, c.order[c.next])
+		c.order[c.next] = jobID
+		c.next = (c.next + 1) % recentJobsSize
+	}
+	c.seen[jobID] = true
+	return true
+}
+
+// reject 退回还没收到过的任务：回传 Rejected，也不记入 seen，取消排空后 Server 可以再次下发。
+// 返回 false 表示之前已经收到过 (任务已经在执行)，应该按重复任务走 accept
+func (c *acceptor) reject(jobID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.seen[jobID] {
+		return false
+	}
+	c.pending = append(c.pending, &pb.JobAccepted{JobId: jobID, Rejected: true})
+	return true
+}
+
+// take 取出待回传的确认
+func (c *acceptor) take() []*pb.JobAccepted {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := c.pending
+	c.pending = nil
+	return out
+}
+
+// putBack 心跳没发出去，确认留到下一条心跳 (换了连接也一样有效)
+func (c *acceptor) putBack(acks []*pb.JobAccepted) {
+	if len(acks) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending = append(acks, c.pending...)
+}
@@ -0,0 +1,25 @@
+package agent
+
+import "testing"
+
+func TestAcceptorReject(t *testing.T) {
+	c := newAcceptor()
+	if !c.reject("j1") {
+		t.Fatal("reject of a new job returned false")
+	}
+	acks := c.take()
+	if len(acks) != 1 || acks[0].JobId != "j1" || !acks[0].Rejected {
+		t.Fatalf("acks = %v, want one rejection of j1", acks)
+	}
+	// 退回的任务没有记入 seen，取消排空后重新下发时要正常执行
+	if !c.accept("j1") {
+		t.Fatal("redelivered job was treated as a duplicate")
+	}
+	// 已经在执行的任务不能退回
+	if c.reject("j1") {
+		t.Fatal("reject of an accepted job returned true")
+	}
+	if acks := c.take(); len(acks) != 1 || acks[0].Rejected {
+		t.Fatalf("acks = %v, want one acceptance", acks)
+	}
+}
@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// ExecSpec 命令的执行环境
+type ExecSpec struct {
+	Dir  string   // 工作目录，为空表示当前目录
+	Env  []string // 为 nil 时继承 Agent 的环境
+	User string   // 以哪个系统用户执行，为空表示和 Agent 相同
+}
+
+// RunLocalCommand 执行本地命令，ctx 取消时命令会被杀掉
+func RunLocalCommand(ctx context.Context, cmdStr string, spec ExecSpec) (string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", cmdStr)
+	cmd.Dir, cmd.Env = spec.Dir, spec.Env
+	if spec.User != "" {
+		if err := runAs(cmd, spec.User); err != nil {
+			return fmt.Sprintf("Error: %v", err), false
+		}
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Sprintf("Error: %v\nOutput: %s", err, output), false
+	}
+	return string(output), true
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package agent
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// 非 Unix 平台不支持切换用户执行
+
+func runAs(cmd *exec.Cmd, name string) error {
+	return errors.New("当前平台不支持以其他用户执行任务")
+}
+
+func chownWorkspace(dir, name string) error {
+	return errors.New("当前平台不支持以其他用户执行任务")
+}
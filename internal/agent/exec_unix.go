@@ -0,0 +1,76 @@
+//go:build unix
+
+package agent
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// runAs 让命令以指定用户执行 (Agent 需要以 root 运行)，HOME / USER / LOGNAME 也换成该用户的
+func runAs(cmd *exec.Cmd, name string) error {
+	u, uid, gid, err := lookupUser(name)
+	if err != nil {
+		return err
+	}
+	var groups []uint32
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+				groups = append(groups, uint32(g))
+			}
+		}
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uid, Gid: gid, Groups: groups},
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	out := make([]string, 0, len(env)+3)
+	for _, kv := range env {
+		if k, _, _ := strings.Cut(kv, "="); k != "HOME" && k != "USER" && k != "LOGNAME" {
+			out = append(out, kv)
+		}
+	}
+	cmd.Env = append(out, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	return nil
+}
+
+// chownWorkspace 把工作区交给执行任务的用户，否则切换用户后没法写入
+func chownWorkspace(dir, name string) error {
+	_, uid, gid, err := lookupUser(name)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(dir, func(p string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(p, int(uid), int(gid))
+	})
+}
+
+func lookupUser(name string) (*user.User, uint32, uint32, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return u, uint32(uid), uint32(gid), nil
+}
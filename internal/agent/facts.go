@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"net"
+	"runtime"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+// collectFacts 采集注册时上报的主机信息，平台相关的部分见 facts_linux.go
+func collectFacts() *pb.AgentFacts {
+	diskTotal, diskFree := diskUsage("/")
+	return &pb.AgentFacts{
+		Ips:         interfaceIPs(),
+		OsRelease:   osRelease(),
+		CpuCount:    int32(runtime.NumCPU()),
+		CpuModel:    cpuModel(),
+		MemoryTotal: memoryTotal(),
+		DiskTotal:   diskTotal,
+		DiskFree:    diskFree,
+		BuildCommit: Commit,
+		Container:   detectContainer(),
+		Hypervisor:  detectHypervisor(),
+	}
+}
+
+// interfaceIPs 返回所有已启用网卡上的地址，跳过回环和 IPv6 链路本地地址
+func interfaceIPs() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var ips []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+	return ips
+}
+
+// primaryIP 注册时的主 IP：优先取第一个 IPv4 地址
+func primaryIP(ips []string) string {
+	for _, ip := range ips {
+		if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil {
+			return ip
+		}
+	}
+	if len(ips) > 0 {
+		return ips[0]
+	}
+	return "127.0.0.1"
+}
@@ -0,0 +1,144 @@
+//go:build linux
+
+package agent
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// kernelVersion 读取内核版本
+func kernelVersion() string {
+	b, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// osRelease 读取 /etc/os-release 的 PRETTY_NAME，如 "Ubuntu 22.04.4 LTS"
+func osRelease() string {
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		if v := scanKeyValue(path, "PRETTY_NAME", "="); v != "" {
+			return strings.Trim(v, `"'`)
+		}
+	}
+	return ""
+}
+
+func cpuModel() string {
+	return scanKeyValue("/proc/cpuinfo", "model name", ":")
+}
+
+// memoryTotal 返回物理内存总量 (字节)
+func memoryTotal() int64 {
+	v := scanKeyValue("/proc/meminfo", "MemTotal", ":") // "16303428 kB"
+	kb, err := strconv.ParseInt(strings.TrimSuffix(v, " kB"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return kb * 1024
+}
+
+// diskUsage 返回 path 所在分区的总容量和可用容量 (字节)
+func diskUsage(path string) (total, free int64) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0
+	}
+	return int64(st.Blocks) * int64(st.Bsize), int64(st.Bavail) * int64(st.Bsize)
+}
+
+// detectContainer 识别常见的容器运行时
+func detectContainer() string {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes"
+	}
+	if fileExists("/run/.containerenv") {
+		return "podman"
+	}
+	if fileExists("/.dockerenv") {
+		return "docker"
+	}
+
+	b, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return ""
+	}
+	cgroup := string(b)
+	for _, c := range []struct{ marker, name string }{
+		{"kubepods", "kubernetes"},
+		{"docker", "docker"},
+		{"containerd", "containerd"},
+		{"libpod", "podman"},
+		{"lxc", "lxc"},
+	} {
+		if strings.Contains(cgroup, c.marker) {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// detectHypervisor 通过 DMI 信息识别虚拟化平台，识别不了但 CPU 带 hypervisor 标志时返回 "vm"
+func detectHypervisor() string {
+	var dmi strings.Builder
+	for _, path := range []string{
+		"/sys/class/dmi/id/sys_vendor",
+		"/sys/class/dmi/id/product_name",
+	} {
+		if b, err := os.ReadFile(path); err == nil {
+			dmi.Write(b)
+		}
+	}
+	vendor := strings.ToLower(dmi.String())
+	for _, h := range []struct{ marker, name string }{
+		{"kvm", "kvm"},
+		{"qemu", "qemu"},
+		{"vmware", "vmware"},
+		{"virtualbox", "virtualbox"},
+		{"xen", "xen"},
+		{"microsoft corporation", "hyperv"},
+		{"amazon ec2", "aws"},
+		{"google compute engine", "gce"},
+	} {
+		if strings.Contains(vendor, h.marker) {
+			return h.name
+		}
+	}
+
+	flags := scanKeyValue("/proc/cpuinfo", "flags", ":")
+	for _, f := range strings.Fields(flags) {
+		if f == "hypervisor" {
+			return "vm"
+		}
+	}
+	return ""
+}
+
+// scanKeyValue 在 "key<sep>value" 格式的文件里找第一个匹配 key 的值
+func scanKeyValue(path, key, sep string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // cpuinfo 的 flags 行很长
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), sep)
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
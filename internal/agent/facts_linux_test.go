@@ -0,0 +1,24 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanKeyValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpuinfo")
+	content := "processor\t: 0\nmodel name\t: Intel(R) Xeon(R)\nflags\t\t: fpu vme\nmodel name\t: second\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := scanKeyValue(path, "model name", ":"); got != "Intel(R) Xeon(R)" {
+		t.Errorf("model name = %q", got)
+	}
+	if got := scanKeyValue(path, "model", ":"); got != "" {
+		t.Errorf("partial key matched %q", got)
+	}
+	if got := scanKeyValue(filepath.Join(t.TempDir(), "missing"), "x", ":"); got != "" {
+		t.Errorf("missing file returned %q", got)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package agent
+
+// 非 Linux 平台暂不采集这些信息
+
+func kernelVersion() string { return "" }
+
+func osRelease() string { return "" }
+
+func cpuModel() string { return "" }
+
+func memoryTotal() int64 { return 0 }
+
+func diskUsage(path string) (total, free int64) { return 0, 0 }
+
+func detectContainer() string { return "" }
+
+func detectHypervisor() string { return "" }
@@ -0,0 +1,18 @@
+package agent
+
+import "testing"
+
+func TestPrimaryIP(t *testing.T) {
+	for _, c := range []struct {
+		ips  []string
+		want string
+	}{
+		{[]string{"fe80::1", "10.0.0.5", "192.168.1.2"}, "10.0.0.5"},
+		{[]string{"fe80::1", "2001:db8::1"}, "fe80::1"},
+		{nil, "127.0.0.1"},
+	} {
+		if got := primaryIP(c.ips); got != c.want {
+			t.Errorf("primaryIP(%v) = %s, want %s", c.ips, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/mq"
+)
+
+// cacheDir 输入文件缓存目录，文件名就是内容的 sha256
+func (a *Agent) cacheDir() string {
+	if a.cfg.CacheDir != "" {
+		return a.cfg.CacheDir
+	}
+	return filepath.Join(os.TempDir(), "gcc-agent", "files")
+}
+
+// stageFiles 把任务的输入文件放进工作目录：先查本地缓存，没有再从 Server 下载并校验
+func (a *Agent) stageFiles(ctx context.Context, dir string, files []*pb.InputFile) error {
+	for _, f := range files {
+		cached, err := a.cachedFile(ctx, f)
+		if err != nil {
+			return fmt.Errorf("下载 %s 失败: %w", f.FileId, err)
+		}
+		dst, err := jobFilePath(dir, f.Path)
+		if err != nil {
+			return err
+		}
+		// 复制而不是硬链接：任务改写输入文件时不能污染缓存
+		if err := copyFile(cached, dst); err != nil {
+			return fmt.Errorf("复制 %s 到工作目录失败: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// jobFilePath 输入文件在工作目录下的路径，不允许跳出工作目录
+func jobFilePath(dir, rel string) (string, error) {
+	p := filepath.Join(dir, filepath.FromSlash(rel))
+	if !strings.HasPrefix(p, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("输入文件路径 %q 不在工作目录内", rel)
+	}
+	return p, nil
+}
+
+// cachedFile 返回缓存里的文件路径，缓存没有 (或大小对不上) 时先下载
+func (a *Agent) cachedFile(ctx context.Context, f *pb.InputFile) (string, error) {
+	if len(f.Sha256) != sha256.Size*2 {
+		return "", fmt.Errorf("缺少 sha256")
+	}
+	dir := a.cacheDir()
+	p := filepath.Join(dir, strings.ToLower(f.Sha256))
+	if st, err := os.Stat(p); err == nil && st.Size() == f.Size {
+		slog.DebugContext(ctx, "输入文件命中缓存", "file_id", f.FileId, "sha256", f.Sha256)
+		return p, nil
+	}
+
+	sess := a.current.Load()
+	if sess == nil {
+		return "", errors.New("尚未连接服务器")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	// 先写临时文件，校验通过再改名，并发下载同一个文件也不会读到半截内容
+	tmp, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	stream, err := sess.client.DownloadFile(ctx, &pb.DownloadFileReq{FileId: f.FileId, AgentId: sess.agentID})
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	w := io.MultiWriter(tmp, h)
+	size := int64(0)
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			return "", err
+		}
+		size += int64(len(chunk.Data))
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, f.Sha256) || size != f.Size {
+		return "", fmt.Errorf("校验失败: 期望 %s (%d 字节)，实际 %s (%d 字节)", f.Sha256, f.Size, sum, size)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", err
+	}
+	slog.InfoContext(ctx, "输入文件已下载", "file_id", f.FileId, "size", size)
+	return p, nil
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// protoFiles MQ 消息里的输入文件转换成和 gRPC 下发相同的结构
+func protoFiles(files []mq.InputFile) []*pb.InputFile {
+	out := make([]*pb.InputFile, len(files))
+	for i, f := range files {
+		out[i] = &pb.InputFile{FileId: f.FileID, Path: f.Path, Sha256: f.SHA256, Size: f.Size}
+	}
+	return out
+}
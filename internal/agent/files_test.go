@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+)
+
+func TestJobFilePath(t *testing.T) {
+	dir := t.TempDir()
+	for rel, ok := range map[string]bool{
+		"input.txt":      true,
+		"data/a.csv":     true,
+		"data/../b.csv":  true,
+		"../escape":      false,
+		"data/../../x":   false,
+		".":              false,
+		"/etc/../passwd": true, // 拼在工作目录下，仍在目录内
+	} {
+		p, err := jobFilePath(dir, rel)
+		if ok != (err == nil) {
+			t.Errorf("jobFilePath(%q) = %q, %v; want ok=%v", rel, p, err, ok)
+		}
+	}
+}
+
+// 缓存里已有的文件 (按 sha256 命名) 直接复制到工作目录，不需要连接 Server；
+// 任务改写工作目录里的副本不影响缓存
+func TestStageFilesFromCache(t *testing.T) {
+	cache := t.TempDir()
+	a := New(config.AgentConfig{CacheDir: cache})
+	content := []byte("cached input")
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if err := os.WriteFile(filepath.Join(cache, hash), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := []*pb.InputFile{{FileId: "f1", Path: "data/in.txt", Sha256: hash, Size: int64(len(content))}}
+	if err := a.stageFiles(context.Background(), dir, files); err != nil {
+		t.Fatal(err)
+	}
+	staged := filepath.Join(dir, "data", "in.txt")
+	if got, _ := os.ReadFile(staged); string(got) != string(content) {
+		t.Fatalf("staged content = %q", got)
+	}
+	os.WriteFile(staged, []byte("changed"), 0o644)
+	if got, _ := os.ReadFile(filepath.Join(cache, hash)); string(got) != string(content) {
+		t.Errorf("cache modified through the staged copy: %q", got)
+	}
+
+	// 缓存里大小对不上、又没有连接时下载失败
+	files[0].Size++
+	if err := a.stageFiles(context.Background(), dir, files); err == nil {
+		t.Error("stale cache entry used without downloading")
+	}
+	files[0].Sha256 = ""
+	if err := a.stageFiles(context.Background(), dir, files); err == nil {
+		t.Error("file without sha256 staged")
+	}
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter 并发槽位 (信号量)，MQ 和 gRPC 两条任务路径共用一个
+// 与 chan struct{} 实现的信号量不同，它的上限可以在运行时调整
+type Limiter struct {
+	mu    sync.Mutex
+	limit int
+	used  int
+	freed chan struct{} // 有槽位释放或上限调整时关闭并换新，唤醒等待者
+}
+
+func NewLimiter(limit int) *Limiter {
+	if limit < 1 {
+		limit = 1
+	}
+	return &Limiter{limit: limit, freed: make(chan struct{})}
+}
+
+// Acquire 占用一个槽位，槽位用满时阻塞，直到有空闲或 ctx 被取消
+func (l *Limiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.used < l.limit {
+			l.used++
+			l.mu.Unlock()
+			return nil
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-freed:
+		}
+	}
+}
+
+// Release 归还一个槽位
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used--
+	l.broadcast()
+}
+
+// SetLimit 调整并发上限；调小时已占用的槽位不受影响，只是暂不再发放新槽位
+func (l *Limiter) SetLimit(limit int) {
+	if limit < 1 {
+		limit = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.broadcast()
+}
+
+// Usage 返回已占用的槽位数和上限
+func (l *Limiter) Usage() (used, limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.used, l.limit
+}
+
+func (l *Limiter) broadcast() {
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// acquireAsync 在后台 Acquire，返回的 channel 在拿到槽位 (或出错) 时收到结果
+func acquireAsync(ctx context.Context, l *Limiter) <-chan error {
+	got := make(chan error, 1)
+	go func() { got <- l.Acquire(ctx) }()
+	return got
+}
+
+func assertBlocked(t *testing.T, got <-chan error) {
+	t.Helper()
+	select {
+	case err := <-got:
+		t.Fatalf("Acquire returned %v, want it to block", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func assertAcquired(t *testing.T, got <-chan error) {
+	t.Helper()
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Fatalf("Acquire: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Acquire still blocked")
+	}
+}
+
+func TestLimiterBlocksAtLimit(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(2)
+	for range 2 {
+		if err := l.Acquire(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if used, limit := l.Usage(); used != 2 || limit != 2 {
+		t.Fatalf("Usage = %d/%d, want 2/2", used, limit)
+	}
+
+	waiting := acquireAsync(ctx, l)
+	assertBlocked(t, waiting)
+	l.Release()
+	assertAcquired(t, waiting)
+
+	// 等待中的 Acquire 可以被取消，不占用槽位
+	cctx, cancel := context.WithCancel(ctx)
+	cancelled := acquireAsync(cctx, l)
+	assertBlocked(t, cancelled)
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled Acquire err = %v", err)
+	}
+	if used, _ := l.Usage(); used != 2 {
+		t.Fatalf("used = %d after cancelled Acquire, want 2", used)
+	}
+}
+
+func TestLimiterSetLimit(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(1)
+	if err := l.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 调大上限立即唤醒等待者
+	waiting := acquireAsync(ctx, l)
+	assertBlocked(t, waiting)
+	l.SetLimit(2)
+	assertAcquired(t, waiting)
+
+	// 调小时已占用的槽位不受影响，归还到低于新上限之前不再发放
+	l.SetLimit(1)
+	if used, limit := l.Usage(); used != 2 || limit != 1 {
+		t.Fatalf("Usage = %d/%d, want 2/1", used, limit)
+	}
+	waiting = acquireAsync(ctx, l)
+	l.Release()
+	assertBlocked(t, waiting)
+	l.Release()
+	assertAcquired(t, waiting)
+
+	l.SetLimit(0)
+	if _, limit := l.Usage(); limit != 1 {
+		t.Errorf("SetLimit(0) left limit %d, want 1", limit)
+	}
+	if _, limit := NewLimiter(-3).Usage(); limit != 1 {
+		t.Errorf("NewLimiter(-3) limit = %d, want 1", limit)
+	}
+}
+
+// 并发抢占时同时持有的槽位数不超过上限
+func TestLimiterConcurrentHolders(t *testing.T) {
+	const limit, workers = 3, 20
+	l := NewLimiter(limit)
+	var holding, peak atomic.Int32
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Acquire(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			n := holding.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			holding.Add(-1)
+			l.Release()
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p > limit {
+		t.Errorf("%d slots held at once, limit %d", p, limit)
+	}
+	if used, _ := l.Usage(); used != 0 {
+		t.Errorf("used = %d after all releases", used)
+	}
+}
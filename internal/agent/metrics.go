@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/metrics"
+)
+
+// 每隔多少条心跳测量一次往返时间
+const heartbeatPingEvery = 6
+
+// serveMetrics 在 metrics_addr 上暴露 /metrics 和日志级别管理接口 /admin/log-level，直到 ctx 取消
+func (a *Agent) serveMetrics(ctx context.Context) {
+	metrics.RegisterAgent(func() float64 {
+		used, _ := a.slots.Usage()
+		return float64(used)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("/admin/log-level", logging.LevelHandler())
+	srv := &http.Server{Addr: a.cfg.MetricsAddr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("指标监听已启动", "addr", a.cfg.MetricsAddr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Error("指标监听失败", "addr", a.cfg.MetricsAddr, "err", err)
+	}
+}
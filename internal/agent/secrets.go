@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+// fetchSecrets 开始执行前向 Server 获取任务引用的秘密值，明文只保存在内存里，通过环境变量交给子进程
+func (a *Agent) fetchSecrets(ctx context.Context, job jobRun) (map[string]string, error) {
+	if len(job.SecretEnv) == 0 {
+		return nil, nil
+	}
+	sess := a.current.Load()
+	if sess == nil {
+		return nil, errors.New("尚未连接服务器")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	resp, err := sess.client.GetJobSecrets(ctx, &pb.GetJobSecretsReq{JobId: job.ID, AgentId: sess.agentID})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range job.SecretEnv {
+		if _, ok := resp.Env[name]; !ok {
+			return nil, fmt.Errorf("server 没有返回 %s", name)
+		}
+	}
+	return resp.Env, nil
+}
+
+func values(m map[string]string) []string {
+	out := make([]string, 0, len(m))
+	for _, v := range m {
+		out = append(out, v)
+	}
+	return out
+}
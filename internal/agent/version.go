@@ -0,0 +1,7 @@
+package agent
+
+// Version / Commit 构建时通过 -ldflags 注入，见 Makefile
+var (
+	Version = "dev"
+	Commit  = ""
+)
@@ -0,0 +1,187 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 工作区保留策略 (agent.workspace_keep)
+const (
+	WorkspaceKeepNone   = "none"   // 任务结束后立即删除
+	WorkspaceKeepFailed = "failed" // 保留失败和取消的任务的工作区，方便排查
+	WorkspaceKeepAll    = "all"
+)
+
+// 清理过期工作区的间隔
+const workspaceJanitorInterval = time.Hour
+
+// workspaceRoot 所有任务工作区的父目录
+func (a *Agent) workspaceRoot() string {
+	if a.cfg.WorkspaceRoot != "" {
+		return a.cfg.WorkspaceRoot
+	}
+	return filepath.Join(os.TempDir(), "gcc-agent", "jobs")
+}
+
+// newWorkspace 为任务创建独立的临时工作区 (权限 0700，其他用户看不到)
+func (a *Agent) newWorkspace(jobID string) (string, error) {
+	root := a.workspaceRoot()
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return "", err
+	}
+	prefix := "job-"
+	if jobID != "" && !strings.ContainsAny(jobID, `/\`) {
+		prefix = jobID + "-"
+	}
+	return os.MkdirTemp(root, prefix)
+}
+
+// releaseWorkspace 任务结束后按保留策略删除或保留工作区，保留的由 cleanWorkspaces 到期删除
+func (a *Agent) releaseWorkspace(dir, status string) {
+	keep := false
+	switch a.cfg.WorkspaceKeep {
+	case WorkspaceKeepAll:
+		keep = true
+	case WorkspaceKeepFailed:
+		keep = status != StatusSuccess
+	}
+	if keep {
+		// 保留期从任务结束时算起
+		now := time.Now()
+		os.Chtimes(dir, now, now)
+		slog.Info("保留工作区", "dir", dir, "status", status)
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		slog.Warn("删除工作区失败", "dir", dir, "err", err)
+	}
+}
+
+// cleanWorkspaces 删除超过保留期的工作区；Agent 异常退出留下的工作区也在这里清理
+func (a *Agent) cleanWorkspaces() {
+	retention := a.cfg.WorkspaceRetention
+	if retention <= 0 {
+		retention = 24 * time.Hour
+	}
+	root := a.workspaceRoot()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		p := filepath.Join(root, e.Name())
+		if _, running := a.jobs.Load(jobIDOfWorkspace(e.Name())); running {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < retention {
+			continue
+		}
+		if err := os.RemoveAll(p); err != nil {
+			slog.Warn("删除过期工作区失败", "dir", p, "err", err)
+			continue
+		}
+		slog.Debug("已删除过期工作区", "dir", p)
+	}
+}
+
+// jobIDOfWorkspace 工作区目录名是 "<jobID>-<随机数>"
+func jobIDOfWorkspace(name string) string {
+	if i := strings.LastIndexByte(name, '-'); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// workspaceJanitor 定期清理过期工作区，直到 ctx 取消
+func (a *Agent) workspaceJanitor(ctx context.Context) {
+	a.cleanWorkspaces()
+	ticker := time.NewTicker(workspaceJanitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.cleanWorkspaces()
+		}
+	}
+}
+
+// jobDir 命令的执行目录：默认就是工作区，workdir 为相对路径时在工作区内创建
+func jobDir(workspace, workdir string) (string, error) {
+	if workdir == "" {
+		return workspace, nil
+	}
+	if filepath.IsAbs(workdir) {
+		return workdir, nil
+	}
+	dir, err := jobFilePath(workspace, workdir)
+	if err != nil {
+		return "", fmt.Errorf("workdir %q 不在工作区内", workdir)
+	}
+	return dir, os.MkdirAll(dir, 0o755)
+}
+
+// scrubEnvPatterns 不能传给任务的 Agent 环境变量：Agent 自己的配置 (GCC_*，含数据库、MQ 密码)
+// 和常见的凭据变量。任务需要的变量应当在提交任务时通过 env 显式传入
+var scrubEnvPatterns = []string{
+	"GCC_*",
+	"*PASSWORD*", "*PASSWD*", "*SECRET*", "*TOKEN*",
+	"*CREDENTIAL*", "*PRIVATE_KEY*", "*ACCESS_KEY*", "*API_KEY*",
+}
+
+// jobEnv 任务的环境变量：去掉敏感变量的 Agent 环境 + 任务指定的变量和秘密 + Agent 注入的标准变量
+func (a *Agent) jobEnv(job jobRun, workspace string, secretEnv map[string]string) []string {
+	patterns := append(scrubEnvPatterns[:len(scrubEnvPatterns):len(scrubEnvPatterns)], a.cfg.ScrubEnv...)
+
+	env := make([]string, 0, len(os.Environ())+len(job.Env)+len(secretEnv)+4)
+	for _, kv := range os.Environ() {
+		k, _, _ := strings.Cut(kv, "=")
+		if !scrubbed(k, patterns) {
+			env = append(env, kv)
+		}
+	}
+	for k, v := range job.Env {
+		env = append(env, k+"="+v)
+	}
+	for k, v := range secretEnv {
+		env = append(env, k+"="+v)
+	}
+
+	agentID := ""
+	if sess := a.current.Load(); sess != nil {
+		agentID = sess.agentID
+	}
+	attempt := job.Attempt
+	if attempt <= 0 {
+		attempt = 1
+	}
+	// 标准变量放在最后，同名时后面的生效
+	return append(env,
+		"JOB_ID="+job.ID,
+		"ATTEMPT="+strconv.Itoa(int(attempt)),
+		"AGENT_ID="+agentID,
+		"WORKSPACE="+workspace,
+	)
+}
+
+func scrubbed(name string, patterns []string) bool {
+	name = strings.ToUpper(name)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+)
+
+func TestJobDir(t *testing.T) {
+	ws := t.TempDir()
+	for workdir, want := range map[string]string{
+		"":          ws,
+		"build/out": filepath.Join(ws, "build", "out"),
+		"/srv/app":  "/srv/app", // 绝对路径原样使用，不创建
+	} {
+		got, err := jobDir(ws, workdir)
+		if err != nil || got != want {
+			t.Errorf("jobDir(%q) = %q, %v; want %q", workdir, got, err, want)
+		}
+	}
+	if st, err := os.Stat(filepath.Join(ws, "build", "out")); err != nil || !st.IsDir() {
+		t.Errorf("relative workdir not created: %v", err)
+	}
+	if _, err := jobDir(ws, "../other"); err == nil {
+		t.Error("workdir outside the workspace accepted")
+	}
+}
+
+func TestScrubbed(t *testing.T) {
+	patterns := append(slices.Clone(scrubEnvPatterns), "INTERNAL_*")
+	for name, want := range map[string]bool{
+		"GCC_DATABASE_DSN":      true,
+		"gcc_rabbitmq_password": true,
+		"DB_PASSWORD":           true,
+		"GITHUB_TOKEN":          true,
+		"AWS_SECRET_ACCESS_KEY": true,
+		"AWS_ACCESS_KEY_ID":     true,
+		"OPENAI_API_KEY":        true,
+		"INTERNAL_URL":          true,
+		"PATH":                  false,
+		"HOME":                  false,
+		"MY_GCC_VAR":            false,
+	} {
+		if got := scrubbed(name, patterns); got != want {
+			t.Errorf("scrubbed(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestJobEnv(t *testing.T) {
+	t.Setenv("GCC_DATABASE_PASSWORD", "db-secret")
+	t.Setenv("DEPLOY_TOKEN", "tok")
+	t.Setenv("SITE_URL", "internal")
+	t.Setenv("KEEP_ME", "1")
+	a := New(config.AgentConfig{ScrubEnv: []string{"SITE_*"}})
+
+	env := a.jobEnv(jobRun{ID: "j1", Env: map[string]string{"MODE": "fast"}}, "/tmp/ws", map[string]string{"DB_PASSWORD": "injected"})
+	lookup := func(k string) (string, bool) {
+		// 同名变量后面的生效
+		val, found := "", false
+		for _, kv := range env {
+			if name, v, _ := strings.Cut(kv, "="); name == k {
+				val, found = v, true
+			}
+		}
+		return val, found
+	}
+	for _, k := range []string{"GCC_DATABASE_PASSWORD", "DEPLOY_TOKEN", "SITE_URL"} {
+		if _, ok := lookup(k); ok {
+			t.Errorf("%s leaked into the job environment", k)
+		}
+	}
+	for k, want := range map[string]string{
+		"KEEP_ME":     "1",
+		"MODE":        "fast",
+		"DB_PASSWORD": "injected", // 任务显式要求的秘密不受过滤影响
+		"JOB_ID":      "j1",
+		"ATTEMPT":     "1",
+		"AGENT_ID":    "",
+		"WORKSPACE":   "/tmp/ws",
+	} {
+		if got, ok := lookup(k); !ok || got != want {
+			t.Errorf("%s = %q (set %v), want %q", k, got, ok, want)
+		}
+	}
+}
+
+func TestReleaseWorkspace(t *testing.T) {
+	for keep, kept := range map[string][]string{
+		WorkspaceKeepNone:   nil,
+		"":                  nil,
+		WorkspaceKeepFailed: {StatusFailed, StatusCancelled},
+		WorkspaceKeepAll:    {StatusSuccess, StatusFailed, StatusCancelled},
+	} {
+		a := New(config.AgentConfig{WorkspaceRoot: t.TempDir(), WorkspaceKeep: keep})
+		for _, status := range []string{StatusSuccess, StatusFailed, StatusCancelled} {
+			dir, err := a.newWorkspace("job-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.releaseWorkspace(dir, status)
+			_, err = os.Stat(dir)
+			if exists := err == nil; exists != slices.Contains(kept, status) {
+				t.Errorf("keep=%q, %s: workspace exists = %v", keep, status, exists)
+			}
+		}
+	}
+}
+
+// 过期的工作区被清理，正在执行的任务和保留期内的工作区不动
+func TestCleanWorkspaces(t *testing.T) {
+	root := t.TempDir()
+	a := New(config.AgentConfig{WorkspaceRoot: root, WorkspaceRetention: time.Hour})
+	old := time.Now().Add(-2 * time.Hour)
+	mkdir := func(name string, mtime time.Time) string {
+		p := filepath.Join(root, name)
+		if err := os.Mkdir(p, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, mtime, mtime)
+		return p
+	}
+	expired := mkdir("job-a-123", old)
+	running := mkdir("job-b-456", old)
+	fresh := mkdir("job-c-789", time.Now())
+	a.jobs.Store("job-b", func() {})
+
+	a.cleanWorkspaces()
+	for p, want := range map[string]bool{expired: false, running: true, fresh: true} {
+		if _, err := os.Stat(p); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(p), err == nil, want)
+		}
+	}
+	if got := jobIDOfWorkspace("job-b-456"); got != "job-b" {
+		t.Errorf("jobIDOfWorkspace = %q", got)
+	}
+}
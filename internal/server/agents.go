@@ -0,0 +1,345 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AgentStatusOffline 不落库，心跳超时的节点在接口里展示为 Offline
+const AgentStatusOffline = "Offline"
+
+// 节点详情里展示的最近任务条数
+const recentJobLimit = 20
+
+// agentView 是节点接口的返回结构
+type agentView struct {
+	AgentID       string     `json:"agent_id"`
+	Hostname      string     `json:"hostname"`
+	IP            string     `json:"ip"`
+	Status        string     `json:"status"`
+	Drain         bool       `json:"drain"`
+	Tags          []string   `json:"tags"`
+	OS            string     `json:"os,omitempty"`
+	Arch          string     `json:"arch,omitempty"`
+	Kernel        string     `json:"kernel,omitempty"`
+	AgentVersion  string     `json:"agent_version,omitempty"`
+	Capabilities  []string   `json:"capabilities"`
+	Facts         agentFacts `json:"facts"`
+	RunningJobs   int        `json:"running_jobs"`
+	MaxJobs       int        `json:"max_jobs"`
+	ConfigVersion string     `json:"config_version,omitempty"` // Agent 当前生效的配置版本
+	LastSeenAt    *time.Time `json:"last_seen_at,omitempty"`
+	RegisteredAt  time.Time  `json:"registered_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// agentFacts Agent 自动采集的主机信息
+type agentFacts struct {
+	IPs         []string `json:"ips"`
+	OSRelease   string   `json:"os_release,omitempty"`
+	CPUCount    int      `json:"cpu_count"`
+	CPUModel    string   `json:"cpu_model,omitempty"`
+	MemoryTotal int64    `json:"memory_total"`
+	DiskTotal   int64    `json:"disk_total"`
+	DiskFree    int64    `json:"disk_free"`
+	BuildCommit string   `json:"build_commit,omitempty"`
+	Container   string   `json:"container,omitempty"`
+	Hypervisor  string   `json:"hypervisor,omitempty"`
+}
+
+func (s *HttpServer) newAgentView(a AgentModel) agentView {
+	return agentView{
+		AgentID:      a.AgentID,
+		Hostname:     a.Hostname,
+		IP:           a.IP,
+		Status:       s.agentStatus(a),
+		Drain:        a.Drain,
+		Tags:         splitList(a.Tags),
+		OS:           a.OS,
+		Arch:         a.Arch,
+		Kernel:       a.Kernel,
+		AgentVersion: a.AgentVersion,
+		Capabilities: splitList(a.Capabilities),
+		Facts: agentFacts{
+			IPs:         splitList(a.IPs),
+			OSRelease:   a.OSRelease,
+			CPUCount:    a.CPUCount,
+			CPUModel:    a.CPUModel,
+			MemoryTotal: a.MemoryTotal,
+			DiskTotal:   a.DiskTotal,
+			DiskFree:    a.DiskFree,
+			BuildCommit: a.BuildCommit,
+			Container:   a.Container,
+			Hypervisor:  a.Hypervisor,
+		},
+		RunningJobs:   a.RunningJobs,
+		MaxJobs:       a.MaxJobs,
+		ConfigVersion: a.ConfigVersion,
+		LastSeenAt:    a.LastSeenAt,
+		RegisteredAt:  a.CreatedAt,
+		UpdatedAt:     a.UpdatedAt,
+	}
+}
+
+// agentStatus 心跳超时的节点展示为 Offline，其余使用库里的状态
+func (s *HttpServer) agentStatus(a AgentModel) string {
+	if a.LastSeenAt == nil || a.LastSeenAt.Before(s.offlineCutoff()) {
+		return AgentStatusOffline
+	}
+	return a.Status
+}
+
+func (s *HttpServer) offlineCutoff() time.Time {
+	after := s.AgentOfflineAfter
+	if after <= 0 {
+		after = 30 * time.Second
+	}
+	return time.Now().Add(-after)
+}
+
+// handleListAgents 节点列表
+// 支持过滤：status=Online|Draining|Drained|Offline、tag=gpu、
+// seen_within=10m (最近 10 分钟有心跳)、not_seen_within=1h (超过 1 小时没有心跳)
+func (s *HttpServer) handleListAgents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var query AgentQuery
+
+	if status := q.Get("status"); status != "" {
+		cutoff := s.offlineCutoff()
+		if status == AgentStatusOffline {
+			query.UnseenSince = cutoff
+		} else {
+			query.Status, query.SeenSince = status, cutoff
+		}
+	}
+	query.Tag = strings.TrimSpace(q.Get("tag"))
+	if v := q.Get("seen_within"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Bad Request: seen_within 格式错误，示例: 10m、1h", http.StatusBadRequest)
+			return
+		}
+		// 和 status 同时指定时两个条件都要满足，取更近的时间
+		if t := time.Now().Add(-d); t.After(query.SeenSince) {
+			query.SeenSince = t
+		}
+	}
+	if v := q.Get("not_seen_within"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Bad Request: not_seen_within 格式错误，示例: 10m、1h", http.StatusBadRequest)
+			return
+		}
+		if t := time.Now().Add(-d); query.UnseenSince.IsZero() || t.Before(query.UnseenSince) {
+			query.UnseenSince = t
+		}
+	}
+
+	agents, err := s.Store.ListAgents(r.Context(), query)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	views := make([]agentView, len(agents))
+	for i, a := range agents {
+		views[i] = s.newAgentView(a)
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleGetAgent 节点详情：注册信息 + 正在执行的任务 + 待执行的定向任务 + 最近的任务历史
+func (s *HttpServer) handleGetAgent(w http.ResponseWriter, r *http.Request) {
+	agent, ok := s.findAgent(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	running, err := s.Store.ListJobs(ctx, JobQuery{
+		AgentID:  agent.AgentID,
+		Statuses: []string{JobStatusRunning},
+		Order:    "started_at",
+	})
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	queued, err := s.Store.ListJobs(ctx, JobQuery{
+		AgentID:  agent.AgentID,
+		Statuses: []string{JobStatusAssigned, JobStatusAccepted},
+		Limit:    recentJobLimit,
+	})
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	recent, err := s.Store.ListJobs(ctx, JobQuery{
+		AgentID:         agent.AgentID,
+		ExcludeStatuses: []string{JobStatusRunning, JobStatusAssigned, JobStatusAccepted},
+		Order:           "updated_at DESC",
+		Limit:           recentJobLimit,
+	})
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		agentView
+		CurrentJobs []jobView       `json:"current_jobs"`
+		QueuedJobs  []jobView       `json:"queued_jobs"` // 定向派发队列里还没开始执行的任务
+		RecentJobs  []jobView       `json:"recent_jobs"`
+		RPC         []rpcMethodView `json:"rpc"` // 按方法统计的 gRPC 调用，Server 重启后清零
+	}{
+		agentView:   s.newAgentView(agent),
+		CurrentJobs: newJobViews(running),
+		QueuedJobs:  newJobViews(queued),
+		RecentJobs:  newJobViews(recent),
+		RPC:         s.Srv.rpcStats.snapshot(agent.AgentID),
+	})
+}
+
+// handleDeleteAgent 下线节点 (软删除)
+// 仍在线的节点需要带 ?force=true，否则它下一次重连注册时会被重新加回来
+func (s *HttpServer) handleDeleteAgent(w http.ResponseWriter, r *http.Request) {
+	agent, ok := s.findAgent(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	if s.agentStatus(agent) != AgentStatusOffline && r.URL.Query().Get("force") != "true" {
+		http.Error(w, "Agent is still online, stop it first or use ?force=true", http.StatusConflict)
+		return
+	}
+
+	// 还没下发的定向任务没有机会执行了，一并取消
+	cancelled, err := s.Store.DecommissionAgent(r.Context(), agent, "cancelled: agent decommissioned")
+	for _, job := range cancelled {
+		s.Srv.onJobFinished(jobLogContext(r.Context(), job), job)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "下线节点失败", "agent_id", agent.AgentID, "err", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.Srv.rpcStats.forget(agent.AgentID)
+	slog.InfoContext(r.Context(), "节点已下线", "agent_id", agent.AgentID)
+	s.Srv.Events.Publish(r.Context(), EventAgentDeleted, "agent:"+agent.AgentID, newAgentEvent(agent))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDrainAgent 让节点进入维护模式：停止消费 MQ、停止接收下发任务，等在途任务跑完
+// 指令经心跳流立即推送，Agent 清空在途任务后状态变为 Drained
+func (s *HttpServer) handleDrainAgent(w http.ResponseWriter, r *http.Request) {
+	s.setAgentDrain(w, r, true)
+}
+
+// handleUndrainAgent 退出维护模式，恢复接收任务
+func (s *HttpServer) handleUndrainAgent(w http.ResponseWriter, r *http.Request) {
+	s.setAgentDrain(w, r, false)
+}
+
+func (s *HttpServer) setAgentDrain(w http.ResponseWriter, r *http.Request, drain bool) {
+	agent, ok := s.findAgent(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	status := AgentStatusOnline
+	if drain {
+		status = AgentStatusDraining
+	}
+	err := s.Store.UpdateAgent(r.Context(), agent.ID, map[string]interface{}{
+		"drain":  drain,
+		"status": status,
+	})
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	agent.Drain, agent.Status = drain, status
+	s.Srv.Kick(agent.AgentID)
+
+	if drain {
+		slog.InfoContext(r.Context(), "节点进入维护模式", "agent_id", agent.AgentID)
+	} else {
+		slog.InfoContext(r.Context(), "节点退出维护模式", "agent_id", agent.AgentID)
+	}
+	writeJSON(w, http.StatusOK, s.newAgentView(agent))
+}
+
+// findAgent 按 ID 查询节点，查不到时直接写好错误响应
+func (s *HttpServer) findAgent(w http.ResponseWriter, r *http.Request, agentID string) (AgentModel, bool) {
+	agent, err := s.Store.GetAgent(r.Context(), agentID, false)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return agent, false
+	}
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return agent, false
+	}
+	return agent, true
+}
+
+// AgentWatcher 定时扫描心跳超时的节点，每个节点失联时发出一次 agent.lost 事件
+// 判定条件和接口里的 Offline 一致；恢复心跳后 lost_at 被清空，下次失联会再发
+type AgentWatcher struct {
+	Srv          *SentinelServer
+	OfflineAfter time.Duration
+	Interval     time.Duration
+}
+
+// Run 阻塞运行，直到 ctx 被取消
+func (a *AgentWatcher) Run(ctx context.Context) {
+	interval := a.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	slog.Info("节点失联检测已启动", "interval", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("节点失联检测已停止")
+			return
+		case <-ticker.C:
+			a.markLost(ctx)
+		}
+	}
+}
+
+func (a *AgentWatcher) markLost(ctx context.Context) {
+	after := a.OfflineAfter
+	if after <= 0 {
+		after = 30 * time.Second
+	}
+	store := a.Srv.Store
+	cutoff := time.Now().Add(-after)
+	agents, err := store.ListAgents(ctx, AgentQuery{UnseenSince: cutoff, NotLost: true, Limit: 100})
+	if err != nil {
+		slog.Error("查询失联节点失败", "err", err)
+		return
+	}
+	for _, agent := range agents {
+		// 条件更新：多个 Server 实例同时扫描、或者节点刚好恢复心跳时，只有一方生效
+		now := time.Now()
+		marked, err := store.MarkAgentLost(ctx, agent.ID, cutoff, now)
+		if err != nil || !marked {
+			continue
+		}
+		slog.WarnContext(ctx, "节点失联", "agent_id", agent.AgentID, "last_seen_at", agent.LastSeenAt)
+		agent.LostAt = &now
+		a.Srv.Events.Publish(ctx, EventAgentLost, "agent:"+agent.AgentID, newAgentEvent(agent))
+	}
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+func setDrain(t *testing.T, h *HttpServer, agentID string, drain bool) {
+	t.Helper()
+	action, handle := "drain", h.handleDrainAgent
+	if !drain {
+		action, handle = "undrain", h.handleUndrainAgent
+	}
+	r := httptest.NewRequest(http.MethodPost, "/agents/"+agentID+"/"+action, nil)
+	r.SetPathValue("id", agentID)
+	w := httptest.NewRecorder()
+	handle(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: status %d: %s", action, w.Code, w.Body)
+	}
+}
+
+func waitAgentStatus(t *testing.T, store Store, agentID, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		agent, err := store.GetAgent(context.Background(), agentID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if agent.Status == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("agent status = %s, want %s", agent.Status, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 维护模式：drain 指令立即推送，期间不下发任务；Agent 上报清空后变为 Drained，undrain 后恢复派发
+func TestDrainStopsDispatch(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormStore(db)
+	s := &SentinelServer{Store: store}
+	h := &HttpServer{Store: store, Srv: s}
+	ctx := context.Background()
+	if err := store.CreateAgent(ctx, &AgentModel{AgentID: "n1", Status: AgentStatusOnline}); err != nil {
+		t.Fatal(err)
+	}
+	st, _ := connect(t, s, "n1")
+
+	setDrain(t, h, "n1", true)
+	waitAgentStatus(t, store, "n1", AgentStatusDraining)
+	select {
+	case resp := <-st.sent:
+		if !resp.Drain {
+			t.Fatalf("first message after drain = %v, want drain", resp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain not pushed to the agent")
+	}
+
+	if err := store.CreateJob(ctx, &JobRecord{JobID: "j1", AgentID: "n1", Status: JobStatusAssigned}); err != nil {
+		t.Fatal(err)
+	}
+	s.Kick("n1")
+	st.reqs <- &pb.HeartbeatReq{AgentId: "n1", Seq: 2, MaxJobs: 4, State: agentStateDrained}
+	waitAgentStatus(t, store, "n1", AgentStatusDrained)
+	for len(st.sent) > 0 {
+		if resp := <-st.sent; resp.Job != nil || !resp.Drain {
+			t.Fatalf("draining agent received %v", resp)
+		}
+	}
+
+	setDrain(t, h, "n1", false)
+	waitAgentStatus(t, store, "n1", AgentStatusOnline)
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case resp := <-st.sent:
+			if resp.Drain {
+				t.Fatalf("message after undrain still has drain set: %v", resp)
+			}
+			if resp.Job != nil {
+				if resp.Job.JobId != "j1" {
+					t.Fatalf("received job %s, want j1", resp.Job.JobId)
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatal("queued job not dispatched after undrain")
+		}
+	}
+}
+
+func TestListAgentsEndpoint(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	h := &HttpServer{Store: store, Srv: &SentinelServer{Store: store}, AgentOfflineAfter: time.Minute}
+	ctx := context.Background()
+	now, hourAgo := time.Now(), time.Now().Add(-time.Hour)
+	for _, a := range []AgentModel{
+		{AgentID: "online", Status: AgentStatusOnline, Tags: joinTags([]string{"gpu"}), LastSeenAt: &now},
+		{AgentID: "stale", Status: AgentStatusOnline, LastSeenAt: &hourAgo},
+		{AgentID: "drained", Status: AgentStatusDrained, Drain: true, LastSeenAt: &now},
+		{AgentID: "never", Status: AgentStatusOnline},
+	} {
+		if err := store.CreateAgent(ctx, &a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(query string) ([]agentView, int) {
+		w := httptest.NewRecorder()
+		h.handleListAgents(w, httptest.NewRequest(http.MethodGet, "/agents?"+query, nil))
+		var views []agentView
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &views); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return views, w.Code
+	}
+	ids := func(views []agentView) []string {
+		out := make([]string, len(views))
+		for i, v := range views {
+			out[i] = v.AgentID
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	for query, want := range map[string][]string{
+		"":                                  {"drained", "never", "online", "stale"},
+		"status=Online":                     {"online"},
+		"status=Offline":                    {"never", "stale"},
+		"status=Drained":                    {"drained"},
+		"tag=gpu":                           {"online"},
+		"seen_within=10m":                   {"drained", "online"},
+		"not_seen_within=10m":               {"never", "stale"},
+		"status=Offline&not_seen_within=2h": {"never"},
+	} {
+		views, code := list(query)
+		if code != http.StatusOK {
+			t.Errorf("%q: status %d", query, code)
+			continue
+		}
+		if got := ids(views); !slices.Equal(got, want) {
+			t.Errorf("%q: %v, want %v", query, got, want)
+		}
+	}
+
+	// 心跳超时的节点展示为 Offline，不管库里的状态
+	views, _ := list("")
+	for _, v := range views {
+		if offline := v.AgentID == "stale" || v.AgentID == "never"; offline != (v.Status == AgentStatusOffline) {
+			t.Errorf("%s shown as %s", v.AgentID, v.Status)
+		}
+	}
+	for _, query := range []string{"seen_within=soon", "not_seen_within=-1h"} {
+		if _, code := list(query); code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want 400", query, code)
+		}
+	}
+}
+
+func TestGetAgentDetail(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	h := &HttpServer{Store: store, Srv: &SentinelServer{Store: store}}
+	ctx := context.Background()
+	now := time.Now()
+	if err := store.CreateAgent(ctx, &AgentModel{AgentID: "n1", Status: AgentStatusOnline, LastSeenAt: &now}); err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range []JobRecord{
+		{JobID: "running", AgentID: "n1", Status: JobStatusRunning},
+		{JobID: "assigned", AgentID: "n1", Status: JobStatusAssigned},
+		{JobID: "done", AgentID: "n1", Status: JobStatusSuccess},
+		{JobID: "other", AgentID: "n2", Status: JobStatusRunning},
+	} {
+		if err := store.CreateJob(ctx, &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/agents/n1", nil)
+	r.SetPathValue("id", "n1")
+	w := httptest.NewRecorder()
+	h.handleGetAgent(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var detail struct {
+		AgentID     string    `json:"agent_id"`
+		CurrentJobs []jobView `json:"current_jobs"`
+		QueuedJobs  []jobView `json:"queued_jobs"`
+		RecentJobs  []jobView `json:"recent_jobs"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &detail); err != nil {
+		t.Fatal(err)
+	}
+	jobIDs := func(views []jobView) []string {
+		var out []string
+		for _, v := range views {
+			out = append(out, v.JobID)
+		}
+		return out
+	}
+	if detail.AgentID != "n1" || !slices.Equal(jobIDs(detail.CurrentJobs), []string{"running"}) ||
+		!slices.Equal(jobIDs(detail.QueuedJobs), []string{"assigned"}) || !slices.Equal(jobIDs(detail.RecentJobs), []string{"done"}) {
+		t.Errorf("detail = %+v", detail)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/agents/missing", nil)
+	r.SetPathValue("id", "missing")
+	w = httptest.NewRecorder()
+	h.handleGetAgent(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("missing agent: status %d, want 404", w.Code)
+	}
+}
+
+// 下线在线节点要带 force；下线后还没下发的定向任务被取消
+func TestDeleteAgent(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	h := &HttpServer{Store: store, Srv: &SentinelServer{Store: store}}
+	ctx := context.Background()
+	now := time.Now()
+	if err := store.CreateAgent(ctx, &AgentModel{AgentID: "n1", Status: AgentStatusOnline, LastSeenAt: &now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateJob(ctx, &JobRecord{JobID: "j1", AgentID: "n1", Status: JobStatusAssigned}); err != nil {
+		t.Fatal(err)
+	}
+
+	del := func(target string) int {
+		r := httptest.NewRequest(http.MethodDelete, target, nil)
+		r.SetPathValue("id", "n1")
+		w := httptest.NewRecorder()
+		h.handleDeleteAgent(w, r)
+		return w.Code
+	}
+	if code := del("/agents/n1"); code != http.StatusConflict {
+		t.Fatalf("online agent without force: status %d, want 409", code)
+	}
+	if code := del("/agents/n1?force=true"); code != http.StatusNoContent {
+		t.Fatalf("force delete: status %d, want 204", code)
+	}
+	if _, err := store.GetAgent(ctx, "n1", false); err == nil {
+		t.Error("agent still listed after delete")
+	}
+	job, err := store.GetJob(ctx, "j1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusCancelled {
+		t.Errorf("queued job = %s, want Cancelled", job.Status)
+	}
+	if code := del("/agents/n1?force=true"); code != http.StatusNotFound {
+		t.Errorf("second delete: status %d, want 404", code)
+	}
+}
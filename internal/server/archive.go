@@ -0,0 +1,252 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/metrics"
+)
+
+// 归档文件格式：每个任务的输出单独压缩成一个 gzip 成员，顺序追加到同一个文件里。
+// 整个文件仍然是合法的 gzip 流 (zcat 得到 JSON lines)，按任务记录上的偏移量又可以只解压一个成员。
+
+// archiveBatchSize 一个归档文件最多放多少个任务
+const archiveBatchSize = 500
+
+// ResultArchiver 按保留策略把旧任务的输出从数据库移到 Root/results 下的压缩归档文件里
+type ResultArchiver struct {
+	Store    Store
+	Root     string // storage_path
+	Interval time.Duration
+	Rules    []config.RetentionRule
+}
+
+// archivedResult 归档文件里的一行
+type archivedResult struct {
+	JobID  string `json:"job_id"`
+	Result string `json:"result"`
+}
+
+func NewResultArchiver(store Store, root string, cfg config.ResultRetentionConfig) *ResultArchiver {
+	if root == "" {
+		root = "./uploads"
+	}
+	return &ResultArchiver{Store: store, Root: root, Interval: cfg.Interval, Rules: cfg.Rules}
+}
+
+// Run 阻塞运行，直到 ctx 被取消；没有配置规则时直接返回
+func (a *ResultArchiver) Run(ctx context.Context) {
+	if len(a.Rules) == 0 {
+		return
+	}
+	interval := a.Interval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	slog.Info("任务输出归档协程已启动", "interval", interval, "rules", len(a.Rules))
+	for {
+		a.compact(ctx)
+		select {
+		case <-ctx.Done():
+			slog.Info("任务输出归档协程已停止")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ruleFor 任务类型对应的规则：先找同名规则，再用 "*"
+func (a *ResultArchiver) ruleFor(typ string) *config.RetentionRule {
+	var fallback *config.RetentionRule
+	for i := range a.Rules {
+		r := &a.Rules[i]
+		if r.Type == "*" {
+			fallback = r
+		} else if strings.EqualFold(r.Type, typ) {
+			return r
+		}
+	}
+	return fallback
+}
+
+// compact 归档所有超出保留范围的任务输出
+func (a *ResultArchiver) compact(ctx context.Context) {
+	types, err := a.Store.ArchivableTypes(ctx)
+	if err != nil {
+		slog.Error("查询待归档的任务类型失败", "err", err)
+		return
+	}
+	for _, typ := range types {
+		rule := a.ruleFor(typ)
+		if rule == nil || (rule.KeepDays <= 0 && rule.KeepLast <= 0) {
+			continue
+		}
+		n, err := a.compactType(ctx, typ, *rule)
+		if n > 0 {
+			slog.Info("任务输出已归档", "type", typ, "count", n)
+		}
+		if err != nil {
+			slog.Error("归档任务输出失败", "type", typ, "err", err)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// compactType 归档一种任务类型，返回归档的任务数
+func (a *ResultArchiver) compactType(ctx context.Context, typ string, rule config.RetentionRule) (int, error) {
+	q := ArchiveQuery{Type: typ, KeepLast: rule.KeepLast}
+	if rule.KeepDays > 0 {
+		q.Before = time.Now().AddDate(0, 0, -rule.KeepDays)
+	}
+
+	total := 0
+	var lastID uint
+	for ctx.Err() == nil {
+		jobs, err := a.Store.ArchiveCandidates(ctx, q, lastID, archiveBatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(jobs) == 0 {
+			break
+		}
+		lastID = jobs[len(jobs)-1].ID
+		n, err := a.archive(ctx, jobs)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if len(jobs) < archiveBatchSize {
+			break
+		}
+	}
+	return total, nil
+}
+
+// archive 把一批任务的输出写进一个新的归档文件，再清空数据库里的输出
+// 文件先落盘再改数据库：中途失败最多留下一个没人引用的归档文件，不会丢输出
+func (a *ResultArchiver) archive(ctx context.Context, jobs []JobRecord) (int, error) {
+	name, spans, err := a.writeArchive(jobs)
+	if err != nil {
+		return 0, err
+	}
+
+	done, err := a.Store.MarkArchived(ctx, name, jobs, spans, time.Now())
+	if err != nil {
+		os.Remove(filepath.Join(a.Root, filepath.FromSlash(name)))
+		return 0, err
+	}
+	for _, job := range done {
+		metrics.ResultsArchived.WithLabelValues(metricType(job.Type)).Inc()
+		metrics.ResultsArchivedBytes.Add(float64(len(job.Result)))
+	}
+	slog.Debug("已写入归档文件", "file", name, "jobs", len(done))
+	return len(done), nil
+}
+
+// archiveSpan 一个任务的输出在归档文件里的位置
+type archiveSpan struct {
+	offset int64
+	size   int64
+}
+
+// writeArchive 写一个归档文件，返回相对 Root 的路径和每个任务的位置
+func (a *ResultArchiver) writeArchive(jobs []JobRecord) (string, []archiveSpan, error) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	name := path.Join("results", time.Now().Format("2006/01/02"), "arc-"+hex.EncodeToString(b)+".jsonl.gz")
+	p := filepath.Join(a.Root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".archive-*")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.Remove(tmp.Name()) // 改名成功后这里删不到任何东西
+
+	bw := bufio.NewWriter(tmp)
+	w := &countingWriter{w: bw}
+	spans := make([]archiveSpan, len(jobs))
+	for i, job := range jobs {
+		start := w.n
+		zw := gzip.NewWriter(w)
+		if err := json.NewEncoder(zw).Encode(archivedResult{JobID: job.JobID, Result: job.Result}); err != nil {
+			tmp.Close()
+			return "", nil, err
+		}
+		if err := zw.Close(); err != nil {
+			tmp.Close()
+			return "", nil, err
+		}
+		spans[i] = archiveSpan{offset: start, size: w.n - start}
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return "", nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", nil, err
+	}
+	return name, spans, os.Rename(tmp.Name(), p)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Load 从归档文件读取任务的输出
+func (a *ResultArchiver) Load(record JobRecord) (string, error) {
+	if record.ArchiveFile == "" {
+		return "", errors.New("job result is not archived")
+	}
+	f, err := os.Open(filepath.Join(a.Root, filepath.FromSlash(record.ArchiveFile)))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(io.NewSectionReader(f, record.ArchiveOffset, record.ArchiveSize))
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	var line archivedResult
+	if err := json.NewDecoder(zr).Decode(&line); err != nil {
+		return "", err
+	}
+	if line.JobID != record.JobID {
+		return "", fmt.Errorf("archive %s at offset %d holds job %s", record.ArchiveFile, record.ArchiveOffset, line.JobID)
+	}
+	return line.Result, nil
+}
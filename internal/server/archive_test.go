@@ -0,0 +1,203 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+)
+
+func TestRetentionRuleFor(t *testing.T) {
+	a := &ResultArchiver{Rules: []config.RetentionRule{
+		{Type: "*", KeepDays: 30},
+		{Type: "SCAN", KeepLast: 10},
+	}}
+	if r := a.ruleFor("scan"); r == nil || r.KeepLast != 10 {
+		t.Errorf("scan rule = %+v, want the scan rule (case-insensitive)", r)
+	}
+	if r := a.ruleFor("shell"); r == nil || r.KeepDays != 30 {
+		t.Errorf("shell rule = %+v, want the * rule", r)
+	}
+	if r := (&ResultArchiver{Rules: []config.RetentionRule{{Type: "scan"}}}).ruleFor("shell"); r != nil {
+		t.Errorf("rule without fallback = %+v", r)
+	}
+}
+
+// newArchiveTestServer 按 types 依次创建已结束的任务，输出是 "out-<job_id>"
+func newArchiveTestServer(t *testing.T, rules []config.RetentionRule, types ...string) (*GormStore, *ResultArchiver) {
+	t.Helper()
+	store := NewGormStore(newTestDB(t))
+	for i, typ := range types {
+		id := fmt.Sprintf("j%d", i)
+		if err := store.CreateJob(context.Background(), &JobRecord{JobID: id, Type: typ, Status: JobStatusSuccess, Result: "out-" + id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store, &ResultArchiver{Store: store, Root: t.TempDir(), Rules: rules}
+}
+
+func TestCompactKeepLast(t *testing.T) {
+	store, a := newArchiveTestServer(t, []config.RetentionRule{{Type: "shell", KeepLast: 2}},
+		"shell", "shell", "ping", "shell", "shell", "shell")
+	ctx := context.Background()
+	// 没结束的任务不归档
+	if err := store.CreateJob(ctx, &JobRecord{JobID: "running", Type: "shell", Status: JobStatusRunning, Result: "partial"}); err != nil {
+		t.Fatal(err)
+	}
+	a.compact(ctx)
+
+	archived := map[string]bool{"j0": true, "j1": true, "j3": true}
+	var file string
+	for _, id := range []string{"j0", "j1", "j2", "j3", "j4", "j5", "running"} {
+		job, err := store.GetJob(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (job.ArchivedAt != nil) != archived[id] {
+			t.Errorf("job %s archived = %v, want %v", id, job.ArchivedAt != nil, archived[id])
+			continue
+		}
+		if !archived[id] {
+			if job.Result == "" {
+				t.Errorf("job %s lost its result", id)
+			}
+			continue
+		}
+		if job.Result != "" {
+			t.Errorf("job %s still has result %q in the database", id, job.Result)
+		}
+		file = job.ArchiveFile
+		if got, err := a.Load(job); err != nil || got != "out-"+id {
+			t.Errorf("Load(%s) = %q, %v", id, got, err)
+		}
+	}
+
+	// 整个归档文件是一个合法的 gzip 流，解压得到 JSON lines
+	f, err := os.Open(filepath.Join(a.Root, filepath.FromSlash(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []archivedResult
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		var line archivedResult
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 3 || lines[0].JobID != "j0" || lines[2].Result != "out-j3" {
+		t.Errorf("archive lines = %+v", lines)
+	}
+
+	// 再跑一次没有新的可归档任务
+	before, _ := os.ReadDir(filepath.Dir(f.Name()))
+	a.compact(ctx)
+	if after, _ := os.ReadDir(filepath.Dir(f.Name())); len(after) != len(before) {
+		t.Errorf("second compact wrote %d new files", len(after)-len(before))
+	}
+}
+
+func TestCompactKeepDays(t *testing.T) {
+	store, a := newArchiveTestServer(t, []config.RetentionRule{{Type: "*", KeepDays: 7}}, "shell", "scan")
+	ctx := context.Background()
+	old := time.Now().AddDate(0, 0, -8)
+	if err := store.DB.Model(&JobRecord{}).Where("job_id = ?", "j0").Update("executed_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	a.compact(ctx)
+
+	for id, want := range map[string]bool{"j0": true, "j1": false} {
+		job, err := store.GetJob(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (job.ArchivedAt != nil) != want {
+			t.Errorf("job %s archived = %v, want %v", id, job.ArchivedAt != nil, want)
+		}
+	}
+}
+
+// 多个实例同时归档同一批任务时只有一个生效
+func TestMarkArchivedSkipsArchivedJobs(t *testing.T) {
+	store, a := newArchiveTestServer(t, nil, "shell", "shell")
+	ctx := context.Background()
+	jobs, err := store.ArchiveCandidates(ctx, ArchiveQuery{Type: "shell"}, 0, 10)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("candidates = %v, %v", jobs, err)
+	}
+	if n, err := a.archive(ctx, jobs); err != nil || n != 2 {
+		t.Fatalf("first archive = %d, %v", n, err)
+	}
+	if n, err := a.archive(ctx, jobs); err != nil || n != 0 {
+		t.Errorf("second archive = %d, %v; want 0", n, err)
+	}
+	job, _ := store.GetJob(ctx, "j1")
+	if got, err := a.Load(job); err != nil || got != "out-j1" {
+		t.Errorf("Load = %q, %v; want the first archive kept", got, err)
+	}
+}
+
+func TestLoadRejectsMismatchedRecord(t *testing.T) {
+	store, a := newArchiveTestServer(t, []config.RetentionRule{{Type: "shell", KeepLast: 1}}, "shell", "shell", "shell")
+	ctx := context.Background()
+	a.compact(ctx)
+
+	if _, err := a.Load(JobRecord{JobID: "j2"}); err == nil {
+		t.Error("Load of an unarchived job succeeded")
+	}
+	j0, _ := store.GetJob(ctx, "j0")
+	j1, _ := store.GetJob(ctx, "j1")
+	j1.ArchiveOffset, j1.ArchiveSize = j0.ArchiveOffset, j0.ArchiveSize
+	if _, err := a.Load(j1); err == nil {
+		t.Error("Load with another job's offset succeeded")
+	}
+}
+
+// GET /jobs/{id} 从归档文件读回输出，调用方看不出区别
+func TestGetJobReadsArchivedResult(t *testing.T) {
+	store, a := newArchiveTestServer(t, []config.RetentionRule{{Type: "shell", KeepLast: 1}}, "shell", "shell")
+	a.compact(context.Background())
+	s := &HttpServer{Store: store, Srv: &SentinelServer{Store: store}}
+
+	get := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/jobs/j0", nil)
+		r.SetPathValue("id", "j0")
+		w := httptest.NewRecorder()
+		s.handleGetJob(w, r)
+		return w
+	}
+	if w := get(); w.Code != http.StatusInternalServerError {
+		t.Errorf("without archiver: status %d, want 500", w.Code)
+	}
+
+	s.Srv.Results = a
+	w := get()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var view struct {
+		Result     string     `json:"result"`
+		ArchivedAt *time.Time `json:"archived_at"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &view); err != nil {
+		t.Fatal(err)
+	}
+	if view.Result != "out-j0" || view.ArchivedAt == nil {
+		t.Errorf("view = %+v", view)
+	}
+}
@@ -0,0 +1,232 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/storage"
+)
+
+// ArtifactRecord 任务产物，文件内容在存储后端里 (见 pkg/storage)
+// 同一个任务重复上传同名文件时覆盖，所以不用软删除
+type ArtifactRecord struct {
+	ID         uint   `gorm:"primarykey"`
+	JobID      string `gorm:"uniqueIndex:idx_artifact_job_name;size:191"`
+	Name       string `gorm:"uniqueIndex:idx_artifact_job_name;size:255"`
+	AgentID    string `gorm:"size:191"`
+	Size       int64
+	SHA256     string `gorm:"column:sha256;size:64"`
+	StorageKey string `gorm:"size:512"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// 单个任务最多声明多少个产物 glob
+const maxArtifactGlobs = 16
+
+// validateArtifactGlobs 提交任务时校验产物 glob，Agent 端用 filepath.Glob 展开
+func validateArtifactGlobs(globs []string) error {
+	if len(globs) > maxArtifactGlobs {
+		return fmt.Errorf("artifacts 最多 %d 个", maxArtifactGlobs)
+	}
+	for _, g := range globs {
+		if g == "" {
+			return errors.New("artifacts 不能包含空字符串")
+		}
+		if _, err := filepath.Match(g, ""); err != nil {
+			return fmt.Errorf("artifacts glob %q 格式错误", g)
+		}
+	}
+	return nil
+}
+
+func artifactKey(jobID, name string) string {
+	return path.Join("artifacts", jobID, name)
+}
+
+var errArtifactTooLarge = errors.New("artifact exceeds max_file_size")
+
+// UploadArtifact Agent 在任务结束后逐个上传产物，边收边写入存储后端，不在内存里攒整个文件
+func (s *SentinelServer) UploadArtifact(stream pb.SentinelService_UploadArtifactServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	name, err := storage.CleanKey(first.Name)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid artifact name %q", first.Name)
+	}
+	job, err := s.Store.GetJob(stream.Context(), first.JobId)
+	if errors.Is(err, ErrNotFound) {
+		return status.Errorf(codes.NotFound, "job %s not found", first.JobId)
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if job.AgentID != "" && job.AgentID != first.AgentId {
+		return status.Errorf(codes.PermissionDenied, "job %s belongs to another agent", first.JobId)
+	}
+
+	ctx := jobLogContext(stream.Context(), job)
+
+	// 接收协程把分片写进管道，存储后端从管道读；超过大小上限时中断
+	pr, pw := io.Pipe()
+	go func() {
+		size := int64(0)
+		chunk := first
+		var err error
+		for {
+			size += int64(len(chunk.Data))
+			if s.MaxArtifactSize > 0 && size > s.MaxArtifactSize {
+				pw.CloseWithError(errArtifactTooLarge)
+				return
+			}
+			if _, err := pw.Write(chunk.Data); err != nil {
+				return // 存储后端已经出错
+			}
+			if chunk, err = stream.Recv(); err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	key := artifactKey(job.JobID, name)
+	h := sha256.New()
+	counter := &countingReader{r: io.TeeReader(pr, h)}
+	if err := s.Storage.Put(ctx, key, counter, -1); err != nil {
+		pr.CloseWithError(err)
+		if errors.Is(err, errArtifactTooLarge) {
+			return status.Errorf(codes.ResourceExhausted, "artifact %s exceeds max_file_size (%d bytes)", name, s.MaxArtifactSize)
+		}
+		slog.ErrorContext(ctx, "保存产物失败", "key", key, "err", err)
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	record := ArtifactRecord{
+		JobID:      job.JobID,
+		Name:       name,
+		AgentID:    first.AgentId,
+		Size:       counter.n,
+		SHA256:     hex.EncodeToString(h.Sum(nil)),
+		StorageKey: key,
+	}
+	if err := s.Store.SaveArtifact(ctx, &record); err != nil {
+		slog.ErrorContext(ctx, "保存产物记录失败", "name", name, "err", err)
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	slog.InfoContext(ctx, "已上传产物", "name", name, "size", record.Size)
+	return stream.SendAndClose(&pb.UploadArtifactResp{
+		Name:   name,
+		Size:   record.Size,
+		Sha256: record.SHA256,
+	})
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// artifactView 是产物列表接口的返回结构
+type artifactView struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	AgentID     string    `json:"agent_id"`
+	DownloadURL string    `json:"download_url"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+// handleListArtifacts 列出任务的产物
+func (s *HttpServer) handleListArtifacts(w http.ResponseWriter, r *http.Request) {
+	jobID := r.PathValue("id")
+	exists, err := s.Store.JobExists(r.Context(), jobID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	records, err := s.Store.ListArtifacts(r.Context(), jobID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	views := make([]artifactView, len(records))
+	for i, a := range records {
+		views[i] = artifactView{
+			Name:        a.Name,
+			Size:        a.Size,
+			SHA256:      a.SHA256,
+			AgentID:     a.AgentID,
+			DownloadURL: "/jobs/" + url.PathEscape(jobID) + "/artifacts/" + (&url.URL{Path: a.Name}).EscapedPath(),
+			UploadedAt:  a.UpdatedAt,
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"job_id":    jobID,
+		"artifacts": views,
+	})
+}
+
+// handleDownloadArtifact 下载产物，name 可以带目录，如 /jobs/{id}/artifacts/out/result.json
+func (s *HttpServer) handleDownloadArtifact(w http.ResponseWriter, r *http.Request) {
+	record, err := s.Store.GetArtifact(r.Context(), r.PathValue("id"), r.PathValue("name"))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Artifact not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	body, size, err := s.Srv.Storage.Get(r.Context(), record.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Artifact content is missing", http.StatusGone)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "读取产物失败", "key", record.StorageKey, "err", err)
+		http.Error(w, "Storage Error", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(record.Name)))
+	w.Header().Set("X-Checksum-Sha256", record.SHA256)
+	if _, err := io.Copy(w, body); err != nil {
+		slog.WarnContext(r.Context(), "产物下载中断", "key", record.StorageKey, "err", err)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/storage"
+)
+
+// fakeUploadStream 按顺序交出预先准备好的分片
+type fakeUploadStream struct {
+	grpc.ServerStream
+	chunks []*pb.ArtifactChunk
+	resp   *pb.UploadArtifactResp
+}
+
+func (f *fakeUploadStream) Context() context.Context { return context.Background() }
+
+func (f *fakeUploadStream) Recv() (*pb.ArtifactChunk, error) {
+	if len(f.chunks) == 0 {
+		return nil, io.EOF
+	}
+	c := f.chunks[0]
+	f.chunks = f.chunks[1:]
+	return c, nil
+}
+
+func (f *fakeUploadStream) SendAndClose(resp *pb.UploadArtifactResp) error {
+	f.resp = resp
+	return nil
+}
+
+func newArtifactTestServer(t *testing.T, maxSize int64) (*SentinelServer, string) {
+	t.Helper()
+	db := newTestDB(t)
+	dir := t.TempDir()
+	backend, err := storage.NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &SentinelServer{Store: NewGormStore(db), Storage: backend, MaxArtifactSize: maxSize}
+	if err := s.Store.CreateJob(context.Background(), &JobRecord{JobID: "job-1", AgentID: "n1", Status: JobStatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func uploadChunks(parts ...string) *fakeUploadStream {
+	stream := &fakeUploadStream{}
+	for _, p := range parts {
+		stream.chunks = append(stream.chunks, &pb.ArtifactChunk{JobId: "job-1", AgentId: "n1", Name: "out/result.txt", Data: []byte(p)})
+	}
+	return stream
+}
+
+func TestUploadArtifact(t *testing.T) {
+	s, _ := newArtifactTestServer(t, 16)
+	stream := uploadChunks("hello ", "world")
+	if err := s.UploadArtifact(stream); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("hello world"))
+	if stream.resp.Size != 11 || stream.resp.Sha256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("resp = %+v, want 11 bytes with the content hash", stream.resp)
+	}
+	rc, _, err := s.Storage.Get(context.Background(), artifactKey("job-1", "out/result.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if got, _ := io.ReadAll(rc); string(got) != "hello world" {
+		t.Errorf("stored object = %q, want %q", got, "hello world")
+	}
+	if _, err := s.Store.GetArtifact(context.Background(), "job-1", "out/result.txt"); err != nil {
+		t.Fatalf("artifact record: %v", err)
+	}
+}
+
+func TestUploadArtifactTooLarge(t *testing.T) {
+	s, dir := newArtifactTestServer(t, 10)
+	err := s.UploadArtifact(uploadChunks("123456", "789012"))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("err = %v, want ResourceExhausted", err)
+	}
+
+	// 存储目录里不能留下半截文件 (包括临时文件)，也不能有产物记录
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			t.Errorf("partial object left behind: %s", p)
+		}
+		return err
+	})
+	if records, _ := s.Store.ListArtifacts(context.Background(), "job-1"); len(records) != 0 {
+		t.Errorf("%d artifact records after a rejected upload, want 0", len(records))
+	}
+}
@@ -0,0 +1,382 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+)
+
+// 审计结果
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	// 不超过这个大小的请求体先整个读进内存算摘要；更大的 (上传文件) 边读边算，
+	// 处理函数没读完的部分最多再读这么多，超过就不记摘要，免得为审计读完一个被拒绝的大文件
+	auditBufferLimit = 1 << 20
+)
+
+var errAuditAppendOnly = errors.New("审计日志只能追加，不能修改或删除")
+
+// AuditRecord 审计日志：谁 (actor) 从哪里 (source_ip) 对什么 (target) 做了什么 (action)，结果如何
+// 只追加：通过 GORM 模型的修改和删除会被钩子拒绝
+type AuditRecord struct {
+	ID            uint64    `gorm:"primaryKey"`
+	CreatedAt     time.Time `gorm:"index"`
+	Actor         string    `gorm:"size:128;index"` // user:<受信任代理填的 X-Remote-User> / key:<API key 指纹> / anonymous
+	SourceIP      string    `gorm:"size:64"`
+	ForwardedFor  string    `gorm:"size:255"` // X-Forwarded-For 原样记录，不作为来源 IP
+	Action        string    `gorm:"size:64;index"`
+	Target        string    `gorm:"size:255;index"` // 如 job:<id>、agent:<id>、secret:<namespace>/<name>
+	Method        string    `gorm:"size:8"`
+	Path          string    `gorm:"size:255"`
+	PayloadSHA256 string    `gorm:"size:64"` // 请求体的 sha256，没有请求体或没读完时为空
+	Status        int       // HTTP 状态码
+	Outcome       string    `gorm:"size:16;index"`
+	Detail        string    `gorm:"type:text"` // 处理函数补充的信息 (JSON)，如派发到的节点
+	RequestID     string    `gorm:"size:64;index"`
+}
+
+func (AuditRecord) BeforeUpdate(*gorm.DB) error { return errAuditAppendOnly }
+func (AuditRecord) BeforeDelete(*gorm.DB) error { return errAuditAppendOnly }
+
+// auditView 是审计接口的返回结构，也是导出的 JSON lines 的每一行
+type auditView struct {
+	ID            uint64            `json:"id"`
+	Time          time.Time         `json:"time"`
+	Actor         string            `json:"actor"`
+	SourceIP      string            `json:"source_ip"`
+	ForwardedFor  string            `json:"forwarded_for,omitempty"`
+	Action        string            `json:"action"`
+	Target        string            `json:"target,omitempty"`
+	Method        string            `json:"method"`
+	Path          string            `json:"path"`
+	PayloadSHA256 string            `json:"payload_sha256,omitempty"`
+	Status        int               `json:"status"`
+	Outcome       string            `json:"outcome"`
+	Detail        map[string]string `json:"detail,omitempty"`
+	RequestID     string            `json:"request_id,omitempty"`
+}
+
+func newAuditView(a AuditRecord) auditView {
+	v := auditView{
+		ID:            a.ID,
+		Time:          a.CreatedAt,
+		Actor:         a.Actor,
+		SourceIP:      a.SourceIP,
+		ForwardedFor:  a.ForwardedFor,
+		Action:        a.Action,
+		Target:        a.Target,
+		Method:        a.Method,
+		Path:          a.Path,
+		PayloadSHA256: a.PayloadSHA256,
+		Status:        a.Status,
+		Outcome:       a.Outcome,
+		RequestID:     a.RequestID,
+	}
+	if a.Detail != "" {
+		json.Unmarshal([]byte(a.Detail), &v.Detail)
+	}
+	return v
+}
+
+// auditEntry 处理函数通过 auditTarget / auditDetail 补充的信息，放在请求的 ctx 里
+type auditEntry struct {
+	target string
+	detail map[string]string
+}
+
+type auditKey struct{}
+
+// auditTarget 设置审计记录的操作对象；对象 ID 在处理函数里才生成时 (提交任务、上传文件) 调用
+func auditTarget(ctx context.Context, target string) {
+	if e, ok := ctx.Value(auditKey{}).(*auditEntry); ok {
+		e.target = target
+	}
+}
+
+// auditDetail 给审计记录补充一项信息
+func auditDetail(ctx context.Context, key, value string) {
+	if e, ok := ctx.Value(auditKey{}).(*auditEntry); ok {
+		if e.detail == nil {
+			e.detail = make(map[string]string)
+		}
+		e.detail[key] = value
+	}
+}
+
+// audited 给修改类接口记审计日志；GET 等只读请求直接放行
+// action 形如 "job.cancel"，点号前面是资源类型，默认的操作对象取路由里的 {id}、{namespace}/{name} 或 {name}
+func (s *HttpServer) audited(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		entry := &auditEntry{target: defaultAuditTarget(action, r)}
+		body := &hashingBody{ReadCloser: r.Body, h: sha256.New()}
+		r.Body = body
+		if r.ContentLength >= 0 && r.ContentLength <= auditBufferLimit {
+			// 读出错时原样留给处理函数，它再读会拿到同样的错误
+			data, _ := io.ReadAll(body)
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(data), body), body}
+		}
+		r = r.WithContext(context.WithValue(r.Context(), auditKey{}, entry))
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next(rec, r)
+
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		record := AuditRecord{
+			Actor:         auditActor(r, s.TrustedProxies),
+			SourceIP:      sourceIP(r),
+			ForwardedFor:  truncate(r.Header.Get("X-Forwarded-For"), 255),
+			Action:        action,
+			Target:        truncate(entry.target, 255),
+			Method:        r.Method,
+			Path:          truncate(r.URL.Path, 255),
+			PayloadSHA256: body.sum(),
+			Status:        rec.code,
+			Outcome:       AuditSuccess,
+			RequestID:     logging.RequestID(r.Context()),
+		}
+		if rec.code >= http.StatusBadRequest {
+			record.Outcome = AuditFailure
+		}
+		if len(entry.detail) > 0 {
+			detail, _ := json.Marshal(entry.detail)
+			record.Detail = string(detail)
+		}
+		// 请求已经处理完了，审计写入失败只能记日志
+		if err := s.Store.AppendAudit(context.WithoutCancel(r.Context()), &record); err != nil {
+			slog.ErrorContext(r.Context(), "写入审计日志失败", "action", action, "target", record.Target, "err", err)
+		}
+	}
+}
+
+func defaultAuditTarget(action string, r *http.Request) string {
+	resource, _, _ := strings.Cut(action, ".")
+	id := r.PathValue("id")
+	if id == "" {
+		id = r.PathValue("name")
+		if ns := r.PathValue("namespace"); ns != "" {
+			id = ns + "/" + id
+		}
+	}
+	if id == "" {
+		return resource
+	}
+	return resource + ":" + id
+}
+
+// auditActor 调用方身份：请求来自受信任的认证代理时取它填的 X-Remote-User，
+// 其次是 X-API-Key 或 Authorization: Bearer 的指纹 (不落原文)，都没有时记为 anonymous
+// 其他来源的 X-Remote-User 是客户端自己填的，不能用来冒充别人
+func auditActor(r *http.Request, trusted []netip.Prefix) string {
+	if u := r.Header.Get("X-Remote-User"); u != "" && fromTrustedProxy(r, trusted) {
+		return truncate("user:"+u, 128)
+	}
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if key = strings.TrimSpace(key); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:])[:16]
+	}
+	return "anonymous"
+}
+
+// fromTrustedProxy 请求的直连地址 (不看 X-Forwarded-For) 是否在受信任的代理地址里
+func fromTrustedProxy(r *http.Request, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(sourceIP(r))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	return slices.ContainsFunc(trusted, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+// parseTrustedProxies 解析 server.trusted_proxies，单个 IP 视为 /32 (/128)；
+// 无效的条目记日志后忽略，不会因此多信任任何地址
+func parseTrustedProxies(entries []string) []netip.Prefix {
+	var out []netip.Prefix
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if p, err := netip.ParsePrefix(e); err == nil {
+			out = append(out, p.Masked())
+			continue
+		}
+		if a, err := netip.ParseAddr(e); err == nil {
+			a = a.Unmap()
+			out = append(out, netip.PrefixFrom(a, a.BitLen()))
+			continue
+		}
+		slog.Error("server.trusted_proxies 中的地址无效，已忽略", "entry", e)
+	}
+	return out
+}
+
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// hashingBody 边读边算请求体的 sha256
+type hashingBody struct {
+	io.ReadCloser
+	h   hash.Hash
+	n   int64
+	eof bool
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.h.Write(p[:n])
+	b.n += int64(n)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// sum 处理函数没读完的部分补读进摘要；请求体为空、太大或已经读不到时返回空字符串
+func (b *hashingBody) sum() string {
+	if !b.eof {
+		io.CopyN(io.Discard, b, auditBufferLimit)
+	}
+	if !b.eof || b.n == 0 {
+		return ""
+	}
+	return hex.EncodeToString(b.h.Sum(nil))
+}
+
+// parseAuditFilter 解析审计日志的过滤参数
+// 支持 actor、action、target、outcome (精确匹配，以 * 结尾时按前缀匹配，如 action=job.*)、
+// since / until (RFC3339)
+func parseAuditFilter(q url.Values) (AuditFilter, error) {
+	f := AuditFilter{
+		Actor:   q.Get("actor"),
+		Action:  q.Get("action"),
+		Target:  q.Get("target"),
+		Outcome: q.Get("outcome"),
+	}
+	for _, p := range []struct {
+		param string
+		t     *time.Time
+	}{
+		{"since", &f.Since},
+		{"until", &f.Until},
+	} {
+		v := q.Get(p.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, errors.New(p.param + " 格式错误，应为 RFC3339，如 2024-01-02T15:04:05Z")
+		}
+		*p.t = t
+	}
+	return f, nil
+}
+
+// escapeLike 转义 LIKE 的通配符，前缀里的 % 和 _ 按字面匹配
+// 转义符用 "!"：MySQL 和 SQLite 对反斜杠的处理不一样
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// handleListAudit 查询审计日志，按时间倒序
+// 除 parseAuditFilter 的过滤条件外支持 limit (默认 100，最多 1000) 和 before_id 翻页 (传上一页最后一条的 id)
+func (s *HttpServer) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, err := parseAuditFilter(q)
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultAuditLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Bad Request: limit 必须是正整数", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxAuditLimit)
+	}
+	var beforeID uint64
+	if v := q.Get("before_id"); v != "" {
+		if beforeID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "Bad Request: before_id 必须是整数", http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, err := s.Store.ListAudit(r.Context(), filter, beforeID, limit)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	views := make([]auditView, len(records))
+	for i, a := range records {
+		views[i] = newAuditView(a)
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleExportAudit 按 parseAuditFilter 的过滤条件导出审计日志，JSON lines 格式，按时间正序逐批输出
+func (s *HttpServer) handleExportAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-`+time.Now().Format("20060102-150405")+`.jsonl"`)
+	enc := json.NewEncoder(w)
+	err = s.Store.ExportAudit(r.Context(), filter, func(records []AuditRecord) error {
+		for _, a := range records {
+			if err := enc.Encode(newAuditView(a)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// 已经开始输出了，出错只能中断并记日志，调用方会拿到不完整的文件
+	if err != nil {
+		slog.ErrorContext(r.Context(), "导出审计日志中断", "err", err)
+	}
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditActor(t *testing.T) {
+	trusted := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5", "not-an-ip"})
+	if len(trusted) != 2 {
+		t.Fatalf("parsed %d trusted proxies, want 2 (invalid entry ignored)", len(trusted))
+	}
+	// API key 只记指纹，不落原文
+	sum := sha256.Sum256([]byte("secret-key"))
+	keyActor := "key:" + hex.EncodeToString(sum[:])[:16]
+
+	for name, c := range map[string]struct {
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		"trusted cidr":       {"10.1.2.3:5000", map[string]string{"X-Remote-User": "alice", "X-API-Key": "secret-key"}, "user:alice"},
+		"trusted single ip":  {"192.168.1.5:5000", map[string]string{"X-Remote-User": "alice"}, "user:alice"},
+		"ipv4-mapped ipv6":   {"[::ffff:10.1.2.3]:5000", map[string]string{"X-Remote-User": "alice"}, "user:alice"},
+		"untrusted uses key": {"203.0.113.9:5000", map[string]string{"X-Remote-User": "alice", "X-API-Key": "secret-key"}, keyActor},
+		"untrusted no key":   {"192.168.1.6:5000", map[string]string{"X-Remote-User": "alice"}, "anonymous"},
+		"forwarded ignored":  {"203.0.113.9:5000", map[string]string{"X-Remote-User": "alice", "X-Forwarded-For": "10.1.2.3"}, "anonymous"},
+		"bearer token":       {"203.0.113.9:5000", map[string]string{"Authorization": "Bearer secret-key"}, keyActor},
+		"trusted no user":    {"10.1.2.3:5000", map[string]string{"X-API-Key": "secret-key"}, keyActor},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/task", nil)
+		r.RemoteAddr = c.remote
+		for k, v := range c.headers {
+			r.Header.Set(k, v)
+		}
+		if got := auditActor(r, trusted); got != c.want {
+			t.Errorf("%s: actor = %q, want %q", name, got, c.want)
+		}
+	}
+}
+
+func TestAuditedRecordsRequest(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	s := &HttpServer{Store: store, TrustedProxies: parseTrustedProxies([]string{"10.0.0.1"})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs/{id}/cancel", s.audited("job.cancel", func(w http.ResponseWriter, r *http.Request) {
+		auditDetail(r.Context(), "agent", "n1")
+		w.WriteHeader(http.StatusConflict)
+	}))
+
+	for _, remote := range []string{"10.0.0.1:1234", "10.0.0.2:1234"} {
+		r := httptest.NewRequest(http.MethodPost, "/jobs/j1/cancel", strings.NewReader(`{"reason":"x"}`))
+		r.RemoteAddr = remote
+		r.Header.Set("X-Remote-User", "alice")
+		mux.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	records, err := store.ListAudit(context.Background(), AuditFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("%d audit records, want 2", len(records))
+	}
+	// 倒序：先是不受信任地址的请求
+	if records[0].Actor != "anonymous" || records[1].Actor != "user:alice" {
+		t.Errorf("actors = %q, %q", records[0].Actor, records[1].Actor)
+	}
+	r := records[1]
+	if r.Action != "job.cancel" || r.Target != "job:j1" || r.Status != http.StatusConflict ||
+		r.Outcome != AuditFailure || r.SourceIP != "10.0.0.1" || r.PayloadSHA256 == "" || r.Detail != `{"agent":"n1"}` {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
+
+func TestAuditExportFormat(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	for i, r := range []AuditRecord{
+		{Actor: "user:alice", Action: "job.submit", Target: "job:1", Method: "POST", Path: "/task", Status: 200, Outcome: AuditSuccess, Detail: `{"agent":"n1"}`},
+		{Actor: "user:bob", Action: "agent.delete", Target: "agent:n1", Method: "DELETE", Path: "/agents/n1", Status: 404, Outcome: AuditFailure},
+	} {
+		r.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if err := store.AppendAudit(ctx, &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &HttpServer{Store: store}
+	w := httptest.NewRecorder()
+	s.handleExportAudit(w, httptest.NewRequest(http.MethodGet, "/audit/export", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, `attachment; filename="audit-`) {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	var lines []auditView
+	sc := bufio.NewScanner(w.Body)
+	for sc.Scan() {
+		var v auditView
+		if err := json.Unmarshal(sc.Bytes(), &v); err != nil {
+			t.Fatalf("line %q is not JSON: %v", sc.Text(), err)
+		}
+		lines = append(lines, v)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("%d lines, want 2", len(lines))
+	}
+	// 按时间正序，detail 还原成对象
+	if lines[0].Target != "job:1" || lines[1].Target != "agent:n1" {
+		t.Errorf("order = %s, %s", lines[0].Target, lines[1].Target)
+	}
+	if lines[0].Detail["agent"] != "n1" || !lines[0].Time.Equal(base) {
+		t.Errorf("first line = %+v", lines[0])
+	}
+
+	w = httptest.NewRecorder()
+	s.handleExportAudit(w, httptest.NewRequest(http.MethodGet, "/audit/export?since=yesterday", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad since: status %d, want 400", w.Code)
+	}
+}
+
+func TestAuditRecordsAreAppendOnly(t *testing.T) {
+	db := newTestDB(t)
+	record := AuditRecord{Actor: "user:alice", Action: "job.submit", Target: "job:1"}
+	if err := NewGormStore(db).AppendAudit(context.Background(), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Model(&record).Update("actor", "user:mallory").Error; !errors.Is(err, errAuditAppendOnly) {
+		t.Errorf("Update err = %v, want errAuditAppendOnly", err)
+	}
+	record.Actor = "user:mallory"
+	if err := db.Save(&record).Error; !errors.Is(err, errAuditAppendOnly) {
+		t.Errorf("Save err = %v, want errAuditAppendOnly", err)
+	}
+	if err := db.Delete(&record).Error; !errors.Is(err, errAuditAppendOnly) {
+		t.Errorf("Delete err = %v, want errAuditAppendOnly", err)
+	}
+
+	var stored AuditRecord
+	if err := db.First(&stored, record.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Actor != "user:alice" {
+		t.Errorf("actor changed to %q", stored.Actor)
+	}
+}
+
+func TestListAuditFilter(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	for i, r := range []AuditRecord{
+		{Actor: "user:alice", Action: "job.submit", Target: "job:1", Outcome: AuditSuccess},
+		{Actor: "user:alice", Action: "job.cancel", Target: "job:1", Outcome: AuditFailure},
+		{Actor: "user:bob", Action: "secret.put", Target: "secret:db_pass", Outcome: AuditSuccess},
+		{Actor: "user:bob", Action: "job_x", Target: "job:2", Outcome: AuditSuccess},
+	} {
+		r.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if err := store.AppendAudit(ctx, &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &HttpServer{Store: store}
+
+	list := func(query string) []string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.handleListAudit(w, httptest.NewRequest(http.MethodGet, "/audit?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", query, w.Code, w.Body)
+		}
+		var views []auditView
+		if err := json.Unmarshal(w.Body.Bytes(), &views); err != nil {
+			t.Fatal(err)
+		}
+		var actions []string
+		for _, v := range views {
+			actions = append(actions, v.Action)
+		}
+		return actions
+	}
+
+	for query, want := range map[string]string{
+		"":                             "job_x,secret.put,job.cancel,job.submit",
+		"actor=user:alice":             "job.cancel,job.submit",
+		"action=job.*":                 "job.cancel,job.submit", // _ 按字面匹配，不匹配 job_x
+		"target=job:1&outcome=failure": "job.cancel",
+		"since=" + base.Add(time.Minute).Format(time.RFC3339) + "&until=" + base.Add(3*time.Minute).Format(time.RFC3339): "secret.put,job.cancel",
+		"limit=2": "job_x,secret.put",
+	} {
+		if got := strings.Join(list(query), ","); got != want {
+			t.Errorf("%q: %s, want %s", query, got, want)
+		}
+	}
+
+	// before_id 翻页
+	w := httptest.NewRecorder()
+	s.handleListAudit(w, httptest.NewRequest(http.MethodGet, "/audit?limit=2", nil))
+	var page []auditView
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if got := strings.Join(list("before_id="+strconv.FormatUint(page[1].ID, 10)), ","); got != "job.cancel,job.submit" {
+		t.Errorf("second page = %s", got)
+	}
+
+	for _, query := range []string{"limit=0", "limit=x", "before_id=-1", "until=tomorrow"} {
+		w := httptest.NewRecorder()
+		s.handleListAudit(w, httptest.NewRequest(http.MethodGet, "/audit?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, w.Code)
+		}
+	}
+}
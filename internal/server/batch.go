@@ -0,0 +1,329 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// BatchRecord 一次批量提交，子任务通过 JobRecord.BatchID 关联
+type BatchRecord struct {
+	gorm.Model
+	BatchID  string `gorm:"uniqueIndex;size:191"`
+	Type     string
+	Template string
+	Total    int
+
+	CompletedAt *time.Time // 最后一个子任务结束的时间，同时保证 batch.completed 事件只发一次
+}
+
+// batchRequest POST /batches 的请求体
+// payload 模板支持 {{target}}、{{host}}、{{port}} 占位符
+type batchRequest struct {
+	Template struct {
+		Type    string `json:"type"`
+		Payload string `json:"payload"`
+		jobSpec        // 所有子任务共用的执行选项
+	} `json:"template"`
+	Targets []string   `json:"targets"` // 显式列出的目标 (IP 或域名)
+	CIDR    string     `json:"cidr"`    // 可选：按网段展开，如 10.0.0.0/24
+	Ports   string     `json:"ports"`   // 可选：端口列表，如 "22,80,8000-8010"
+	RunAt   *time.Time `json:"run_at"`
+	Delay   string     `json:"delay"`
+}
+
+// batchTarget 展开后的单个目标
+type batchTarget struct {
+	Host string
+	Port int // 0 表示没有端口维度
+}
+
+func (t batchTarget) String() string {
+	if t.Port == 0 {
+		return t.Host
+	}
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+// render 用目标替换 payload 模板里的占位符
+func (t batchTarget) render(tpl string) string {
+	port := ""
+	if t.Port != 0 {
+		port = strconv.Itoa(t.Port)
+	}
+	return strings.NewReplacer(
+		"{{target}}", t.String(),
+		"{{host}}", t.Host,
+		"{{port}}", port,
+	).Replace(tpl)
+}
+
+// expandTargets 把 targets + cidr 展开成主机列表，再和端口做笛卡尔积
+func expandTargets(req batchRequest, limit int) ([]batchTarget, error) {
+	hosts := make([]string, 0, len(req.Targets))
+	seen := make(map[string]bool)
+	addHost := func(h string) {
+		if h != "" && !seen[h] {
+			seen[h] = true
+			hosts = append(hosts, h)
+		}
+	}
+	for _, t := range req.Targets {
+		addHost(strings.TrimSpace(t))
+	}
+
+	if req.CIDR != "" {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(req.CIDR))
+		if err != nil {
+			return nil, fmt.Errorf("cidr 格式错误: %v", err)
+		}
+		prefix = prefix.Masked()
+		for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+			// IPv4 网段跳过网络地址和广播地址 (/31、/32 除外)
+			if addr.Is4() && prefix.Bits() < 31 && (addr == prefix.Addr() || !prefix.Contains(addr.Next())) {
+				continue
+			}
+			addHost(addr.String())
+			if len(hosts) > limit {
+				return nil, fmt.Errorf("目标数量超过上限 %d", limit)
+			}
+		}
+	}
+
+	ports, err := parsePorts(req.Ports)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hosts) == 0 {
+		return nil, errors.New("targets 和 cidr 至少要指定一个")
+	}
+	total := len(hosts)
+	if len(ports) > 0 {
+		total *= len(ports)
+	}
+	if total > limit {
+		return nil, fmt.Errorf("展开后任务数 %d 超过上限 %d", total, limit)
+	}
+
+	targets := make([]batchTarget, 0, total)
+	for _, h := range hosts {
+		if len(ports) == 0 {
+			targets = append(targets, batchTarget{Host: h})
+			continue
+		}
+		for _, p := range ports {
+			targets = append(targets, batchTarget{Host: h, Port: p})
+		}
+	}
+	return targets, nil
+}
+
+// parsePorts 解析 "22,80,8000-8010" 形式的端口列表
+func parsePorts(spec string) ([]int, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var ports []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("端口格式错误: %q", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return nil, fmt.Errorf("端口格式错误: %q", part)
+			}
+		}
+		if start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("端口范围错误: %q", part)
+		}
+		for p := start; p <= end; p++ {
+			if !seen[p] {
+				seen[p] = true
+				ports = append(ports, p)
+			}
+		}
+	}
+	return ports, nil
+}
+
+// handleCreateBatch 批量提交：展开目标 -> 事务内创建子任务和发件箱消息 -> 唤醒 OutboxRelay
+func (s *HttpServer) handleCreateBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request: JSON 格式错误", http.StatusBadRequest)
+		return
+	}
+	if req.Template.Payload == "" {
+		http.Error(w, "Bad Request: template.payload 不能为空", http.StatusBadRequest)
+		return
+	}
+
+	runAt, err := resolveRunAt(req.RunAt, req.Delay)
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 子任务以 base 为模板，只有 ID、目标和 payload 不同
+	base := JobRecord{Type: req.Template.Type}
+	if err := req.Template.jobSpec.apply(r.Context(), s.Store, &base); err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	targets, err := expandTargets(req, s.maxBatchSize())
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batch := BatchRecord{
+		BatchID:  newBatchID(),
+		Type:     req.Template.Type,
+		Template: req.Template.Payload,
+		Total:    len(targets),
+	}
+	// 整个批次一个 span，子任务共用它的 trace context
+	ctx, span := startJobSpan(r.Context(), "batch.submit")
+	defer span.End()
+	span.SetAttributes(attribute.String("job.batch_id", batch.BatchID), attribute.Int("batch.total", batch.Total))
+	setJobTrace(ctx, &base)
+	auditTarget(ctx, "batch:"+batch.BatchID)
+	auditDetail(ctx, "type", metricType(batch.Type))
+	auditDetail(ctx, "total", strconv.Itoa(batch.Total))
+	status := JobStatusQueued
+	if runAt != nil {
+		status = JobStatusScheduled
+	}
+	jobs := make([]JobRecord, len(targets))
+	for i, t := range targets {
+		job := base
+		job.JobID = newJobID()
+		job.BatchID = batch.BatchID
+		job.Target = t.String()
+		job.Payload = t.render(req.Template.Payload)
+		job.Status = status
+		job.RunAt = runAt
+		jobs[i] = job
+	}
+
+	// 批次、所有子任务及其发件箱消息要么全部入库，要么全部不入库；
+	// 延时批次交给 DelayScheduler 逐个释放
+	if err := s.Store.CreateBatch(ctx, &batch, jobs); err != nil {
+		slog.ErrorContext(ctx, "批次入库失败", "batch_id", batch.BatchID, "err", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(ctx, "批次已创建", "batch_id", batch.BatchID, "total", batch.Total, "status", status)
+	s.Srv.Events.Publish(ctx, EventBatchSubmitted, "batch:"+batch.BatchID, batchEvent{
+		BatchID:   batch.BatchID,
+		Type:      batch.Type,
+		Total:     batch.Total,
+		CreatedAt: batch.CreatedAt,
+	})
+	countSubmitted(batch.Type, len(jobs))
+
+	// OutboxRelay 会在 confirm 模式下批量投递
+	s.Srv.Outbox.Notify()
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"code":     200,
+		"msg":      "批次已创建",
+		"batch_id": batch.BatchID,
+		"total":    batch.Total,
+		"status":   status,
+	})
+}
+
+// 失败目标列表最多返回多少条
+const maxFailedTargets = 1000
+
+// handleGetBatch 查询批次的聚合进度
+func (s *HttpServer) handleGetBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := s.Store.GetBatch(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	counts, err := s.Store.BatchCounts(r.Context(), batch.BatchID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	finished := 0
+	for st, n := range counts {
+		if isTerminalStatus(st) {
+			finished += n
+		}
+	}
+
+	failedTargets, err := s.Store.BatchFailedTargets(r.Context(), batch.BatchID, maxFailedTargets)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	status := "Running"
+	if finished >= batch.Total {
+		status = "Completed"
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"batch_id":       batch.BatchID,
+		"type":           batch.Type,
+		"template":       batch.Template,
+		"total":          batch.Total,
+		"finished":       finished,
+		"status":         status,
+		"counts":         counts,
+		"failed_targets": failedTargets,
+		"created_at":     batch.CreatedAt,
+		"completed_at":   batch.CompletedAt,
+	})
+}
+
+// terminalStatuses 任务的终态，用于 SQL 查询
+var terminalStatuses = []string{JobStatusSuccess, JobStatusFailed, JobStatusCancelled}
+
+// pendingStatuses 还没开始执行的状态
+var pendingStatuses = []string{JobStatusScheduled, JobStatusQueued, JobStatusAssigned, JobStatusAccepted}
+
+// activeStatuses 还没结束的状态，任务只能从这些状态进入终态
+var activeStatuses = append(pendingStatuses[:len(pendingStatuses):len(pendingStatuses)], JobStatusRunning)
+
+// isTerminalStatus 任务是否已经结束 (不会再变化)
+func isTerminalStatus(status string) bool {
+	switch status {
+	case JobStatusSuccess, JobStatusFailed, JobStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func (s *HttpServer) maxBatchSize() int {
+	if s.MaxBatchSize > 0 {
+		return s.MaxBatchSize
+	}
+	return 10000
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePorts(t *testing.T) {
+	for spec, want := range map[string][]int{
+		"":             nil,
+		"22":           {22},
+		" 22, 80 ":     {22, 80},
+		"8000-8002,22": {8000, 8001, 8002, 22},
+		"80,80,79-81":  {80, 79, 81},
+		"65535":        {65535},
+		"1 - 2":        {1, 2},
+		"0":            nil,
+		"65536":        nil,
+		"90-80":        nil,
+		"http":         nil,
+		"80-":          nil,
+		"22,,80":       nil,
+		"1-3,99999":    nil,
+	} {
+		got, err := parsePorts(spec)
+		if want == nil && spec != "" {
+			if err == nil {
+				t.Errorf("parsePorts(%q) = %v, want error", spec, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, want) {
+			t.Errorf("parsePorts(%q) = %v, %v; want %v", spec, got, err, want)
+		}
+	}
+}
+
+func TestExpandTargets(t *testing.T) {
+	strs := func(targets []batchTarget) []string {
+		out := make([]string, len(targets))
+		for i, t := range targets {
+			out[i] = t.String()
+		}
+		return out
+	}
+
+	for name, c := range map[string]struct {
+		req  batchRequest
+		want []string
+	}{
+		"targets deduplicated": {batchRequest{Targets: []string{"a", " b ", "a", ""}}, []string{"a", "b"}},
+		"cidr skips network and broadcast": {batchRequest{CIDR: "10.0.0.0/30"},
+			[]string{"10.0.0.1", "10.0.0.2"}},
+		"cidr unmasked": {batchRequest{CIDR: "10.0.0.7/30"}, []string{"10.0.0.5", "10.0.0.6"}},
+		"cidr /31":      {batchRequest{CIDR: "10.0.0.0/31"}, []string{"10.0.0.0", "10.0.0.1"}},
+		"cidr /32 joins targets": {batchRequest{Targets: []string{"10.0.0.9", "h"}, CIDR: "10.0.0.9/32"},
+			[]string{"10.0.0.9", "h"}},
+		"ports cartesian": {batchRequest{Targets: []string{"a", "::1"}, Ports: "22,80"},
+			[]string{"a:22", "a:80", "[::1]:22", "[::1]:80"}},
+	} {
+		got, err := expandTargets(c.req, 100)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !slices.Equal(strs(got), c.want) {
+			t.Errorf("%s: %v, want %v", name, strs(got), c.want)
+		}
+	}
+
+	for name, req := range map[string]batchRequest{
+		"empty":              {},
+		"bad cidr":           {CIDR: "10.0.0.0/33"},
+		"bad ports":          {Targets: []string{"a"}, Ports: "x"},
+		"cidr over limit":    {CIDR: "10.0.0.0/16"},
+		"product over limit": {Targets: []string{"a", "b"}, Ports: "1-6"},
+	} {
+		if got, err := expandTargets(req, 10); err == nil {
+			t.Errorf("%s: expanded to %d targets, want error", name, len(got))
+		}
+	}
+}
+
+func TestBatchTargetRender(t *testing.T) {
+	tpl := "nc -z {{host}} {{port}} # {{target}}"
+	if got := (batchTarget{Host: "10.0.0.1", Port: 22}).render(tpl); got != "nc -z 10.0.0.1 22 # 10.0.0.1:22" {
+		t.Errorf("with port: %q", got)
+	}
+	if got := (batchTarget{Host: "example.com"}).render(tpl); got != "nc -z example.com  # example.com" {
+		t.Errorf("without port: %q", got)
+	}
+}
+
+// 每个目标一个子任务，payload 按目标渲染，全部带上批次 ID 和发件箱消息
+func TestCreateBatchFansOut(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormStore(db)
+	s := &HttpServer{Store: store, Srv: &SentinelServer{Store: store}}
+
+	body := `{"template":{"type":"shell","payload":"ping -c1 {{host}}:{{port}}"},"targets":["a","b"],"ports":"22,80"}`
+	w := httptest.NewRecorder()
+	s.handleCreateBatch(w, httptest.NewRequest(http.MethodPost, "/batches", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		BatchID string `json:"batch_id"`
+		Total   int    `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 4 {
+		t.Fatalf("total = %d, want 4", resp.Total)
+	}
+
+	var jobs []JobRecord
+	if err := db.Where("batch_id = ?", resp.BatchID).Order("target").Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	var payloads []string
+	for _, j := range jobs {
+		if j.Type != "shell" || j.Status != JobStatusQueued {
+			t.Errorf("job %s = %s/%s", j.Target, j.Type, j.Status)
+		}
+		payloads = append(payloads, j.Payload)
+	}
+	want := []string{"ping -c1 a:22", "ping -c1 a:80", "ping -c1 b:22", "ping -c1 b:80"}
+	if !slices.Equal(payloads, want) {
+		t.Errorf("payloads = %v, want %v", payloads, want)
+	}
+	var outbox int64
+	db.Model(&OutboxMessage{}).Count(&outbox)
+	if outbox != 4 {
+		t.Errorf("%d outbox messages, want 4", outbox)
+	}
+
+	counts, err := store.BatchCounts(context.Background(), resp.BatchID)
+	if err != nil || counts[JobStatusQueued] != 4 {
+		t.Errorf("BatchCounts = %v, %v", counts, err)
+	}
+
+	// 超过上限的批次整体拒绝
+	s.MaxBatchSize = 3
+	w = httptest.NewRecorder()
+	s.handleCreateBatch(w, httptest.NewRequest(http.MethodPost, "/batches", strings.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("over limit: status %d, want 400", w.Code)
+	}
+}
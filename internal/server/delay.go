@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// DelayScheduler 定时扫描 MySQL，把到期的延时任务经发件箱释放到 RabbitMQ
+// 不依赖 rabbitmq-delayed-message-exchange 插件，任务在释放前都可以取消
+type DelayScheduler struct {
+	Store    Store
+	Interval time.Duration
+	Outbox   *OutboxRelay
+}
+
+// Run 阻塞运行，直到 ctx 被取消
+func (d *DelayScheduler) Run(ctx context.Context) {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	slog.Info("延时任务调度器已启动", "interval", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("延时任务调度器已停止")
+			return
+		case <-ticker.C:
+			d.releaseDue()
+		}
+	}
+}
+
+func (d *DelayScheduler) releaseDue() {
+	ctx := context.Background()
+	jobs, err := d.Store.DueScheduled(ctx, time.Now(), 100)
+	if err != nil {
+		slog.Error("查询到期的延时任务失败", "err", err)
+		return
+	}
+
+	released := 0
+	for _, job := range jobs {
+		ok, err := d.Store.ReleaseScheduled(ctx, job)
+		if err != nil {
+			slog.ErrorContext(jobLogContext(ctx, job), "释放延时任务失败，等待重试", "err", err)
+			continue
+		}
+		if !ok {
+			continue // 已被取消或被其他实例释放
+		}
+		released++
+		slog.InfoContext(jobLogContext(ctx, job), "延时任务已释放到发件箱")
+	}
+
+	if released > 0 {
+		d.Outbox.Notify()
+	}
+}
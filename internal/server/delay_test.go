@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveRunAt(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+
+	for name, c := range map[string]struct {
+		runAt   *time.Time
+		delay   string
+		want    time.Duration // 相对 now 的释放时间，0 表示立即执行
+		wantErr bool
+	}{
+		"immediate":      {},
+		"delay":          {delay: "30s", want: 30 * time.Second},
+		"zero delay":     {delay: "0s"},
+		"negative delay": {delay: "-5m", wantErr: true},
+		"bad delay":      {delay: "soon", wantErr: true},
+		"both":           {runAt: &future, delay: "30s", wantErr: true},
+		"run_at future":  {runAt: &future, want: time.Hour},
+		"run_at past":    {runAt: &past},
+	} {
+		got, err := resolveRunAt(c.runAt, c.delay)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %v, want error", name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if c.want == 0 {
+			if got != nil {
+				t.Errorf("%s: run_at = %v, want immediate", name, got)
+			}
+			continue
+		}
+		if got == nil || got.Sub(now) < c.want || got.Sub(now) > c.want+time.Second {
+			t.Errorf("%s: run_at = %v, want now+%s", name, got, c.want)
+		}
+	}
+}
+
+func TestDelaySchedulerReleasesDueJobs(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormStore(db)
+	ctx := context.Background()
+	past, future := time.Now().Add(-time.Second), time.Now().Add(time.Hour)
+	for _, job := range []JobRecord{
+		{JobID: "due", Status: JobStatusScheduled, RunAt: &past},
+		{JobID: "later", Status: JobStatusScheduled, RunAt: &future},
+	} {
+		if err := store.CreateJob(ctx, &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outbox := NewOutboxRelay(db, 0, 0)
+	d := &DelayScheduler{Store: store, Outbox: outbox}
+	d.releaseDue()
+
+	for id, want := range map[string]string{"due": JobStatusQueued, "later": JobStatusScheduled} {
+		job, err := store.GetJob(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != want {
+			t.Errorf("job %s = %s, want %s", id, job.Status, want)
+		}
+	}
+	select {
+	case <-outbox.wake:
+	default:
+		t.Error("outbox not notified after releasing a job")
+	}
+
+	// 没有到期任务时不唤醒发件箱
+	d.releaseDue()
+	select {
+	case <-outbox.wake:
+		t.Error("outbox notified with nothing released")
+	default:
+	}
+}
+
+// 延时任务在释放前可以取消，取消后调度器不会再释放它
+func TestCancelScheduledJob(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormStore(db)
+	s := &HttpServer{Store: store, Srv: &SentinelServer{Store: store}}
+
+	w := httptest.NewRecorder()
+	s.handleTask(w, httptest.NewRequest(http.MethodPost, "/task", strings.NewReader(`{"type":"shell","payload":"echo hi","delay":"1ms"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("submit: status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		JobID  string `json:"job_id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != JobStatusScheduled {
+		t.Fatalf("status = %s, want Scheduled", resp.Status)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/jobs/"+resp.JobID+"/cancel", nil)
+	r.SetPathValue("id", resp.JobID)
+	w = httptest.NewRecorder()
+	s.handleCancelJob(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel: status %d: %s", w.Code, w.Body)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	(&DelayScheduler{Store: store}).releaseDue()
+	job, err := store.GetJob(context.Background(), resp.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusCancelled {
+		t.Errorf("job = %s after release, want Cancelled", job.Status)
+	}
+	var outbox int64
+	db.Model(&OutboxMessage{}).Where("job_id = ?", resp.JobID).Count(&outbox)
+	if outbox != 0 {
+		t.Errorf("%d outbox messages for a cancelled job", outbox)
+	}
+}
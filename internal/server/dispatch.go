@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+// 定向派发队列：JobRecord 中 status = Assigned 且 agent_id 指向某个节点的任务，
+// 就是这个节点在 MySQL 里的待下发队列，按 id 先进先出。
+// 心跳会话把任务推给 Agent 后要等 JobAccepted 确认才改成 Accepted，
+// 没确认的任务 (发送失败、断线) 留在队列里，节点重连后重新下发。
+// Agent 收到任务时已经在排空的话会回传 Rejected，任务保持 Assigned，见 returnJob。
+
+// dispatchBatchLimit 一次最多从队列里取多少个任务下发
+const dispatchBatchLimit = 32
+
+// nextAssigned 取节点队列里还没在本次会话中下发过的任务
+func (s *SentinelServer) nextAssigned(agentID string, inflight map[string]int64, limit int) ([]JobRecord, error) {
+	ids := make([]string, 0, len(inflight))
+	for id := range inflight {
+		ids = append(ids, id)
+	}
+	return s.Store.ListJobs(context.Background(), JobQuery{
+		AgentID:       agentID,
+		Statuses:      []string{JobStatusAssigned},
+		ExcludeJobIDs: ids,
+		Limit:         min(limit, dispatchBatchLimit),
+	})
+}
+
+// markDelivered 记录一次下发
+func (s *SentinelServer) markDelivered(jobID string) {
+	if err := s.Store.MarkDelivered(context.Background(), jobID, time.Now()); err != nil {
+		slog.Error("记录任务下发失败", "job_id", jobID, "err", err)
+	}
+}
+
+// acceptJob 处理 Agent 的 JobAccepted 确认
+// 只有 Assigned 才改成 Accepted：任务可能已经被取消，或者 Agent 已经汇报了 Running
+func (s *SentinelServer) acceptJob(agentID, jobID string) {
+	_, err := s.Store.UpdateJob(context.Background(), JobMatch{
+		JobID:    jobID,
+		AgentID:  agentID,
+		Statuses: []string{JobStatusAssigned},
+	}, map[string]interface{}{
+		"status":      JobStatusAccepted,
+		"accepted_at": time.Now(),
+	})
+	if err != nil {
+		slog.Error("更新任务为 Accepted 失败", "job_id", jobID, "agent_id", agentID, "err", err)
+	}
+}
+
+// returnJob 处理 Agent 退回的任务 (下发时和 drain 指令擦肩而过)，任务保持 Assigned：
+// 按 selector 指派的任务换一个满足条件的在线节点；直接派给这个节点的任务留在它的队列里，取消排空后重新下发
+func (s *SentinelServer) returnJob(agentID, jobID string) {
+	ctx := context.Background()
+	record, err := s.Store.GetJob(ctx, jobID)
+	if err != nil || record.Status != JobStatusAssigned || record.AgentID != agentID {
+		return
+	}
+	if record.Selector == "" {
+		slog.Info("节点在维护中退回任务，任务留在队列里", "agent_id", agentID, "job_id", jobID)
+		return
+	}
+	var sel Selector
+	if err := json.Unmarshal([]byte(record.Selector), &sel); err != nil {
+		return
+	}
+	agents, err := s.Store.ListAgents(ctx, AgentQuery{NoDrain: true, NotLost: true})
+	if err != nil {
+		slog.Error("查询节点失败", "job_id", jobID, "err", err)
+		return
+	}
+	// 只考虑心跳流在线的其他节点
+	online := agents[:0]
+	for _, a := range agents {
+		if _, ok := s.sessions.Load(a.AgentID); ok && a.AgentID != agentID {
+			online = append(online, a)
+		}
+	}
+	queued, err := s.Store.QueuedCounts(ctx)
+	if err != nil {
+		slog.Error("查询节点队列失败", "job_id", jobID, "err", err)
+		return
+	}
+	candidates := pickAgents(online, sel, queued)
+	if len(candidates) == 0 {
+		slog.Warn("节点在维护中退回任务，暂时没有其他满足 selector 的节点，任务留在队列里", "agent_id", agentID, "job_id", jobID)
+		return
+	}
+	target := candidates[0].AgentID
+	// 条件更新：和取消接口并发时只有一方生效
+	moved, err := s.Store.UpdateJob(ctx, JobMatch{
+		JobID:    jobID,
+		AgentID:  agentID,
+		Statuses: []string{JobStatusAssigned},
+	}, map[string]interface{}{"agent_id": target})
+	if err != nil {
+		slog.Error("改派任务失败", "job_id", jobID, "err", err)
+		return
+	}
+	if moved {
+		slog.Info("节点在维护中退回任务，已改派给其他节点", "from", agentID, "agent_id", target, "job_id", jobID)
+		s.Kick(target)
+	}
+}
+
+// assignJob 把任务放进节点的待下发队列，并唤醒节点的心跳会话
+func (s *HttpServer) assignJob(ctx context.Context, record *JobRecord, agentID string) error {
+	record.AgentID = agentID
+	record.Status = JobStatusAssigned
+	if err := s.Store.CreateJob(ctx, record); err != nil {
+		return err
+	}
+	countSubmitted(record.Type, 1)
+	s.Srv.Events.Publish(ctx, EventJobSubmitted, "job:"+record.JobID, jobEvent(*record))
+	s.Srv.Kick(agentID) // 节点在线且有空闲槽位的话马上下发，不必等下一次心跳
+	return nil
+}
+
+// handleDispatchToAgent 直接把任务派发给指定节点
+// 节点离线时任务留在队列里，重连后下发；维护中的节点不接收新任务
+func (s *HttpServer) handleDispatchToAgent(w http.ResponseWriter, r *http.Request) {
+	// 任务还没创建时审计记录落在节点上，创建后改成任务
+	auditTarget(r.Context(), "agent:"+r.PathValue("id"))
+	agent, ok := s.findAgent(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if agent.Drain {
+		http.Error(w, "Agent is draining, undrain it first", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		Type    string `json:"type"`
+		Payload string `json:"payload"`
+		jobSpec
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request: JSON 格式错误", http.StatusBadRequest)
+		return
+	}
+	if req.Payload == "" {
+		http.Error(w, "Bad Request: payload 不能为空", http.StatusBadRequest)
+		return
+	}
+
+	record := JobRecord{
+		JobID:   newJobID(),
+		Type:    req.Type,
+		Payload: req.Payload,
+		AgentID: agent.AgentID,
+	}
+	ctx, span := startJobSpan(r.Context(), "job.submit")
+	defer span.End()
+	span.SetAttributes(jobSpanAttrs(record)...)
+	setJobTrace(ctx, &record)
+	auditTarget(ctx, "job:"+record.JobID)
+	auditDetail(ctx, "type", metricType(record.Type))
+	auditDetail(ctx, "agent_id", agent.AgentID)
+	if err := req.jobSpec.apply(ctx, s.Store, &record); err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.assignJob(ctx, &record, agent.AgentID); err != nil {
+		slog.ErrorContext(ctx, "任务入库失败", "err", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(jobLogContext(ctx, record), "任务已加入节点的下发队列", "agent_id", agent.AgentID)
+	writeJSON(w, http.StatusCreated, newJobView(record))
+}
+
+// toProtoJob 把任务记录转换成下发给 Agent 的消息
+func toProtoJob(r JobRecord) *pb.Job {
+	return &pb.Job{
+		JobId:       r.JobID,
+		Type:        jobTypeOf(r.Type),
+		Payload:     r.Payload,
+		Artifacts:   splitLines(r.Artifacts),
+		Files:       toProtoFiles(decodeJobFiles(r.Files)),
+		Env:         decodeJobEnv(r.Env),
+		Workdir:     r.Workdir,
+		User:        r.RunAs,
+		Attempt:     int32(r.DeliveryAttempts) + 1, // markDelivered 在发送之后才加一
+		SecretEnv:   secretEnvNames(r.Secrets),
+		Traceparent: r.TraceParent,
+		RequestId:   r.RequestID,
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+// 排空中的节点退回的任务不能变成失败：按 selector 指派的改派给其他在线节点，直接派发的留在原队列
+func TestRejectedJobStaysAssigned(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormStore(db)
+	s := &SentinelServer{Store: store}
+	ctx := context.Background()
+	for _, a := range []AgentModel{
+		{AgentID: "n1", Tags: joinTags([]string{"gpu"}), Drain: true},
+		{AgentID: "n2", Tags: joinTags([]string{"gpu"})},
+		{AgentID: "n3"},
+	} {
+		if err := store.CreateAgent(ctx, &a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"n1", "n2", "n3"} {
+		s.sessions.Store(id, newAgentSession(context.Background(), id))
+	}
+	jobs := []JobRecord{
+		{JobID: "sel", AgentID: "n1", Status: JobStatusAssigned, Selector: `{"tag":"gpu"}`},
+		{JobID: "direct", AgentID: "n1", Status: JobStatusAssigned},
+	}
+	for i := range jobs {
+		if err := store.CreateJob(ctx, &jobs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sess := newAgentSession(context.Background(), "n1")
+	sess.inflight["sel"], sess.inflight["direct"] = 1, 2
+	s.onHeartbeat(sess, &pb.HeartbeatReq{AgentId: "n1", Seq: 1, Accepted: []*pb.JobAccepted{
+		{JobId: "sel", Rejected: true},
+		{JobId: "direct", Rejected: true},
+	}})
+	if len(sess.inflight) != 0 {
+		t.Errorf("inflight = %v, want empty", sess.inflight)
+	}
+
+	for jobID, wantAgent := range map[string]string{"sel": "n2", "direct": "n1"} {
+		job, err := store.GetJob(ctx, jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != JobStatusAssigned || job.AgentID != wantAgent {
+			t.Errorf("job %s: status %s on %s, want Assigned on %s", jobID, job.Status, job.AgentID, wantAgent)
+		}
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	for _, c := range []struct {
+		running, max int32
+		inflight     int
+		want         int
+	}{
+		{running: 0, max: 4, want: 4},
+		{running: 1, max: 4, inflight: 2, want: 1},
+		{running: 4, max: 4, want: 0},
+		{running: 3, max: 2, want: -1}, // 运行中调小了上限
+		{max: 0, want: 1},              // 旧版 Agent 不上报上限，一次一个
+		{max: 0, inflight: 1, want: 0},
+	} {
+		sess := &agentSession{running: c.running, max: c.max, inflight: map[string]int64{}}
+		for i := range c.inflight {
+			sess.inflight[string(rune('a'+i))] = int64(i)
+		}
+		if got := sess.freeSlots(); got != c.want {
+			t.Errorf("running %d, max %d, inflight %d: freeSlots = %d, want %d", c.running, c.max, c.inflight, got, c.want)
+		}
+	}
+}
+
+// 下发后没收到确认的任务保持 Assigned，节点重连后在新的心跳流上重发；确认后变为 Accepted
+func TestUnackedJobRedeliveredAfterReconnect(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	s := &SentinelServer{Store: store}
+	ctx := context.Background()
+	if err := store.CreateAgent(ctx, &AgentModel{AgentID: "n1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	nextJob := func(st *fakeHeartbeatStream) *pb.HeartbeatResp {
+		t.Helper()
+		deadline := time.After(5 * time.Second)
+		for {
+			select {
+			case resp := <-st.sent:
+				if resp.Job != nil {
+					return resp
+				}
+			case <-deadline:
+				t.Fatal("job not dispatched")
+			}
+		}
+	}
+
+	st1, _ := connect(t, s, "n1")
+	if err := store.CreateJob(ctx, &JobRecord{JobID: "j1", AgentID: "n1", Status: JobStatusAssigned}); err != nil {
+		t.Fatal(err)
+	}
+	s.Kick("n1")
+	if resp := nextJob(st1); resp.Job.JobId != "j1" || resp.Job.Attempt != 1 {
+		t.Fatalf("first delivery = %v", resp.Job)
+	}
+	// 确认在路上丢了，Agent 重连；新会话的首条回复就带上任务
+	st2 := newFakeHeartbeatStream()
+	t.Cleanup(st2.cancel)
+	st2.reqs <- &pb.HeartbeatReq{AgentId: "n1", Seq: 1, MaxJobs: 4}
+	go s.Heartbeat(st2)
+	resp := nextJob(st2)
+	if resp.Job.JobId != "j1" || resp.Job.Attempt != 2 {
+		t.Fatalf("redelivery = %v, want j1 attempt 2", resp.Job)
+	}
+	if job, _ := store.GetJob(ctx, "j1"); job.Status != JobStatusAssigned || job.DeliveryAttempts != 2 {
+		t.Fatalf("job = %s after %d deliveries, want Assigned after 2", job.Status, job.DeliveryAttempts)
+	}
+
+	st2.reqs <- &pb.HeartbeatReq{AgentId: "n1", Seq: 2, MaxJobs: 4, Accepted: []*pb.JobAccepted{{JobId: "j1"}}}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := store.GetJob(ctx, "j1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == JobStatusAccepted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job = %s after ack, want Accepted", job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// 已确认的任务不再重发
+	s.Kick("n1")
+	select {
+	case resp := <-st2.sent:
+		if resp.Job != nil {
+			t.Errorf("accepted job sent again: %v", resp.Job)
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,560 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	gcdb "github.com/stywzn/Go-Cloud-Compute/pkg/db"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+)
+
+// 事件类型
+const (
+	EventAgentRegistered = "agent.registered"
+	EventAgentLost       = "agent.lost"
+	EventAgentDeleted    = "agent.deleted"
+	EventJobSubmitted    = "job.submitted"
+	EventJobDispatched   = "job.dispatched" // 经心跳流下发到节点 (每次重新下发都会发一次)
+	EventJobStarted      = "job.started"
+	EventJobSucceeded    = "job.succeeded"
+	EventJobFailed       = "job.failed"
+	EventJobCancelled    = "job.cancelled"
+	EventBatchSubmitted  = "batch.submitted"
+	EventBatchCompleted  = "batch.completed"
+)
+
+// eventTypes 总线上所有的事件类型
+var eventTypes = map[string]bool{
+	EventAgentRegistered: true,
+	EventAgentLost:       true,
+	EventAgentDeleted:    true,
+	EventJobSubmitted:    true,
+	EventJobDispatched:   true,
+	EventJobStarted:      true,
+	EventJobSucceeded:    true,
+	EventJobFailed:       true,
+	EventJobCancelled:    true,
+	EventBatchSubmitted:  true,
+	EventBatchCompleted:  true,
+}
+
+const (
+	defaultEventLimit   = 100
+	maxEventLimit       = 1000
+	eventPollInterval   = 2 * time.Second  // 兜底轮询，其他 Server 实例发布的事件靠它发现
+	eventKeepAlive      = 15 * time.Second // SSE 空闲时发注释行，避免被代理断开
+	defaultEventWait    = 30 * time.Second
+	maxEventWait        = 60 * time.Second
+	eventPurgeInterval  = time.Hour
+	eventMaxResultBytes = 4 << 10 // job.* 事件里任务输出最多带多少字节
+	eventLockName       = "event_records"
+	eventLockTimeout    = 10 // 秒，等待写事件的命名锁
+)
+
+// EventRecord 持久化的事件，自增 ID 就是订阅方续传用的游标 (按 ID 顺序提交，见 EventBus.insert)
+type EventRecord struct {
+	ID        uint64    `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	Type      string    `gorm:"index;size:64"`
+	Subject   string    `gorm:"index;size:191"` // 事件关联的对象，如 job:job-1a2b、agent:node-1、batch:batch-3c4d
+	RequestID string    `gorm:"size:64"`
+	Data      string    `gorm:"type:text"` // 事件内容 (JSON)，结构随类型不同，见下面的 xxxEvent
+}
+
+// Event 是 GET /events 的返回结构，也是总线监听方收到的内容
+type Event struct {
+	ID        uint64          `json:"id"`
+	Type      string          `json:"type"`
+	Subject   string          `json:"subject"`
+	Time      time.Time       `json:"time"`
+	RequestID string          `json:"request_id,omitempty"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func newEvent(r EventRecord) Event {
+	return Event{
+		ID:        r.ID,
+		Type:      r.Type,
+		Subject:   r.Subject,
+		Time:      r.CreatedAt,
+		RequestID: r.RequestID,
+		Data:      json.RawMessage(r.Data),
+	}
+}
+
+// agentEvent agent.* 事件的内容
+type agentEvent struct {
+	AgentID    string     `json:"agent_id"`
+	Hostname   string     `json:"hostname,omitempty"`
+	IP         string     `json:"ip,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	Version    string     `json:"version,omitempty"`
+	Drain      bool       `json:"drain,omitempty"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	LostAt     *time.Time `json:"lost_at,omitempty"`
+}
+
+func newAgentEvent(a AgentModel) agentEvent {
+	return agentEvent{
+		AgentID:    a.AgentID,
+		Hostname:   a.Hostname,
+		IP:         a.IP,
+		Tags:       splitList(a.Tags),
+		Version:    a.AgentVersion,
+		Drain:      a.Drain,
+		LastSeenAt: a.LastSeenAt,
+		LostAt:     a.LostAt,
+	}
+}
+
+// jobDispatchedEvent job.dispatched 事件的内容
+type jobDispatchedEvent struct {
+	JobID   string `json:"job_id"`
+	AgentID string `json:"agent_id"`
+	Attempt int32  `json:"attempt"`
+}
+
+// batchEvent batch.* 事件的内容
+type batchEvent struct {
+	BatchID     string         `json:"batch_id"`
+	Type        string         `json:"type"`
+	Total       int            `json:"total"`
+	Counts      map[string]int `json:"counts,omitempty"` // 各状态的任务数，batch.completed 才有
+	CreatedAt   time.Time      `json:"created_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+}
+
+// jobEvent job.* 事件的内容；输出截断，避免把大段日志推给每个订阅方，完整输出用 GET /jobs/{id} 查询
+func jobEvent(record JobRecord) jobView {
+	v := newJobView(record)
+	v.Result = truncate(v.Result, eventMaxResultBytes)
+	return v
+}
+
+// jobFinishedEvent 任务终态对应的事件
+func jobFinishedEvent(status string) string {
+	switch status {
+	case JobStatusSuccess:
+		return EventJobSucceeded
+	case JobStatusFailed:
+		return EventJobFailed
+	default:
+		return EventJobCancelled
+	}
+}
+
+// onJobFinished 任务进入终态后调用 (record 已是更新后的状态)：发出任务事件，批次里最后一个任务结束时再发 batch.completed
+func (s *SentinelServer) onJobFinished(ctx context.Context, record JobRecord) {
+	s.Events.Publish(ctx, jobFinishedEvent(record.Status), "job:"+record.JobID, jobEvent(record))
+	if record.BatchID != "" {
+		s.checkBatchCompleted(ctx, record.BatchID)
+	}
+}
+
+// checkBatchCompleted 批次的任务全部结束时记下完成时间并发出 batch.completed
+// 完成时间是条件更新，并发汇报时只有一个能发出事件
+func (s *SentinelServer) checkBatchCompleted(ctx context.Context, batchID string) {
+	now := time.Now()
+	if done, err := s.Store.CompleteBatch(ctx, batchID, now); err != nil || !done {
+		return
+	}
+
+	batch, err := s.Store.GetBatch(ctx, batchID)
+	if err != nil {
+		return
+	}
+	counts, _ := s.Store.BatchCounts(ctx, batchID)
+	slog.InfoContext(ctx, "批次已完成", "batch_id", batchID, "total", batch.Total, "counts", counts)
+	s.Events.Publish(ctx, EventBatchCompleted, "batch:"+batch.BatchID, batchEvent{
+		BatchID:     batch.BatchID,
+		Type:        batch.Type,
+		Total:       batch.Total,
+		Counts:      counts,
+		CreatedAt:   batch.CreatedAt,
+		CompletedAt: &now,
+	})
+}
+
+// EventBus 服务端内部的事件总线：各模块发布状态变化，先落库再通知监听方 (如 Webhook)
+// 和唤醒 GET /events 的订阅方；事件保留 Retention 后清理
+// 事件表只由 EventBus 读写，不经过 Store
+type EventBus struct {
+	DB        *gorm.DB
+	Retention time.Duration
+
+	lock      eventLock // 为 nil 时直接插入，见 insert
+	mu        sync.Mutex
+	changed   chan struct{} // 有新事件时关闭并换一个新的，用来同时唤醒所有等待的订阅方
+	listeners []func(context.Context, Event)
+}
+
+func NewEventBus(db *gorm.DB, retention time.Duration) *EventBus {
+	bus := &EventBus{
+		DB:        db,
+		Retention: retention,
+		changed:   make(chan struct{}),
+	}
+	if db.Dialector.Name() == gcdb.DriverMySQL {
+		bus.lock = mysqlEventLock{}
+	}
+	return bus
+}
+
+// Listen 注册监听函数，在 Publish 的调用方协程里同步执行，不要做耗时操作
+// 只能在启动阶段调用
+func (b *EventBus) Listen(fn func(context.Context, Event)) {
+	b.listeners = append(b.listeners, fn)
+}
+
+// Publish 发布事件；subject 是事件关联的对象，data 是对应类型的 xxxEvent
+// 事件通知尽力而为：写入失败只记日志，不影响触发它的操作。b 为 nil 时什么也不做
+func (b *EventBus) Publish(ctx context.Context, typ, subject string, data interface{}) {
+	if b == nil {
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		slog.ErrorContext(ctx, "编码事件失败", "type", typ, "err", err)
+		return
+	}
+	record := EventRecord{
+		Type:      typ,
+		Subject:   subject,
+		RequestID: logging.RequestID(ctx),
+		Data:      string(raw),
+	}
+	if err := b.insert(&record); err != nil {
+		slog.ErrorContext(ctx, "保存事件失败", "type", typ, "subject", subject, "err", err)
+		return
+	}
+	slog.DebugContext(ctx, "事件已发布", "event_id", record.ID, "type", typ, "subject", subject)
+
+	b.mu.Lock()
+	close(b.changed)
+	b.changed = make(chan struct{})
+	b.mu.Unlock()
+
+	ev := newEvent(record)
+	for _, fn := range b.listeners {
+		fn(ctx, ev)
+	}
+}
+
+// insert 写入事件，保证事件按 ID 的顺序提交
+// MySQL 并发插入时自增 ID 的提交顺序和分配顺序可能不一致 (N+1 先于 N 提交)，
+// 订阅方的游标越过 N+1 后就再也看不到 N；所以在 lock 里插入，上一条提交后下一条才分配 ID。
+// SQLite 只有一个写连接，本来就按顺序提交，lock 为 nil
+func (b *EventBus) insert(record *EventRecord) error {
+	if b.lock == nil {
+		return b.DB.Create(record).Error
+	}
+	return b.DB.Connection(func(conn *gorm.DB) error {
+		unlock, err := b.lock.Lock(conn)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		return conn.Create(record).Error
+	})
+}
+
+// eventLock 写事件时持有的锁，Lock 和插入在同一个连接 conn 上执行，返回的 unlock 释放锁
+type eventLock interface {
+	Lock(conn *gorm.DB) (unlock func(), err error)
+}
+
+// mysqlEventLock MySQL 的命名锁 (GET_LOCK)，多个 Server 实例之间也互斥
+type mysqlEventLock struct{}
+
+func (mysqlEventLock) Lock(conn *gorm.DB) (func(), error) {
+	var got int
+	if err := conn.Raw("SELECT GET_LOCK(?, ?)", eventLockName, eventLockTimeout).Scan(&got).Error; err != nil {
+		return nil, err
+	}
+	if got != 1 {
+		return nil, errors.New("timed out waiting for the event lock")
+	}
+	return func() { conn.Exec("SELECT RELEASE_LOCK(?)", eventLockName) }, nil
+}
+
+// wait 返回一个在下一次 Publish 时关闭的 channel；要在查询之前拿，避免漏掉查询期间发布的事件
+func (b *EventBus) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.changed
+}
+
+// Run 定时清理超过保留期的事件，阻塞运行，直到 ctx 被取消
+func (b *EventBus) Run(ctx context.Context) {
+	if b.Retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(eventPurgeInterval)
+	defer ticker.Stop()
+
+	slog.Info("事件清理协程已启动", "retention", b.Retention)
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("事件清理协程已停止")
+			return
+		case <-ticker.C:
+			b.purge()
+		}
+	}
+}
+
+func (b *EventBus) purge() {
+	res := b.DB.Where("created_at < ?", time.Now().Add(-b.Retention)).Delete(&EventRecord{})
+	if res.Error != nil {
+		slog.Error("清理事件失败", "err", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		slog.Info("已清理过期事件", "count", res.RowsAffected)
+	}
+}
+
+// eventFilter GET /events 的过滤条件
+type eventFilter struct {
+	types   []string // 精确类型或以 * 结尾的前缀，如 job.*
+	subject string   // 精确匹配，以 * 结尾时按前缀匹配，如 agent:*
+}
+
+func parseEventFilter(q url.Values) (eventFilter, error) {
+	var f eventFilter
+	for _, v := range q["type"] {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if t == "" {
+				continue
+			}
+			if !strings.HasSuffix(t, "*") && !eventTypes[t] {
+				return f, fmt.Errorf("不支持的事件类型 %q", t)
+			}
+			f.types = append(f.types, t)
+		}
+	}
+	f.subject = q.Get("subject")
+	return f, nil
+}
+
+func (f eventFilter) apply(db *gorm.DB) *gorm.DB {
+	if len(f.types) > 0 {
+		db = db.Where(anyOf(db, "type", f.types))
+	}
+	if f.subject != "" {
+		if prefix, ok := strings.CutSuffix(f.subject, "*"); ok {
+			db = db.Where("subject LIKE ? ESCAPE '!'", escapeLike(prefix)+"%")
+		} else {
+			db = db.Where("subject = ?", f.subject)
+		}
+	}
+	return db
+}
+
+// anyOf 把多个精确值或前缀拼成 (col = ? OR col LIKE ? ...)
+func anyOf(db *gorm.DB, col string, values []string) *gorm.DB {
+	cond := db.Session(&gorm.Session{NewDB: true})
+	for _, v := range values {
+		if prefix, ok := strings.CutSuffix(v, "*"); ok {
+			cond = cond.Or(col+" LIKE ? ESCAPE '!'", escapeLike(prefix)+"%")
+		} else {
+			cond = cond.Or(col+" = ?", v)
+		}
+	}
+	return cond
+}
+
+// since 查询游标之后的事件，按 ID 升序
+func (b *EventBus) since(after uint64, f eventFilter, limit int) ([]Event, error) {
+	var records []EventRecord
+	err := f.apply(b.DB.Model(&EventRecord{})).
+		Where("id > ?", after).
+		Order("id").
+		Limit(limit).
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, len(records))
+	for i, r := range records {
+		events[i] = newEvent(r)
+	}
+	return events, nil
+}
+
+// lastID 当前最新事件的 ID，没有事件时为 0
+func (b *EventBus) lastID() (uint64, error) {
+	var id uint64
+	err := b.DB.Model(&EventRecord{}).Select("COALESCE(MAX(id), 0)").Scan(&id).Error
+	return id, err
+}
+
+// handleEvents 事件流
+// Accept: text/event-stream 时按 SSE 推送，断线重连时浏览器会带上 Last-Event-ID 续传；
+// 否则按长轮询返回 {"events": [...], "next": 游标}，没有新事件时最多等 wait (默认 30s，最多 60s)
+// 游标用 after=<事件 ID> 指定：长轮询不带 after 时从保留的最早事件开始，SSE 不带时只推之后的新事件
+// 过滤：type=job.failed,agent.*、subject=job:job-1a2b 或 subject=agent:*
+func (s *HttpServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	bus := s.Srv.Events
+	if bus == nil {
+		http.Error(w, "event bus is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	filter, err := parseEventFilter(q)
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultEventLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Bad Request: limit 必须是正整数", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxEventLimit)
+	}
+
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	cursor := q.Get("after")
+	if cursor == "" {
+		cursor = r.Header.Get("Last-Event-ID")
+	}
+	var after uint64
+	switch {
+	case cursor != "":
+		if after, err = strconv.ParseUint(cursor, 10, 64); err != nil {
+			http.Error(w, "Bad Request: after 必须是事件 ID", http.StatusBadRequest)
+			return
+		}
+	case sse:
+		if after, err = bus.lastID(); err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if sse {
+		s.streamEvents(w, r, bus, filter, after, limit)
+		return
+	}
+
+	wait := defaultEventWait
+	if v := q.Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			http.Error(w, "Bad Request: wait 格式错误，示例: 0s、10s、1m", http.StatusBadRequest)
+			return
+		}
+		wait = min(d, maxEventWait)
+	}
+	s.pollEvents(w, r, bus, filter, after, limit, wait)
+}
+
+// pollEvents 长轮询：有事件立即返回，没有时等到有新事件或超时
+func (s *HttpServer) pollEvents(w http.ResponseWriter, r *http.Request, bus *EventBus, f eventFilter, after uint64, limit int, wait time.Duration) {
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+
+	for {
+		changed := bus.wait()
+		events, err := bus.since(after, f, limit)
+		if err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		if len(events) > 0 {
+			after = events[len(events)-1].ID
+		}
+		if len(events) > 0 || wait == 0 {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"events": events, "next": after})
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout.C:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"events": events, "next": after})
+			return
+		case <-changed:
+		case <-poll.C:
+		}
+	}
+}
+
+// streamEvents SSE：先补发游标之后的事件，再持续推送新事件，直到客户端断开
+func (s *HttpServer) streamEvents(w http.ResponseWriter, r *http.Request, bus *EventBus, f eventFilter, after uint64, limit int) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // 关掉 nginx 的响应缓冲
+	w.WriteHeader(http.StatusOK)
+	// 告诉客户端断线后多久重连
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if err := rc.Flush(); err != nil {
+		slog.WarnContext(r.Context(), "事件流不支持 flush", "err", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+
+	slog.InfoContext(r.Context(), "事件流已连接", "after", after)
+	defer slog.InfoContext(r.Context(), "事件流已断开", "after", after)
+	for {
+		changed := bus.wait()
+		events, err := bus.since(after, f, limit)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "查询事件失败", "err", err)
+			return
+		}
+		for _, ev := range events {
+			data, _ := json.Marshal(ev)
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data); err != nil {
+				return
+			}
+			after = ev.ID
+		}
+		if len(events) > 0 {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+		// 一页没推完的话马上接着查
+		if len(events) == limit {
+			continue
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-changed:
+		case <-poll.C:
+		}
+	}
+}
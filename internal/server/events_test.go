@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// 并发发布时，按游标续读的订阅方要看到每个事件恰好一次，不能因为 ID 提交乱序而跳过
+func TestEventCursorSeesConcurrentPublishes(t *testing.T) {
+	bus := NewEventBus(newTestDB(t), 0)
+	const publishers, perPublisher = 8, 25
+	total := publishers * perPublisher
+
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perPublisher; i++ {
+				bus.Publish(context.Background(), EventJobSubmitted, "job:x", map[string]int{"i": i})
+			}
+		}()
+	}
+
+	seen := make(map[uint64]bool, total)
+	var after uint64
+	deadline := time.Now().Add(10 * time.Second)
+	for len(seen) < total && time.Now().Before(deadline) {
+		events, err := bus.since(after, eventFilter{}, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ev := range events {
+			if ev.ID <= after || seen[ev.ID] {
+				t.Fatalf("event %d returned again after cursor %d", ev.ID, after)
+			}
+			seen[ev.ID] = true
+			after = ev.ID
+		}
+	}
+	wg.Wait()
+	if len(seen) != total {
+		t.Fatalf("cursor reader saw %d events, want %d", len(seen), total)
+	}
+}
+
+// fakeEventLock 代替 MySQL 的命名锁，记录加锁次数和当前持有者数量
+type fakeEventLock struct {
+	mu       sync.Mutex
+	held     atomic.Int32
+	locks    atomic.Int32
+	unlocks  atomic.Int32
+	overlaps atomic.Int32 // 同时有两个持有者的次数
+	err      error
+}
+
+func (l *fakeEventLock) Lock(conn *gorm.DB) (func(), error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	l.mu.Lock()
+	l.locks.Add(1)
+	if l.held.Add(1) != 1 {
+		l.overlaps.Add(1)
+	}
+	return func() {
+		l.held.Add(-1)
+		l.unlocks.Add(1)
+		l.mu.Unlock()
+	}, nil
+}
+
+func TestNewEventBusUsesNamedLockOnMySQL(t *testing.T) {
+	if bus := NewEventBus(newTestDB(t), 0); bus.lock != nil {
+		t.Errorf("sqlite bus has lock %T, want none", bus.lock)
+	}
+	// 不连数据库，只看方言
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "u:p@tcp(127.0.0.1:1)/gcc", SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := NewEventBus(db, 0).lock.(mysqlEventLock); !ok {
+		t.Error("mysql bus does not use the named lock")
+	}
+}
+
+// 有锁时每条事件都要在持有锁期间插入，且同一时刻只有一个发布方在插入
+func TestEventInsertHoldsLock(t *testing.T) {
+	db := newTestDB(t)
+	lock := &fakeEventLock{}
+	var unlockedInserts atomic.Int32
+	err := db.Callback().Create().Before("gorm:create").Register("test:event_lock", func(tx *gorm.DB) {
+		if tx.Statement.Table == "event_records" && lock.held.Load() != 1 {
+			unlockedInserts.Add(1)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := NewEventBus(db, 0)
+	bus.lock = lock
+	var notified atomic.Int32
+	bus.Listen(func(context.Context, Event) { notified.Add(1) })
+
+	const publishers, perPublisher = 8, 25
+	total := publishers * perPublisher
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perPublisher; i++ {
+				bus.Publish(context.Background(), EventJobSubmitted, "job:x", map[string]int{"i": i})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := unlockedInserts.Load(); n != 0 {
+		t.Errorf("%d events inserted without holding the lock", n)
+	}
+	if n := lock.overlaps.Load(); n != 0 {
+		t.Errorf("lock held by two publishers %d times", n)
+	}
+	if l, u := lock.locks.Load(), lock.unlocks.Load(); l != int32(total) || u != l {
+		t.Errorf("locked %d times, unlocked %d times, want %d", l, u, total)
+	}
+	events, err := bus.since(0, eventFilter{}, total+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != total || notified.Load() != int32(total) {
+		t.Errorf("stored %d events, notified %d, want %d", len(events), notified.Load(), total)
+	}
+}
+
+// 拿不到锁时事件不落库，也不通知监听方和订阅方
+func TestEventLockFailureDropsEvent(t *testing.T) {
+	bus := NewEventBus(newTestDB(t), 0)
+	bus.lock = &fakeEventLock{err: errors.New("timed out waiting for the event lock")}
+	notified := false
+	bus.Listen(func(context.Context, Event) { notified = true })
+	changed := bus.wait()
+
+	bus.Publish(context.Background(), EventJobSubmitted, "job:x", nil)
+
+	events, err := bus.since(0, eventFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 || notified {
+		t.Errorf("stored %d events, notified %v after lock failure", len(events), notified)
+	}
+	select {
+	case <-changed:
+		t.Error("subscribers woken after lock failure")
+	default:
+	}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/mq"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/storage"
+)
+
+// FileRecord 通过 POST /files 上传的输入文件，任务按 FileID 引用，内容在存储后端里
+type FileRecord struct {
+	gorm.Model
+	FileID     string `gorm:"uniqueIndex;size:191"`
+	Name       string `gorm:"size:255"` // 上传时的文件名，任务没指定 path 时用它
+	Size       int64
+	SHA256     string `gorm:"column:sha256;index;size:64"`
+	StorageKey string `gorm:"size:512"`
+}
+
+// 单个任务最多引用多少个输入文件
+const maxJobFiles = 32
+
+// newFileID 生成随机文件 ID
+func newFileID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "file-" + hex.EncodeToString(b)
+}
+
+// fileView 是文件接口的返回结构
+type fileView struct {
+	FileID    string    `json:"file_id"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newFileView(f FileRecord) fileView {
+	return fileView{
+		FileID:    f.FileID,
+		Name:      f.Name,
+		Size:      f.Size,
+		SHA256:    f.SHA256,
+		CreatedAt: f.CreatedAt,
+	}
+}
+
+var errFileTooLarge = errors.New("file exceeds max_file_size")
+
+// limitedReader 超过上限时返回 errFileTooLarge，而不是像 io.LimitReader 那样悄悄截断
+type limitedReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.limit > 0 && l.n > l.limit {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
+
+// handleUploadFile 上传输入文件：multipart/form-data 的 file 字段，
+// 或者直接把文件内容作为请求体、用 ?name= 指定文件名
+func (s *HttpServer) handleUploadFile(w http.ResponseWriter, r *http.Request) {
+	body, name := io.Reader(r.Body), r.URL.Query().Get("name")
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				http.Error(w, "Bad Request: 缺少 file 字段", http.StatusBadRequest)
+				return
+			}
+			if part.FormName() == "file" {
+				body, name = part, part.FileName()
+				break
+			}
+		}
+	}
+	name = path.Base(name)
+	if name == "." || name == "/" || name == "" {
+		http.Error(w, "Bad Request: 缺少文件名", http.StatusBadRequest)
+		return
+	}
+
+	record := FileRecord{FileID: newFileID(), Name: name}
+	auditTarget(r.Context(), "file:"+record.FileID)
+	record.StorageKey = path.Join("files", record.FileID)
+	h := sha256.New()
+	lr := &limitedReader{r: io.TeeReader(body, h), limit: s.Srv.MaxArtifactSize}
+	if err := s.Srv.Storage.Put(r.Context(), record.StorageKey, lr, -1); err != nil {
+		if errors.Is(err, errFileTooLarge) {
+			http.Error(w, fmt.Sprintf("文件超过大小上限 (%d 字节)", s.Srv.MaxArtifactSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		slog.ErrorContext(r.Context(), "保存上传文件失败", "key", record.StorageKey, "err", err)
+		http.Error(w, "Storage Error", http.StatusInternalServerError)
+		return
+	}
+	record.Size, record.SHA256 = lr.n, hex.EncodeToString(h.Sum(nil))
+
+	if err := s.Store.CreateFile(r.Context(), &record); err != nil {
+		s.Srv.Storage.Delete(r.Context(), record.StorageKey)
+		slog.ErrorContext(r.Context(), "文件记录入库失败", "file_id", record.FileID, "err", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "文件已上传", "file_id", record.FileID, "name", record.Name, "size", record.Size)
+	writeJSON(w, http.StatusCreated, newFileView(record))
+}
+
+// handleGetFile 查询文件信息
+func (s *HttpServer) handleGetFile(w http.ResponseWriter, r *http.Request) {
+	record, err := s.Store.GetFile(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, newFileView(record))
+}
+
+// resolveJobFiles 提交任务时把引用的文件 ID 解析成带校验和的输入文件列表，
+// 校验和跟着任务一起下发，Agent 据此校验下载内容、查本地缓存
+func resolveJobFiles(ctx context.Context, store Store, files []mq.InputFile) ([]mq.InputFile, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	if len(files) > maxJobFiles {
+		return nil, fmt.Errorf("files 最多 %d 个", maxJobFiles)
+	}
+
+	ids := make([]string, len(files))
+	for i, f := range files {
+		ids[i] = f.FileID
+	}
+	records, err := store.GetFiles(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]FileRecord, len(records))
+	for _, rec := range records {
+		byID[rec.FileID] = rec
+	}
+
+	out := make([]mq.InputFile, len(files))
+	paths := make(map[string]bool, len(files))
+	for i, f := range files {
+		rec, ok := byID[f.FileID]
+		if !ok {
+			return nil, fmt.Errorf("文件 %q 不存在", f.FileID)
+		}
+		p := f.Path
+		if p == "" {
+			p = rec.Name
+		}
+		clean, err := storage.CleanKey(p)
+		if err != nil {
+			return nil, fmt.Errorf("文件路径 %q 必须是工作目录下的相对路径", p)
+		}
+		if paths[clean] {
+			return nil, fmt.Errorf("文件路径 %q 重复", clean)
+		}
+		paths[clean] = true
+		out[i] = mq.InputFile{FileID: rec.FileID, Path: clean, SHA256: rec.SHA256, Size: rec.Size}
+	}
+	return out, nil
+}
+
+// encodeJobFiles 输入文件以 JSON 存在 JobRecord.Files 里
+func encodeJobFiles(files []mq.InputFile) string {
+	if len(files) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(files)
+	return string(b)
+}
+
+func decodeJobFiles(s string) []mq.InputFile {
+	if s == "" {
+		return nil
+	}
+	var files []mq.InputFile
+	json.Unmarshal([]byte(s), &files)
+	return files
+}
+
+func toProtoFiles(files []mq.InputFile) []*pb.InputFile {
+	out := make([]*pb.InputFile, len(files))
+	for i, f := range files {
+		out[i] = &pb.InputFile{FileId: f.FileID, Path: f.Path, Sha256: f.SHA256, Size: f.Size}
+	}
+	return out
+}
+
+const fileChunkSize = 64 << 10
+
+// DownloadFile Agent 下载任务的输入文件，按 64KiB 分片流式返回
+func (s *SentinelServer) DownloadFile(req *pb.DownloadFileReq, stream pb.SentinelService_DownloadFileServer) error {
+	record, err := s.Store.GetFile(stream.Context(), req.FileId)
+	if errors.Is(err, ErrNotFound) {
+		return status.Errorf(codes.NotFound, "file %s not found", req.FileId)
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	body, _, err := s.Storage.Get(stream.Context(), record.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return status.Errorf(codes.NotFound, "content of file %s is missing", req.FileId)
+	}
+	if err != nil {
+		slog.ErrorContext(stream.Context(), "读取输入文件失败", "key", record.StorageKey, "err", err)
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer body.Close()
+
+	buf := make([]byte, fileChunkSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&pb.FileChunk{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+	slog.InfoContext(stream.Context(), "Agent 已下载输入文件", "agent_id", req.AgentId, "file_id", record.FileID)
+	return nil
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/mq"
+)
+
+func uploadFile(t *testing.T, h *HttpServer, r *http.Request) (fileView, int) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.handleUploadFile(w, r)
+	var view fileView
+	if w.Code == http.StatusCreated {
+		if err := json.Unmarshal(w.Body.Bytes(), &view); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return view, w.Code
+}
+
+func TestUploadFile(t *testing.T) {
+	s, _ := newArtifactTestServer(t, 16)
+	h := &HttpServer{Store: s.Store, Srv: s}
+	sum := sha256.Sum256([]byte("hello"))
+
+	// 请求体直接是文件内容，文件名只取最后一段
+	view, code := uploadFile(t, h, httptest.NewRequest(http.MethodPost, "/files?name=../../etc/input.txt", strings.NewReader("hello")))
+	if code != http.StatusCreated {
+		t.Fatalf("raw upload: status %d", code)
+	}
+	if view.Name != "input.txt" || view.Size != 5 || view.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("raw upload = %+v", view)
+	}
+	stored, err := s.Store.GetFile(context.Background(), view.FileID)
+	if err != nil || stored.StorageKey != "files/"+view.FileID {
+		t.Errorf("stored file = %+v, %v", stored, err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("comment", "ignored")
+	fw, _ := mw.CreateFormFile("file", "data.csv")
+	fw.Write([]byte("a,b"))
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/files", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if view, code := uploadFile(t, h, r); code != http.StatusCreated || view.Name != "data.csv" || view.Size != 3 {
+		t.Errorf("multipart upload = %+v, status %d", view, code)
+	}
+
+	if _, code := uploadFile(t, h, httptest.NewRequest(http.MethodPost, "/files", strings.NewReader("hello"))); code != http.StatusBadRequest {
+		t.Errorf("missing name: status %d, want 400", code)
+	}
+	if _, code := uploadFile(t, h, httptest.NewRequest(http.MethodPost, "/files?name=big", strings.NewReader(strings.Repeat("x", 17)))); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("too large: status %d, want 413", code)
+	}
+}
+
+func TestResolveJobFiles(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	ctx := context.Background()
+	for _, f := range []FileRecord{
+		{FileID: "f1", Name: "input.txt", Size: 5, SHA256: "aa"},
+		{FileID: "f2", Name: "input.txt", Size: 7, SHA256: "bb"},
+	} {
+		if err := store.CreateFile(ctx, &f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := resolveJobFiles(ctx, store, []mq.InputFile{{FileID: "f1"}, {FileID: "f2", Path: "data/./second.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mq.InputFile{
+		{FileID: "f1", Path: "input.txt", SHA256: "aa", Size: 5},
+		{FileID: "f2", Path: "data/second.txt", SHA256: "bb", Size: 7},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("resolveJobFiles = %+v, want %+v", got, want)
+	}
+
+	many := make([]mq.InputFile, maxJobFiles+1)
+	for name, files := range map[string][]mq.InputFile{
+		"unknown file":   {{FileID: "missing"}},
+		"absolute path":  {{FileID: "f1", Path: "/etc/passwd"}},
+		"escaping path":  {{FileID: "f1", Path: "a/../../x"}},
+		"duplicate path": {{FileID: "f1"}, {FileID: "f2"}},
+		"too many":       many,
+	} {
+		if _, err := resolveJobFiles(ctx, store, files); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+type fakeDownloadStream struct {
+	grpc.ServerStream
+	data   bytes.Buffer
+	chunks int
+}
+
+func (f *fakeDownloadStream) Context() context.Context { return context.Background() }
+
+func (f *fakeDownloadStream) Send(c *pb.FileChunk) error {
+	f.chunks++
+	f.data.Write(c.Data)
+	return nil
+}
+
+func TestDownloadFile(t *testing.T) {
+	s, _ := newArtifactTestServer(t, 0)
+	h := &HttpServer{Store: s.Store, Srv: s}
+	content := strings.Repeat("0123456789", fileChunkSize/5) // 两个分片
+	view, code := uploadFile(t, h, httptest.NewRequest(http.MethodPost, "/files?name=big.bin", strings.NewReader(content)))
+	if code != http.StatusCreated {
+		t.Fatalf("upload: status %d", code)
+	}
+
+	stream := &fakeDownloadStream{}
+	if err := s.DownloadFile(&pb.DownloadFileReq{FileId: view.FileID, AgentId: "n1"}, stream); err != nil {
+		t.Fatal(err)
+	}
+	if stream.data.String() != content || stream.chunks != 2 {
+		t.Errorf("downloaded %d bytes in %d chunks, want %d bytes in 2", stream.data.Len(), stream.chunks, len(content))
+	}
+
+	err := s.DownloadFile(&pb.DownloadFileReq{FileId: "missing"}, &fakeDownloadStream{})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("missing file: %v, want NotFound", err)
+	}
+}
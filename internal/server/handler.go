@@ -2,62 +2,176 @@ package server
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/secrets"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/storage"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/tracing"
 )
 
+// Agent 状态
+const (
+	AgentStatusOnline   = "Online"
+	AgentStatusDraining = "Draining" // 已下发 drain，等待在途任务结束
+	AgentStatusDrained  = "Drained"  // 在途任务已清空，可以安全维护
+)
+
+// Agent 在途任务清空后在心跳里上报的状态 (HeartbeatReq.state)
+const agentStateDrained = "Drained"
+
 type AgentModel struct {
 	gorm.Model
 	AgentID  string `gorm:"uniqueIndex;size:191"`
 	Hostname string
 	IP       string
 	Status   string
+	Drain    bool // 运维通过 POST /agents/{id}/drain 设置，Agent 重连后依然保持
+
+	// 以下字段由注册请求上报
+	Tags         string `gorm:"size:1024"` // 逗号分隔并首尾加逗号 (",gpu,prod,")，方便 LIKE 过滤
+	OS           string `gorm:"size:64"`
+	Arch         string `gorm:"size:64"`
+	Kernel       string `gorm:"size:191"`
+	AgentVersion string `gorm:"size:64"`
+	Capabilities string `gorm:"size:512"` // 逗号分隔
+
+	// 以下字段来自 Agent 自动采集的主机信息 (RegisterReq.facts)
+	IPs         string `gorm:"column:ips;size:1024"` // 逗号分隔
+	OSRelease   string `gorm:"column:os_release;size:191"`
+	CPUCount    int    `gorm:"column:cpu_count"`
+	CPUModel    string `gorm:"column:cpu_model;size:191"`
+	MemoryTotal int64  // 字节
+	DiskTotal   int64  // 根分区，字节
+	DiskFree    int64
+	BuildCommit string `gorm:"size:64"`
+	Container   string `gorm:"size:32"`
+	Hypervisor  string `gorm:"size:32"`
+
+	// 以下字段由心跳维护
+	RunningJobs   int        // 已占用的并发槽位
+	MaxJobs       int        // 并发上限，0 表示旧版 Agent 未上报
+	ConfigVersion string     `gorm:"size:255"` // Agent 当前生效的配置版本，见 AgentProfile
+	LastSeenAt    *time.Time `gorm:"index"`
+	LostAt        *time.Time // AgentWatcher 判定失联的时间，恢复心跳后清空；保证 agent.lost 事件只发一次
 }
 
+// 任务状态
+const (
+	JobStatusScheduled = "Scheduled" // 延时任务，等待到点释放到 MQ
+	JobStatusQueued    = "Queued"    // 已进入 MQ，等待 Agent 消费
+	JobStatusAssigned  = "Assigned"  // 已进入某个节点的下发队列，等待经心跳流下发 (见 dispatch.go)
+	JobStatusAccepted  = "Accepted"  // Agent 已确认收到，等待空闲槽位
+	JobStatusRunning   = "Running"   // Agent 已开始执行
+	JobStatusSuccess   = "Success"
+	JobStatusFailed    = "Failed"
+	JobStatusCancelled = "Cancelled"
+)
+
 type JobRecord struct {
 	gorm.Model
-	JobID      string `gorm:"uniqueIndex;size:191"`
-	AgentID    string `gorm:"index;size:191"`
-	Type       string
-	Result     string
-	Payload    string
-	Status     string
-	ExecutedAt time.Time
+	JobID     string `gorm:"uniqueIndex;size:191"`
+	AgentID   string `gorm:"index;size:191"`
+	BatchID   string `gorm:"index;size:191"` // 所属批次，单独提交的任务为空
+	Target    string `gorm:"size:255"`       // 批次展开出的目标，如 10.0.0.1:22
+	Selector  string `gorm:"size:1024"`      // 提交时指定的 selector (JSON)，未指定为空
+	Artifacts string `gorm:"size:1024"`      // 执行结束后要上传的产物 glob，换行分隔
+	Files     string `gorm:"type:text"`      // 执行前要下载的输入文件 ([]mq.InputFile 的 JSON)
+	Env       string `gorm:"type:text"`      // 额外的环境变量 (JSON)
+	Workdir   string `gorm:"size:255"`
+	RunAs     string `gorm:"size:64"`   // 以哪个系统用户执行
+	Secrets   string `gorm:"size:2048"` // 注入的秘密：环境变量名 -> namespace/name (JSON)，不含明文
+	TraceID   string `gorm:"index;size:32"`
+	RequestID string `gorm:"index;size:64"` // 提交任务的请求 ID，Server 和 Agent 上这个任务的日志都带着它
+	// 提交时的 W3C traceparent，入队、下发和汇报的 span 都挂在它下面 (见 tracing.go)
+	TraceParent string `gorm:"size:64"`
+	Type        string
+	Result      string
+	Payload     string
+	Status      string     `gorm:"index;size:32"`
+	RunAt       *time.Time `gorm:"index"` // 延时任务的释放时间，立即执行的任务为空
+	StartedAt   *time.Time // Agent 开始执行的时间
+	ExecutedAt  *time.Time // 执行结束的时间
+
+	// 以下字段只有定向派发 (Assigned) 的任务才有
+	DeliveredAt      *time.Time // 最近一次经心跳流下发的时间
+	DeliveryAttempts int        // 下发次数，大于 1 说明发生过重新下发
+	AcceptedAt       *time.Time // Agent 确认收到的时间
+
+	// 以下字段只有输出被归档 (见 archive.go) 的任务才有，归档后 Result 为空
+	ArchivedAt    *time.Time `gorm:"index"`
+	ArchiveFile   string     `gorm:"size:255"` // 相对 storage_path 的归档文件路径
+	ArchiveOffset int64      // 这个任务的输出在归档文件里的位置 (独立的 gzip 成员)
+	ArchiveSize   int64
 }
 
 type SentinelServer struct {
 	pb.UnimplementedSentinelServiceServer
-	DB       *gorm.DB
-	JobQueue sync.Map
+	Store           Store // 业务数据的读写，见 store.go
+	Outbox          *OutboxRelay
+	HeartbeatPolicy HeartbeatPolicy
+	Storage         storage.Backend // 任务产物的存储后端
+	MaxArtifactSize int64           // 单个产物的大小上限 (server.max_file_size)，0 表示不限
+	Secrets         *secrets.Box    // 加解密秘密值，未配置 server.secret_key 时为 nil
+	Events          *EventBus       // 状态变化的事件总线，为 nil 时不发布事件
+	Webhooks        *WebhookWorker  // 测试事件、重新投递时唤醒投递协程，为 nil 时等下一次轮询
+	Results         *ResultArchiver // 归档旧任务的输出，查询任务时从归档文件读回
+
+	profiles     profileCache // 配置档缓存，见 profileFor
+	sessions     sync.Map     // agentID -> *agentSession，当前在线的心跳流
+	sessionCount atomic.Int64
+	rpcStats     rpcStats // 按节点统计的 gRPC 调用 (见 interceptor.go)
 }
 
 func (s *SentinelServer) Register(ctx context.Context, req *pb.RegisterReq) (*pb.RegisterResp, error) {
 	agentID := req.Hostname
 
-	log.Printf(" [Register] 收到注册请求: %s (%s)", req.Hostname, req.Ip)
+	slog.InfoContext(ctx, "收到注册请求", "hostname", req.Hostname, "ip", req.Ip, "version", req.AgentVersion)
 
-	var agent AgentModel
-	result := s.DB.Where("agent_id = ?", agentID).First(&agent)
+	// 被下线 (DELETE /agents/{id}) 的节点重新注册时恢复原记录，所以这里要带上软删除的行
+	agent, err := s.Store.GetAgent(ctx, agentID, true)
 
-	if result.Error != nil {
+	if err != nil {
 		newAgent := AgentModel{
-			AgentID:  agentID,
-			Hostname: req.Hostname,
-			IP:       req.Ip,
-			Status:   "online",
+			AgentID: agentID,
+			Status:  AgentStatusOnline,
+		}
+		applyRegistration(&newAgent, req)
+		if err := s.Store.CreateAgent(ctx, &newAgent); err != nil {
+			slog.ErrorContext(ctx, "新节点入库失败", "agent_id", agentID, "err", err)
+		} else {
+			slog.InfoContext(ctx, "新节点已入库", "agent_id", agentID)
 		}
-		s.DB.Create(&newAgent)
-		log.Println(" [DB] 新节点已入库")
+		agent = newAgent
 	} else {
-		agent.Status = "Online"
-		agent.IP = req.Ip
-		s.DB.Save(&agent)
-		log.Println(" [DB] 节点信息已更新")
+		if agent.DeletedAt.Valid {
+			agent.DeletedAt = gorm.DeletedAt{}
+			slog.InfoContext(ctx, "已下线的节点重新注册", "agent_id", agentID)
+		}
+		// 维护中的节点重启后仍然保持 drain，直到运维执行 undrain
+		agent.Status = AgentStatusOnline
+		if agent.Drain {
+			agent.Status = AgentStatusDraining
+		}
+		applyRegistration(&agent, req)
+		if err := s.Store.SaveAgent(ctx, &agent); err != nil {
+			slog.ErrorContext(ctx, "更新节点信息失败", "agent_id", agentID, "err", err)
+		} else {
+			slog.InfoContext(ctx, "节点信息已更新", "agent_id", agentID)
+		}
 	}
+	s.Events.Publish(ctx, EventAgentRegistered, "agent:"+agentID, newAgentEvent(agent))
 
 	return &pb.RegisterResp{
 		AgentId: agentID,
@@ -65,49 +179,183 @@ func (s *SentinelServer) Register(ctx context.Context, req *pb.RegisterReq) (*pb
 	}, nil
 }
 
-func (s *SentinelServer) Heartbeat(stream pb.SentinelService_HeartbeatServer) error {
-	for {
+// applyRegistration 用注册请求里的信息覆盖节点记录
+func applyRegistration(agent *AgentModel, req *pb.RegisterReq) {
+	agent.Hostname = req.Hostname
+	agent.IP = req.Ip
+	agent.Tags = joinTags(req.Tags)
+	agent.OS = req.Os
+	agent.Arch = req.Arch
+	agent.Kernel = req.Kernel
+	agent.AgentVersion = req.AgentVersion
+	agent.Capabilities = strings.Join(req.Capabilities, ",")
 
-		req, err := stream.Recv()
+	facts := req.GetFacts()
+	agent.IPs = strings.Join(facts.GetIps(), ",")
+	agent.OSRelease = facts.GetOsRelease()
+	agent.CPUCount = int(facts.GetCpuCount())
+	agent.CPUModel = facts.GetCpuModel()
+	agent.MemoryTotal = facts.GetMemoryTotal()
+	agent.DiskTotal = facts.GetDiskTotal()
+	agent.DiskFree = facts.GetDiskFree()
+	agent.BuildCommit = facts.GetBuildCommit()
+	agent.Container = facts.GetContainer()
+	agent.Hypervisor = facts.GetHypervisor()
+}
 
-		if err != nil {
-			log.Printf(" 接收错误: %v", err)
-			return err
+// joinTags 把标签存成 ",a,b," 的形式，查询时用 LIKE '%,a,%' 精确匹配单个标签
+func joinTags(tags []string) string {
+	var clean []string
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t != "" && !strings.Contains(t, ",") {
+			clean = append(clean, t)
+		}
+	}
+	if len(clean) == 0 {
+		return ""
+	}
+	return "," + strings.Join(clean, ",") + ","
+}
+
+// splitList 把逗号分隔的字段还原成切片
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item != "" {
+			out = append(out, item)
 		}
+	}
+	return out
+}
 
-		if val, ok := s.JobQueue.LoadAndDelete(req.AgentId); ok {
-			job := val.(*pb.Job)
-			log.Printf("[Dispatch] 发现信箱有任务! 派发给 %s -> %s", req.AgentId, job.Payload)
+// recordHeartbeat 记录 Agent 的最后在线时间、槽位占用和维护状态，
+// 返回是否需要 drain 以及节点当前应该使用的配置档
+func (s *SentinelServer) recordHeartbeat(req *pb.HeartbeatReq) (drain bool, profile *AgentProfile, ok bool) {
+	agent, profile, err := s.loadAgentState(req.AgentId)
+	if err != nil {
+		slog.Error("查询节点失败", "agent_id", req.AgentId, "err", err)
+		return false, nil, false
+	}
 
-			err := stream.Send(&pb.HeartbeatResp{
-				Job: job,
-			})
-			if err != nil {
-				return err
-			}
-		} else {
-			stream.Send(&pb.HeartbeatResp{ConfigOutdated: false})
+	// Draining -> Drained 由 Agent 在在途任务清空后上报
+	status := AgentStatusOnline
+	if agent.Drain {
+		status = AgentStatusDraining
+		if req.State == agentStateDrained {
+			status = AgentStatusDrained
 		}
 	}
+
+	err = s.Store.UpdateAgent(context.Background(), agent.ID, map[string]interface{}{
+		"status":         status,
+		"running_jobs":   req.RunningJobs,
+		"max_jobs":       req.MaxJobs,
+		"config_version": req.ConfigVersion,
+		"last_seen_at":   time.Now(),
+		"lost_at":        nil,
+	})
+	if err != nil {
+		slog.Error("更新心跳信息失败", "agent_id", req.AgentId, "err", err)
+	}
+	return agent.Drain, profile, true
+}
+
+// loadAgentState 读取心跳会话关心的节点状态：drain 标记和命中的配置档
+func (s *SentinelServer) loadAgentState(agentID string) (AgentModel, *AgentProfile, error) {
+	agent, err := s.Store.GetAgent(context.Background(), agentID, false)
+	if err != nil {
+		return agent, nil, err
+	}
+	profile, err := s.profileFor(agent.Tags)
+	return agent, profile, err
 }
 
 func (s *SentinelServer) ReportJobStatus(ctx context.Context, req *pb.ReportJobReq) (*pb.ReportJobResp, error) {
 
-	log.Printf(" [Report] 收到任务汇报! Agent: %s | Job: %s | 状态: %s | 结果: %s",
-		req.AgentId, req.JobId, req.Status, req.Result)
-	record := JobRecord{
+	now := time.Now()
+
+	// 通过 HTTP 提交的任务在提交时就已经入库，这里只需要更新执行结果
+	record, err := s.Store.GetJob(ctx, req.JobId)
+	if err == nil && record.Secrets != "" && req.Result != "" {
+		// Agent 已经打过码，这里再兜底一次 (旧版 Agent、秘密在执行中途被修改)
+		req.Result = secrets.Mask(req.Result, s.maskValues(record))
+	}
+	// 旧版 Agent 不在 metadata 里传 trace context，用任务上记录的接上
+	if err == nil && !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = tracing.WithTraceParent(ctx, record.TraceParent)
+	}
+	// 新版 Agent 在 metadata 里带着提交任务时的请求 ID，旧版的用任务上记录的
+	logCtx := logging.With(logging.WithRequestID(ctx, record.RequestID), "job_id", req.JobId)
+	_, span := tracing.Tracer().Start(ctx, "job.report", trace.WithAttributes(
+		attribute.String("job.id", req.JobId),
+		attribute.String("job.status", req.Status),
+		attribute.String("agent.id", req.AgentId),
+	))
+	defer span.End()
+	slog.InfoContext(logCtx, "收到任务汇报", "agent_id", req.AgentId, "status", req.Status, "result", req.Result)
+	if err == nil {
+		updates := map[string]interface{}{
+			"agent_id":    req.AgentId,
+			"status":      req.Status,
+			"result":      req.Result,
+			"executed_at": now,
+		}
+		// Running 是开始执行的通知，没有结果
+		if req.Status == JobStatusRunning {
+			updates = map[string]interface{}{
+				"agent_id":   req.AgentId,
+				"status":     req.Status,
+				"started_at": now,
+			}
+		}
+		// 条件更新：任务已经结束 (被取消、重复的结果汇报) 时不能再被覆盖；
+		// Running 只能从还没开始的状态进入，Agent 重试的 Running 汇报不算
+		from := activeStatuses
+		if req.Status == JobStatusRunning {
+			from = pendingStatuses
+		}
+		var changed bool
+		changed, err = s.Store.UpdateJob(ctx, JobMatch{ID: record.ID, Statuses: from}, updates)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			slog.ErrorContext(logCtx, "更新任务记录失败", "err", err)
+			return &pb.ReportJobResp{Received: true}, nil
+		}
+		if !changed {
+			// 并发的汇报只有一个能改成功，事件和指标也只由它发出
+			slog.InfoContext(logCtx, "任务已不在可更新的状态，忽略汇报", "agent_id", req.AgentId, "status", req.Status)
+			return &pb.ReportJobResp{Received: true}, nil
+		}
+		slog.DebugContext(logCtx, "任务记录已更新", "id", record.ID)
+		observeReport(record, req.Status, now)
+		if req.Status == JobStatusRunning {
+			record.AgentID, record.Status, record.StartedAt = req.AgentId, req.Status, &now
+			s.Events.Publish(logCtx, EventJobStarted, "job:"+record.JobID, jobEvent(record))
+		}
+		if isTerminalStatus(req.Status) {
+			record.AgentID, record.Status, record.Result, record.ExecutedAt = req.AgentId, req.Status, req.Result, &now
+			s.onJobFinished(logCtx, record)
+		}
+		return &pb.ReportJobResp{Received: true}, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		slog.ErrorContext(logCtx, "查询任务记录失败", "err", err)
+		return &pb.ReportJobResp{Received: true}, nil
+	}
+
+	record = JobRecord{
 		JobID:      req.JobId,
 		AgentID:    req.AgentId,
 		Type:       "PING",
 		Payload:    "Unknown",
 		Result:     req.Result,
 		Status:     req.Status,
-		ExecutedAt: time.Now(),
+		ExecutedAt: &now,
 	}
-	if err := s.DB.Create(&record).Error; err != nil {
-		log.Printf("[DB] 保存任务记录失败: %v", err)
+	if err := s.Store.CreateJob(ctx, &record); err != nil {
+		slog.ErrorContext(logCtx, "保存任务记录失败", "err", err)
 	} else {
-		log.Printf("[DB] 任务记录已入库 (ID: %d)", record.ID)
+		slog.DebugContext(logCtx, "任务记录已入库", "id", record.ID)
 	}
 	return &pb.ReportJobResp{Received: true}, nil
 }
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+// newReportTestServer 返回的 events 按类型统计发布过的事件
+func newReportTestServer(t *testing.T) (*SentinelServer, map[string]int) {
+	t.Helper()
+	db := newTestDB(t)
+	s := &SentinelServer{Store: NewGormStore(db), Events: NewEventBus(db, 0)}
+	events := map[string]int{}
+	s.Events.Listen(func(_ context.Context, ev Event) { events[ev.Type]++ })
+	return s, events
+}
+
+func report(t *testing.T, s *SentinelServer, status string) {
+	t.Helper()
+	if _, err := s.ReportJobStatus(context.Background(), &pb.ReportJobReq{JobId: "job-1", AgentId: "n1", Status: status, Result: "out"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReportAfterCancelKeepsJobCancelled(t *testing.T) {
+	s, events := newReportTestServer(t)
+	ctx := context.Background()
+	if err := s.Store.CreateJob(ctx, &JobRecord{JobID: "job-1", AgentID: "n1", Status: JobStatusAccepted}); err != nil {
+		t.Fatal(err)
+	}
+	report(t, s, JobStatusRunning)
+	if _, err := s.Store.UpdateJob(ctx, JobMatch{JobID: "job-1"}, map[string]interface{}{"status": JobStatusCancelled}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Agent 还没收到取消指令，照常汇报了开始和结果
+	report(t, s, JobStatusRunning)
+	report(t, s, JobStatusSuccess)
+
+	job, err := s.Store.GetJob(ctx, "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusCancelled || job.Result != "" {
+		t.Errorf("job = %s (result %q), want Cancelled with no result", job.Status, job.Result)
+	}
+	if events[EventJobStarted] != 1 || events[EventJobSucceeded] != 0 {
+		t.Errorf("events = %v, want one job.started and no job.succeeded", events)
+	}
+}
+
+func TestDuplicateReportsFireEventsOnce(t *testing.T) {
+	s, events := newReportTestServer(t)
+	ctx := context.Background()
+	if err := s.Store.CreateJob(ctx, &JobRecord{JobID: "job-1", Status: JobStatusQueued}); err != nil {
+		t.Fatal(err)
+	}
+	// Agent 超时重试：同一个汇报到了两次
+	report(t, s, JobStatusRunning)
+	report(t, s, JobStatusRunning)
+	report(t, s, JobStatusFailed)
+	report(t, s, JobStatusFailed)
+
+	if job, _ := s.Store.GetJob(ctx, "job-1"); job.Status != JobStatusFailed {
+		t.Errorf("status = %s, want Failed", job.Status)
+	}
+	if events[EventJobStarted] != 1 || events[EventJobFailed] != 1 {
+		t.Errorf("events = %v, want one job.started and one job.failed", events)
+	}
+}
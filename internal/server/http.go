@@ -1,57 +1,201 @@
 package server
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
 	"time"
 
-	"gorm.io/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
-	"github.com/stywzn/Go-Cloud-Compute/pkg/mq" // ✅ 引入 MQ 包
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/metrics"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/mq"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/tracing"
 )
 
 type HttpServer struct {
-	DB  *gorm.DB
-	Srv *SentinelServer
+	Store Store // 和 Srv.Store 是同一个
+	Srv   *SentinelServer
+
+	MaxBatchSize      int            // 单个批次展开后的最大任务数
+	AgentOfflineAfter time.Duration  // 超过这么久没有心跳的节点视为 Offline
+	TrustedProxies    []netip.Prefix // 只信任来自这些地址的 X-Remote-User
 }
 
 // NewHttpServer 初始化 HTTP 服务 (标准库版本)
-func NewHttpServer(db *gorm.DB, srv *SentinelServer) http.Handler {
+func NewHttpServer(srv *SentinelServer) http.Handler {
 	mux := http.NewServeMux()
-	server := &HttpServer{DB: db, Srv: srv}
+	server := &HttpServer{
+		Store:             srv.Store,
+		Srv:               srv,
+		MaxBatchSize:      config.GlobalConfig.Server.MaxBatchSize,
+		AgentOfflineAfter: config.GlobalConfig.Server.AgentOfflineAfter,
+		TrustedProxies:    parseTrustedProxies(config.GlobalConfig.Server.TrustedProxies),
+	}
 
 	// 注册路由
-	mux.HandleFunc("/task", server.handleTask)     // 发任务接口
-	mux.HandleFunc("/health", server.handleHealth) // 健康检查
+	mux.HandleFunc("/task", server.audited("job.submit", server.handleTask))                                         // 发任务接口
+	mux.HandleFunc("GET /jobs/{id}", server.handleGetJob)                                                            // 查询任务状态
+	mux.HandleFunc("POST /jobs/{id}/cancel", server.audited("job.cancel", server.handleCancelJob))                   // 取消任务
+	mux.HandleFunc("GET /jobs/{id}/artifacts", server.handleListArtifacts)                                           // 任务产物列表
+	mux.HandleFunc("GET /jobs/{id}/artifacts/{name...}", server.handleDownloadArtifact)                              // 下载产物
+	mux.HandleFunc("POST /files", server.audited("file.upload", server.handleUploadFile))                            // 上传输入文件
+	mux.HandleFunc("GET /files/{id}", server.handleGetFile)                                                          // 查询文件信息
+	mux.HandleFunc("GET /secrets", server.handleListSecrets)                                                         // 秘密列表 (不含值)
+	mux.HandleFunc("PUT /secrets/{namespace}/{name}", server.audited("secret.put", server.handlePutSecret))          // 创建或修改秘密
+	mux.HandleFunc("DELETE /secrets/{namespace}/{name}", server.audited("secret.delete", server.handleDeleteSecret)) // 删除秘密
+	mux.HandleFunc("POST /batches", server.audited("batch.submit", server.handleCreateBatch))                        // 批量提交
+	mux.HandleFunc("GET /batches/{id}", server.handleGetBatch)                                                       // 批次进度
+	mux.HandleFunc("GET /agents", server.handleListAgents)                                                           // 节点列表
+	mux.HandleFunc("GET /agents/{id}", server.handleGetAgent)                                                        // 节点详情
+	mux.HandleFunc("DELETE /agents/{id}", server.audited("agent.delete", server.handleDeleteAgent))                  // 下线节点
+	mux.HandleFunc("POST /agents/{id}/jobs", server.audited("job.dispatch", server.handleDispatchToAgent))           // 定向派发任务
+	mux.HandleFunc("POST /agents/{id}/drain", server.audited("agent.drain", server.handleDrainAgent))                // 进入维护模式
+	mux.HandleFunc("POST /agents/{id}/undrain", server.audited("agent.undrain", server.handleUndrainAgent))          // 退出维护模式
+	mux.HandleFunc("GET /profiles", server.handleListProfiles)                                                       // Agent 配置档列表
+	mux.HandleFunc("PUT /profiles/{name}", server.audited("profile.put", server.handlePutProfile))                   // 创建或修改配置档
+	mux.HandleFunc("DELETE /profiles/{name}", server.audited("profile.delete", server.handleDeleteProfile))          // 删除配置档
+	mux.HandleFunc("GET /audit", server.handleListAudit)                                                             // 审计日志
+	mux.HandleFunc("GET /audit/export", server.handleExportAudit)                                                    // 导出审计日志 (JSON lines)
+	mux.HandleFunc("GET /events", server.handleEvents)                                                               // 事件流 (SSE 或长轮询)
+	mux.HandleFunc("/health", server.handleHealth)                                                                   // 健康检查
+	mux.Handle("GET /metrics", metrics.Handler())                                                                    // Prometheus 指标
+	mux.Handle("GET /admin/log-level", logging.LevelHandler())                                                       // 查询日志级别
+	mux.HandleFunc("PUT /admin/log-level", server.audited("admin.log_level", logging.LevelHandler().ServeHTTP))      // 运行中调整日志级别
+
+	// Webhook 订阅和投递日志 (见 webhook.go)
+	mux.HandleFunc("GET /webhooks", server.handleListWebhooks)                                                                         // Webhook 订阅列表
+	mux.HandleFunc("POST /webhooks", server.audited("webhook.create", server.handleCreateWebhook))                                     // 创建订阅
+	mux.HandleFunc("GET /webhooks/{id}", server.handleGetWebhook)                                                                      // 订阅详情
+	mux.HandleFunc("PUT /webhooks/{id}", server.audited("webhook.update", server.handleUpdateWebhook))                                 // 修改订阅
+	mux.HandleFunc("DELETE /webhooks/{id}", server.audited("webhook.delete", server.handleDeleteWebhook))                              // 删除订阅
+	mux.HandleFunc("POST /webhooks/{id}/test", server.audited("webhook.test", server.handleTestWebhook))                               // 发送测试事件
+	mux.HandleFunc("GET /webhooks/{id}/deliveries", server.handleListDeliveries)                                                       // 投递日志
+	mux.HandleFunc("GET /webhooks/{id}/deliveries/{delivery}", server.handleGetDelivery)                                               // 单条投递记录
+	mux.HandleFunc("POST /webhooks/{id}/deliveries/{delivery}/redeliver", server.audited("webhook.redeliver", server.handleRedeliver)) // 重新投递
 
 	// 👇 套上我们写的日志中间件
 	return LoggingMiddleware(mux)
 }
 
-// LoggingMiddleware 日志中间件
+// statusRecorder 记录响应状态码，用于指标
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap 让 http.ResponseController 能拿到底层的 Flush 等能力
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// LoggingMiddleware 日志中间件：分配请求 ID，记录访问日志、请求耗时指标和 span
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
 
-		next.ServeHTTP(w, r) // 执行业务逻辑
+		// 请求 ID 写进响应头，这个请求 (以及它提交的任务) 的日志都带着它
+		requestID := logging.RequestIDFromHeader(r)
+		w.Header().Set("X-Request-ID", requestID)
+		ctx := logging.WithRequestID(r.Context(), requestID)
+
+		// 调用方带了 traceparent 的话接上它的 trace；指标和健康检查不记 span
+		traced := r.URL.Path != "/metrics" && r.URL.Path != "/health"
+		var span trace.Span
+		if traced {
+			ctx = tracing.Extract(ctx, propagation.HeaderCarrier(r.Header))
+			ctx, span = tracing.Tracer().Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+			span.SetAttributes(attribute.String("request.id", requestID))
+		}
+		r = r.WithContext(ctx)
+
+		next.ServeHTTP(rec, r) // 执行业务逻辑
 
 		duration := time.Since(start)
 
-		// 打印结构化日志: [HTTP] 方法 路径 | 耗时 | IP
-		log.Printf("🌐 [HTTP] %s %s | ⏳ %v | 📍 %s",
-			r.Method, r.URL.Path, duration, r.RemoteAddr)
+		// route 用路由模板 (如 /jobs/{id})，不用实际路径，避免每个 ID 一条时间序列
+		route := r.Pattern
+		if _, path, ok := strings.Cut(route, " "); ok {
+			route = path
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		metrics.HTTPRequestDuration.WithLabelValues(r.Method, route, strconv.Itoa(rec.code)).Observe(duration.Seconds())
+		if traced {
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.Int("http.response.status_code", rec.code),
+			)
+			if rec.code >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rec.code))
+			}
+			span.End()
+		}
+
+		// 访问日志；指标抓取和健康检查很频繁，只在 debug 级别打印
+		level := slog.LevelInfo
+		if !traced {
+			level = slog.LevelDebug
+		}
+		slog.Log(r.Context(), level, "HTTP 请求",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", rec.code,
+			"duration_ms", duration.Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+		)
 
 		if duration > 500*time.Millisecond {
-			log.Printf("⚠️ [Slow Request] 发现慢请求: %s", r.URL.Path)
+			slog.WarnContext(r.Context(), "慢请求", "path", r.URL.Path, "duration_ms", duration.Milliseconds())
 		}
 	})
 }
 
 // handleHealth 健康检查
+// MQ 断线时 HTTP 接口仍可接收任务 (先写入发件箱)，所以只报告 degraded 而不返回 5xx
 func (s *HttpServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	mqState := mq.State()
+	status := "ok"
+	if mqState != mq.StateConnected {
+		status = "degraded"
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": status,
+		"mq":     mqState,
+	})
 }
 
 // 🔥🔥 核心逻辑：接收 HTTP 请求 -> 发送给 RabbitMQ 🔥🔥
@@ -65,8 +209,13 @@ func (s *HttpServer) handleTask(w http.ResponseWriter, r *http.Request) {
 	// 2. 解析请求 JSON
 	// 我们统一定义一个简单的任务结构
 	var req struct {
-		Type    string `json:"type"`    // 任务类型: shell, python, etc.
-		Payload string `json:"payload"` // 具体命令: "echo hello"
+		Type    string     `json:"type"`    // 任务类型: shell, python, etc.
+		Payload string     `json:"payload"` // 具体命令: "echo hello"
+		RunAt   *time.Time `json:"run_at"`  // 可选：指定执行时间 (RFC3339)
+		Delay   string     `json:"delay"`   // 可选：延迟执行，如 "30s"、"5m"
+		// 可选：只在满足条件的节点上执行，如 {"os": "linux", "tag": "gpu"}，见 Selector
+		Selector Selector `json:"selector"`
+		jobSpec           // 产物、输入文件、环境变量等执行选项，见 jobSpec
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -74,24 +223,292 @@ func (s *HttpServer) handleTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3. (可选) 可以在这里存入 MySQL 做审计记录
-	// s.DB.Create(...)
+	runAt, err := resolveRunAt(req.RunAt, req.Delay)
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	record := JobRecord{
+		JobID:   newJobID(),
+		Type:    req.Type,
+		Payload: req.Payload,
+		Status:  JobStatusQueued,
+	}
+	ctx, span := startJobSpan(r.Context(), "job.submit")
+	defer span.End()
+	span.SetAttributes(jobSpanAttrs(record)...)
+	setJobTrace(ctx, &record)
+	auditTarget(ctx, "job:"+record.JobID)
+	auditDetail(ctx, "type", metricType(record.Type))
+	if err := req.jobSpec.apply(ctx, s.Store, &record); err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// 4. 发送到 RabbitMQ
-	// ⚠️ 注意：这里不再存入 Srv.JobQueue (内存Map)，那是旧架构
-	// 我们直接把 payload 扔进 MQ，让 Agent 自己去抢
-	err := mq.Publish(req.Payload)
+	if len(req.Selector) > 0 {
+		if runAt != nil {
+			http.Error(w, "Bad Request: selector 暂不支持延时任务", http.StatusBadRequest)
+			return
+		}
+		if err := req.Selector.Validate(); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.handleSelectorTask(ctx, w, record, req.Selector)
+		return
+	}
 
-	if err != nil {
-		log.Printf("❌ [MQ] 投递失败: %v", err)
-		http.Error(w, "MQ Publish Failed", http.StatusInternalServerError)
+	// 3. 先入库，之后通过 GET /jobs/{id} 查询状态
+	if runAt != nil {
+		record.Status = JobStatusScheduled
+		record.RunAt = runAt
+	}
+	// 立即执行的任务和发件箱消息在同一个事务里写入，由 OutboxRelay 投递到 MQ；
+	// 延时任务交给 DelayScheduler 到点释放
+	if err := s.Store.CreateJob(ctx, &record); err != nil {
+		slog.ErrorContext(ctx, "任务入库失败", "err", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	if record.Status == JobStatusScheduled {
+		countSubmitted(record.Type, 1)
+		slog.InfoContext(jobLogContext(ctx, record), "任务已进入延时队列", "run_at", runAt)
+		s.Srv.Events.Publish(ctx, EventJobSubmitted, "job:"+record.JobID, jobEvent(record))
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"code":   200,
+			"msg":    "任务已进入延时队列",
+			"job_id": record.JobID,
+			"status": record.Status,
+			"run_at": runAt,
+		})
 		return
 	}
 
-	log.Printf("✅ [MQ] 任务已进入队列: %s", req.Payload)
+	countSubmitted(record.Type, 1)
+
+	// 4. 唤醒发件箱，尽快投递到 RabbitMQ
+	// ⚠️ 注意：没有指定节点的任务不进定向派发队列 (见 dispatch.go)
+	// 任务进入 MQ 后让 Agent 自己去抢
+	s.Srv.Outbox.Notify()
+	slog.InfoContext(jobLogContext(ctx, record), "任务已写入发件箱", "type", record.Type, "payload", record.Payload)
+	s.Srv.Events.Publish(ctx, EventJobSubmitted, "job:"+record.JobID, jobEvent(record))
 
 	// 5. 返回成功响应
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"code":   200,
+		"msg":    "任务已派发至 MQ",
+		"job_id": record.JobID,
+		"status": record.Status,
+	})
+}
+
+// resolveRunAt 把 run_at / delay 统一换算成释放时间，立即执行的任务返回 nil
+func resolveRunAt(runAt *time.Time, delay string) (*time.Time, error) {
+	if runAt != nil && delay != "" {
+		return nil, errors.New("run_at 和 delay 只能指定一个")
+	}
+	if delay != "" {
+		d, err := time.ParseDuration(delay)
+		if err != nil || d < 0 {
+			return nil, errors.New("delay 格式错误，示例: 30s、5m、1h")
+		}
+		if d == 0 {
+			return nil, nil
+		}
+		t := time.Now().Add(d)
+		return &t, nil
+	}
+	if runAt != nil && runAt.After(time.Now()) {
+		return runAt, nil
+	}
+	// run_at 已经过去的任务直接执行
+	return nil, nil
+}
+
+// jobView 是任务状态接口的返回结构
+type jobView struct {
+	JobID            string            `json:"job_id"`
+	AgentID          string            `json:"agent_id,omitempty"`
+	BatchID          string            `json:"batch_id,omitempty"`
+	Target           string            `json:"target,omitempty"`
+	Selector         Selector          `json:"selector,omitempty"`
+	Artifacts        []string          `json:"artifacts,omitempty"`
+	Files            []mq.InputFile    `json:"files,omitempty"`
+	Env              map[string]string `json:"env,omitempty"`
+	Workdir          string            `json:"workdir,omitempty"`
+	User             string            `json:"user,omitempty"`
+	Secrets          map[string]string `json:"secrets,omitempty"` // 只有引用，没有明文
+	TraceID          string            `json:"trace_id,omitempty"`
+	RequestID        string            `json:"request_id,omitempty"`
+	Type             string            `json:"type"`
+	Payload          string            `json:"payload"`
+	Status           string            `json:"status"`
+	Result           string            `json:"result,omitempty"`
+	ArchivedAt       *time.Time        `json:"archived_at,omitempty"` // 输出已归档；列表接口里不带输出，GET /jobs/{id} 会读回
+	RunAt            *time.Time        `json:"run_at,omitempty"`
+	StartedAt        *time.Time        `json:"started_at,omitempty"`
+	ExecutedAt       *time.Time        `json:"executed_at,omitempty"`
+	DeliveredAt      *time.Time        `json:"delivered_at,omitempty"`
+	DeliveryAttempts int               `json:"delivery_attempts,omitempty"`
+	AcceptedAt       *time.Time        `json:"accepted_at,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+}
+
+func newJobView(r JobRecord) jobView {
+	var sel Selector
+	if r.Selector != "" {
+		json.Unmarshal([]byte(r.Selector), &sel)
+	}
+	return jobView{
+		JobID:            r.JobID,
+		AgentID:          r.AgentID,
+		BatchID:          r.BatchID,
+		Target:           r.Target,
+		Selector:         sel,
+		Artifacts:        splitLines(r.Artifacts),
+		Files:            decodeJobFiles(r.Files),
+		Env:              decodeJobEnv(r.Env),
+		Workdir:          r.Workdir,
+		User:             r.RunAs,
+		Secrets:          decodeJobSecrets(r.Secrets),
+		TraceID:          r.TraceID,
+		RequestID:        r.RequestID,
+		Type:             r.Type,
+		Payload:          r.Payload,
+		Status:           r.Status,
+		Result:           r.Result,
+		ArchivedAt:       r.ArchivedAt,
+		RunAt:            r.RunAt,
+		StartedAt:        r.StartedAt,
+		ExecutedAt:       r.ExecutedAt,
+		DeliveredAt:      r.DeliveredAt,
+		DeliveryAttempts: r.DeliveryAttempts,
+		AcceptedAt:       r.AcceptedAt,
+		CreatedAt:        r.CreatedAt,
+		UpdatedAt:        r.UpdatedAt,
+	}
+}
+
+func newJobViews(records []JobRecord) []jobView {
+	views := make([]jobView, len(records))
+	for i, r := range records {
+		views[i] = newJobView(r)
+	}
+	return views
+}
+
+// handleGetJob 查询任务状态
+func (s *HttpServer) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	record, err := s.Store.GetJob(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	// 输出已归档的任务从归档文件读回，调用方不需要关心
+	if record.ArchivedAt != nil {
+		if s.Srv.Results == nil {
+			http.Error(w, "result archive is not configured", http.StatusInternalServerError)
+			return
+		}
+		result, err := s.Srv.Results.Load(record)
+		if err != nil {
+			slog.ErrorContext(jobLogContext(r.Context(), record), "读取归档的任务输出失败", "file", record.ArchiveFile, "err", err)
+			http.Error(w, "读取归档的任务输出失败", http.StatusInternalServerError)
+			return
+		}
+		record.Result = result
+	}
+	writeJSON(w, http.StatusOK, newJobView(record))
+}
+
+// handleCancelJob 取消任务：还没释放的延时任务直接取消；
+// 定向派发还没下发的任务直接取消，已经下发到节点的任务推送取消指令 (返回 202)
+// 已进入 MQ 还没被领取的任务暂不支持取消
+func (s *HttpServer) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	jobID := r.PathValue("id")
+
+	// 和 DelayScheduler 一样用条件更新，避免与释放动作并发冲突
+	unscheduled, err := s.Store.UpdateJob(r.Context(), JobMatch{JobID: jobID, Statuses: []string{JobStatusScheduled}},
+		map[string]interface{}{"status": JobStatusCancelled})
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	record, err := s.Store.GetJob(r.Context(), jobID)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if unscheduled {
+		metrics.JobsCompleted.WithLabelValues(metricType(record.Type), JobStatusCancelled).Inc()
+		slog.InfoContext(jobLogContext(r.Context(), record), "延时任务已取消")
+		s.Srv.onJobFinished(jobLogContext(r.Context(), record), record)
+		writeJSON(w, http.StatusOK, newJobView(record))
+		return
+	}
+
+	if record.AgentID == "" || (record.Status != JobStatusAssigned &&
+		record.Status != JobStatusAccepted && record.Status != JobStatusRunning) {
+		http.Error(w, "Job is "+record.Status+", only Scheduled, Assigned, Accepted or Running jobs can be cancelled", http.StatusConflict)
+		return
+	}
+
+	// 还在下发队列里的任务直接取消；可能已经发出去了，所以也给节点推一条取消指令
+	if record.Status == JobStatusAssigned {
+		cancelled, err := s.Store.UpdateJob(r.Context(), JobMatch{JobID: jobID, Statuses: []string{JobStatusAssigned}},
+			map[string]interface{}{"status": JobStatusCancelled})
+		if err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		if cancelled {
+			s.Srv.CancelJob(record.AgentID, jobID)
+			metrics.JobsCompleted.WithLabelValues(metricType(record.Type), JobStatusCancelled).Inc()
+			slog.InfoContext(jobLogContext(r.Context(), record), "任务已从节点的下发队列取消", "agent_id", record.AgentID)
+			record.Status = JobStatusCancelled
+			s.Srv.onJobFinished(jobLogContext(r.Context(), record), record)
+			writeJSON(w, http.StatusOK, newJobView(record))
+			return
+		}
+		// 并发地被 Agent 确认了，按已下发处理
+	}
+
+	// 已经下发到节点的任务：推送取消指令，Agent 中止后汇报 Cancelled
+	if !s.Srv.CancelJob(record.AgentID, jobID) {
+		http.Error(w, "Agent "+record.AgentID+" is not connected, cannot cancel the job", http.StatusConflict)
+		return
+	}
+	slog.InfoContext(jobLogContext(r.Context(), record), "已向节点推送取消指令", "agent_id", record.AgentID)
+	writeJSON(w, http.StatusAccepted, newJobView(record))
+}
+
+// newJobID 生成随机任务 ID
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "job-" + hex.EncodeToString(b)
+}
+
+// newBatchID 生成随机批次 ID
+func newBatchID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "batch-" + hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte(`{"code": 200, "msg": "任务已派发至 MQ"}`))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
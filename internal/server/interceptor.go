@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/metrics"
+)
+
+// agentIDGetter 带节点 ID 的请求 (心跳、汇报、产物分片等)，用来把调用归到节点上
+type agentIDGetter interface {
+	GetAgentId() string
+}
+
+func agentIDOf(msg interface{}) string {
+	if m, ok := msg.(agentIDGetter); ok {
+		return m.GetAgentId()
+	}
+	return ""
+}
+
+// UnaryStatsInterceptor 按节点统计 unary 调用；Register 的请求里没有节点 ID，从响应里取
+func (s *SentinelServer) UnaryStatsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	agentID := agentIDOf(req)
+	if agentID == "" {
+		agentID = agentIDOf(resp)
+	}
+	if agentID != "" {
+		s.rpcStats.observeUnary(agentID, info.FullMethod, time.Since(start), err)
+	}
+	return resp, err
+}
+
+// StreamStatsInterceptor 记录流的建立、关闭、收发消息数和时长
+// 节点 ID 在第一条消息里，拿到之后才记到节点名下；一条消息都没收到的流只计入指标
+func (s *SentinelServer) StreamStatsInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	method := info.FullMethod
+	metrics.GRPCStreamsActive.WithLabelValues(method).Inc()
+	defer metrics.GRPCStreamsActive.WithLabelValues(method).Dec()
+
+	st := &statsStream{
+		ServerStream: ss,
+		srv:          s,
+		method:       method,
+		recvCounter:  metrics.GRPCStreamMessages.WithLabelValues(method, "recv"),
+		sentCounter:  metrics.GRPCStreamMessages.WithLabelValues(method, "sent"),
+	}
+	err := handler(srv, st)
+
+	duration := time.Since(start)
+	code := streamCode(err)
+	metrics.GRPCStreamDuration.WithLabelValues(method, code.String()).Observe(duration.Seconds())
+
+	ctx := ss.Context()
+	if agentID := st.agentID.Load(); agentID != nil {
+		ctx = logging.With(ctx, "agent_id", *agentID)
+	}
+	args := []any{"method", method, "code", code.String(), "duration_ms", duration.Milliseconds(),
+		"messages_recv", st.recv.Load(), "messages_sent", st.sent.Load()}
+	if code != codes.OK && code != codes.Canceled {
+		s.closeStreamStats(st, duration, err)
+		slog.WarnContext(ctx, "gRPC 流异常关闭", append(args, "err", err)...)
+		return err
+	}
+	// Agent 主动断开 (EOF、取消) 是正常关闭，不计为错误
+	s.closeStreamStats(st, duration, nil)
+	slog.InfoContext(ctx, "gRPC 流已关闭", args...)
+	return err
+}
+
+func (s *SentinelServer) closeStreamStats(st *statsStream, d time.Duration, err error) {
+	if m := st.stats.Load(); m != nil {
+		s.rpcStats.closeStream(m, d, err)
+	}
+}
+
+// streamCode 流处理函数返回的错误对应的状态码，客户端正常结束 (EOF) 算 OK
+func streamCode(err error) codes.Code {
+	if err == nil || errors.Is(err, io.EOF) {
+		return codes.OK
+	}
+	if errors.Is(err, context.Canceled) {
+		return codes.Canceled
+	}
+	return status.Code(err)
+}
+
+// statsStream 包装 ServerStream 统计收发的消息
+// 心跳流的接收和发送在不同的协程里，字段都用原子操作
+type statsStream struct {
+	grpc.ServerStream
+	srv         *SentinelServer
+	method      string
+	recvCounter prometheus.Counter
+	sentCounter prometheus.Counter
+
+	agentID atomic.Pointer[string]
+	stats   atomic.Pointer[rpcMethodStats]
+	// 总数，拿到节点 ID 之前的消息也算
+	recv atomic.Int64
+	sent atomic.Int64
+}
+
+func (st *statsStream) RecvMsg(m interface{}) error {
+	if err := st.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	st.recvCounter.Inc()
+	st.recv.Add(1)
+	if stats := st.stats.Load(); stats != nil {
+		stats.recv.Add(1)
+		return nil
+	}
+	if id := agentIDOf(m); id != "" {
+		st.open(id)
+	}
+	return nil
+}
+
+func (st *statsStream) SendMsg(m interface{}) error {
+	if err := st.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	st.sentCounter.Inc()
+	st.sent.Add(1)
+	if stats := st.stats.Load(); stats != nil {
+		stats.sent.Add(1)
+	}
+	return nil
+}
+
+// open 第一次拿到节点 ID，把之前收发的消息一起记到节点名下
+func (st *statsStream) open(agentID string) {
+	st.agentID.Store(&agentID)
+	stats := st.srv.rpcStats.openStream(agentID, st.method)
+	stats.recv.Add(st.recv.Load())
+	stats.sent.Add(st.sent.Load())
+	st.stats.Store(stats)
+	slog.InfoContext(logging.With(st.Context(), "agent_id", agentID), "gRPC 流已建立", "method", st.method)
+}
+
+// RecoveryUnaryInterceptor 把处理函数里的 panic 转成 Internal 错误，避免一个异常请求拖垮整个控制面
+func RecoveryUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(ctx, info.FullMethod, agentIDOf(req), p)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// RecoveryStreamInterceptor 流处理函数的 panic 恢复；处理函数自己起的协程里的 panic 拦不住
+func RecoveryStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = recovered(ss.Context(), info.FullMethod, "", p)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func recovered(ctx context.Context, method, agentID string, p interface{}) error {
+	metrics.GRPCPanics.WithLabelValues(method).Inc()
+	args := []any{"method", method, "panic", p, "stack", string(debug.Stack())}
+	if agentID != "" {
+		args = append(args, "agent_id", agentID)
+	}
+	slog.ErrorContext(ctx, "gRPC 处理函数 panic，已恢复", args...)
+	return status.Errorf(codes.Internal, "internal error")
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/metrics"
+)
+
+// fakeServerStream 依次返回 msgs 里的消息，之后返回 EOF
+type fakeServerStream struct {
+	grpc.ServerStream
+	msgs []proto.Message
+	sent int
+}
+
+func (f *fakeServerStream) Context() context.Context { return context.Background() }
+
+func (f *fakeServerStream) RecvMsg(m interface{}) error {
+	if len(f.msgs) == 0 {
+		return io.EOF
+	}
+	proto.Merge(m.(proto.Message), f.msgs[0])
+	f.msgs = f.msgs[1:]
+	return nil
+}
+
+func (f *fakeServerStream) SendMsg(m interface{}) error {
+	f.sent++
+	return nil
+}
+
+func TestStreamCode(t *testing.T) {
+	for err, want := range map[error]codes.Code{
+		nil:                                      codes.OK,
+		io.EOF:                                   codes.OK,
+		context.Canceled:                         codes.Canceled,
+		fmt.Errorf("recv: %w", context.Canceled): codes.Canceled,
+		status.Error(codes.Unavailable, "x"):     codes.Unavailable,
+		errors.New("boom"):                       codes.Unknown,
+	} {
+		if got := streamCode(err); got != want {
+			t.Errorf("streamCode(%v) = %s, want %s", err, got, want)
+		}
+	}
+}
+
+// 节点 ID 出现之前收到的消息也记到节点名下，正常结束不计错误，异常结束计错误
+func TestStreamStatsInterceptor(t *testing.T) {
+	s := &SentinelServer{}
+	info := &grpc.StreamServerInfo{FullMethod: "/sentinel.SentinelService/Heartbeat"}
+	handler := func(result error) grpc.StreamHandler {
+		return func(srv interface{}, ss grpc.ServerStream) error {
+			for {
+				var req pb.HeartbeatReq
+				if err := ss.RecvMsg(&req); err != nil {
+					if errors.Is(err, io.EOF) {
+						return result
+					}
+					return err
+				}
+				if req.AgentId != "" {
+					// 流还开着
+					if views := s.rpcStats.snapshot("n1"); len(views) != 1 || views[0].Active != 1 {
+						t.Errorf("open stream stats = %+v", views)
+					}
+				}
+				ss.SendMsg(&pb.HeartbeatResp{})
+			}
+		}
+	}
+	msgs := func() []proto.Message {
+		return []proto.Message{&pb.HeartbeatReq{}, &pb.HeartbeatReq{AgentId: "n1"}, &pb.HeartbeatReq{AgentId: "n1"}}
+	}
+
+	if err := s.StreamStatsInterceptor(nil, &fakeServerStream{msgs: msgs()}, info, handler(io.EOF)); !errors.Is(err, io.EOF) {
+		t.Fatalf("err = %v, want the handler's error", err)
+	}
+	views := s.rpcStats.snapshot("n1")
+	if len(views) != 1 {
+		t.Fatalf("stats = %+v", views)
+	}
+	if v := views[0]; v.Method != info.FullMethod || v.Calls != 1 || v.Active != 0 || v.Errors != 0 ||
+		v.MessagesRecv != 3 || v.MessagesSent != 3 {
+		t.Errorf("after clean close: %+v", v)
+	}
+
+	failed := status.Error(codes.Unavailable, "gone")
+	s.StreamStatsInterceptor(nil, &fakeServerStream{msgs: msgs()}, info, handler(failed))
+	if v := s.rpcStats.snapshot("n1")[0]; v.Calls != 2 || v.Errors != 1 || v.LastError != failed.Error() ||
+		v.MessagesRecv != 6 || v.LastErrorAt == nil {
+		t.Errorf("after failed close: %+v", v)
+	}
+
+	// 一条消息都没收到的流不记到任何节点名下
+	s.StreamStatsInterceptor(nil, &fakeServerStream{}, info, handler(nil))
+	if len(s.rpcStats.agents) != 1 {
+		t.Errorf("stats for %d agents, want 1", len(s.rpcStats.agents))
+	}
+}
+
+// Register 的请求里没有节点 ID，从响应里取
+func TestUnaryStatsInterceptor(t *testing.T) {
+	s := &SentinelServer{}
+	register := &grpc.UnaryServerInfo{FullMethod: "/sentinel.SentinelService/Register"}
+	report := &grpc.UnaryServerInfo{FullMethod: "/sentinel.SentinelService/ReportJobStatus"}
+
+	s.UnaryStatsInterceptor(context.Background(), &pb.RegisterReq{}, register, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &pb.RegisterResp{AgentId: "n1"}, nil
+	})
+	s.UnaryStatsInterceptor(context.Background(), &pb.ReportJobReq{AgentId: "n1"}, report, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no job")
+	})
+	// 没有节点 ID 的调用不统计
+	s.UnaryStatsInterceptor(context.Background(), &pb.RegisterReq{}, register, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("rejected")
+	})
+
+	views := s.rpcStats.snapshot("n1")
+	if len(views) != 2 || views[0].Method != register.FullMethod || views[1].Method != report.FullMethod {
+		t.Fatalf("stats = %+v", views)
+	}
+	if views[0].Calls != 1 || views[0].Errors != 0 || views[1].Calls != 1 || views[1].Errors != 1 {
+		t.Errorf("stats = %+v", views)
+	}
+}
+
+func TestRecoveryInterceptors(t *testing.T) {
+	unary := &grpc.UnaryServerInfo{FullMethod: "/test/PanicUnary"}
+	before := testutil.ToFloat64(metrics.GRPCPanics.WithLabelValues(unary.FullMethod))
+	resp, err := RecoveryUnaryInterceptor(context.Background(), &pb.ReportJobReq{AgentId: "n1"}, unary,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic("boom")
+		})
+	if resp != nil || status.Code(err) != codes.Internal {
+		t.Errorf("unary panic: %v, %v", resp, err)
+	}
+	if got := testutil.ToFloat64(metrics.GRPCPanics.WithLabelValues(unary.FullMethod)) - before; got != 1 {
+		t.Errorf("panics +%v, want +1", got)
+	}
+
+	// 没有 panic 时原样返回
+	want := status.Error(codes.NotFound, "no job")
+	if _, err := RecoveryUnaryInterceptor(context.Background(), nil, unary,
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, want }); err != want {
+		t.Errorf("err = %v, want %v", err, want)
+	}
+
+	stream := &grpc.StreamServerInfo{FullMethod: "/test/PanicStream"}
+	err = RecoveryStreamInterceptor(nil, &fakeServerStream{}, stream, func(srv interface{}, ss grpc.ServerStream) error {
+		var m map[string]int
+		m["x"] = 1 // nil map
+		return nil
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("stream panic: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.GRPCPanics.WithLabelValues(stream.FullMethod)); got != 1 {
+		t.Errorf("stream panics = %v, want 1", got)
+	}
+}
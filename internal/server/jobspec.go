@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/mq"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/storage"
+)
+
+// jobSpec 任务的执行选项，/task、/batches 的模板和 POST /agents/{id}/jobs 共用
+type jobSpec struct {
+	// 可选：执行结束后上传的产物 glob，如 ["out/*.json"]，通过 GET /jobs/{id}/artifacts 下载
+	Artifacts []string `json:"artifacts"`
+	// 可选：执行前下载到工作目录的输入文件，如 [{"file_id": "file-xxx", "path": "data/in.csv"}]
+	Files []mq.InputFile `json:"files"`
+	// 可选：额外的环境变量，不能覆盖 Agent 注入的 JOB_ID、ATTEMPT、AGENT_ID、WORKSPACE
+	Env map[string]string `json:"env"`
+	// 可选：工作目录，相对路径在任务的临时工作区内，绝对路径原样使用
+	Workdir string `json:"workdir"`
+	// 可选：以哪个系统用户执行 (Agent 需要有切换用户的权限)
+	User string `json:"user"`
+	// 可选：以环境变量注入的秘密，环境变量名 -> "namespace/name"，如 {"DB_PASSWORD": "prod/db"}
+	// 明文不进任务记录和 MQ，Agent 执行前才通过 GetJobSecrets 获取
+	Secrets map[string]string `json:"secrets"`
+}
+
+const maxJobEnv = 64
+
+var (
+	envNameRe  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	userNameRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,63}$`)
+)
+
+// reservedEnv Agent 为每个任务注入的变量
+var reservedEnv = map[string]bool{"JOB_ID": true, "ATTEMPT": true, "AGENT_ID": true, "WORKSPACE": true}
+
+// apply 校验执行选项并写入任务记录
+func (spec jobSpec) apply(ctx context.Context, store Store, record *JobRecord) error {
+	if err := validateArtifactGlobs(spec.Artifacts); err != nil {
+		return err
+	}
+	files, err := resolveJobFiles(ctx, store, spec.Files)
+	if err != nil {
+		return err
+	}
+
+	if len(spec.Env) > maxJobEnv {
+		return fmt.Errorf("env 最多 %d 个", maxJobEnv)
+	}
+	for k, v := range spec.Env {
+		if !envNameRe.MatchString(k) {
+			return fmt.Errorf("env 变量名 %q 不合法", k)
+		}
+		if reservedEnv[strings.ToUpper(k)] {
+			return fmt.Errorf("env 变量 %s 由 Agent 注入，不能覆盖", k)
+		}
+		if strings.ContainsRune(v, 0) {
+			return fmt.Errorf("env 变量 %s 的值不能包含 NUL 字符", k)
+		}
+	}
+
+	if spec.Workdir != "" && !filepath.IsAbs(spec.Workdir) && !strings.HasPrefix(spec.Workdir, "/") {
+		if _, err := storage.CleanKey(spec.Workdir); err != nil {
+			return errors.New("workdir 必须是绝对路径或工作区内的相对路径")
+		}
+	}
+	if spec.User != "" && !userNameRe.MatchString(spec.User) {
+		return fmt.Errorf("user %q 不合法", spec.User)
+	}
+	secrets, err := resolveJobSecrets(ctx, store, spec.Secrets)
+	if err != nil {
+		return err
+	}
+	for env := range secrets {
+		if _, ok := spec.Env[env]; ok {
+			return fmt.Errorf("环境变量 %s 同时出现在 env 和 secrets 里", env)
+		}
+	}
+
+	record.Artifacts = strings.Join(spec.Artifacts, "\n")
+	record.Files = encodeJobFiles(files)
+	record.Env = encodeJobEnv(spec.Env)
+	record.Workdir = spec.Workdir
+	record.RunAs = spec.User
+	record.Secrets = encodeJobEnv(secrets)
+	return nil
+}
+
+// encodeJobEnv 环境变量 (以及秘密引用) 以 JSON 存在 JobRecord 里
+func encodeJobEnv(env map[string]string) string {
+	if len(env) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(env)
+	return string(b)
+}
+
+func decodeJobEnv(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	var env map[string]string
+	json.Unmarshal([]byte(s), &env)
+	return env
+}
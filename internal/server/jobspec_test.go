@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"testing"
+)
+
+func TestJobSpecApply(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	ctx := context.Background()
+
+	var record JobRecord
+	spec := jobSpec{
+		Env:     map[string]string{"MODE": "fast", "_X1": ""},
+		Workdir: "build/out",
+		User:    "deploy",
+	}
+	if err := spec.apply(ctx, store, &record); err != nil {
+		t.Fatal(err)
+	}
+	if env := decodeJobEnv(record.Env); env["MODE"] != "fast" || len(env) != 2 ||
+		record.Workdir != "build/out" || record.RunAs != "deploy" {
+		t.Errorf("record = env %q, workdir %q, user %q", record.Env, record.Workdir, record.RunAs)
+	}
+	if err := (jobSpec{Workdir: "/srv/app"}).apply(ctx, store, &record); err != nil {
+		t.Errorf("absolute workdir: %v", err)
+	}
+
+	tooMany := map[string]string{}
+	for i := range maxJobEnv + 1 {
+		tooMany["V"+string(rune('A'+i%26))+string(rune('A'+i/26))] = "x"
+	}
+	for name, spec := range map[string]jobSpec{
+		"bad env name":     {Env: map[string]string{"1ABC": "x"}},
+		"env with equals":  {Env: map[string]string{"A=B": "x"}},
+		"reserved env":     {Env: map[string]string{"job_id": "x"}},
+		"nul in value":     {Env: map[string]string{"A": "x\x00y"}},
+		"too many env":     {Env: tooMany},
+		"escaping workdir": {Workdir: "../etc"},
+		"bad user":         {User: "root; rm -rf /"},
+	} {
+		if err := spec.apply(ctx, store, &JobRecord{}); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
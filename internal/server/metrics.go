@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/metrics"
+)
+
+// metricType 任务类型作为指标标签时归一化成 proto 枚举名，避免用户随便填的类型撑爆标签基数
+func metricType(t string) string {
+	return jobTypeOf(t).String()
+}
+
+func countSubmitted(jobType string, n int) {
+	metrics.JobsSubmitted.WithLabelValues(metricType(jobType)).Add(float64(n))
+}
+
+// observeReport 根据 Agent 的汇报更新任务指标
+func observeReport(record JobRecord, status string, now time.Time) {
+	switch status {
+	case JobStatusRunning:
+		since := record.CreatedAt
+		if record.RunAt != nil && record.RunAt.After(since) {
+			since = *record.RunAt // 延时任务从释放时间算起
+		}
+		metrics.DispatchLatency.WithLabelValues(metricType(record.Type)).Observe(now.Sub(since).Seconds())
+	case JobStatusSuccess, JobStatusFailed, JobStatusCancelled:
+		metrics.JobsCompleted.WithLabelValues(metricType(record.Type), status).Inc()
+	}
+}
+
+// stateCollector 在每次抓取时从数据库和会话表里读取队列深度、在线节点数
+type stateCollector struct {
+	srv      *SentinelServer
+	queue    *prometheus.Desc
+	outbox   *prometheus.Desc
+	sessions *prometheus.Desc
+}
+
+// NewMetricsCollector 队列深度和在线节点数的采集器，交给 metrics.RegisterServer 注册
+func NewMetricsCollector(srv *SentinelServer) prometheus.Collector {
+	return &stateCollector{
+		srv:      srv,
+		queue:    prometheus.NewDesc("gcc_jobs_queued", "还没开始执行的任务数", []string{"status"}, nil),
+		outbox:   prometheus.NewDesc("gcc_outbox_pending", "发件箱里等待投递到 MQ 的消息数", nil, nil),
+		sessions: prometheus.NewDesc("gcc_agents_connected", "当前保持心跳流的节点数", nil, nil),
+	}
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queue
+	ch <- c.outbox
+	ch <- c.sessions
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, float64(c.srv.sessionCount.Load()))
+
+	counts, err := c.srv.Store.StatusCounts(context.Background(), pendingStatuses)
+	if err != nil {
+		slog.Error("统计队列深度失败", "err", err)
+		return
+	}
+	for _, st := range pendingStatuses {
+		ch <- prometheus.MustNewConstMetric(c.queue, prometheus.GaugeValue, float64(counts[st]), st)
+	}
+
+	if c.srv.Outbox == nil {
+		return
+	}
+	if n, err := c.srv.Outbox.Pending(context.Background()); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.outbox, prometheus.GaugeValue, float64(n))
+	}
+}
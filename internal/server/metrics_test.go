@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/metrics"
+)
+
+// sampleCount 直方图里某组标签的观测次数
+func sampleCount(t *testing.T, c prometheus.Collector, labels map[string]string) uint64 {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+	next:
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if v, ok := labels[lp.GetName()]; ok && v != lp.GetValue() {
+					continue next
+				}
+			}
+			return m.GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestMetricType(t *testing.T) {
+	for in, want := range map[string]string{
+		"shell":  "SHELL",
+		"Ping":   "PING",
+		"SCAN":   "SCAN",
+		"":       "SHELL",
+		"custom": "SHELL", // 未知类型不单独成为标签值
+	} {
+		if got := metricType(in); got != want {
+			t.Errorf("metricType(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestObserveReport(t *testing.T) {
+	now := time.Now()
+	completed := metrics.JobsCompleted.WithLabelValues("SCAN", JobStatusFailed)
+	before := testutil.ToFloat64(completed)
+	latencyBefore := sampleCount(t, metrics.DispatchLatency, map[string]string{"type": "SCAN"})
+
+	record := JobRecord{Type: "scan"}
+	record.CreatedAt = now.Add(-time.Minute)
+	observeReport(record, JobStatusAccepted, now) // 中间状态不计数
+	observeReport(record, JobStatusRunning, now)
+	observeReport(record, JobStatusFailed, now)
+
+	if got := testutil.ToFloat64(completed) - before; got != 1 {
+		t.Errorf("jobs completed +%v, want +1", got)
+	}
+	if got := sampleCount(t, metrics.DispatchLatency, map[string]string{"type": "SCAN"}) - latencyBefore; got != 1 {
+		t.Errorf("dispatch latency observed %d times, want 1", got)
+	}
+}
+
+func TestStateCollector(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormStore(db)
+	ctx := context.Background()
+	for id, status := range map[string]string{"q1": JobStatusQueued, "q2": JobStatusQueued, "a1": JobStatusAssigned, "r1": JobStatusRunning} {
+		if err := store.CreateJob(ctx, &JobRecord{JobID: id, Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &SentinelServer{Store: store}
+	s.sessionCount.Store(3)
+
+	// 没有发件箱时不输出 gcc_outbox_pending
+	want := `
+# HELP gcc_agents_connected 当前保持心跳流的节点数
+# TYPE gcc_agents_connected gauge
+gcc_agents_connected 3
+# HELP gcc_jobs_queued 还没开始执行的任务数
+# TYPE gcc_jobs_queued gauge
+gcc_jobs_queued{status="Accepted"} 0
+gcc_jobs_queued{status="Assigned"} 1
+gcc_jobs_queued{status="Queued"} 2
+gcc_jobs_queued{status="Scheduled"} 0
+`
+	if err := testutil.CollectAndCompare(NewMetricsCollector(s), strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+
+	// 两个 Queued 任务提交时各写了一条发件箱消息
+	s.Outbox = NewOutboxRelay(db, 0, 0)
+	want = `
+# HELP gcc_outbox_pending 发件箱里等待投递到 MQ 的消息数
+# TYPE gcc_outbox_pending gauge
+gcc_outbox_pending 2
+`
+	if err := testutil.CollectAndCompare(NewMetricsCollector(s), strings.NewReader(want), "gcc_outbox_pending"); err != nil {
+		t.Error(err)
+	}
+}
+
+// 请求耗时按路由模板记录，不按实际路径
+func TestLoggingMiddlewareRecordsRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	h := LoggingMiddleware(mux)
+
+	labels := map[string]string{"method": "GET", "route": "/jobs/{id}", "code": "404"}
+	before := sampleCount(t, metrics.HTTPRequestDuration, labels)
+	unmatched := map[string]string{"method": "GET", "route": "unmatched", "code": "404"}
+	unmatchedBefore := sampleCount(t, metrics.HTTPRequestDuration, unmatched)
+
+	for _, path := range []string{"/jobs/a", "/jobs/b", "/nowhere"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Header().Get("X-Request-ID") == "" {
+			t.Errorf("%s: no X-Request-ID header", path)
+		}
+	}
+	if got := sampleCount(t, metrics.HTTPRequestDuration, labels) - before; got != 2 {
+		t.Errorf("route /jobs/{id} observed %d times, want 2", got)
+	}
+	if got := sampleCount(t, metrics.HTTPRequestDuration, unmatched) - unmatchedBefore; got != 1 {
+		t.Errorf("unmatched route observed %d times, want 1", got)
+	}
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/mq"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/tracing"
+)
+
+// 发件箱消息状态
+const (
+	OutboxPending = "Pending"
+	OutboxSent    = "Sent"
+)
+
+// OutboxMessage 发件箱 (Transactional Outbox)
+// 与 JobRecord 在同一个事务里写入，由 OutboxRelay 异步投递到 RabbitMQ，
+// 只有拿到 Broker 的 publisher confirm 才标记为 Sent，保证任务不丢、不孤立
+type OutboxMessage struct {
+	gorm.Model
+	JobID         string    `gorm:"index;size:191"`
+	Body          string    `gorm:"type:text"`
+	Status        string    `gorm:"index:idx_outbox_pending,priority:1;size:16"`
+	NextAttemptAt time.Time `gorm:"index:idx_outbox_pending,priority:2"`
+	Attempts      int
+	LastError     string `gorm:"size:512"`
+	SentAt        *time.Time
+	TraceParent   string `gorm:"size:64"` // 任务的 trace context，投递时放进 AMQP 消息头
+}
+
+// newOutboxMessage 把任务编码成一条待投递的发件箱消息
+func newOutboxMessage(job JobRecord) (OutboxMessage, error) {
+	body, err := mq.EncodeJob(mq.JobMessage{
+		JobID:     job.JobID,
+		Type:      job.Type,
+		Payload:   job.Payload,
+		Artifacts: splitLines(job.Artifacts),
+		Files:     decodeJobFiles(job.Files),
+		Env:       decodeJobEnv(job.Env),
+		Workdir:   job.Workdir,
+		User:      job.RunAs,
+		SecretEnv: secretEnvNames(job.Secrets),
+		RequestID: job.RequestID,
+	})
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+	return OutboxMessage{
+		JobID:         job.JobID,
+		Body:          string(body),
+		Status:        OutboxPending,
+		NextAttemptAt: time.Now(),
+		TraceParent:   job.TraceParent,
+	}, nil
+}
+
+// enqueueJobs 在事务 tx 内为任务写入发件箱消息，调用方负责提交事务
+func enqueueJobs(tx *gorm.DB, jobs []JobRecord) error {
+	msgs := make([]OutboxMessage, len(jobs))
+	for i, job := range jobs {
+		msg, err := newOutboxMessage(job)
+		if err != nil {
+			return err
+		}
+		msgs[i] = msg
+	}
+	return tx.CreateInBatches(msgs, 500).Error
+}
+
+const (
+	outboxPageSize       = 500
+	outboxConfirmTimeout = 30 * time.Second
+	outboxMaxBackoff     = time.Minute
+	outboxPurgeInterval  = time.Hour
+)
+
+// OutboxRelay 把发件箱里的消息投递到 RabbitMQ
+// Broker 重启或确认超时的消息保持 Pending，按指数退避重试
+// 发件箱的表只由 OutboxRelay 和 enqueueJobs 读写，不经过 Store
+type OutboxRelay struct {
+	DB        *gorm.DB
+	Interval  time.Duration // 兜底轮询间隔
+	Retention time.Duration // 已投递消息保留多久
+
+	wake chan struct{}
+}
+
+func NewOutboxRelay(db *gorm.DB, interval, retention time.Duration) *OutboxRelay {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &OutboxRelay{
+		DB:        db,
+		Interval:  interval,
+		Retention: retention,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Pending 还没投递的消息数
+func (o *OutboxRelay) Pending(ctx context.Context) (int64, error) {
+	var n int64
+	err := o.DB.WithContext(ctx).Model(&OutboxMessage{}).Where("status = ?", OutboxPending).Count(&n).Error
+	return n, err
+}
+
+// Notify 在事务提交后调用，唤醒 relay 立即投递，不必等下一次轮询
+func (o *OutboxRelay) Notify() {
+	if o == nil {
+		return
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 阻塞运行，直到 ctx 被取消
+func (o *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.Interval)
+	defer ticker.Stop()
+	lastPurge := time.Now()
+
+	slog.Info("发件箱投递协程已启动", "interval", o.Interval)
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("发件箱投递协程已停止")
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+
+		// 一页投满说明还有积压，继续投直到清空
+		for o.relayOnce() == outboxPageSize && ctx.Err() == nil {
+		}
+
+		if o.Retention > 0 && time.Since(lastPurge) > outboxPurgeInterval {
+			o.purgeSent()
+			lastPurge = time.Now()
+		}
+	}
+}
+
+// relayOnce 投递一页到期的 Pending 消息，返回本页的消息数
+func (o *OutboxRelay) relayOnce() int {
+	var msgs []OutboxMessage
+	err := o.DB.Where("status = ? AND next_attempt_at <= ?", OutboxPending, time.Now()).
+		Order("id").
+		Limit(outboxPageSize).
+		Find(&msgs).Error
+	if err != nil {
+		slog.Error("查询待投递的发件箱消息失败", "err", err)
+		return 0
+	}
+	if len(msgs) == 0 {
+		return 0
+	}
+
+	// 每条消息一个 job.enqueue span，Agent 从消息头里接上它
+	out := make([]mq.Message, len(msgs))
+	spans := make([]trace.Span, len(msgs))
+	for i, m := range msgs {
+		ctx := tracing.WithTraceParent(context.Background(), m.TraceParent)
+		ctx, spans[i] = tracing.Tracer().Start(ctx, "job.enqueue",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("job.id", m.JobID),
+				attribute.String("messaging.system", "rabbitmq"),
+				attribute.String("messaging.destination.name", mq.QueueName),
+				attribute.Int("outbox.attempts", m.Attempts),
+			))
+		headers := amqp.Table{}
+		tracing.Inject(ctx, tracing.AMQPCarrier(headers))
+		out[i] = mq.Message{Body: []byte(m.Body), Headers: headers}
+	}
+	acked, pubErr := mq.PublishConfirmed(out, outboxConfirmTimeout)
+
+	var sent []uint
+	for i, m := range msgs {
+		if acked[i] {
+			sent = append(sent, m.ID)
+			spans[i].End()
+			continue
+		}
+		reason := "nacked by broker"
+		if pubErr != nil {
+			reason = pubErr.Error()
+		}
+		spans[i].SetStatus(codes.Error, reason)
+		spans[i].End()
+		o.DB.Model(&OutboxMessage{}).Where("id = ?", m.ID).Updates(map[string]interface{}{
+			"attempts":        m.Attempts + 1,
+			"next_attempt_at": time.Now().Add(outboxBackoff(m.Attempts + 1)),
+			"last_error":      truncate(reason, 512),
+		})
+	}
+
+	if len(sent) > 0 {
+		err := o.DB.Model(&OutboxMessage{}).Where("id IN ?", sent).Updates(map[string]interface{}{
+			"status":  OutboxSent,
+			"sent_at": time.Now(),
+		}).Error
+		if err != nil {
+			// 标记失败的消息下一轮会被重复投递，Agent 侧需要按 JobID 去重
+			slog.Error("标记发件箱消息已投递失败", "count", len(sent), "err", err)
+		}
+	}
+
+	if pubErr != nil {
+		slog.Warn("发件箱投递出错，未确认的消息稍后重试", "acked", len(sent), "total", len(msgs), "err", pubErr)
+	} else {
+		slog.Info("发件箱消息已投递", "acked", len(sent), "total", len(msgs))
+	}
+	return len(msgs)
+}
+
+// purgeSent 清理超过保留期的已投递消息
+func (o *OutboxRelay) purgeSent() {
+	res := o.DB.Unscoped().
+		Where("status = ? AND sent_at < ?", OutboxSent, time.Now().Add(-o.Retention)).
+		Delete(&OutboxMessage{})
+	if res.Error != nil {
+		slog.Error("清理已投递的发件箱消息失败", "err", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		slog.Info("已清理投递过的发件箱消息", "count", res.RowsAffected)
+	}
+}
+
+// outboxBackoff 指数退避：2s, 4s, 8s ... 最长 1 分钟
+func outboxBackoff(attempts int) time.Duration {
+	d := time.Second << min(attempts, 6)
+	return min(d, outboxMaxBackoff)
+}
+
+// truncate 把 s 截到最多 n 个字节，截断位置落在多字节字符中间时往前退到字符边界，
+// 否则写进 utf8mb4 列时 MySQL 严格模式会报 Incorrect string value
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateKeepsRuneBoundary(t *testing.T) {
+	cases := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"连接失败", 3, "连"},
+		{"连接失败", 4, "连"}, // 第二个字符只放得下一个字节
+		{"连接失败", 5, "连"},
+		{"连接失败", 6, "连接"},
+		{"a连", 2, "a"},
+		{"连", 1, ""},
+	}
+	for _, c := range cases {
+		got := truncate(c.s, c.n)
+		if got != c.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", c.s, c.n, got, c.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q is not valid UTF-8", c.s, c.n, got)
+		}
+	}
+
+	long := strings.Repeat("错误", 1000)
+	for n := 0; n < 50; n++ {
+		if got := truncate(long, n); !utf8.ValidString(got) || len(got) > n {
+			t.Fatalf("truncate(long, %d) = %q", n, got)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+// AgentProfile 集中管理的 Agent 配置档，按标签分配给节点
+// 节点命中多个配置档时取 Priority 最高的；Tag 为空的是默认配置档，对所有节点生效
+// 不用软删除：删除后允许同名重建
+type AgentProfile struct {
+	ID                uint   `gorm:"primarykey"`
+	Name              string `gorm:"uniqueIndex;size:191"`
+	Tag               string `gorm:"size:191"`
+	Priority          int
+	Revision          int    // 每次修改自增，和 ID 一起组成下发给 Agent 的配置版本
+	HeartbeatInterval int    // 秒，0 表示使用 Agent 默认值
+	MaxConcurrentJobs int    // 0 表示使用 Agent 本地配置
+	AllowedExecutors  string `gorm:"size:255"`  // 逗号分隔，空表示不限制
+	DenyPatterns      string `gorm:"type:text"` // 换行分隔的正则
+	LogLevel          string `gorm:"size:16"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+// Version 下发给 Agent 的配置版本；删除后同名重建的配置档 ID 不同，不会和旧版本撞上
+func (p *AgentProfile) Version() string {
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s@%d.%d", p.Name, p.ID, p.Revision)
+}
+
+// 心跳间隔的合法范围 (秒)
+const (
+	minHeartbeatInterval = 1
+	maxHeartbeatInterval = 300
+)
+
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+
+// matchProfile 为节点挑选配置档，没有命中返回 nil
+func matchProfile(profiles []AgentProfile, tags string) *AgentProfile {
+	var best *AgentProfile
+	for i := range profiles {
+		p := &profiles[i]
+		if p.Tag != "" && !strings.Contains(tags, ","+p.Tag+",") {
+			continue
+		}
+		if best == nil || betterProfile(p, best) {
+			best = p
+		}
+	}
+	return best
+}
+
+// betterProfile 优先级高的优先；同优先级时按标签匹配的比默认配置档更具体，再按 ID 保证结果稳定
+func betterProfile(a, b *AgentProfile) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if (a.Tag != "") != (b.Tag != "") {
+		return a.Tag != ""
+	}
+	return a.ID < b.ID
+}
+
+// profileCacheTTL 配置档缓存的有效期：本实例修改配置档时立即失效，
+// 其他 Server 实例的修改最多这么久之后生效
+const profileCacheTTL = 30 * time.Second
+
+// profileCache 缓存全部配置档，每次心跳都要挑配置档，不必每次查库
+type profileCache struct {
+	mu       sync.Mutex
+	profiles []AgentProfile
+	loadedAt time.Time
+	gen      uint64 // 每次失效加一，查库期间失效过的结果不放进缓存
+}
+
+// invalidate 配置档变化后调用，下一次 profileFor 重新查库
+func (c *profileCache) invalidate() {
+	c.mu.Lock()
+	c.profiles, c.loadedAt = nil, time.Time{}
+	c.gen++
+	c.mu.Unlock()
+}
+
+func (c *profileCache) get(store Store) ([]AgentProfile, error) {
+	c.mu.Lock()
+	if !c.loadedAt.IsZero() && time.Since(c.loadedAt) < profileCacheTTL {
+		profiles := c.profiles
+		c.mu.Unlock()
+		return profiles, nil
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	profiles, err := store.ListProfiles(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.gen == gen {
+		c.profiles, c.loadedAt = profiles, time.Now()
+	}
+	c.mu.Unlock()
+	return profiles, nil
+}
+
+// profileFor 查出节点当前应该使用的配置档
+// 返回的配置档和缓存共用，调用方不能修改
+func (s *SentinelServer) profileFor(tags string) (*AgentProfile, error) {
+	profiles, err := s.profiles.get(s.Store)
+	if err != nil {
+		return nil, err
+	}
+	return matchProfile(profiles, tags), nil
+}
+
+// ProfilesChanged 配置档被创建、修改或删除：清掉缓存，并让所有在线节点重新检查配置
+func (s *SentinelServer) ProfilesChanged() {
+	s.profiles.invalidate()
+	s.KickAll()
+}
+
+// GetAgentConfig Agent 在心跳收到 config_outdated 后调用，拉取当前生效的配置
+func (s *SentinelServer) GetAgentConfig(ctx context.Context, req *pb.GetAgentConfigReq) (*pb.AgentConfig, error) {
+	agent, err := s.Store.GetAgent(ctx, req.AgentId, false)
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "agent %s not registered", req.AgentId)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	profile, err := s.profileFor(agent.Tags)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if profile == nil {
+		// 没有命中任何配置档：Agent 回到本地配置
+		return &pb.AgentConfig{}, nil
+	}
+
+	slog.InfoContext(ctx, "下发配置", "agent_id", req.AgentId, "version", profile.Version())
+	return &pb.AgentConfig{
+		Version:                  profile.Version(),
+		Profile:                  profile.Name,
+		HeartbeatIntervalSeconds: int32(profile.HeartbeatInterval),
+		MaxConcurrentJobs:        int32(profile.MaxConcurrentJobs),
+		AllowedExecutors:         splitList(profile.AllowedExecutors),
+		DenyPatterns:             splitLines(profile.DenyPatterns),
+		LogLevel:                 profile.LogLevel,
+	}, nil
+}
+
+func splitLines(s string) []string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// profileView 是配置档接口的请求和返回结构
+type profileView struct {
+	Name              string    `json:"name"`
+	Tag               string    `json:"tag"`
+	Priority          int       `json:"priority"`
+	Version           string    `json:"version,omitempty"`
+	HeartbeatInterval int       `json:"heartbeat_interval"` // 秒
+	MaxConcurrentJobs int       `json:"max_concurrent_jobs"`
+	AllowedExecutors  []string  `json:"allowed_executors"`
+	DenyPatterns      []string  `json:"deny_patterns"`
+	LogLevel          string    `json:"log_level,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func newProfileView(p AgentProfile) profileView {
+	return profileView{
+		Name:              p.Name,
+		Tag:               p.Tag,
+		Priority:          p.Priority,
+		Version:           p.Version(),
+		HeartbeatInterval: p.HeartbeatInterval,
+		MaxConcurrentJobs: p.MaxConcurrentJobs,
+		AllowedExecutors:  splitList(p.AllowedExecutors),
+		DenyPatterns:      splitLines(p.DenyPatterns),
+		LogLevel:          p.LogLevel,
+		UpdatedAt:         p.UpdatedAt,
+	}
+}
+
+// validate 校验并规整配置档，错误直接返回给调用方
+func (v *profileView) validate() error {
+	if strings.Contains(v.Tag, ",") {
+		return errors.New("tag 不能包含逗号")
+	}
+	if v.HeartbeatInterval != 0 && (v.HeartbeatInterval < minHeartbeatInterval || v.HeartbeatInterval > maxHeartbeatInterval) {
+		return fmt.Errorf("heartbeat_interval 需在 %d-%d 秒之间", minHeartbeatInterval, maxHeartbeatInterval)
+	}
+	if v.MaxConcurrentJobs < 0 {
+		return errors.New("max_concurrent_jobs 不能为负数")
+	}
+	for i, e := range v.AllowedExecutors {
+		e = strings.ToUpper(strings.TrimSpace(e))
+		if _, ok := pb.JobType_value[e]; !ok {
+			return fmt.Errorf("未知的任务类型: %s", v.AllowedExecutors[i])
+		}
+		v.AllowedExecutors[i] = e
+	}
+	for _, p := range v.DenyPatterns {
+		if strings.Contains(p, "\n") {
+			return errors.New("deny_patterns 的单条规则不能换行")
+		}
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("deny_patterns 正则错误: %v", err)
+		}
+	}
+	v.LogLevel = strings.ToLower(v.LogLevel)
+	if v.LogLevel != "" && !logLevels[v.LogLevel] {
+		return errors.New("log_level 只能是 debug / info / warn / error")
+	}
+	return nil
+}
+
+// handleListProfiles 配置档列表
+func (s *HttpServer) handleListProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := s.Store.ListProfiles(r.Context())
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(profiles, func(i, j int) bool { return betterProfile(&profiles[i], &profiles[j]) })
+
+	views := make([]profileView, len(profiles))
+	for i, p := range profiles {
+		views[i] = newProfileView(p)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"profiles": views})
+}
+
+// handlePutProfile 创建或整体替换配置档，每次修改版本号 +1，在线节点会立即收到 config_outdated 并拉取
+func (s *HttpServer) handlePutProfile(w http.ResponseWriter, r *http.Request) {
+	var req profileView
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request: JSON 格式错误", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	profile, err := s.Store.PutProfile(r.Context(), r.PathValue("name"), func(profile *AgentProfile) {
+		profile.Tag = req.Tag
+		profile.Priority = req.Priority
+		profile.Revision++
+		profile.HeartbeatInterval = req.HeartbeatInterval
+		profile.MaxConcurrentJobs = req.MaxConcurrentJobs
+		profile.AllowedExecutors = strings.Join(req.AllowedExecutors, ",")
+		profile.DenyPatterns = strings.Join(req.DenyPatterns, "\n")
+		profile.LogLevel = req.LogLevel
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "保存配置档失败", "profile", r.PathValue("name"), "err", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	s.Srv.ProfilesChanged()
+	slog.InfoContext(r.Context(), "配置档已更新", "profile", profile.Name, "version", profile.Version())
+	writeJSON(w, http.StatusOK, newProfileView(profile))
+}
+
+// handleDeleteProfile 删除配置档，原来使用它的节点会切换到下一个命中的配置档
+func (s *HttpServer) handleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.Store.DeleteProfile(r.Context(), r.PathValue("name"))
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	s.Srv.ProfilesChanged()
+	slog.InfoContext(r.Context(), "配置档已删除", "profile", r.PathValue("name"))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,37 @@
+package server
+
+import "testing"
+
+func TestProfileForIsCached(t *testing.T) {
+	db := newTestDB(t)
+	s := &SentinelServer{Store: NewGormStore(db)}
+	if err := db.Create(&AgentProfile{Name: "gpu", Tag: "gpu", Revision: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	tags := joinTags([]string{"gpu"})
+	p, err := s.profileFor(tags)
+	if err != nil || p == nil || p.Revision != 1 {
+		t.Fatalf("profileFor = %+v, %v; want revision 1", p, err)
+	}
+
+	// 绕过接口直接改库：缓存有效期内还是旧的
+	if err := db.Model(&AgentProfile{}).Where("name = ?", "gpu").Update("revision", 2).Error; err != nil {
+		t.Fatal(err)
+	}
+	if p, _ = s.profileFor(tags); p.Revision != 1 {
+		t.Fatalf("revision = %d before invalidation, want cached 1", p.Revision)
+	}
+
+	s.ProfilesChanged()
+	if p, _ = s.profileFor(tags); p == nil || p.Revision != 2 {
+		t.Fatalf("profileFor after ProfilesChanged = %+v, want revision 2", p)
+	}
+
+	if err := db.Where("name = ?", "gpu").Delete(&AgentProfile{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.ProfilesChanged()
+	if p, _ = s.profileFor(tags); p != nil {
+		t.Fatalf("profileFor after delete = %+v, want nil", p)
+	}
+}
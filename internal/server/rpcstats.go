@@ -0,0 +1,133 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rpcStats 按节点、按方法统计 gRPC 调用，只保存在内存里 (Server 重启后清零)，在节点详情里展示
+// 流的消息数用原子计数，心跳流上每条消息都要加一次，不必抢锁
+type rpcStats struct {
+	mu     sync.Mutex
+	agents map[string]map[string]*rpcMethodStats // agentID -> 方法名 -> 统计
+}
+
+type rpcMethodStats struct {
+	recv atomic.Int64
+	sent atomic.Int64
+
+	// 以下字段由 rpcStats.mu 保护
+	calls       int64 // unary 调用次数或建立过的流数
+	active      int64 // 当前打开的流
+	errors      int64
+	total       time.Duration
+	last        time.Duration
+	lastAt      time.Time
+	lastError   string
+	lastErrorAt *time.Time
+}
+
+// rpcMethodView 节点详情里展示的调用统计
+type rpcMethodView struct {
+	Method          string     `json:"method"`
+	Calls           int64      `json:"calls"`
+	Active          int64      `json:"active,omitempty"`
+	Errors          int64      `json:"errors"`
+	MessagesRecv    int64      `json:"messages_recv,omitempty"`
+	MessagesSent    int64      `json:"messages_sent,omitempty"`
+	TotalDurationMs int64      `json:"total_duration_ms"`
+	LastDurationMs  int64      `json:"last_duration_ms"`
+	LastAt          time.Time  `json:"last_at"`
+	LastError       string     `json:"last_error,omitempty"`
+	LastErrorAt     *time.Time `json:"last_error_at,omitempty"`
+}
+
+func (r *rpcStats) method(agentID, method string) *rpcMethodStats {
+	if r.agents == nil {
+		r.agents = make(map[string]map[string]*rpcMethodStats)
+	}
+	methods := r.agents[agentID]
+	if methods == nil {
+		methods = make(map[string]*rpcMethodStats)
+		r.agents[agentID] = methods
+	}
+	m := methods[method]
+	if m == nil {
+		m = &rpcMethodStats{}
+		methods[method] = m
+	}
+	return m
+}
+
+// observeUnary 记录一次 unary 调用
+func (r *rpcStats) observeUnary(agentID, method string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.method(agentID, method)
+	m.calls++
+	m.finish(d, err)
+}
+
+// openStream 流上第一次拿到节点 ID 时调用，返回的统计用来累加消息数
+func (r *rpcStats) openStream(agentID, method string) *rpcMethodStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.method(agentID, method)
+	m.calls++
+	m.active++
+	m.lastAt = time.Now()
+	return m
+}
+
+// closeStream 流结束时调用
+func (r *rpcStats) closeStream(m *rpcMethodStats, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m.active--
+	m.finish(d, err)
+}
+
+func (m *rpcMethodStats) finish(d time.Duration, err error) {
+	now := time.Now()
+	m.total += d
+	m.last = d
+	m.lastAt = now
+	if err != nil {
+		m.errors++
+		m.lastError = err.Error()
+		m.lastErrorAt = &now
+	}
+}
+
+// snapshot 某个节点的调用统计，按方法名排序
+func (r *rpcStats) snapshot(agentID string) []rpcMethodView {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	views := make([]rpcMethodView, 0, len(r.agents[agentID]))
+	for name, m := range r.agents[agentID] {
+		views = append(views, rpcMethodView{
+			Method:          name,
+			Calls:           m.calls,
+			Active:          m.active,
+			Errors:          m.errors,
+			MessagesRecv:    m.recv.Load(),
+			MessagesSent:    m.sent.Load(),
+			TotalDurationMs: m.total.Milliseconds(),
+			LastDurationMs:  m.last.Milliseconds(),
+			LastAt:          m.lastAt,
+			LastError:       m.lastError,
+			LastErrorAt:     m.lastErrorAt,
+		})
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Method < views[j].Method })
+	return views
+}
+
+// forget 节点下线后丢掉它的统计
+func (r *rpcStats) forget(agentID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.agents, agentID)
+}
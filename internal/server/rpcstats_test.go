@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRPCStats(t *testing.T) {
+	var r rpcStats
+	r.observeUnary("n1", "/b", 30*time.Millisecond, nil)
+	r.observeUnary("n1", "/b", 10*time.Millisecond, errors.New("denied"))
+	r.observeUnary("n2", "/a", time.Millisecond, nil)
+
+	m := r.openStream("n1", "/a")
+	m.recv.Add(5)
+	m.sent.Add(2)
+	views := r.snapshot("n1")
+	if len(views) != 2 || views[0].Method != "/a" || views[1].Method != "/b" {
+		t.Fatalf("snapshot = %+v, want sorted by method", views)
+	}
+	if v := views[0]; v.Calls != 1 || v.Active != 1 || v.MessagesRecv != 5 || v.MessagesSent != 2 {
+		t.Errorf("open stream = %+v", v)
+	}
+	if v := views[1]; v.Calls != 2 || v.Errors != 1 || v.TotalDurationMs != 40 || v.LastDurationMs != 10 ||
+		v.LastError != "denied" || v.LastErrorAt == nil {
+		t.Errorf("unary = %+v", v)
+	}
+
+	r.closeStream(m, time.Second, nil)
+	if v := r.snapshot("n1")[0]; v.Active != 0 || v.Errors != 0 || v.LastDurationMs != 1000 {
+		t.Errorf("closed stream = %+v", v)
+	}
+
+	r.forget("n1")
+	if views := r.snapshot("n1"); len(views) != 0 {
+		t.Errorf("stats after forget = %+v", views)
+	}
+	if views := r.snapshot("n2"); len(views) != 1 {
+		t.Errorf("forget removed other agents: %+v", views)
+	}
+	if views := r.snapshot("unknown"); views == nil || len(views) != 0 {
+		t.Errorf("unknown agent = %#v, want empty slice", views)
+	}
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+// SecretRecord 加密保存的秘密值，任务通过 "namespace/name" 引用，明文只在执行时发给 Agent
+// 修改时覆盖原记录，所以不用软删除
+type SecretRecord struct {
+	ID        uint   `gorm:"primarykey"`
+	Namespace string `gorm:"uniqueIndex:idx_secret_ns_name;size:64"`
+	Name      string `gorm:"uniqueIndex:idx_secret_ns_name;size:64"`
+	Value     []byte // 密文，见 secrets.Box
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// 不写 namespace 时的默认值
+const defaultSecretNamespace = "default"
+
+var secretNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// parseSecretRef 解析任务里的引用："namespace/name" 或 "name" (默认 namespace)
+func parseSecretRef(ref string) (namespace, name string, err error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		namespace, name = defaultSecretNamespace, ref
+	}
+	if !secretNameRe.MatchString(namespace) || !secretNameRe.MatchString(name) {
+		return "", "", fmt.Errorf("secret 引用 %q 格式错误，应为 namespace/name", ref)
+	}
+	return namespace, name, nil
+}
+
+// secretAAD 密文绑定 namespace/name，被挪到别的记录上会解密失败
+func secretAAD(namespace, name string) []byte {
+	return []byte(namespace + "/" + name)
+}
+
+// resolveJobSecrets 校验任务引用的秘密都存在，返回规范化后的 环境变量名 -> namespace/name
+func resolveJobSecrets(ctx context.Context, store Store, refs map[string]string) (map[string]string, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]string, len(refs))
+	for env, ref := range refs {
+		if !envNameRe.MatchString(env) || reservedEnv[strings.ToUpper(env)] {
+			return nil, fmt.Errorf("secrets 的环境变量名 %q 不合法", env)
+		}
+		ns, name, err := parseSecretRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		exists, err := store.SecretExists(ctx, ns, name)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("secret %s/%s 不存在", ns, name)
+		}
+		out[env] = ns + "/" + name
+	}
+	return out, nil
+}
+
+func decodeJobSecrets(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	var refs map[string]string
+	json.Unmarshal([]byte(s), &refs)
+	return refs
+}
+
+// secretEnvNames 下发给 Agent 的只有环境变量名
+func secretEnvNames(s string) []string {
+	refs := decodeJobSecrets(s)
+	if len(refs) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(refs))
+	for env := range refs {
+		names = append(names, env)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadJobSecrets 解密任务引用的全部秘密，返回 环境变量名 -> 明文
+func (s *SentinelServer) loadJobSecrets(record JobRecord) (map[string]string, error) {
+	refs := decodeJobSecrets(record.Secrets)
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	if s.Secrets == nil {
+		return nil, errors.New("server.secret_key 未配置")
+	}
+	values := make(map[string]string, len(refs))
+	for env, ref := range refs {
+		v, err := s.secretValue(ref)
+		if err != nil {
+			return nil, err
+		}
+		values[env] = v
+	}
+	return values, nil
+}
+
+// secretValue 解密一个秘密，ref 为 "namespace/name" 或 "name"
+func (s *SentinelServer) secretValue(ref string) (string, error) {
+	if s.Secrets == nil {
+		return "", errors.New("server.secret_key 未配置")
+	}
+	ns, name, err := parseSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	secret, err := s.Store.GetSecret(context.Background(), ns, name)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", ref, err)
+	}
+	plain, err := s.Secrets.Open(secret.Value, secretAAD(ns, name))
+	if err != nil {
+		return "", fmt.Errorf("secret %s 解密失败 (主密钥是否更换过?): %w", ref, err)
+	}
+	return string(plain), nil
+}
+
+// GetJobSecrets Agent 在开始执行任务前获取秘密值；只有汇报了 Running 的那个 Agent 能取到
+func (s *SentinelServer) GetJobSecrets(ctx context.Context, req *pb.GetJobSecretsReq) (*pb.JobSecrets, error) {
+	record, err := s.Store.GetJob(ctx, req.JobId)
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "job %s not found", req.JobId)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if record.AgentID != req.AgentId || record.Status != JobStatusRunning {
+		slog.WarnContext(ctx, "拒绝获取任务秘密", "agent_id", req.AgentId, "job_id", req.JobId, "status", record.Status, "job_agent_id", record.AgentID)
+		return nil, status.Errorf(codes.PermissionDenied, "job %s is not running on agent %s", req.JobId, req.AgentId)
+	}
+
+	values, err := s.loadJobSecrets(record)
+	if err != nil {
+		slog.ErrorContext(ctx, "获取任务秘密失败", "job_id", req.JobId, "err", err)
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	slog.InfoContext(ctx, "任务秘密已发给 Agent", "job_id", req.JobId, "agent_id", req.AgentId, "count", len(values))
+	return &pb.JobSecrets{Env: values}, nil
+}
+
+// maskValues 任务引用的秘密明文，用于在保存和打印输出前打码；出错时返回 nil
+func (s *SentinelServer) maskValues(record JobRecord) []string {
+	values, err := s.loadJobSecrets(record)
+	if err != nil {
+		slog.Warn("任务秘密读取失败，输出无法打码", "job_id", record.JobID, "err", err)
+		return nil
+	}
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, v)
+	}
+	return out
+}
+
+// secretView 是秘密接口的返回结构，永远不包含值
+type secretView struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newSecretView(r SecretRecord) secretView {
+	return secretView{Namespace: r.Namespace, Name: r.Name, CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt}
+}
+
+// secretPath 校验路径里的 namespace 和 name
+func secretPath(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	ns, name := r.PathValue("namespace"), r.PathValue("name")
+	if !secretNameRe.MatchString(ns) || !secretNameRe.MatchString(name) {
+		http.Error(w, "Bad Request: namespace 和 name 只能包含字母、数字和 _.-，最长 64 个字符", http.StatusBadRequest)
+		return "", "", false
+	}
+	return ns, name, true
+}
+
+// handleListSecrets 列出秘密 (只有名字)，可以用 ?namespace= 过滤
+func (s *HttpServer) handleListSecrets(w http.ResponseWriter, r *http.Request) {
+	records, err := s.Store.ListSecrets(r.Context(), r.URL.Query().Get("namespace"))
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	views := make([]secretView, len(records))
+	for i, rec := range records {
+		views[i] = newSecretView(rec)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"secrets": views})
+}
+
+// handlePutSecret 创建或修改秘密，请求体 {"value": "..."}
+func (s *HttpServer) handlePutSecret(w http.ResponseWriter, r *http.Request) {
+	if s.Srv.Secrets == nil {
+		http.Error(w, "server.secret_key 未配置，无法保存秘密", http.StatusServiceUnavailable)
+		return
+	}
+	ns, name, ok := secretPath(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request: JSON 格式错误", http.StatusBadRequest)
+		return
+	}
+	if req.Value == "" {
+		http.Error(w, "Bad Request: value 不能为空", http.StatusBadRequest)
+		return
+	}
+
+	record := SecretRecord{Namespace: ns, Name: name, Value: s.Srv.Secrets.Seal([]byte(req.Value), secretAAD(ns, name))}
+	if err := s.Store.PutSecret(r.Context(), &record); err != nil {
+		slog.ErrorContext(r.Context(), "保存秘密失败", "namespace", ns, "name", name, "err", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "秘密已保存", "namespace", ns, "name", name)
+	writeJSON(w, http.StatusOK, newSecretView(record))
+}
+
+// handleDeleteSecret 删除秘密；引用它的任务在执行时会失败
+func (s *HttpServer) handleDeleteSecret(w http.ResponseWriter, r *http.Request) {
+	ns, name, ok := secretPath(w, r)
+	if !ok {
+		return
+	}
+	deleted, err := s.Store.DeleteSecret(r.Context(), ns, name)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Secret not found", http.StatusNotFound)
+		return
+	}
+	slog.InfoContext(r.Context(), "秘密已删除", "namespace", ns, "name", name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/secrets"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	for ref, want := range map[string]string{
+		"prod/db":  "prod/db",
+		"db":       defaultSecretNamespace + "/db",
+		"a.b/c-d_": "a.b/c-d_",
+	} {
+		ns, name, err := parseSecretRef(ref)
+		if err != nil || ns+"/"+name != want {
+			t.Errorf("parseSecretRef(%q) = %s/%s, %v; want %s", ref, ns, name, err, want)
+		}
+	}
+	for _, ref := range []string{"", "prod/", "/db", "a/b/c", "prod/db name", strings.Repeat("x", 65)} {
+		if _, _, err := parseSecretRef(ref); err == nil {
+			t.Errorf("parseSecretRef(%q) accepted", ref)
+		}
+	}
+}
+
+func newSecretTestServer(t *testing.T) (*SentinelServer, *HttpServer) {
+	t.Helper()
+	box, err := secrets.NewBox(hex.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewGormStore(newTestDB(t))
+	s := &SentinelServer{Store: store, Secrets: box}
+	return s, &HttpServer{Store: store, Srv: s}
+}
+
+func putSecret(h *HttpServer, ns, name, body string) int {
+	r := httptest.NewRequest(http.MethodPut, "/secrets/"+url.PathEscape(ns)+"/"+url.PathEscape(name), strings.NewReader(body))
+	r.SetPathValue("namespace", ns)
+	r.SetPathValue("name", name)
+	w := httptest.NewRecorder()
+	h.handlePutSecret(w, r)
+	return w.Code
+}
+
+// 秘密以密文入库，接口不返回值；只有正在执行该任务的 Agent 能取到明文
+func TestSecretInjection(t *testing.T) {
+	s, h := newSecretTestServer(t)
+	ctx := context.Background()
+	if code := putSecret(h, "prod", "db", `{"value":"hunter2"}`); code != http.StatusOK {
+		t.Fatalf("put: status %d", code)
+	}
+	stored, err := s.Store.GetSecret(ctx, "prod", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored.Value, []byte("hunter2")) {
+		t.Fatal("secret stored in plaintext")
+	}
+
+	w := httptest.NewRecorder()
+	h.handleListSecrets(w, httptest.NewRequest(http.MethodGet, "/secrets", nil))
+	if !strings.Contains(w.Body.String(), `"name":"db"`) || strings.Contains(w.Body.String(), "hunter2") {
+		t.Errorf("list = %s", w.Body)
+	}
+
+	var record JobRecord
+	spec := jobSpec{Env: map[string]string{"MODE": "x"}, Secrets: map[string]string{"DB_PASSWORD": "prod/db"}}
+	if err := spec.apply(ctx, s.Store, &record); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(record.Secrets, "hunter2") || !strings.Contains(record.Secrets, "prod/db") {
+		t.Errorf("job secrets = %q", record.Secrets)
+	}
+	if names := secretEnvNames(record.Secrets); len(names) != 1 || names[0] != "DB_PASSWORD" {
+		t.Errorf("secretEnvNames = %v", names)
+	}
+	record.JobID, record.AgentID, record.Status = "j1", "n1", JobStatusAssigned
+	if err := s.Store.CreateJob(ctx, &record); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(agentID string) (*pb.JobSecrets, error) {
+		return s.GetJobSecrets(ctx, &pb.GetJobSecretsReq{JobId: "j1", AgentId: agentID})
+	}
+	if _, err := get("n1"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("before Running: %v, want PermissionDenied", err)
+	}
+	s.Store.UpdateJob(ctx, JobMatch{JobID: "j1"}, map[string]interface{}{"status": JobStatusRunning})
+	if _, err := get("n2"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("other agent: %v, want PermissionDenied", err)
+	}
+	resp, err := get("n1")
+	if err != nil || resp.Env["DB_PASSWORD"] != "hunter2" || len(resp.Env) != 1 {
+		t.Fatalf("GetJobSecrets = %v, %v", resp, err)
+	}
+
+	// Agent 没打码的输出在入库前打码
+	if _, err := s.ReportJobStatus(ctx, &pb.ReportJobReq{JobId: "j1", AgentId: "n1", Status: JobStatusSuccess, Result: "connected with hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := s.Store.GetJob(ctx, "j1"); job.Result != "connected with "+secrets.Redacted {
+		t.Errorf("stored result = %q", job.Result)
+	}
+}
+
+func TestSecretValidation(t *testing.T) {
+	s, h := newSecretTestServer(t)
+	ctx := context.Background()
+	if code := putSecret(h, "prod", "db", `{"value":"v"}`); code != http.StatusOK {
+		t.Fatalf("put: status %d", code)
+	}
+
+	for name, refs := range map[string]map[string]string{
+		"missing secret":  {"DB": "prod/other"},
+		"bad reference":   {"DB": "a/b/c"},
+		"bad env name":    {"1DB": "prod/db"},
+		"reserved env":    {"JOB_ID": "prod/db"},
+		"also set in env": {"MODE": "prod/db"},
+	} {
+		spec := jobSpec{Env: map[string]string{"MODE": "x"}, Secrets: refs}
+		if err := spec.apply(ctx, s.Store, &JobRecord{}); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+
+	for body, want := range map[string]int{`{"value":""}`: http.StatusBadRequest, `not json`: http.StatusBadRequest} {
+		if code := putSecret(h, "prod", "db", body); code != want {
+			t.Errorf("put %s: status %d, want %d", body, code, want)
+		}
+	}
+	if code := putSecret(h, "prod", "bad name", `{"value":"v"}`); code != http.StatusBadRequest {
+		t.Errorf("bad name: status %d, want 400", code)
+	}
+	s.Secrets = nil
+	if code := putSecret(h, "prod", "db", `{"value":"v"}`); code != http.StatusServiceUnavailable {
+		t.Errorf("no master key: status %d, want 503", code)
+	}
+
+	del := func() int {
+		r := httptest.NewRequest(http.MethodDelete, "/secrets/prod/db", nil)
+		r.SetPathValue("namespace", "prod")
+		r.SetPathValue("name", "db")
+		w := httptest.NewRecorder()
+		h.handleDeleteSecret(w, r)
+		return w.Code
+	}
+	if code := del(); code != http.StatusNoContent {
+		t.Errorf("delete: status %d, want 204", code)
+	}
+	if code := del(); code != http.StatusNotFound {
+		t.Errorf("second delete: status %d, want 404", code)
+	}
+}
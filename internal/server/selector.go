@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+// Selector 按节点属性挑选 Agent，所有条件都满足才算匹配
+//
+//	os / arch / kernel / hostname / agent_version / build_commit / container / hypervisor  精确匹配 (忽略大小写)
+//	os_release / cpu_model                                                                 包含匹配 (忽略大小写)
+//	tag          节点具备全部标签，多个用逗号分隔，如 "gpu,prod"
+//	capability   节点能执行该类型的任务，如 "SHELL"
+//	ip           节点任一地址等于该 IP 或落在该网段内，如 "10.0.0.0/8"
+//	min_cpus / min_memory_mb / min_disk_free_mb  数值下限
+type Selector map[string]string
+
+var selectorExact = map[string]func(AgentModel) string{
+	"os":            func(a AgentModel) string { return a.OS },
+	"arch":          func(a AgentModel) string { return a.Arch },
+	"kernel":        func(a AgentModel) string { return a.Kernel },
+	"hostname":      func(a AgentModel) string { return a.Hostname },
+	"agent_version": func(a AgentModel) string { return a.AgentVersion },
+	"build_commit":  func(a AgentModel) string { return a.BuildCommit },
+	"container":     func(a AgentModel) string { return a.Container },
+	"hypervisor":    func(a AgentModel) string { return a.Hypervisor },
+}
+
+var selectorContains = map[string]func(AgentModel) string{
+	"os_release": func(a AgentModel) string { return a.OSRelease },
+	"cpu_model":  func(a AgentModel) string { return a.CPUModel },
+}
+
+// selectorMin 数值下限，值的单位见键名
+var selectorMin = map[string]func(AgentModel) int64{
+	"min_cpus":         func(a AgentModel) int64 { return int64(a.CPUCount) },
+	"min_memory_mb":    func(a AgentModel) int64 { return a.MemoryTotal >> 20 },
+	"min_disk_free_mb": func(a AgentModel) int64 { return a.DiskFree >> 20 },
+}
+
+// Validate 提交任务时校验 selector，避免写错键名导致永远匹配不上
+func (sel Selector) Validate() error {
+	for key, val := range sel {
+		switch {
+		case selectorExact[key] != nil, selectorContains[key] != nil,
+			key == "tag", key == "capability":
+		case selectorMin[key] != nil:
+			if _, err := strconv.ParseInt(val, 10, 64); err != nil {
+				return fmt.Errorf("selector %s 必须是整数", key)
+			}
+		case key == "ip":
+			if _, err := parseIPOrPrefix(val); err != nil {
+				return fmt.Errorf("selector ip 格式错误: %v", err)
+			}
+		default:
+			return fmt.Errorf("不支持的 selector 键: %s", key)
+		}
+	}
+	return nil
+}
+
+// Match 节点是否满足 selector (调用前应先 Validate)
+func (sel Selector) Match(a AgentModel) bool {
+	for key, val := range sel {
+		if get := selectorExact[key]; get != nil {
+			if !strings.EqualFold(get(a), val) {
+				return false
+			}
+			continue
+		}
+		if get := selectorContains[key]; get != nil {
+			if !strings.Contains(strings.ToLower(get(a)), strings.ToLower(val)) {
+				return false
+			}
+			continue
+		}
+		if get := selectorMin[key]; get != nil {
+			min, _ := strconv.ParseInt(val, 10, 64)
+			if get(a) < min {
+				return false
+			}
+			continue
+		}
+
+		switch key {
+		case "tag":
+			for _, tag := range strings.Split(val, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" && !strings.Contains(a.Tags, ","+tag+",") {
+					return false
+				}
+			}
+		case "capability":
+			if !containsFold(splitList(a.Capabilities), val) {
+				return false
+			}
+		case "ip":
+			if !matchIP(splitList(a.IPs), val) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// pickAgents 返回满足 selector 的节点，空闲槽位 (扣掉队列里待执行的任务) 多的排在前面
+func pickAgents(agents []AgentModel, sel Selector, queued map[string]int) []AgentModel {
+	var matched []AgentModel
+	for _, a := range agents {
+		if sel.Match(a) {
+			matched = append(matched, a)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return freeSlots(matched[i])-queued[matched[i].AgentID] > freeSlots(matched[j])-queued[matched[j].AgentID]
+	})
+	return matched
+}
+
+// freeSlots 旧版 Agent 不上报并发上限，按 1 个空闲槽位算
+func freeSlots(a AgentModel) int {
+	if a.MaxJobs <= 0 {
+		return 1
+	}
+	return a.MaxJobs - a.RunningJobs
+}
+
+func parseIPOrPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func matchIP(ips []string, want string) bool {
+	prefix, err := parseIPOrPrefix(want)
+	if err != nil {
+		return false
+	}
+	for _, ip := range ips {
+		if addr, err := netip.ParseAddr(ip); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, want string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// jobTypeOf 把 HTTP 提交的任务类型映射到 proto 枚举，未知类型按 SHELL 处理
+func jobTypeOf(t string) pb.JobType {
+	if v, ok := pb.JobType_value[strings.ToUpper(t)]; ok {
+		return pb.JobType(v)
+	}
+	return pb.JobType_SHELL
+}
+
+// handleSelectorTask 指定了 selector 的任务不走 MQ (MQ 里谁抢到算谁的)，
+// 而是挑一个满足条件、最空闲的在线节点，放进它的下发队列，经心跳流推送给节点
+func (s *HttpServer) handleSelectorTask(ctx context.Context, w http.ResponseWriter, record JobRecord, sel Selector) {
+	agents, err := s.Store.ListAgents(ctx, AgentQuery{SeenSince: s.offlineCutoff(), NoDrain: true})
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	queued, err := s.Store.QueuedCounts(ctx)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	candidates := pickAgents(agents, sel, queued)
+	if len(candidates) == 0 {
+		http.Error(w, "没有满足 selector 的在线节点", http.StatusConflict)
+		return
+	}
+
+	selJSON, _ := json.Marshal(sel)
+	record.Selector = string(selJSON)
+	if err := s.assignJob(ctx, &record, candidates[0].AgentID); err != nil {
+		slog.ErrorContext(ctx, "任务入库失败", "err", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	auditDetail(ctx, "agent_id", record.AgentID)
+	slog.InfoContext(jobLogContext(ctx, record), "任务已按 selector 指派给节点", "agent_id", record.AgentID)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"code":     200,
+		"msg":      "任务已指派给节点",
+		"job_id":   record.JobID,
+		"status":   record.Status,
+		"agent_id": record.AgentID,
+	})
+}
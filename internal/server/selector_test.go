@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+func TestSelectorValidate(t *testing.T) {
+	for _, sel := range []Selector{
+		nil,
+		{"os": "linux", "tag": "gpu,prod", "capability": "SHELL"},
+		{"cpu_model": "xeon", "min_cpus": "8", "min_memory_mb": "1024"},
+		{"ip": "10.0.0.0/8"},
+		{"ip": "fe80::1"},
+	} {
+		if err := sel.Validate(); err != nil {
+			t.Errorf("%v: %v", sel, err)
+		}
+	}
+	for _, sel := range []Selector{
+		{"region": "cn"},
+		{"min_cpus": "many"},
+		{"ip": "10.0.0.0/33"},
+		{"ip": "host.local"},
+	} {
+		if err := sel.Validate(); err == nil {
+			t.Errorf("%v: want error", sel)
+		}
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	agent := AgentModel{
+		OS:           "linux",
+		Arch:         "amd64",
+		Hostname:     "web-1",
+		Tags:         joinTags([]string{"gpu", "prod"}),
+		Capabilities: "SHELL,PYTHON",
+		IPs:          "10.1.2.3,fe80::1",
+		OSRelease:    "Ubuntu 22.04.3 LTS",
+		CPUModel:     "Intel(R) Xeon(R) Gold",
+		CPUCount:     8,
+		MemoryTotal:  16 << 30,
+		DiskFree:     500 << 20,
+	}
+	for name, c := range map[string]struct {
+		sel  Selector
+		want bool
+	}{
+		"empty":                {Selector{}, true},
+		"exact ignores case":   {Selector{"os": "Linux", "arch": "AMD64"}, true},
+		"exact mismatch":       {Selector{"os": "windows"}, false},
+		"exact is not prefix":  {Selector{"hostname": "web"}, false},
+		"contains":             {Selector{"os_release": "ubuntu 22", "cpu_model": "xeon"}, true},
+		"contains mismatch":    {Selector{"os_release": "debian"}, false},
+		"all tags":             {Selector{"tag": "prod, gpu"}, true},
+		"missing tag":          {Selector{"tag": "gpu,staging"}, false},
+		"tag is not substring": {Selector{"tag": "pro"}, false},
+		"capability":           {Selector{"capability": "python"}, true},
+		"missing capability":   {Selector{"capability": "DOCKER"}, false},
+		"ip in cidr":           {Selector{"ip": "10.0.0.0/8"}, true},
+		"ip exact v6":          {Selector{"ip": "fe80::1"}, true},
+		"ip outside":           {Selector{"ip": "192.168.0.0/16"}, false},
+		"min reached":          {Selector{"min_cpus": "8", "min_memory_mb": "16384", "min_disk_free_mb": "500"}, true},
+		"min not reached":      {Selector{"min_cpus": "16"}, false},
+		"one condition fails":  {Selector{"os": "linux", "tag": "gpu", "arch": "arm64"}, false},
+		"unknown key":          {Selector{"region": "cn"}, false},
+	} {
+		if got := c.sel.Match(agent); got != c.want {
+			t.Errorf("%s: Match = %v, want %v", name, got, c.want)
+		}
+	}
+}
+
+// 满足条件的节点按空闲槽位 (扣掉队列里的任务) 从多到少排列
+func TestPickAgents(t *testing.T) {
+	agents := []AgentModel{
+		{AgentID: "busy", OS: "linux", MaxJobs: 4, RunningJobs: 4},
+		{AgentID: "windows", OS: "windows", MaxJobs: 8},
+		{AgentID: "idle", OS: "linux", MaxJobs: 4},
+		{AgentID: "queued", OS: "linux", MaxJobs: 8, RunningJobs: 1},
+		{AgentID: "legacy", OS: "linux"},
+	}
+	queued := map[string]int{"queued": 5}
+
+	var got []string
+	for _, a := range pickAgents(agents, Selector{"os": "linux"}, queued) {
+		got = append(got, a.AgentID)
+	}
+	if want := []string{"idle", "queued", "legacy", "busy"}; !slices.Equal(got, want) {
+		t.Errorf("pickAgents = %v, want %v", got, want)
+	}
+	if got := pickAgents(agents, Selector{"os": "darwin"}, nil); len(got) != 0 {
+		t.Errorf("pickAgents with no match = %v", got)
+	}
+}
+
+func TestJoinTags(t *testing.T) {
+	if got := joinTags([]string{" gpu ", "", "a,b", "prod"}); got != ",gpu,prod," {
+		t.Errorf("joinTags = %q", got)
+	}
+	if got := joinTags(nil); got != "" {
+		t.Errorf("joinTags(nil) = %q", got)
+	}
+	if got := splitList(",gpu,prod,"); !slices.Equal(got, []string{"gpu", "prod"}) {
+		t.Errorf("splitList = %q", got)
+	}
+}
+
+// 注册时上报的主机信息全部入库，重新注册时覆盖
+func TestRegisterStoresFacts(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	s := &SentinelServer{Store: store}
+	ctx := context.Background()
+	req := &pb.RegisterReq{
+		Hostname:     "n1",
+		Ip:           "10.0.0.5",
+		Tags:         []string{"gpu"},
+		Os:           "linux",
+		Arch:         "arm64",
+		Kernel:       "6.1.0",
+		AgentVersion: "v1.2.0",
+		Capabilities: []string{"SHELL", "PYTHON"},
+		Facts: &pb.AgentFacts{
+			Ips:         []string{"10.0.0.5", "fe80::1"},
+			OsRelease:   "Debian GNU/Linux 12",
+			CpuCount:    4,
+			CpuModel:    "Cortex-A72",
+			MemoryTotal: 8 << 30,
+			DiskTotal:   100 << 30,
+			DiskFree:    40 << 30,
+			BuildCommit: "abc123",
+			Container:   "docker",
+		},
+	}
+	if _, err := s.Register(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	agent, err := store.GetAgent(ctx, "n1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent.IP != "10.0.0.5" || agent.Tags != ",gpu," || agent.Arch != "arm64" || agent.Capabilities != "SHELL,PYTHON" ||
+		agent.IPs != "10.0.0.5,fe80::1" || agent.CPUCount != 4 || agent.MemoryTotal != 8<<30 ||
+		agent.DiskFree != 40<<30 || agent.BuildCommit != "abc123" || agent.Container != "docker" {
+		t.Errorf("stored agent = %+v", agent)
+	}
+	if !(Selector{"arch": "arm64", "ip": "10.0.0.0/24", "min_memory_mb": "8192"}).Match(agent) {
+		t.Error("registered agent does not match its own facts")
+	}
+
+	req.Tags, req.Facts.Container = []string{"prod"}, ""
+	if _, err := s.Register(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	agent, _ = store.GetAgent(ctx, "n1", false)
+	if agent.Tags != ",prod," || agent.Container != "" {
+		t.Errorf("re-registered agent kept old facts: tags %q, container %q", agent.Tags, agent.Container)
+	}
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	grpccodes "google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/tracing"
+)
+
+// HeartbeatPolicy 心跳间隔由 Server 决定，随心跳响应下发给 Agent
+type HeartbeatPolicy struct {
+	Interval   time.Duration // 节点较少时的心跳间隔
+	Jitter     time.Duration // 随机抖动上限，0 表示取间隔的 1/5
+	TargetRate int           // 每秒最多处理多少条心跳，在线节点多了自动拉长间隔，0 表示不限
+	Max        time.Duration // 间隔上限，要明显小于判定 Offline 的时长
+}
+
+// interval 配置档指定了心跳间隔就用配置档的，否则按在线节点数自适应
+func (p HeartbeatPolicy) interval(agents int64, profile *AgentProfile) time.Duration {
+	d := p.Interval
+	if d <= 0 {
+		d = 5 * time.Second
+	}
+	if profile != nil && profile.HeartbeatInterval > 0 {
+		d = time.Duration(profile.HeartbeatInterval) * time.Second
+	} else if p.TargetRate > 0 {
+		// 取整到秒，节点数小幅波动时不必给所有节点下发新间隔
+		if adaptive := (time.Duration(agents) * time.Second / time.Duration(p.TargetRate)).Round(time.Second); adaptive > d {
+			d = adaptive
+		}
+	}
+	if p.Max > 0 && d > p.Max {
+		d = p.Max
+	}
+	return d
+}
+
+func (p HeartbeatPolicy) jitter(interval time.Duration) time.Duration {
+	if p.Jitter > 0 {
+		return min(p.Jitter, interval)
+	}
+	return interval / 5
+}
+
+// agentSession 一条心跳流对应的会话
+// 发往 Agent 的消息只在 Heartbeat 的主循环里发送，其他协程通过 kick 唤醒它
+type agentSession struct {
+	agentID string
+	kick    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc // 节点建立了新的心跳流时由新会话调用，旧会话的主循环随之退出
+	reload  atomic.Bool        // 唤醒时是否需要重新读取节点状态 (drain、配置档)
+
+	mu      sync.Mutex
+	cancels []string // 待下发的取消指令
+
+	// 以下字段只在主循环里访问
+	legacy        bool // 旧版 Agent 不带 seq，也不会确认消息
+	seq           int64
+	lastHeartbeat int64
+	running, max  int32
+	drain         bool
+	configVersion string
+	profile       *AgentProfile
+	inflight      map[string]int64 // 本次会话已下发、还没收到 JobAccepted 的任务 (jobID -> seq)
+
+	ping           bool // 上一条心跳要求立即回复
+	replied        bool
+	sentDrain      bool
+	sentInterval   time.Duration
+	outdatedSentAt time.Time
+}
+
+func newAgentSession(ctx context.Context, agentID string) *agentSession {
+	ctx, cancel := context.WithCancel(ctx)
+	return &agentSession{
+		agentID:  agentID,
+		kick:     make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+		inflight: make(map[string]int64),
+	}
+}
+
+func (sess *agentSession) wake(reload bool) {
+	if reload {
+		sess.reload.Store(true)
+	}
+	select {
+	case sess.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (sess *agentSession) takeCancels() []string {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	ids := sess.cancels
+	sess.cancels = nil
+	return ids
+}
+
+// errSessionReplaced 同一个节点建立了新的心跳流，旧的流以这个错误结束
+var errSessionReplaced = status.Error(grpccodes.Aborted, "replaced by a newer heartbeat stream")
+
+// Heartbeat 双向流：Agent 按 Server 下发的间隔发心跳，Server 只在有消息时才回复，
+// 任务、取消、drain 和配置变化可以随时推送，不必等下一次心跳
+func (s *SentinelServer) Heartbeat(stream pb.SentinelService_HeartbeatServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		slog.WarnContext(stream.Context(), "接收首条心跳失败", "err", err)
+		return err
+	}
+	ctx := logging.With(stream.Context(), "agent_id", req.AgentId)
+
+	sess := newAgentSession(stream.Context(), req.AgentId)
+	if old, replaced := s.sessions.Swap(sess.agentID, sess); replaced {
+		// 旧连接可能是半开的，不能等它自己断开：先停掉它的主循环，任务只从新连接下发
+		old.(*agentSession).cancel()
+		slog.InfoContext(ctx, "节点重新建立心跳流，旧连接将被丢弃")
+	}
+	s.sessionCount.Add(1)
+	// 没确认的任务还是 Assigned，留在队列里，下一个会话会重新下发
+	defer func() {
+		sess.cancel()
+		s.sessionCount.Add(-1)
+		s.sessions.CompareAndDelete(sess.agentID, sess)
+	}()
+
+	reqs := make(chan *pb.HeartbeatReq)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-sess.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.onHeartbeat(sess, req)
+	for {
+		if sess.ctx.Err() != nil {
+			return errSessionReplaced
+		}
+		if err := s.flush(stream, sess); err != nil {
+			return err
+		}
+		select {
+		case <-sess.ctx.Done():
+			return errSessionReplaced
+		case req := <-reqs:
+			s.onHeartbeat(sess, req)
+		case <-sess.kick:
+			if sess.reload.Swap(false) {
+				s.reloadSession(sess)
+			}
+		case err := <-errc:
+			slog.InfoContext(ctx, "心跳流已断开", "err", err)
+			return err
+		}
+	}
+}
+
+// onHeartbeat 处理一条心跳：处理任务确认，刷新节点状态
+func (s *SentinelServer) onHeartbeat(sess *agentSession, req *pb.HeartbeatReq) {
+	if req.Seq == 0 {
+		sess.legacy = true
+	}
+	sess.lastHeartbeat = req.Seq
+	sess.ping = sess.ping || req.Ping
+	for _, acc := range req.Accepted {
+		delete(sess.inflight, acc.JobId)
+		if acc.Rejected {
+			s.returnJob(sess.agentID, acc.JobId)
+			continue
+		}
+		s.acceptJob(sess.agentID, acc.JobId)
+		if acc.Duplicate {
+			slog.Info("Agent 重复收到任务 (之前的确认丢失)，未重复执行", "agent_id", sess.agentID, "job_id", acc.JobId)
+		}
+	}
+
+	if drain, profile, ok := s.recordHeartbeat(req); ok {
+		sess.drain, sess.profile = drain, profile
+	}
+	sess.running, sess.max = req.RunningJobs, req.MaxJobs
+	sess.configVersion = req.ConfigVersion
+}
+
+// reloadSession 运维修改了 drain 或配置档，重新读取节点状态
+func (s *SentinelServer) reloadSession(sess *agentSession) {
+	agent, profile, err := s.loadAgentState(sess.agentID)
+	if err != nil {
+		slog.Error("查询节点失败", "agent_id", sess.agentID, "err", err)
+		return
+	}
+	sess.drain, sess.profile = agent.Drain, profile
+}
+
+// flush 把需要告诉 Agent 的内容合并成一条消息发出去，没有变化就不发
+func (s *SentinelServer) flush(stream pb.SentinelService_HeartbeatServer, sess *agentSession) error {
+	resp := &pb.HeartbeatResp{Drain: sess.drain, Ack: sess.lastHeartbeat}
+	send := !sess.replied || sess.drain != sess.sentDrain || sess.ping
+	sess.ping = false
+
+	interval := s.HeartbeatPolicy.interval(s.sessionCount.Load(), sess.profile)
+	if interval != sess.sentInterval {
+		resp.IntervalMs = int32(interval / time.Millisecond)
+		resp.JitterMs = int32(s.HeartbeatPolicy.jitter(interval) / time.Millisecond)
+		send = true
+	}
+
+	if sess.profile.Version() != sess.configVersion {
+		resp.ConfigOutdated = true
+		// Agent 拉取配置失败的话，隔几个心跳周期再提醒一次
+		if time.Since(sess.outdatedSentAt) > 3*interval {
+			send = true
+		}
+	}
+
+	resp.CancelJobIds = sess.takeCancels()
+	if len(resp.CancelJobIds) > 0 {
+		sess.seq++
+		resp.Seq = sess.seq
+		send = true
+	}
+
+	// 槽位用满或处于维护模式时，任务留在队列里，等 Agent 可用再派发
+	var jobs []JobRecord
+	if free := sess.freeSlots(); !sess.drain && free > 0 {
+		var err error
+		if jobs, err = s.nextAssigned(sess.agentID, sess.inflight, free); err != nil {
+			slog.Error("查询节点的下发队列失败", "agent_id", sess.agentID, "err", err)
+		}
+	}
+
+	if !send && len(jobs) == 0 {
+		return nil
+	}
+	if err := s.send(stream, sess, resp, jobs); err != nil {
+		return err // 没确认的任务还是 Assigned，重连后重新下发
+	}
+
+	sess.replied = true
+	sess.sentDrain = sess.drain
+	sess.sentInterval = interval
+	if resp.ConfigOutdated {
+		sess.outdatedSentAt = time.Now()
+	}
+	return nil
+}
+
+// send 发出 resp，任务逐个附在消息上：第一个任务跟 resp 一起发，其余每个任务单独一条消息
+func (s *SentinelServer) send(stream pb.SentinelService_HeartbeatServer, sess *agentSession, resp *pb.HeartbeatResp, jobs []JobRecord) error {
+	for i, record := range jobs {
+		if sess.ctx.Err() != nil {
+			return errSessionReplaced // 会话已被替换，剩下的任务由新会话下发
+		}
+		msg := resp
+		if i > 0 {
+			// Agent 每收到一条消息都会按 drain 字段切换状态，所以每条都要带上
+			msg = &pb.HeartbeatResp{Drain: sess.drain, Ack: sess.lastHeartbeat}
+		}
+		if msg.Seq == 0 {
+			sess.seq++
+			msg.Seq = sess.seq
+		}
+		msg.Job = toProtoJob(record)
+		ctx, span := tracing.Tracer().Start(tracing.WithTraceParent(context.Background(), record.TraceParent), "job.dispatch",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(jobSpanAttrs(record)...),
+			trace.WithAttributes(attribute.Int("job.attempt", int(msg.Job.Attempt))))
+		msg.Job.Traceparent = tracing.TraceParent(ctx)
+
+		err := stream.Send(msg)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		if err != nil {
+			return err
+		}
+		s.markDelivered(record.JobID)
+		if sess.legacy {
+			// 旧版 Agent 不会确认，发出去就算送达；下一次心跳前先按占用一个槽位计
+			s.acceptJob(sess.agentID, record.JobID)
+			sess.running++
+		} else {
+			sess.inflight[record.JobID] = msg.Seq
+		}
+		slog.InfoContext(jobLogContext(ctx, record), "任务已下发", "agent_id", sess.agentID, "attempt", msg.Job.Attempt, "payload", record.Payload)
+		s.Events.Publish(jobLogContext(ctx, record), EventJobDispatched, "job:"+record.JobID, jobDispatchedEvent{
+			JobID:   record.JobID,
+			AgentID: sess.agentID,
+			Attempt: msg.Job.Attempt,
+		})
+	}
+	if len(jobs) == 0 {
+		return stream.Send(resp)
+	}
+	return nil
+}
+
+// freeSlots 节点还能接收多少任务：并发上限减去已占用的槽位和还在路上的任务
+// 旧版 Agent 不上报上限，一次只下发一个
+func (sess *agentSession) freeSlots() int {
+	if sess.max <= 0 {
+		if len(sess.inflight) > 0 {
+			return 0
+		}
+		return 1
+	}
+	return int(sess.max-sess.running) - len(sess.inflight)
+}
+
+// Kick 唤醒节点的心跳会话，重新读取 drain/配置档并尝试派发队列里的任务；节点不在线时什么也不做
+func (s *SentinelServer) Kick(agentID string) {
+	if v, ok := s.sessions.Load(agentID); ok {
+		v.(*agentSession).wake(true)
+	}
+}
+
+// KickAll 配置档变更会影响所有节点
+func (s *SentinelServer) KickAll() {
+	s.sessions.Range(func(_, v any) bool {
+		v.(*agentSession).wake(true)
+		return true
+	})
+}
+
+// CancelJob 把取消指令推给节点，节点不在线时返回 false
+func (s *SentinelServer) CancelJob(agentID, jobID string) bool {
+	v, ok := s.sessions.Load(agentID)
+	if !ok {
+		return false
+	}
+	sess := v.(*agentSession)
+	sess.mu.Lock()
+	sess.cancels = append(sess.cancels, jobID)
+	sess.mu.Unlock()
+	sess.wake(false)
+	return true
+}
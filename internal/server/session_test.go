@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/stywzn/Go-Cloud-Compute/api/proto"
+)
+
+// fakeHeartbeatStream 测试用的心跳流，reqs 模拟 Agent 发来的心跳，sent 收集 Server 发出的消息
+type fakeHeartbeatStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	cancel context.CancelFunc
+	reqs   chan *pb.HeartbeatReq
+	sent   chan *pb.HeartbeatResp
+}
+
+func newFakeHeartbeatStream() *fakeHeartbeatStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &fakeHeartbeatStream{
+		ctx:    ctx,
+		cancel: cancel,
+		reqs:   make(chan *pb.HeartbeatReq, 8),
+		sent:   make(chan *pb.HeartbeatResp, 64),
+	}
+}
+
+func (f *fakeHeartbeatStream) Context() context.Context { return f.ctx }
+
+func (f *fakeHeartbeatStream) Send(resp *pb.HeartbeatResp) error {
+	f.sent <- resp
+	return nil
+}
+
+func (f *fakeHeartbeatStream) Recv() (*pb.HeartbeatReq, error) {
+	select {
+	case req := <-f.reqs:
+		return req, nil
+	case <-f.ctx.Done():
+		return nil, io.EOF
+	}
+}
+
+// connect 建立一条心跳流，等收到 Server 的首条回复后返回；done 在 Heartbeat 返回时收到它的错误
+func connect(t *testing.T, s *SentinelServer, agentID string) (*fakeHeartbeatStream, chan error) {
+	t.Helper()
+	st := newFakeHeartbeatStream()
+	t.Cleanup(st.cancel)
+	st.reqs <- &pb.HeartbeatReq{AgentId: agentID, Seq: 1, MaxJobs: 4}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Heartbeat(st)
+		st.cancel() // gRPC 在处理函数返回后取消流的 context
+	}()
+	select {
+	case <-st.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to the first heartbeat")
+	}
+	return st, done
+}
+
+func TestReconnectReplacesSession(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormStore(db)
+	s := &SentinelServer{Store: store}
+	ctx := context.Background()
+	if err := store.CreateAgent(ctx, &AgentModel{AgentID: "n1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 同一个节点连续重连两次，前两条流都要被结束
+	var streams []*fakeHeartbeatStream
+	var dones []chan error
+	for range 3 {
+		st, done := connect(t, s, "n1")
+		streams = append(streams, st)
+		dones = append(dones, done)
+	}
+	for i, done := range dones[:2] {
+		select {
+		case err := <-done:
+			if !errors.Is(err, errSessionReplaced) {
+				t.Errorf("stream %d ended with %v, want errSessionReplaced", i, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("stream %d still running after being replaced", i)
+		}
+	}
+	if n := s.sessionCount.Load(); n != 1 {
+		t.Errorf("sessionCount = %d, want 1", n)
+	}
+
+	for i := range 3 {
+		if err := store.CreateJob(ctx, &JobRecord{JobID: fmt.Sprintf("j%d", i), AgentID: "n1", Status: JobStatusAssigned}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Kick("n1")
+
+	got := map[string]bool{}
+	for len(got) < 3 {
+		select {
+		case resp := <-streams[2].sent:
+			if resp.Job != nil {
+				got[resp.Job.JobId] = true
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("newest stream received %v, want 3 jobs", got)
+		}
+	}
+	for i, st := range streams[:2] {
+		select {
+		case resp := <-st.sent:
+			t.Errorf("replaced stream %d received %v", i, resp)
+		default:
+		}
+	}
+
+	streams[2].cancel()
+	if err := <-dones[2]; err == nil {
+		t.Error("newest stream ended without error")
+	}
+	if _, ok := s.sessions.Load("n1"); ok {
+		t.Error("session still registered after the stream ended")
+	}
+}
+
+func TestHeartbeatPolicyInterval(t *testing.T) {
+	for name, c := range map[string]struct {
+		policy  HeartbeatPolicy
+		agents  int64
+		profile *AgentProfile
+		want    time.Duration
+	}{
+		"default":           {HeartbeatPolicy{}, 10, nil, 5 * time.Second},
+		"configured":        {HeartbeatPolicy{Interval: 2 * time.Second}, 10, nil, 2 * time.Second},
+		"few agents":        {HeartbeatPolicy{Interval: 2 * time.Second, TargetRate: 100}, 50, nil, 2 * time.Second},
+		"many agents":       {HeartbeatPolicy{Interval: 2 * time.Second, TargetRate: 100}, 1000, nil, 10 * time.Second},
+		"rounded to second": {HeartbeatPolicy{Interval: time.Second, TargetRate: 100}, 349, nil, 3 * time.Second},
+		"capped":            {HeartbeatPolicy{Interval: 2 * time.Second, TargetRate: 10, Max: 20 * time.Second}, 1000, nil, 20 * time.Second},
+		"profile wins":      {HeartbeatPolicy{Interval: 2 * time.Second, TargetRate: 100}, 1000, &AgentProfile{HeartbeatInterval: 7}, 7 * time.Second},
+		"profile capped":    {HeartbeatPolicy{Max: 20 * time.Second}, 0, &AgentProfile{HeartbeatInterval: 60}, 20 * time.Second},
+	} {
+		if got := c.policy.interval(c.agents, c.profile); got != c.want {
+			t.Errorf("%s: interval = %s, want %s", name, got, c.want)
+		}
+	}
+
+	if got := (HeartbeatPolicy{}).jitter(5 * time.Second); got != time.Second {
+		t.Errorf("default jitter = %s, want 1s", got)
+	}
+	if got := (HeartbeatPolicy{Jitter: time.Minute}).jitter(5 * time.Second); got != 5*time.Second {
+		t.Errorf("jitter larger than interval = %s, want 5s", got)
+	}
+}
+
+// Server 只在有内容时回复：首条心跳下发间隔，之后普通心跳不回复，ping 立即回复并确认 seq
+func TestHeartbeatRepliesOnlyWhenNeeded(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	s := &SentinelServer{Store: store, HeartbeatPolicy: HeartbeatPolicy{Interval: 2 * time.Second}}
+	if err := store.CreateAgent(context.Background(), &AgentModel{AgentID: "n1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	st := newFakeHeartbeatStream()
+	t.Cleanup(st.cancel)
+	st.reqs <- &pb.HeartbeatReq{AgentId: "n1", Seq: 1, MaxJobs: 4}
+	go s.Heartbeat(st)
+
+	recv := func() *pb.HeartbeatResp {
+		t.Helper()
+		select {
+		case resp := <-st.sent:
+			return resp
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reply")
+			return nil
+		}
+	}
+	first := recv()
+	if first.IntervalMs != 2000 || first.JitterMs != 400 || first.Ack != 1 {
+		t.Fatalf("first reply = %v, want interval 2000ms, jitter 400ms, ack 1", first)
+	}
+
+	st.reqs <- &pb.HeartbeatReq{AgentId: "n1", Seq: 2, MaxJobs: 4}
+	select {
+	case resp := <-st.sent:
+		t.Fatalf("plain heartbeat got a reply: %v", resp)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	st.reqs <- &pb.HeartbeatReq{AgentId: "n1", Seq: 3, MaxJobs: 4, Ping: true}
+	if resp := recv(); resp.Ack != 3 || resp.IntervalMs != 0 {
+		t.Errorf("ping reply = %v, want ack 3 without interval", resp)
+	}
+}
@@ -0,0 +1,778 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound 要查询的记录不存在
+var ErrNotFound = errors.New("record not found")
+
+// Store 业务数据的读写：节点、任务、批次、产物、文件、秘密、配置档、Webhook 和审计日志
+// 处理函数和后台协程通过它访问数据，不直接拼 SQL；GormStore 是基于 GORM 的实现，
+// MySQL 和 SQLite 共用 (见 pkg/db.Open)。
+// 只有两个模块自己持有 *gorm.DB、不经过 Store：发件箱 (OutboxRelay，写入要和任务在同一个事务里，
+// 见 enqueueJobs) 和事件总线 (EventBus，MySQL 上要在同一个连接里加锁写入)，它们的表也只由自己读写
+type Store interface {
+	// GetAgent 按 ID 查询节点，查不到时返回 ErrNotFound；withDeleted 为 true 时包括已下线的节点
+	GetAgent(ctx context.Context, agentID string, withDeleted bool) (AgentModel, error)
+	ListAgents(ctx context.Context, q AgentQuery) ([]AgentModel, error)
+	CreateAgent(ctx context.Context, agent *AgentModel) error
+	// SaveAgent 保存整条节点记录，已下线的节点 DeletedAt 清空后保存即恢复
+	SaveAgent(ctx context.Context, agent *AgentModel) error
+	UpdateAgent(ctx context.Context, id uint, updates map[string]interface{}) error
+	// DecommissionAgent 下线节点，并取消它下发队列里还没下发的任务，返回被取消的任务
+	DecommissionAgent(ctx context.Context, agent AgentModel, reason string) ([]JobRecord, error)
+	// MarkAgentLost 节点在 cutoff 之后仍然没有心跳、且还没标记过时记录失联时间，返回是否由这次调用标记
+	MarkAgentLost(ctx context.Context, id uint, cutoff, at time.Time) (bool, error)
+
+	// GetJob 按任务 ID 查询，查不到时返回 ErrNotFound
+	GetJob(ctx context.Context, jobID string) (JobRecord, error)
+	ListJobs(ctx context.Context, q JobQuery) ([]JobRecord, error)
+	// CreateJob 创建任务；Queued 的任务在同一个事务里写入发件箱
+	CreateJob(ctx context.Context, job *JobRecord) error
+	// CreateBatch 创建批次和所有子任务，Queued 的子任务在同一个事务里写入发件箱
+	CreateBatch(ctx context.Context, batch *BatchRecord, jobs []JobRecord) error
+	// UpdateJob 条件更新，返回是否有任务被更新 (条件不满足时为 false)
+	UpdateJob(ctx context.Context, m JobMatch, updates map[string]interface{}) (bool, error)
+	// MarkDelivered 记录定向任务的一次下发
+	MarkDelivered(ctx context.Context, jobID string, at time.Time) error
+	// QueuedCounts 各节点待执行 (Assigned + Accepted) 的任务数
+	QueuedCounts(ctx context.Context) (map[string]int, error)
+	JobExists(ctx context.Context, jobID string) (bool, error)
+	// StatusCounts 处于这些状态的任务数
+	StatusCounts(ctx context.Context, statuses []string) (map[string]int, error)
+
+	// GetBatch 按批次 ID 查询，查不到时返回 ErrNotFound
+	GetBatch(ctx context.Context, batchID string) (BatchRecord, error)
+	// BatchCounts 批次里各状态的任务数
+	BatchCounts(ctx context.Context, batchID string) (map[string]int, error)
+	// BatchFailedTargets 批次里失败的任务的目标，按提交顺序
+	BatchFailedTargets(ctx context.Context, batchID string, limit int) ([]string, error)
+	// CompleteBatch 批次的任务全部结束、且还没记录过完成时间时记下 at，返回是否由这次调用记录
+	CompleteBatch(ctx context.Context, batchID string, at time.Time) (bool, error)
+
+	// SaveArtifact 保存产物记录，同一个任务的同名产物覆盖原记录
+	SaveArtifact(ctx context.Context, artifact *ArtifactRecord) error
+	// ListArtifacts 任务的产物，按名字排序
+	ListArtifacts(ctx context.Context, jobID string) ([]ArtifactRecord, error)
+	// GetArtifact 查不到时返回 ErrNotFound
+	GetArtifact(ctx context.Context, jobID, name string) (ArtifactRecord, error)
+
+	CreateFile(ctx context.Context, file *FileRecord) error
+	// GetFile 按文件 ID 查询上传的输入文件，查不到时返回 ErrNotFound
+	GetFile(ctx context.Context, fileID string) (FileRecord, error)
+	// GetFiles 按文件 ID 查询上传的输入文件，不存在的 ID 直接跳过
+	GetFiles(ctx context.Context, fileIDs []string) ([]FileRecord, error)
+
+	// GetSecret 查不到时返回 ErrNotFound
+	GetSecret(ctx context.Context, namespace, name string) (SecretRecord, error)
+	// ListSecrets 按 namespace、name 排序，namespace 为空时列出全部
+	ListSecrets(ctx context.Context, namespace string) ([]SecretRecord, error)
+	SecretExists(ctx context.Context, namespace, name string) (bool, error)
+	// PutSecret 创建秘密，已存在时覆盖值 (调用方已加密)
+	PutSecret(ctx context.Context, secret *SecretRecord) error
+	// DeleteSecret 返回是否有记录被删除
+	DeleteSecret(ctx context.Context, namespace, name string) (bool, error)
+
+	ListProfiles(ctx context.Context) ([]AgentProfile, error)
+	// PutProfile 在一个事务里读出配置档 (不存在时是只有名字的新记录)，交给 fn 修改后保存
+	PutProfile(ctx context.Context, name string, fn func(*AgentProfile)) (AgentProfile, error)
+	// DeleteProfile 返回是否有记录被删除
+	DeleteProfile(ctx context.Context, name string) (bool, error)
+
+	// GetWebhook 查不到时返回 ErrNotFound
+	GetWebhook(ctx context.Context, webhookID string) (WebhookSubscription, error)
+	// ListWebhooks 按创建顺序，webhookIDs 为空时列出全部
+	ListWebhooks(ctx context.Context, webhookIDs []string) ([]WebhookSubscription, error)
+	// WebhooksFor 订阅了这个事件、且没有停用的 Webhook
+	WebhooksFor(ctx context.Context, event string) ([]WebhookSubscription, error)
+	CreateWebhook(ctx context.Context, sub *WebhookSubscription) error
+	SaveWebhook(ctx context.Context, sub *WebhookSubscription) error
+	DeleteWebhook(ctx context.Context, sub WebhookSubscription) error
+	CreateDeliveries(ctx context.Context, deliveries []WebhookDelivery) error
+	// GetDelivery 查不到时返回 ErrNotFound
+	GetDelivery(ctx context.Context, webhookID, deliveryID string) (WebhookDelivery, error)
+	// ListDeliveries Webhook 的投递记录，按时间倒序，status 为空时不过滤
+	ListDeliveries(ctx context.Context, webhookID, status string, limit int) ([]WebhookDelivery, error)
+	// DueDeliveries 到了投递时间的待投递记录，按 id 升序
+	DueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, id uint, updates map[string]interface{}) error
+	// PurgeDeliveries 删除在 before 之前结束的投递记录，返回删除的条数
+	PurgeDeliveries(ctx context.Context, before time.Time) (int64, error)
+
+	// DueScheduled 到期的延时任务，按释放时间排序
+	DueScheduled(ctx context.Context, now time.Time, limit int) ([]JobRecord, error)
+	// ReleaseScheduled 把延时任务改成 Queued 并写入发件箱；已被取消或被其他实例释放时返回 false
+	ReleaseScheduled(ctx context.Context, job JobRecord) (bool, error)
+
+	// ArchivableTypes 还有没归档的终态任务输出的任务类型
+	ArchivableTypes(ctx context.Context) ([]string, error)
+	// ArchiveCandidates 超出保留范围、还没归档的任务，只带 id、job_id、type、result，按 id 升序从 afterID 之后开始
+	ArchiveCandidates(ctx context.Context, q ArchiveQuery, afterID uint, limit int) ([]JobRecord, error)
+	// MarkArchived 清空任务输出并记下它在归档文件里的位置，已经被其他实例归档的跳过，返回这次归档的任务
+	MarkArchived(ctx context.Context, file string, jobs []JobRecord, spans []archiveSpan, at time.Time) ([]JobRecord, error)
+
+	AppendAudit(ctx context.Context, record *AuditRecord) error
+	// ListAudit 按时间倒序查询审计日志，beforeID 不为 0 时从这条之前开始 (翻页)
+	ListAudit(ctx context.Context, f AuditFilter, beforeID uint64, limit int) ([]AuditRecord, error)
+	// ExportAudit 按时间正序逐批读出审计日志，fn 返回错误时中断
+	ExportAudit(ctx context.Context, f AuditFilter, fn func([]AuditRecord) error) error
+}
+
+// AgentQuery 节点列表的过滤条件，零值表示不过滤
+type AgentQuery struct {
+	Status      string    // 库里的状态：Online / Draining / Drained
+	Tag         string    // 带有这个标签
+	SeenSince   time.Time // 这个时间之后有过心跳
+	UnseenSince time.Time // 这个时间之后没有心跳 (包括从来没有心跳的)
+	NoDrain     bool      // 排除维护中的节点
+	NotLost     bool      // 排除已经标记失联的节点 (见 AgentWatcher)
+	Limit       int
+}
+
+// JobQuery 任务列表的过滤条件，零值表示不过滤
+type JobQuery struct {
+	AgentID         string
+	Statuses        []string
+	ExcludeStatuses []string
+	ExcludeJobIDs   []string
+	Order           string // 如 "updated_at DESC"，为空时按 id
+	Limit           int
+}
+
+// JobMatch 条件更新的匹配条件，ID 和 JobID 至少指定一个
+type JobMatch struct {
+	ID       uint
+	JobID    string
+	AgentID  string
+	Statuses []string // 任务当前处于其中一个状态才更新
+}
+
+// ArchiveQuery 一种任务类型的归档范围，见 config.RetentionRule
+type ArchiveQuery struct {
+	Type     string
+	Before   time.Time // 在这个时间之前结束的才归档，零值表示不按时间
+	KeepLast int       // 最新的这么多个任务 (包括已经归档的) 不归档，0 表示不按个数
+}
+
+// AuditFilter 审计日志的过滤条件
+// Actor / Action / Target / Outcome 精确匹配，以 * 结尾时按前缀匹配 (如 job.*)
+type AuditFilter struct {
+	Actor   string
+	Action  string
+	Target  string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+}
+
+// GormStore 基于 GORM 的 Store
+type GormStore struct {
+	DB *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{DB: db}
+}
+
+// notFound 把 GORM 的 ErrRecordNotFound 换成 ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *GormStore) GetAgent(ctx context.Context, agentID string, withDeleted bool) (AgentModel, error) {
+	db := s.DB.WithContext(ctx)
+	if withDeleted {
+		db = db.Unscoped()
+	}
+	var agent AgentModel
+	err := db.Where("agent_id = ?", agentID).First(&agent).Error
+	return agent, notFound(err)
+}
+
+func (s *GormStore) ListAgents(ctx context.Context, q AgentQuery) ([]AgentModel, error) {
+	db := s.DB.WithContext(ctx).Model(&AgentModel{})
+	if q.Status != "" {
+		db = db.Where("status = ?", q.Status)
+	}
+	if q.Tag != "" {
+		db = db.Where("tags LIKE ? ESCAPE '!'", "%,"+escapeLike(q.Tag)+",%")
+	}
+	if !q.SeenSince.IsZero() {
+		db = db.Where("last_seen_at >= ?", q.SeenSince)
+	}
+	if !q.UnseenSince.IsZero() {
+		db = db.Where("(last_seen_at IS NULL OR last_seen_at < ?)", q.UnseenSince)
+	}
+	if q.NoDrain {
+		db = db.Where("drain = ?", false)
+	}
+	if q.NotLost {
+		db = db.Where("lost_at IS NULL")
+	}
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+	var agents []AgentModel
+	err := db.Order("agent_id").Find(&agents).Error
+	return agents, err
+}
+
+func (s *GormStore) CreateAgent(ctx context.Context, agent *AgentModel) error {
+	return s.DB.WithContext(ctx).Create(agent).Error
+}
+
+func (s *GormStore) SaveAgent(ctx context.Context, agent *AgentModel) error {
+	return s.DB.WithContext(ctx).Unscoped().Save(agent).Error
+}
+
+func (s *GormStore) UpdateAgent(ctx context.Context, id uint, updates map[string]interface{}) error {
+	return s.DB.WithContext(ctx).Model(&AgentModel{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (s *GormStore) DecommissionAgent(ctx context.Context, agent AgentModel, reason string) ([]JobRecord, error) {
+	db := s.DB.WithContext(ctx)
+	if err := db.Delete(&agent).Error; err != nil {
+		return nil, err
+	}
+	var orphaned []JobRecord
+	if err := db.Where("agent_id = ? AND status = ?", agent.AgentID, JobStatusAssigned).Find(&orphaned).Error; err != nil {
+		return nil, err
+	}
+	var cancelled []JobRecord
+	for _, job := range orphaned {
+		// 条件更新：和节点确认、取消接口并发时只有一方生效
+		res := db.Model(&JobRecord{}).
+			Where("id = ? AND status = ?", job.ID, JobStatusAssigned).
+			Updates(map[string]interface{}{
+				"status": JobStatusCancelled,
+				"result": reason,
+			})
+		if res.Error != nil {
+			return cancelled, res.Error
+		}
+		if res.RowsAffected > 0 {
+			job.Status, job.Result = JobStatusCancelled, reason
+			cancelled = append(cancelled, job)
+		}
+	}
+	return cancelled, nil
+}
+
+func (s *GormStore) MarkAgentLost(ctx context.Context, id uint, cutoff, at time.Time) (bool, error) {
+	res := s.DB.WithContext(ctx).Model(&AgentModel{}).
+		Where("id = ? AND lost_at IS NULL AND last_seen_at < ?", id, cutoff).
+		Update("lost_at", at)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (s *GormStore) GetJob(ctx context.Context, jobID string) (JobRecord, error) {
+	var job JobRecord
+	err := s.DB.WithContext(ctx).Where("job_id = ?", jobID).First(&job).Error
+	return job, notFound(err)
+}
+
+func (s *GormStore) ListJobs(ctx context.Context, q JobQuery) ([]JobRecord, error) {
+	db := s.DB.WithContext(ctx).Model(&JobRecord{})
+	if q.AgentID != "" {
+		db = db.Where("agent_id = ?", q.AgentID)
+	}
+	if len(q.Statuses) > 0 {
+		db = db.Where("status IN ?", q.Statuses)
+	}
+	if len(q.ExcludeStatuses) > 0 {
+		db = db.Where("status NOT IN ?", q.ExcludeStatuses)
+	}
+	if len(q.ExcludeJobIDs) > 0 {
+		db = db.Where("job_id NOT IN ?", q.ExcludeJobIDs)
+	}
+	order := q.Order
+	if order == "" {
+		order = "id"
+	}
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+	var jobs []JobRecord
+	err := db.Order(order).Find(&jobs).Error
+	return jobs, err
+}
+
+func (s *GormStore) CreateJob(ctx context.Context, job *JobRecord) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		if job.Status != JobStatusQueued {
+			return nil // 延时任务交给 DelayScheduler 到点释放，定向任务经心跳流下发
+		}
+		return enqueueJobs(tx, []JobRecord{*job})
+	})
+}
+
+func (s *GormStore) CreateBatch(ctx context.Context, batch *BatchRecord, jobs []JobRecord) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(batch).Error; err != nil {
+			return err
+		}
+		if err := tx.CreateInBatches(jobs, 500).Error; err != nil {
+			return err
+		}
+		var queued []JobRecord
+		for _, job := range jobs {
+			if job.Status == JobStatusQueued {
+				queued = append(queued, job)
+			}
+		}
+		if len(queued) == 0 {
+			return nil
+		}
+		return enqueueJobs(tx, queued)
+	})
+}
+
+func (s *GormStore) UpdateJob(ctx context.Context, m JobMatch, updates map[string]interface{}) (bool, error) {
+	if m.ID == 0 && m.JobID == "" {
+		return false, errors.New("job match needs an id or a job id")
+	}
+	db := s.DB.WithContext(ctx).Model(&JobRecord{})
+	if m.ID != 0 {
+		db = db.Where("id = ?", m.ID)
+	}
+	if m.JobID != "" {
+		db = db.Where("job_id = ?", m.JobID)
+	}
+	if m.AgentID != "" {
+		db = db.Where("agent_id = ?", m.AgentID)
+	}
+	if len(m.Statuses) > 0 {
+		db = db.Where("status IN ?", m.Statuses)
+	}
+	res := db.Updates(updates)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (s *GormStore) MarkDelivered(ctx context.Context, jobID string, at time.Time) error {
+	return s.DB.WithContext(ctx).Model(&JobRecord{}).
+		Where("job_id = ? AND status = ?", jobID, JobStatusAssigned).
+		Updates(map[string]interface{}{
+			"delivered_at":      at,
+			"delivery_attempts": gorm.Expr("delivery_attempts + 1"),
+		}).Error
+}
+
+func (s *GormStore) QueuedCounts(ctx context.Context) (map[string]int, error) {
+	var rows []struct {
+		AgentID string
+		N       int
+	}
+	err := s.DB.WithContext(ctx).Model(&JobRecord{}).
+		Select("agent_id, COUNT(*) AS n").
+		Where("status IN ?", []string{JobStatusAssigned, JobStatusAccepted}).
+		Group("agent_id").
+		Scan(&rows).Error
+	counts := make(map[string]int, len(rows))
+	for _, r := range rows {
+		counts[r.AgentID] = r.N
+	}
+	return counts, err
+}
+
+func (s *GormStore) JobExists(ctx context.Context, jobID string) (bool, error) {
+	var count int64
+	err := s.DB.WithContext(ctx).Model(&JobRecord{}).Where("job_id = ?", jobID).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *GormStore) StatusCounts(ctx context.Context, statuses []string) (map[string]int, error) {
+	return s.countByStatus(s.DB.WithContext(ctx).Where("status IN ?", statuses))
+}
+
+// countByStatus 按状态统计 db 条件下的任务数
+func (s *GormStore) countByStatus(db *gorm.DB) (map[string]int, error) {
+	var rows []struct {
+		Status string
+		N      int
+	}
+	err := db.Model(&JobRecord{}).
+		Select("status, COUNT(*) AS n").
+		Group("status").
+		Scan(&rows).Error
+	counts := make(map[string]int, len(rows))
+	for _, r := range rows {
+		counts[r.Status] = r.N
+	}
+	return counts, err
+}
+
+func (s *GormStore) GetBatch(ctx context.Context, batchID string) (BatchRecord, error) {
+	var batch BatchRecord
+	err := s.DB.WithContext(ctx).Where("batch_id = ?", batchID).First(&batch).Error
+	return batch, notFound(err)
+}
+
+func (s *GormStore) BatchCounts(ctx context.Context, batchID string) (map[string]int, error) {
+	return s.countByStatus(s.DB.WithContext(ctx).Where("batch_id = ?", batchID))
+}
+
+func (s *GormStore) BatchFailedTargets(ctx context.Context, batchID string, limit int) ([]string, error) {
+	var targets []string
+	err := s.DB.WithContext(ctx).Model(&JobRecord{}).
+		Where("batch_id = ? AND status = ?", batchID, JobStatusFailed).
+		Order("id").
+		Limit(limit).
+		Pluck("target", &targets).Error
+	return targets, err
+}
+
+func (s *GormStore) CompleteBatch(ctx context.Context, batchID string, at time.Time) (bool, error) {
+	db := s.DB.WithContext(ctx)
+	var pending int64
+	err := db.Model(&JobRecord{}).
+		Where("batch_id = ? AND status NOT IN ?", batchID, terminalStatuses).
+		Count(&pending).Error
+	if err != nil || pending > 0 {
+		return false, err
+	}
+	// completed_at IS NULL 做条件更新，并发汇报时只有一个能记下
+	res := db.Model(&BatchRecord{}).
+		Where("batch_id = ? AND completed_at IS NULL", batchID).
+		Update("completed_at", at)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (s *GormStore) GetFiles(ctx context.Context, fileIDs []string) ([]FileRecord, error) {
+	var records []FileRecord
+	err := s.DB.WithContext(ctx).Where("file_id IN ?", fileIDs).Find(&records).Error
+	return records, err
+}
+
+func (s *GormStore) SecretExists(ctx context.Context, namespace, name string) (bool, error) {
+	var count int64
+	err := s.DB.WithContext(ctx).Model(&SecretRecord{}).
+		Where("namespace = ? AND name = ?", namespace, name).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *GormStore) DueScheduled(ctx context.Context, now time.Time, limit int) ([]JobRecord, error) {
+	var jobs []JobRecord
+	err := s.DB.WithContext(ctx).
+		Where("status = ? AND run_at <= ?", JobStatusScheduled, now).
+		Order("run_at").
+		Limit(limit).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+func (s *GormStore) ReleaseScheduled(ctx context.Context, job JobRecord) (bool, error) {
+	// 状态流转和发件箱消息在同一个事务里，要么都成功要么都回滚
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 条件更新相当于抢锁：多个 Server 实例同时扫描时，只有一个能把任务改成 Queued
+		res := tx.Model(&JobRecord{}).
+			Where("id = ? AND status = ?", job.ID, JobStatusScheduled).
+			Update("status", JobStatusQueued)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errSkipped
+		}
+		return enqueueJobs(tx, []JobRecord{job})
+	})
+	if errors.Is(err, errSkipped) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// errSkipped 用于提前结束事务，不是真正的错误
+var errSkipped = errors.New("skipped")
+
+func (s *GormStore) ArchivableTypes(ctx context.Context) ([]string, error) {
+	var types []string
+	err := s.DB.WithContext(ctx).Model(&JobRecord{}).
+		Where("archived_at IS NULL AND result <> '' AND status IN ?", terminalStatuses).
+		Distinct("type").
+		Pluck("type", &types).Error
+	return types, err
+}
+
+func (s *GormStore) ArchiveCandidates(ctx context.Context, q ArchiveQuery, afterID uint, limit int) ([]JobRecord, error) {
+	finished := func() *gorm.DB {
+		return s.DB.WithContext(ctx).Model(&JobRecord{}).Where("type = ? AND status IN ?", q.Type, terminalStatuses)
+	}
+	db := finished().Where("archived_at IS NULL AND result <> '' AND id > ?", afterID)
+	if !q.Before.IsZero() {
+		db = db.Where("COALESCE(executed_at, updated_at) < ?", q.Before)
+	}
+	if q.KeepLast > 0 {
+		// 第 keep_last 新的任务之前的才归档
+		var ids []uint
+		err := finished().Order("id DESC").Offset(q.KeepLast-1).Limit(1).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return nil, err // 还不到 keep_last 个
+		}
+		db = db.Where("id < ?", ids[0])
+	}
+	var jobs []JobRecord
+	err := db.Select("id", "job_id", "type", "result").Order("id").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+func (s *GormStore) MarkArchived(ctx context.Context, file string, jobs []JobRecord, spans []archiveSpan, at time.Time) ([]JobRecord, error) {
+	var done []JobRecord
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		done = done[:0]
+		for i, job := range jobs {
+			// 条件更新：多个实例同时归档时，先提交的生效
+			res := tx.Model(&JobRecord{}).
+				Where("id = ? AND archived_at IS NULL", job.ID).
+				Updates(map[string]interface{}{
+					"result":         "",
+					"archived_at":    at,
+					"archive_file":   file,
+					"archive_offset": spans[i].offset,
+					"archive_size":   spans[i].size,
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				done = append(done, job)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+func (s *GormStore) AppendAudit(ctx context.Context, record *AuditRecord) error {
+	return s.DB.WithContext(ctx).Create(record).Error
+}
+
+func (s *GormStore) ListAudit(ctx context.Context, f AuditFilter, beforeID uint64, limit int) ([]AuditRecord, error) {
+	db := s.auditQuery(ctx, f)
+	if beforeID != 0 {
+		db = db.Where("id < ?", beforeID)
+	}
+	var records []AuditRecord
+	err := db.Order("id DESC").Limit(limit).Find(&records).Error
+	return records, err
+}
+
+func (s *GormStore) ExportAudit(ctx context.Context, f AuditFilter, fn func([]AuditRecord) error) error {
+	var records []AuditRecord
+	return s.auditQuery(ctx, f).Order("id").FindInBatches(&records, 500, func(tx *gorm.DB, batch int) error {
+		return fn(records)
+	}).Error
+}
+
+func (s *GormStore) auditQuery(ctx context.Context, f AuditFilter) *gorm.DB {
+	db := s.DB.WithContext(ctx).Model(&AuditRecord{})
+	for _, c := range []struct {
+		col string
+		v   string
+	}{
+		{"actor", f.Actor},
+		{"action", f.Action},
+		{"target", f.Target},
+		{"outcome", f.Outcome},
+	} {
+		if c.v == "" {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(c.v, "*"); ok {
+			db = db.Where(c.col+" LIKE ? ESCAPE '!'", escapeLike(prefix)+"%")
+		} else {
+			db = db.Where(c.col+" = ?", c.v)
+		}
+	}
+	if !f.Since.IsZero() {
+		db = db.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		db = db.Where("created_at < ?", f.Until)
+	}
+	return db
+}
+
+func (s *GormStore) SaveArtifact(ctx context.Context, artifact *ArtifactRecord) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing ArtifactRecord
+		err := tx.Select("id", "created_at").Where("job_id = ? AND name = ?", artifact.JobID, artifact.Name).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		artifact.ID, artifact.CreatedAt = existing.ID, existing.CreatedAt
+		return tx.Save(artifact).Error
+	})
+}
+
+func (s *GormStore) ListArtifacts(ctx context.Context, jobID string) ([]ArtifactRecord, error) {
+	var artifacts []ArtifactRecord
+	err := s.DB.WithContext(ctx).Where("job_id = ?", jobID).Order("name").Find(&artifacts).Error
+	return artifacts, err
+}
+
+func (s *GormStore) GetArtifact(ctx context.Context, jobID, name string) (ArtifactRecord, error) {
+	var artifact ArtifactRecord
+	err := s.DB.WithContext(ctx).Where("job_id = ? AND name = ?", jobID, name).First(&artifact).Error
+	return artifact, notFound(err)
+}
+
+func (s *GormStore) CreateFile(ctx context.Context, file *FileRecord) error {
+	return s.DB.WithContext(ctx).Create(file).Error
+}
+
+func (s *GormStore) GetFile(ctx context.Context, fileID string) (FileRecord, error) {
+	var file FileRecord
+	err := s.DB.WithContext(ctx).Where("file_id = ?", fileID).First(&file).Error
+	return file, notFound(err)
+}
+
+func (s *GormStore) GetSecret(ctx context.Context, namespace, name string) (SecretRecord, error) {
+	var secret SecretRecord
+	err := s.DB.WithContext(ctx).Where("namespace = ? AND name = ?", namespace, name).First(&secret).Error
+	return secret, notFound(err)
+}
+
+func (s *GormStore) ListSecrets(ctx context.Context, namespace string) ([]SecretRecord, error) {
+	db := s.DB.WithContext(ctx).Order("namespace, name")
+	if namespace != "" {
+		db = db.Where("namespace = ?", namespace)
+	}
+	var secrets []SecretRecord
+	err := db.Find(&secrets).Error
+	return secrets, err
+}
+
+func (s *GormStore) PutSecret(ctx context.Context, secret *SecretRecord) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing SecretRecord
+		err := tx.Select("id", "created_at").Where("namespace = ? AND name = ?", secret.Namespace, secret.Name).First(&existing).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		secret.ID, secret.CreatedAt = existing.ID, existing.CreatedAt
+		return tx.Save(secret).Error
+	})
+}
+
+func (s *GormStore) DeleteSecret(ctx context.Context, namespace, name string) (bool, error) {
+	res := s.DB.WithContext(ctx).Where("namespace = ? AND name = ?", namespace, name).Delete(&SecretRecord{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (s *GormStore) ListProfiles(ctx context.Context) ([]AgentProfile, error) {
+	var profiles []AgentProfile
+	err := s.DB.WithContext(ctx).Find(&profiles).Error
+	return profiles, err
+}
+
+func (s *GormStore) PutProfile(ctx context.Context, name string, fn func(*AgentProfile)) (AgentProfile, error) {
+	profile := AgentProfile{Name: name}
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("name = ?", name).First(&profile).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		fn(&profile)
+		return tx.Save(&profile).Error
+	})
+	return profile, err
+}
+
+func (s *GormStore) DeleteProfile(ctx context.Context, name string) (bool, error) {
+	res := s.DB.WithContext(ctx).Where("name = ?", name).Delete(&AgentProfile{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (s *GormStore) GetWebhook(ctx context.Context, webhookID string) (WebhookSubscription, error) {
+	var sub WebhookSubscription
+	err := s.DB.WithContext(ctx).Where("webhook_id = ?", webhookID).First(&sub).Error
+	return sub, notFound(err)
+}
+
+func (s *GormStore) ListWebhooks(ctx context.Context, webhookIDs []string) ([]WebhookSubscription, error) {
+	db := s.DB.WithContext(ctx).Order("id")
+	if len(webhookIDs) > 0 {
+		db = db.Where("webhook_id IN ?", webhookIDs)
+	}
+	var subs []WebhookSubscription
+	err := db.Find(&subs).Error
+	return subs, err
+}
+
+func (s *GormStore) WebhooksFor(ctx context.Context, event string) ([]WebhookSubscription, error) {
+	var subs []WebhookSubscription
+	err := s.DB.WithContext(ctx).
+		Where("enabled = ? AND (events = '' OR events LIKE ? ESCAPE '!')", true, "%,"+escapeLike(event)+",%").
+		Order("id").
+		Find(&subs).Error
+	return subs, err
+}
+
+func (s *GormStore) CreateWebhook(ctx context.Context, sub *WebhookSubscription) error {
+	return s.DB.WithContext(ctx).Create(sub).Error
+}
+
+func (s *GormStore) SaveWebhook(ctx context.Context, sub *WebhookSubscription) error {
+	return s.DB.WithContext(ctx).Save(sub).Error
+}
+
+func (s *GormStore) DeleteWebhook(ctx context.Context, sub WebhookSubscription) error {
+	return s.DB.WithContext(ctx).Delete(&sub).Error
+}
+
+func (s *GormStore) CreateDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	return s.DB.WithContext(ctx).Create(&deliveries).Error
+}
+
+func (s *GormStore) GetDelivery(ctx context.Context, webhookID, deliveryID string) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := s.DB.WithContext(ctx).Where("webhook_id = ? AND delivery_id = ?", webhookID, deliveryID).First(&d).Error
+	return d, notFound(err)
+}
+
+func (s *GormStore) ListDeliveries(ctx context.Context, webhookID, status string, limit int) ([]WebhookDelivery, error) {
+	db := s.DB.WithContext(ctx).Where("webhook_id = ?", webhookID)
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	var deliveries []WebhookDelivery
+	err := db.Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (s *GormStore) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	var due []WebhookDelivery
+	err := s.DB.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("id").
+		Limit(limit).
+		Find(&due).Error
+	return due, err
+}
+
+func (s *GormStore) UpdateDelivery(ctx context.Context, id uint, updates map[string]interface{}) error {
+	return s.DB.WithContext(ctx).Model(&WebhookDelivery{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (s *GormStore) PurgeDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	res := s.DB.WithContext(ctx).Unscoped().
+		Where("status IN ? AND updated_at < ?", []string{DeliverySucceeded, DeliveryFailed}, before).
+		Delete(&WebhookDelivery{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+	gcdb "github.com/stywzn/Go-Cloud-Compute/pkg/db"
+)
+
+// newTestDB 内存 SQLite，表结构用正式的迁移脚本创建；每次调用都是一个新库
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gcdb.Open(config.DatabaseConfig{Driver: gcdb.DriverSQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrator, err := gcdb.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func agentIDs(agents []AgentModel) []string {
+	ids := make([]string, len(agents))
+	for i, a := range agents {
+		ids[i] = a.AgentID
+	}
+	return ids
+}
+
+func TestListAgentsTagIsLiteral(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	ctx := context.Background()
+	for id, tags := range map[string][]string{
+		"n1": {"gpu_a100"},
+		"n2": {"gpuXa100"},
+		"n3": {"100%"},
+		"n4": {"1000"},
+	} {
+		if err := store.CreateAgent(ctx, &AgentModel{AgentID: id, Tags: joinTags(tags)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for tag, want := range map[string]string{"gpu_a100": "n1", "100%": "n3"} {
+		agents, err := store.ListAgents(ctx, AgentQuery{Tag: tag})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := agentIDs(agents); len(ids) != 1 || ids[0] != want {
+			t.Errorf("tag %q matched %v, want [%s]", tag, ids, want)
+		}
+	}
+}
+
+func TestListAgentsFilters(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	ctx := context.Background()
+	now := time.Now()
+	recent, old := now.Add(-time.Minute), now.Add(-time.Hour)
+	for _, a := range []AgentModel{
+		{AgentID: "active", Status: AgentStatusOnline, LastSeenAt: &recent},
+		{AgentID: "draining", Status: AgentStatusDraining, Drain: true, LastSeenAt: &recent},
+		{AgentID: "lost", Status: AgentStatusOnline, LastSeenAt: &old, LostAt: &old},
+		{AgentID: "silent", Status: AgentStatusOnline, LastSeenAt: &old},
+		{AgentID: "unseen", Status: AgentStatusOnline},
+	} {
+		if err := store.CreateAgent(ctx, &a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cutoff := now.Add(-10 * time.Minute)
+	for name, c := range map[string]struct {
+		q    AgentQuery
+		want []string
+	}{
+		"all":          {AgentQuery{}, []string{"active", "draining", "lost", "silent", "unseen"}},
+		"status":       {AgentQuery{Status: AgentStatusDraining}, []string{"draining"}},
+		"seen since":   {AgentQuery{SeenSince: cutoff}, []string{"active", "draining"}},
+		"unseen since": {AgentQuery{UnseenSince: cutoff}, []string{"lost", "silent", "unseen"}},
+		"no drain":     {AgentQuery{SeenSince: cutoff, NoDrain: true}, []string{"active"}},
+		"not lost":     {AgentQuery{UnseenSince: cutoff, NotLost: true}, []string{"silent", "unseen"}},
+		"limit":        {AgentQuery{Limit: 2}, []string{"active", "draining"}},
+	} {
+		agents, err := store.ListAgents(ctx, c.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := agentIDs(agents); !slices.Equal(ids, c.want) {
+			t.Errorf("%s: got %v, want %v", name, ids, c.want)
+		}
+	}
+}
+
+func TestCreateBatchIsAtomic(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormStore(db)
+	ctx := context.Background()
+	if err := store.CreateJob(ctx, &JobRecord{JobID: "job-taken", Status: JobStatusSuccess}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第二个子任务和已有任务的 job_id 冲突：批次、第一个子任务和发件箱消息都不能留下
+	err := store.CreateBatch(ctx, &BatchRecord{BatchID: "batch-1", Total: 2}, []JobRecord{
+		{JobID: "job-a", BatchID: "batch-1", Status: JobStatusQueued},
+		{JobID: "job-taken", BatchID: "batch-1", Status: JobStatusQueued},
+	})
+	if err == nil {
+		t.Fatal("CreateBatch with a duplicate job id succeeded")
+	}
+	if _, err := store.GetBatch(ctx, "batch-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetBatch after failed CreateBatch: err = %v, want ErrNotFound", err)
+	}
+	if exists, _ := store.JobExists(ctx, "job-a"); exists {
+		t.Error("job-a was created by a failed CreateBatch")
+	}
+	var outbox int64
+	db.Model(&OutboxMessage{}).Count(&outbox)
+	if outbox != 0 {
+		t.Errorf("%d outbox messages after a failed CreateBatch, want 0", outbox)
+	}
+
+	// 成功时只有 Queued 的子任务写入发件箱
+	err = store.CreateBatch(ctx, &BatchRecord{BatchID: "batch-2", Total: 2}, []JobRecord{
+		{JobID: "job-b", BatchID: "batch-2", Status: JobStatusQueued},
+		{JobID: "job-c", BatchID: "batch-2", Status: JobStatusScheduled},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []OutboxMessage
+	db.Find(&msgs)
+	if len(msgs) != 1 || msgs[0].JobID != "job-b" {
+		t.Errorf("outbox = %+v, want one message for job-b", msgs)
+	}
+	counts, err := store.BatchCounts(ctx, "batch-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[JobStatusQueued] != 1 || counts[JobStatusScheduled] != 1 {
+		t.Errorf("BatchCounts = %v, want one Queued and one Scheduled", counts)
+	}
+
+	// 最后一个子任务结束时才记下完成时间，而且只记一次
+	if done, err := store.CompleteBatch(ctx, "batch-2", time.Now()); err != nil || done {
+		t.Fatalf("CompleteBatch with pending jobs = %v, %v; want false", done, err)
+	}
+	store.UpdateJob(ctx, JobMatch{JobID: "job-b"}, map[string]interface{}{"status": JobStatusSuccess})
+	store.UpdateJob(ctx, JobMatch{JobID: "job-c"}, map[string]interface{}{"status": JobStatusFailed})
+	if done, err := store.CompleteBatch(ctx, "batch-2", time.Now()); err != nil || !done {
+		t.Fatalf("CompleteBatch = %v, %v; want true", done, err)
+	}
+	if done, _ := store.CompleteBatch(ctx, "batch-2", time.Now()); done {
+		t.Error("CompleteBatch recorded the completion twice")
+	}
+}
+
+func TestDueAndReleaseScheduled(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormStore(db)
+	ctx := context.Background()
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	for _, job := range []JobRecord{
+		{JobID: "later", Status: JobStatusScheduled, RunAt: at(time.Hour)},
+		{JobID: "due-2", Status: JobStatusScheduled, RunAt: at(-time.Minute)},
+		{JobID: "due-1", Status: JobStatusScheduled, RunAt: at(-time.Hour)},
+		{JobID: "cancelled", Status: JobStatusCancelled, RunAt: at(-time.Hour)},
+	} {
+		if err := store.CreateJob(ctx, &job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due, err := store.DueScheduled(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(due))
+	for i, j := range due {
+		ids[i] = j.JobID
+	}
+	if want := []string{"due-1", "due-2"}; !slices.Equal(ids, want) {
+		t.Fatalf("DueScheduled = %v, want %v (by run_at)", ids, want)
+	}
+	if due, _ := store.DueScheduled(ctx, now, 1); len(due) != 1 {
+		t.Errorf("DueScheduled with limit 1 returned %d jobs", len(due))
+	}
+
+	released, err := store.ReleaseScheduled(ctx, due[0])
+	if err != nil || !released {
+		t.Fatalf("ReleaseScheduled = %v, %v; want true", released, err)
+	}
+	// 另一个实例拿着同一份查询结果再释放一次：条件更新不满足，也不能重复写发件箱
+	if released, err := store.ReleaseScheduled(ctx, due[0]); err != nil || released {
+		t.Fatalf("second ReleaseScheduled = %v, %v; want false", released, err)
+	}
+	job, _ := store.GetJob(ctx, "due-1")
+	if job.Status != JobStatusQueued {
+		t.Errorf("released job status = %s, want Queued", job.Status)
+	}
+	var outbox int64
+	db.Model(&OutboxMessage{}).Where("job_id = ?", "due-1").Count(&outbox)
+	if outbox != 1 {
+		t.Errorf("%d outbox messages for the released job, want 1", outbox)
+	}
+}
+
+func TestAuditQuery(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	ctx := context.Background()
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i, r := range []AuditRecord{
+		{Actor: "user:alice", Action: "job.submit", Target: "job:1", Outcome: "success"},
+		{Actor: "user:bob", Action: "job.cancel", Target: "job:1", Outcome: "denied"},
+		{Actor: "user:alice", Action: "agent.delete", Target: "agent:n1", Outcome: "success"},
+		{Actor: "key:ab12", Action: "job_submit", Target: "job:2", Outcome: "success"},
+		{Actor: "user:alice", Action: "job.submit", Target: "job:3", Outcome: "error"},
+	} {
+		r.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if err := store.AppendAudit(ctx, &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	targets := func(records []AuditRecord) []string {
+		out := make([]string, len(records))
+		for i, r := range records {
+			out[i] = r.Target
+		}
+		return out
+	}
+
+	for name, c := range map[string]struct {
+		f    AuditFilter
+		want []string // 按时间倒序
+	}{
+		"actor":        {AuditFilter{Actor: "user:alice"}, []string{"job:3", "agent:n1", "job:1"}},
+		"action glob":  {AuditFilter{Action: "job.*"}, []string{"job:3", "job:1", "job:1"}},
+		"outcome":      {AuditFilter{Outcome: "success", Target: "job:*"}, []string{"job:2", "job:1"}},
+		"time window":  {AuditFilter{Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)}, []string{"agent:n1", "job:1"}},
+		"no wildcards": {AuditFilter{Action: "job_*"}, []string{"job:2"}},
+	} {
+		records, err := store.ListAudit(ctx, c.f, 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := targets(records); !slices.Equal(got, c.want) {
+			t.Errorf("%s: got %v, want %v", name, got, c.want)
+		}
+	}
+
+	// 翻页：beforeID 之前的下一页
+	page, err := store.ListAudit(ctx, AuditFilter{}, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := store.ListAudit(ctx, AuditFilter{}, page[len(page)-1].ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := targets(append(page, next...)); !slices.Equal(got, []string{"job:3", "job:2", "agent:n1", "job:1"}) {
+		t.Errorf("two pages = %v", got)
+	}
+
+	// 导出按时间正序
+	var exported []AuditRecord
+	err = store.ExportAudit(ctx, AuditFilter{Actor: "user:alice"}, func(batch []AuditRecord) error {
+		exported = append(exported, batch...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := targets(exported); !slices.Equal(got, []string{"job:1", "agent:n1", "job:3"}) {
+		t.Errorf("ExportAudit = %v", got)
+	}
+}
+
+// 产物、秘密和配置档按业务键覆盖：再次保存时更新原记录，不新增
+func TestStoreUpsertsByKey(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	ctx := context.Background()
+
+	for _, size := range []int64{1, 2} {
+		if err := store.SaveArtifact(ctx, &ArtifactRecord{JobID: "j1", Name: "out.txt", Size: size}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	artifacts, err := store.ListArtifacts(ctx, "j1")
+	if err != nil || len(artifacts) != 1 || artifacts[0].Size != 2 {
+		t.Errorf("artifacts = %+v, %v; want one record of size 2", artifacts, err)
+	}
+
+	first := SecretRecord{Namespace: "default", Name: "token", Value: []byte("v1")}
+	if err := store.PutSecret(ctx, &first); err != nil {
+		t.Fatal(err)
+	}
+	second := SecretRecord{Namespace: "default", Name: "token", Value: []byte("v2")}
+	if err := store.PutSecret(ctx, &second); err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID || !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("PutSecret created a new record: %d vs %d", second.ID, first.ID)
+	}
+	if secret, err := store.GetSecret(ctx, "default", "token"); err != nil || string(secret.Value) != "v2" {
+		t.Errorf("GetSecret = %q, %v; want v2", secret.Value, err)
+	}
+	if deleted, err := store.DeleteSecret(ctx, "default", "token"); err != nil || !deleted {
+		t.Errorf("DeleteSecret = %v, %v", deleted, err)
+	}
+	if _, err := store.GetSecret(ctx, "default", "token"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSecret after delete err = %v, want ErrNotFound", err)
+	}
+
+	for range 2 {
+		if _, err := store.PutProfile(ctx, "gpu", func(p *AgentProfile) { p.Revision++ }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	profiles, err := store.ListProfiles(ctx)
+	if err != nil || len(profiles) != 1 || profiles[0].Revision != 2 {
+		t.Errorf("profiles = %+v, %v; want one profile at revision 2", profiles, err)
+	}
+}
+
+func TestWebhooksFor(t *testing.T) {
+	store := NewGormStore(newTestDB(t))
+	ctx := context.Background()
+	for _, sub := range []WebhookSubscription{
+		{WebhookID: "all", Enabled: true},
+		{WebhookID: "failed", Events: joinTags([]string{EventJobFailed}), Enabled: true},
+		{WebhookID: "disabled", Enabled: false},
+	} {
+		if err := store.CreateWebhook(ctx, &sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for event, want := range map[string][]string{
+		EventJobFailed:    {"all", "failed"},
+		EventJobSucceeded: {"all"},
+	} {
+		subs, err := store.WebhooksFor(ctx, event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range subs {
+			got = append(got, s.WebhookID)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("WebhooksFor(%s) = %v, want %v", event, got, want)
+		}
+	}
+}
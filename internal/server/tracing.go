@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/tracing"
+)
+
+// 任务链路：job.submit (HTTP) -> job.enqueue (发件箱投递) 或 job.dispatch (心跳流下发)
+// -> Agent 的 job.dequeue / job.execute -> job.report (ReportJobStatus)
+// 提交时的 trace context 存在 JobRecord.TraceParent 里，延时释放、重新下发也能接上同一个 trace
+
+// startJobSpan 在提交任务的请求里开启 span，ctx 一般来自 HTTP 中间件
+func startJobSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name)
+}
+
+// setJobTrace 把当前 span 和请求 ID 记到任务上
+func setJobTrace(ctx context.Context, record *JobRecord) {
+	record.TraceID = tracing.TraceID(ctx)
+	record.TraceParent = tracing.TraceParent(ctx)
+	record.RequestID = logging.RequestID(ctx)
+}
+
+// jobLogContext 任务相关日志的 ctx：带上提交时的请求 ID 和任务 ID
+func jobLogContext(ctx context.Context, r JobRecord) context.Context {
+	if logging.RequestID(ctx) == "" {
+		ctx = logging.WithRequestID(ctx, r.RequestID)
+	}
+	return logging.With(ctx, "job_id", r.JobID)
+}
+
+// jobSpanAttrs 任务相关 span 的公共属性
+func jobSpanAttrs(r JobRecord) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("job.id", r.JobID),
+		attribute.String("job.type", metricType(r.Type)),
+	}
+	if r.BatchID != "" {
+		attrs = append(attrs, attribute.String("job.batch_id", r.BatchID))
+	}
+	if r.AgentID != "" {
+		attrs = append(attrs, attribute.String("agent.id", r.AgentID))
+	}
+	return attrs
+}
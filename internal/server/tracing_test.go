@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/logging"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/tracing"
+)
+
+func TestSetJobTrace(t *testing.T) {
+	var record JobRecord
+	setJobTrace(context.Background(), &record)
+	if record.TraceID != "" || record.TraceParent != "" || record.RequestID != "" {
+		t.Errorf("untraced ctx: %+v", record)
+	}
+
+	ctx := logging.WithRequestID(tracing.WithTraceParent(context.Background(),
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"), "req-1")
+	setJobTrace(ctx, &record)
+	if record.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || record.RequestID != "req-1" ||
+		!strings.Contains(record.TraceParent, record.TraceID) {
+		t.Errorf("record = trace %q, parent %q, request %q", record.TraceID, record.TraceParent, record.RequestID)
+	}
+}
+
+// 调用方带的 traceparent 跟着任务存下来，发件箱消息也带上，投递到 MQ 时接上同一个 trace
+func TestSubmitKeepsCallerTrace(t *testing.T) {
+	db := newTestDB(t)
+	store := NewGormStore(db)
+	s := &HttpServer{Store: store, Srv: &SentinelServer{Store: store}}
+
+	r := httptest.NewRequest(http.MethodPost, "/task", strings.NewReader(`{"type":"shell","payload":"echo hi"}`))
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set("X-Request-ID", "req-42")
+	w := httptest.NewRecorder()
+	LoggingMiddleware(http.HandlerFunc(s.handleTask)).ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := store.GetJob(context.Background(), resp.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || job.RequestID != "req-42" {
+		t.Errorf("job trace %q, request %q", job.TraceID, job.RequestID)
+	}
+	var msg OutboxMessage
+	if err := db.Where("job_id = ?", resp.JobID).First(&msg).Error; err != nil {
+		t.Fatal(err)
+	}
+	if msg.TraceParent != job.TraceParent || tracing.TraceID(tracing.WithTraceParent(context.Background(), msg.TraceParent)) != job.TraceID {
+		t.Errorf("outbox traceparent %q, job %q", msg.TraceParent, job.TraceParent)
+	}
+}
@@ -0,0 +1,693 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EventWebhookPing 由 POST /webhooks/{id}/test 发出，不经过事件总线，也不需要订阅
+const EventWebhookPing = "webhook.ping"
+
+// webhookEvents 可以订阅的事件，是事件总线 (见 events.go) 的子集；
+// 提交、下发这类高频事件只在 GET /events 里提供
+var webhookEvents = map[string]bool{
+	EventJobSucceeded:   true,
+	EventJobFailed:      true,
+	EventJobCancelled:   true,
+	EventAgentLost:      true,
+	EventBatchCompleted: true,
+}
+
+// 投递状态
+const (
+	DeliveryPending   = "Pending"
+	DeliverySucceeded = "Succeeded"
+	DeliveryFailed    = "Failed" // 重试次数用完，不再投递
+)
+
+const (
+	webhookPageSize      = 100
+	webhookConcurrency   = 8
+	webhookPollInterval  = time.Second
+	webhookMaxBackoff    = time.Hour
+	webhookPurgeInterval = time.Hour
+	webhookMaxRespBytes  = 512 // 投递日志里保存的响应体长度
+)
+
+// WebhookSubscription Webhook 订阅：事件发生时 POST 到 URL
+type WebhookSubscription struct {
+	gorm.Model
+	WebhookID   string `gorm:"uniqueIndex;size:64"`
+	URL         string `gorm:"size:1024"`
+	Events      string `gorm:"size:512"` // 逗号分隔并首尾加逗号 (",job.failed,agent.lost,")；为空表示订阅全部事件
+	SecretRef   string `gorm:"size:130"` // HMAC 签名密钥，引用 /secrets 里的秘密 (namespace/name)；为空时不签名
+	Description string `gorm:"size:255"`
+	Enabled     bool
+}
+
+// WebhookDelivery 一次事件投递，也是投递日志
+// 事件发生时按订阅展开写入，由 WebhookWorker 投递，失败按指数退避重试
+type WebhookDelivery struct {
+	gorm.Model
+	DeliveryID     string    `gorm:"uniqueIndex;size:64"`
+	WebhookID      string    `gorm:"index;size:64"`
+	EventID        string    `gorm:"index;size:64"` // 同一个事件投给多个订阅时相同，接收方可以据此去重
+	Event          string    `gorm:"size:64"`
+	Payload        string    `gorm:"type:text"`
+	Status         string    `gorm:"index:idx_webhook_pending,priority:1;size:16"`
+	NextAttemptAt  time.Time `gorm:"index:idx_webhook_pending,priority:2"`
+	Attempts       int
+	LastStatusCode int
+	LastError      string `gorm:"size:512"`
+	LastResponse   string `gorm:"size:512"`
+	DeliveredAt    *time.Time
+}
+
+// webhookEnvelope 投递的请求体
+type webhookEnvelope struct {
+	ID      string      `json:"id"` // 事件 ID，和 GET /events 里的一致；测试事件以 ping- 开头
+	Event   string      `json:"event"`
+	Subject string      `json:"subject,omitempty"`
+	Time    time.Time   `json:"time"`
+	Data    interface{} `json:"data"`
+}
+
+// newWebhookID 生成随机订阅 ID
+func newWebhookID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "wh-" + hex.EncodeToString(b)
+}
+
+// newDeliveryID 生成随机投递 ID
+func newDeliveryID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "whd-" + hex.EncodeToString(b)
+}
+
+// newPingID 生成随机的测试事件 ID
+func newPingID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "ping-" + hex.EncodeToString(b)
+}
+
+func newDelivery(webhookID, eventID, event string, payload []byte) WebhookDelivery {
+	return WebhookDelivery{
+		DeliveryID:    newDeliveryID(),
+		WebhookID:     webhookID,
+		EventID:       eventID,
+		Event:         event,
+		Payload:       string(payload),
+		Status:        DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+}
+
+// WebhookWorker 投递 Webhook：每次请求带 HMAC 签名，非 2xx 或网络错误按指数退避重试
+type WebhookWorker struct {
+	Srv         *SentinelServer
+	Client      *http.Client
+	MaxAttempts int           // 超过后标记为 Failed
+	Retention   time.Duration // 投递日志保留多久
+
+	wake chan struct{}
+}
+
+func NewWebhookWorker(srv *SentinelServer, timeout time.Duration, maxAttempts int, retention time.Duration) *WebhookWorker {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 8
+	}
+	w := &WebhookWorker{
+		Srv:         srv,
+		Client:      &http.Client{Timeout: timeout},
+		MaxAttempts: maxAttempts,
+		Retention:   retention,
+		wake:        make(chan struct{}, 1),
+	}
+	// 订阅事件总线，事件发布时按订阅展开成投递记录
+	if srv.Events != nil {
+		srv.Events.Listen(w.enqueue)
+	}
+	return w
+}
+
+// enqueue 为订阅了这个事件的 Webhook 各写一条待投递记录，然后唤醒投递协程
+// 在发布事件的协程里同步执行；写入失败只记日志，不影响触发事件的操作
+func (w *WebhookWorker) enqueue(ctx context.Context, ev Event) {
+	if !webhookEvents[ev.Type] {
+		return
+	}
+	subs, err := w.Srv.Store.WebhooksFor(ctx, ev.Type)
+	if err != nil {
+		slog.ErrorContext(ctx, "查询 Webhook 订阅失败", "event", ev.Type, "err", err)
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+	eventID := strconv.FormatUint(ev.ID, 10)
+	payload, err := json.Marshal(webhookEnvelope{ID: eventID, Event: ev.Type, Subject: ev.Subject, Time: ev.Time, Data: ev.Data})
+	if err != nil {
+		slog.ErrorContext(ctx, "编码 Webhook 事件失败", "event", ev.Type, "err", err)
+		return
+	}
+	deliveries := make([]WebhookDelivery, len(subs))
+	for i, sub := range subs {
+		deliveries[i] = newDelivery(sub.WebhookID, eventID, ev.Type, payload)
+	}
+	if err := w.Srv.Store.CreateDeliveries(ctx, deliveries); err != nil {
+		slog.ErrorContext(ctx, "写入 Webhook 投递记录失败", "event", ev.Type, "err", err)
+		return
+	}
+	slog.DebugContext(ctx, "Webhook 事件已排队", "event", ev.Type, "event_id", ev.ID, "subscriptions", len(subs))
+	w.Notify()
+}
+
+// Notify 有新的投递记录时调用，不必等下一次轮询
+func (w *WebhookWorker) Notify() {
+	if w == nil {
+		return
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 阻塞运行，直到 ctx 被取消
+func (w *WebhookWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Now()
+
+	slog.Info("Webhook 投递协程已启动", "max_attempts", w.MaxAttempts, "timeout", w.Client.Timeout)
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Webhook 投递协程已停止")
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+
+		for w.deliverOnce(ctx) == webhookPageSize && ctx.Err() == nil {
+		}
+
+		if w.Retention > 0 && time.Since(lastPurge) > webhookPurgeInterval {
+			w.purge()
+			lastPurge = time.Now()
+		}
+	}
+}
+
+// deliverOnce 并发投递一页到期的记录，返回本页的记录数
+func (w *WebhookWorker) deliverOnce(ctx context.Context) int {
+	due, err := w.Srv.Store.DueDeliveries(ctx, time.Now(), webhookPageSize)
+	if err != nil {
+		slog.Error("查询待投递的 Webhook 失败", "err", err)
+		return 0
+	}
+	if len(due) == 0 {
+		return 0
+	}
+
+	ids := make([]string, 0, len(due))
+	for _, d := range due {
+		ids = append(ids, d.WebhookID)
+	}
+	subs, err := w.Srv.Store.ListWebhooks(ctx, ids)
+	if err != nil {
+		slog.Error("查询 Webhook 订阅失败", "err", err)
+		return 0
+	}
+	byID := make(map[string]WebhookSubscription, len(subs))
+	for _, sub := range subs {
+		byID[sub.WebhookID] = sub
+	}
+
+	sem := make(chan struct{}, webhookConcurrency)
+	var wg sync.WaitGroup
+	for _, d := range due {
+		sub, ok := byID[d.WebhookID]
+		if !ok {
+			// 订阅已删除，剩下的投递没有意义
+			w.finish(d, DeliveryFailed, 0, "webhook deleted", "")
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			w.deliver(ctx, sub, d)
+		}()
+	}
+	wg.Wait()
+	return len(due)
+}
+
+// deliver 投递一条记录并更新投递日志
+func (w *WebhookWorker) deliver(ctx context.Context, sub WebhookSubscription, d WebhookDelivery) {
+	code, resp, err := w.post(ctx, sub, d)
+	if err == nil {
+		w.finish(d, DeliverySucceeded, code, "", resp)
+		return
+	}
+	d.Attempts++
+	if d.Attempts >= w.MaxAttempts {
+		slog.Warn("Webhook 投递失败，不再重试", "webhook_id", sub.WebhookID, "delivery_id", d.DeliveryID,
+			"event", d.Event, "attempts", d.Attempts, "err", err)
+		w.finish(d, DeliveryFailed, code, err.Error(), resp)
+		return
+	}
+	next := time.Now().Add(webhookBackoff(d.Attempts))
+	slog.Info("Webhook 投递失败，稍后重试", "webhook_id", sub.WebhookID, "delivery_id", d.DeliveryID,
+		"event", d.Event, "attempts", d.Attempts, "next_attempt_at", next, "err", err)
+	w.Srv.Store.UpdateDelivery(ctx, d.ID, map[string]interface{}{
+		"attempts":         d.Attempts,
+		"next_attempt_at":  next,
+		"last_status_code": code,
+		"last_error":       truncate(err.Error(), 512),
+		"last_response":    resp,
+	})
+}
+
+// finish 投递结束 (成功或放弃)
+func (w *WebhookWorker) finish(d WebhookDelivery, status string, code int, errMsg, resp string) {
+	updates := map[string]interface{}{
+		"status":           status,
+		"attempts":         d.Attempts,
+		"last_status_code": code,
+		"last_error":       truncate(errMsg, 512),
+		"last_response":    resp,
+	}
+	if status == DeliverySucceeded {
+		updates["attempts"] = d.Attempts + 1
+		updates["delivered_at"] = time.Now()
+	}
+	if err := w.Srv.Store.UpdateDelivery(context.Background(), d.ID, updates); err != nil {
+		// 状态没更新成功的记录下一轮会再投一次，接收方按事件 ID 去重
+		slog.Error("更新 Webhook 投递记录失败", "delivery_id", d.DeliveryID, "err", err)
+	}
+}
+
+// post 发出一次请求，返回状态码和截断的响应体；非 2xx 也算失败
+func (w *WebhookWorker) post(ctx context.Context, sub WebhookSubscription, d WebhookDelivery) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, strings.NewReader(d.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gcc-webhook/1")
+	req.Header.Set("X-GCC-Event", d.Event)
+	req.Header.Set("X-GCC-Event-ID", d.EventID)
+	req.Header.Set("X-GCC-Delivery", d.DeliveryID)
+	req.Header.Set("X-GCC-Timestamp", ts)
+	if sub.SecretRef != "" {
+		// 每次都重新读取秘密，轮换 /secrets 里的值后立即生效
+		secret, err := w.Srv.secretValue(sub.SecretRef)
+		if err != nil {
+			return 0, "", fmt.Errorf("load signing secret: %w", err)
+		}
+		req.Header.Set("X-GCC-Signature", "sha256="+webhookSignature(secret, ts, []byte(d.Payload)))
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxRespBytes))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // 读完一小段剩余内容，让连接可以复用
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(body), fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// webhookSignature 签名内容为 "<timestamp>.<body>"，接收方校验时间戳可以防重放
+func webhookSignature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff 指数退避：10s, 20s, 40s ... 最长 1 小时
+func webhookBackoff(attempts int) time.Duration {
+	d := 10 * time.Second << min(attempts-1, 10)
+	return min(d, webhookMaxBackoff)
+}
+
+// purge 清理超过保留期的已结束投递记录
+func (w *WebhookWorker) purge() {
+	n, err := w.Srv.Store.PurgeDeliveries(context.Background(), time.Now().Add(-w.Retention))
+	if err != nil {
+		slog.Error("清理 Webhook 投递记录失败", "err", err)
+		return
+	}
+	if n > 0 {
+		slog.Info("已清理 Webhook 投递记录", "count", n)
+	}
+}
+
+// ---------------- HTTP 接口 ----------------
+
+// webhookView 是订阅接口的返回结构
+type webhookView struct {
+	WebhookID   string    `json:"webhook_id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"` // 为空表示全部事件
+	Secret      string    `json:"secret,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func newWebhookView(s WebhookSubscription) webhookView {
+	events := splitList(s.Events)
+	if events == nil {
+		events = []string{}
+	}
+	return webhookView{
+		WebhookID:   s.WebhookID,
+		URL:         s.URL,
+		Events:      events,
+		Secret:      s.SecretRef,
+		Description: s.Description,
+		Enabled:     s.Enabled,
+		CreatedAt:   s.CreatedAt,
+		UpdatedAt:   s.UpdatedAt,
+	}
+}
+
+// deliveryView 是投递日志接口的返回结构
+type deliveryView struct {
+	DeliveryID     string          `json:"delivery_id"`
+	WebhookID      string          `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	LastResponse   string          `json:"last_response,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	Payload        json.RawMessage `json:"payload,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+func newDeliveryView(d WebhookDelivery, withPayload bool) deliveryView {
+	v := deliveryView{
+		DeliveryID:     d.DeliveryID,
+		WebhookID:      d.WebhookID,
+		EventID:        d.EventID,
+		Event:          d.Event,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		LastResponse:   d.LastResponse,
+		DeliveredAt:    d.DeliveredAt,
+		CreatedAt:      d.CreatedAt,
+	}
+	if d.Status == DeliveryPending {
+		v.NextAttemptAt = &d.NextAttemptAt
+	}
+	if withPayload {
+		v.Payload = json.RawMessage(d.Payload)
+	}
+	return v
+}
+
+// webhookRequest 创建和修改订阅的请求体
+type webhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Secret      string   `json:"secret"` // 引用 /secrets 里的秘密，如 "default/webhook-key"
+	Description string   `json:"description"`
+	Enabled     *bool    `json:"enabled"` // 默认启用
+}
+
+// apply 校验请求并写到订阅上
+func (req webhookRequest) apply(ctx context.Context, store Store, sub *WebhookSubscription) error {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url 必须是 http:// 或 https:// 开头的完整地址")
+	}
+	if len(req.URL) > 1024 {
+		return errors.New("url 太长")
+	}
+	events := make([]string, 0, len(req.Events))
+	for _, e := range req.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if !webhookEvents[e] {
+			return fmt.Errorf("不支持的事件 %q，可选 %s", e, strings.Join(sortedEvents(), " / "))
+		}
+		events = append(events, e)
+	}
+	if req.Secret != "" {
+		ns, name, err := parseSecretRef(req.Secret)
+		if err != nil {
+			return err
+		}
+		exists, err := store.SecretExists(ctx, ns, name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("secret %s/%s 不存在，先通过 PUT /secrets/%s/%s 创建", ns, name, ns, name)
+		}
+		sub.SecretRef = ns + "/" + name
+	} else {
+		sub.SecretRef = ""
+	}
+	sub.URL = req.URL
+	sub.Events = joinTags(events)
+	sub.Description = truncate(req.Description, 255)
+	sub.Enabled = req.Enabled == nil || *req.Enabled
+	return nil
+}
+
+func sortedEvents() []string {
+	out := make([]string, 0, len(webhookEvents))
+	for e := range webhookEvents {
+		out = append(out, e)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *HttpServer) findWebhook(ctx context.Context, w http.ResponseWriter, id string) (WebhookSubscription, bool) {
+	sub, err := s.Store.GetWebhook(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return sub, false
+	}
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return sub, false
+	}
+	return sub, true
+}
+
+// handleListWebhooks 订阅列表
+func (s *HttpServer) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	subs, err := s.Store.ListWebhooks(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	views := make([]webhookView, len(subs))
+	for i, sub := range subs {
+		views[i] = newWebhookView(sub)
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleCreateWebhook 创建订阅
+// 请求体 {"url": "...", "events": ["job.failed"], "secret": "default/webhook-key"}，events 为空表示全部事件
+func (s *HttpServer) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request: JSON 格式错误", http.StatusBadRequest)
+		return
+	}
+	sub := WebhookSubscription{WebhookID: newWebhookID()}
+	auditTarget(r.Context(), "webhook:"+sub.WebhookID)
+	if err := req.apply(r.Context(), s.Store, &sub); err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.Store.CreateWebhook(r.Context(), &sub); err != nil {
+		slog.ErrorContext(r.Context(), "保存 Webhook 失败", "err", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Webhook 已创建", "webhook_id", sub.WebhookID, "url", sub.URL, "events", sub.Events)
+	writeJSON(w, http.StatusCreated, newWebhookView(sub))
+}
+
+// handleGetWebhook 订阅详情
+func (s *HttpServer) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := s.findWebhook(r.Context(), w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newWebhookView(sub))
+}
+
+// handleUpdateWebhook 整体修改订阅，请求体同创建
+func (s *HttpServer) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := s.findWebhook(r.Context(), w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request: JSON 格式错误", http.StatusBadRequest)
+		return
+	}
+	if err := req.apply(r.Context(), s.Store, &sub); err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.Store.SaveWebhook(r.Context(), &sub); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Webhook 已修改", "webhook_id", sub.WebhookID, "url", sub.URL, "events", sub.Events, "enabled", sub.Enabled)
+	writeJSON(w, http.StatusOK, newWebhookView(sub))
+}
+
+// handleDeleteWebhook 删除订阅；还没投递的记录会被标记为 Failed
+func (s *HttpServer) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := s.findWebhook(r.Context(), w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	if err := s.Store.DeleteWebhook(r.Context(), sub); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Webhook 已删除", "webhook_id", sub.WebhookID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTestWebhook 发一条 webhook.ping 事件，用来检查地址和签名配置；停用的订阅也可以测试
+func (s *HttpServer) handleTestWebhook(w http.ResponseWriter, r *http.Request) {
+	sub, ok := s.findWebhook(r.Context(), w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	eventID := newPingID()
+	payload, _ := json.Marshal(webhookEnvelope{
+		ID:    eventID,
+		Event: EventWebhookPing,
+		Time:  time.Now(),
+		Data:  map[string]string{"webhook_id": sub.WebhookID},
+	})
+	deliveries := []WebhookDelivery{newDelivery(sub.WebhookID, eventID, EventWebhookPing, payload)}
+	if err := s.Store.CreateDeliveries(r.Context(), deliveries); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	s.Srv.Webhooks.Notify()
+	writeJSON(w, http.StatusAccepted, newDeliveryView(deliveries[0], false))
+}
+
+// handleListDeliveries 投递日志，按时间倒序；支持 status=Pending|Succeeded|Failed、limit (默认 50，最多 500)
+func (s *HttpServer) handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	sub, ok := s.findWebhook(r.Context(), w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Bad Request: limit 必须是正整数", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, 500)
+	}
+	deliveries, err := s.Store.ListDeliveries(r.Context(), sub.WebhookID, q.Get("status"), limit)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	views := make([]deliveryView, len(deliveries))
+	for i, d := range deliveries {
+		views[i] = newDeliveryView(d, false)
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleGetDelivery 单条投递记录，包含请求体
+func (s *HttpServer) handleGetDelivery(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.findDelivery(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newDeliveryView(d, true))
+}
+
+// handleRedeliver 重新投递一条记录 (比如接收方修好之后)，重试次数从零算起
+func (s *HttpServer) handleRedeliver(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.findDelivery(w, r)
+	if !ok {
+		return
+	}
+	err := s.Store.UpdateDelivery(r.Context(), d.ID, map[string]interface{}{
+		"status":          DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	}).Error
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	s.Srv.Webhooks.Notify()
+	d.Status, d.Attempts, d.NextAttemptAt = DeliveryPending, 0, time.Now()
+	writeJSON(w, http.StatusAccepted, newDeliveryView(d, false))
+}
+
+func (s *HttpServer) findDelivery(w http.ResponseWriter, r *http.Request) (WebhookDelivery, bool) {
+	d, err := s.Store.GetDelivery(r.Context(), r.PathValue("id"), r.PathValue("delivery"))
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return d, false
+	}
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return d, false
+	}
+	return d, true
+}
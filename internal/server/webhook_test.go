@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/secrets"
+)
+
+// newTestWebhook 建一个指向 url 的订阅，签名密钥保存在 /secrets 的 default/hook
+func newTestWebhook(t *testing.T, url string, maxAttempts int) (*WebhookWorker, *gorm.DB) {
+	t.Helper()
+	db := newTestDB(t)
+	box, err := secrets.NewBox("0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := SecretRecord{Namespace: "default", Name: "hook", Value: box.Seal([]byte("s3cret"), secretAAD("default", "hook"))}
+	if err := db.Create(&secret).Error; err != nil {
+		t.Fatal(err)
+	}
+	sub := WebhookSubscription{WebhookID: "wh-1", URL: url, SecretRef: "default/hook", Enabled: true}
+	if err := db.Create(&sub).Error; err != nil {
+		t.Fatal(err)
+	}
+	return NewWebhookWorker(&SentinelServer{Store: NewGormStore(db), Secrets: box}, time.Second, maxAttempts, 0), db
+}
+
+func createDelivery(t *testing.T, db *gorm.DB, webhookID string) WebhookDelivery {
+	t.Helper()
+	d := newDelivery(webhookID, "42", EventJobFailed, []byte(`{"id":"42","event":"job.failed"}`))
+	if err := db.Create(&d).Error; err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func reloadDelivery(t *testing.T, db *gorm.DB, d WebhookDelivery) WebhookDelivery {
+	t.Helper()
+	var got WebhookDelivery
+	if err := db.First(&got, d.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestWebhookSignature(t *testing.T) {
+	var sig, ts, body string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		sig, ts, body = r.Header.Get("X-GCC-Signature"), r.Header.Get("X-GCC-Timestamp"), string(b)
+	}))
+	defer receiver.Close()
+	w, db := newTestWebhook(t, receiver.URL, 3)
+	d := createDelivery(t, db, "wh-1")
+
+	if n := w.deliverOnce(context.Background()); n != 1 {
+		t.Fatalf("deliverOnce = %d, want 1", n)
+	}
+	// 接收方的校验方式：HMAC-SHA256(secret, "<timestamp>.<body>")
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(ts + "." + body))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); sig != want {
+		t.Errorf("X-GCC-Signature = %q, want %q", sig, want)
+	}
+	if body != d.Payload {
+		t.Errorf("body = %q, want %q", body, d.Payload)
+	}
+	if got := reloadDelivery(t, db, d); got.Status != DeliverySucceeded || got.Attempts != 1 || got.LastStatusCode != http.StatusOK {
+		t.Errorf("delivery = %s, %d attempts, code %d; want Succeeded after 1 attempt", got.Status, got.Attempts, got.LastStatusCode)
+	}
+}
+
+func TestWebhookRetriesUntilMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+	w, db := newTestWebhook(t, receiver.URL, 2)
+	d := createDelivery(t, db, "wh-1")
+
+	before := time.Now()
+	w.deliverOnce(context.Background())
+	got := reloadDelivery(t, db, d)
+	if got.Status != DeliveryPending || got.Attempts != 1 || got.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("after first failure: %s, %d attempts, code %d; want Pending, 1, 500", got.Status, got.Attempts, got.LastStatusCode)
+	}
+	if wait := got.NextAttemptAt.Sub(before); wait < webhookBackoff(1) || wait > webhookBackoff(1)+5*time.Second {
+		t.Errorf("next_attempt_at is %s after the attempt, want about %s", wait, webhookBackoff(1))
+	}
+
+	// 还没到重试时间
+	if n := w.deliverOnce(context.Background()); n != 0 {
+		t.Fatalf("deliverOnce before next_attempt_at = %d, want 0", n)
+	}
+	if err := db.Model(&WebhookDelivery{}).Where("id = ?", d.ID).Update("next_attempt_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	w.deliverOnce(context.Background())
+	got = reloadDelivery(t, db, d)
+	if got.Status != DeliveryFailed || got.Attempts != 2 {
+		t.Fatalf("after MaxAttempts: %s, %d attempts; want Failed, 2", got.Status, got.Attempts)
+	}
+	if n := w.deliverOnce(context.Background()); n != 0 || calls.Load() != 2 {
+		t.Errorf("delivered again after giving up: deliverOnce = %d, calls = %d", n, calls.Load())
+	}
+}
+
+func TestWebhookDeletedSubscriptionFailsDelivery(t *testing.T) {
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer receiver.Close()
+	w, db := newTestWebhook(t, receiver.URL, 3)
+	d := createDelivery(t, db, "wh-1")
+	if err := db.Where("webhook_id = ?", "wh-1").Delete(&WebhookSubscription{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	w.deliverOnce(context.Background())
+	got := reloadDelivery(t, db, d)
+	if got.Status != DeliveryFailed || got.LastError != "webhook deleted" {
+		t.Errorf("delivery = %s (%q), want Failed (webhook deleted)", got.Status, got.LastError)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("receiver called %d times for a deleted subscription", calls.Load())
+	}
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
-	"log"
+	"log/slog"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,17 +14,129 @@ type Config struct {
 	Database DatabaseConfig `mapstructure:"database"`
 	RabbitMQ RabbitMQConfig `mapstructure:"rabbitmq"`
 	Redis    RedisConfig    `mapstructure:"redis"`
+	Agent    AgentConfig    `mapstructure:"agent"`
+	S3       S3Config       `mapstructure:"s3"`
+	Tracing  TracingConfig  `mapstructure:"tracing"`
+	Log      LogConfig      `mapstructure:"log"`
 }
 
 type ServerConfig struct {
 	Port        string `mapstructure:"port"`
 	GRPCPort    string `mapstructure:"grpc_port"`
 	StoragePath string `mapstructure:"storage_path"`
-	MaxSize     int64  `mapstructure:"max_file_size"`
+	MaxSize     int64  `mapstructure:"max_file_size"` // 单个产物文件的大小上限 (字节)
+	// 产物存储后端：local (写到 storage_path) 或 s3 (见 S3Config)
+	StorageBackend string `mapstructure:"storage_backend"`
+
+	// 延时任务调度器扫描 MySQL 的间隔
+	SchedulerInterval time.Duration `mapstructure:"scheduler_interval"`
+	// 单个批次展开后的最大任务数
+	MaxBatchSize int `mapstructure:"max_batch_size"`
+	// 发件箱兜底轮询间隔，以及已投递消息的保留时长
+	OutboxInterval  time.Duration `mapstructure:"outbox_interval"`
+	OutboxRetention time.Duration `mapstructure:"outbox_retention"`
+	// 超过这么久没有心跳的节点视为 Offline
+	AgentOfflineAfter time.Duration `mapstructure:"agent_offline_after"`
+	// 心跳间隔和随机抖动，由 Server 下发给 Agent；在线节点多了会按 heartbeat_rate 自动拉长间隔
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	HeartbeatJitter   time.Duration `mapstructure:"heartbeat_jitter"`
+	HeartbeatRate     int           `mapstructure:"heartbeat_rate"` // 每秒最多处理的心跳数
+	// 加密秘密值的主密钥 (32 字节，base64 或 hex)，建议用环境变量 GCC_SERVER_SECRET_KEY 传入；
+	// 为空时不能使用 /secrets
+	SecretKey string `mapstructure:"secret_key"`
+	// 前置认证代理的地址 (IP 或 CIDR)，只有来自这些地址的请求才信任 X-Remote-User 作为审计日志的操作人；
+	// 为空时一律不信任，操作人记为 API key 的指纹
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// Webhook 投递：单次请求超时、最多尝试次数 (失败按指数退避重试)、投递日志保留时长
+	WebhookTimeout     time.Duration `mapstructure:"webhook_timeout"`
+	WebhookMaxAttempts int           `mapstructure:"webhook_max_attempts"`
+	WebhookRetention   time.Duration `mapstructure:"webhook_retention"`
+	// 事件总线 (GET /events) 保留多久的事件，订阅方断线超过这个时长就续传不上了
+	EventRetention time.Duration `mapstructure:"event_retention"`
+	// 任务输出的保留策略，超出范围的输出压缩归档到 storage_path/results 下
+	ResultRetention ResultRetentionConfig `mapstructure:"result_retention"`
+}
+
+// ResultRetentionConfig 任务输出的保留和归档
+// 归档后输出从数据库里移走，GET /jobs/{id} 照常返回 (从归档文件读取)
+type ResultRetentionConfig struct {
+	Interval time.Duration   `mapstructure:"interval"` // 归档扫描间隔
+	Rules    []RetentionRule `mapstructure:"rules"`    // 没有匹配规则的任务类型不归档
+}
+
+// RetentionRule 一种任务类型的保留规则，keep_days 和 keep_last 同时配置时两个条件都满足才归档
+type RetentionRule struct {
+	Type     string `mapstructure:"type"`      // 任务类型 (不区分大小写)，"*" 匹配没有单独配置的类型
+	KeepDays int    `mapstructure:"keep_days"` // 结束超过这么多天才归档，0 表示不按时间
+	KeepLast int    `mapstructure:"keep_last"` // 同类型最近结束的这么多个任务不归档，0 表示不限
+}
+
+// AgentConfig 只有 Agent 进程使用
+type AgentConfig struct {
+	ServerAddr string   `mapstructure:"server_addr"` // Server 的 gRPC 地址
+	Tags       []string `mapstructure:"tags"`
+	// 同时执行的最大任务数，MQ 和 gRPC 下发的任务共用；MQ 的预取数量也取这个值
+	MaxConcurrentJobs int `mapstructure:"max_concurrent_jobs"`
+	// 输入文件的本地缓存目录，按 sha256 存放，同一个文件只下载一次；为空时放在系统临时目录下
+	CacheDir string `mapstructure:"cache_dir"`
+	// 每个任务在 workspace_root 下有独立的临时工作区；为空时放在系统临时目录下
+	WorkspaceRoot string `mapstructure:"workspace_root"`
+	// 任务结束后保留哪些工作区：none (默认，立即删除) / failed (只保留失败和取消的) / all
+	WorkspaceKeep string `mapstructure:"workspace_keep"`
+	// 保留的工作区超过这么久后删除
+	WorkspaceRetention time.Duration `mapstructure:"workspace_retention"`
+	// 除默认规则外，还要从任务环境变量里去掉的变量 (支持通配符，如 "AWS_*")
+	ScrubEnv []string `mapstructure:"scrub_env"`
+	// Prometheus 指标监听地址，如 ":9101"；为空时不开启
+	MetricsAddr string `mapstructure:"metrics_addr"`
 }
 
+// S3Config storage_backend 为 s3 时使用，兼容 MinIO 等 S3 协议的对象存储
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"` // 不带协议头，如 "127.0.0.1:9000"
+	Bucket    string `mapstructure:"bucket"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	Region    string `mapstructure:"region"`
+	UseSSL    bool   `mapstructure:"use_ssl"`
+	Prefix    string `mapstructure:"prefix"` // 对象 key 的前缀，多个环境共用一个 bucket 时区分
+}
+
+// LogConfig 日志配置，Server 和 Agent 共用
+type LogConfig struct {
+	// debug / info / warn / error，运行中可以通过 /admin/log-level 调整
+	Level string `mapstructure:"level"`
+	// json (默认，给日志采集用) 或 text (本地调试时更易读)
+	Format string `mapstructure:"format"`
+}
+
+// TracingConfig OpenTelemetry 链路追踪，Server 和 Agent 共用
+type TracingConfig struct {
+	// 是否通过 OTLP 导出 span；关闭时仍然生成并传递 trace ID
+	Enabled bool `mapstructure:"enabled"`
+	// OTLP/gRPC Collector 地址，如 "localhost:4317"；为空时用 OTEL_EXPORTER_OTLP_ENDPOINT 或默认值
+	Endpoint string `mapstructure:"endpoint"`
+	// Collector 没有开 TLS 时设为 true
+	Insecure bool `mapstructure:"insecure"`
+	// 新 trace 的采样比例 (0, 1]
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// DatabaseConfig Server 的数据库，见 pkg/db.Open
+// driver 为 sqlite 时不需要外部数据库，适合本地运行和测试
 type DatabaseConfig struct {
-	DSN string `mapstructure:"dsn"`
+	Driver string `mapstructure:"driver"` // mysql (默认) 或 sqlite
+	// MySQL：dsn 不为空时直接使用，否则用下面几项拼接
+	DSN      string `mapstructure:"dsn"`
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	DBName   string `mapstructure:"dbname"`
+	// SQLite：数据库文件路径，":memory:" 表示内存库 (进程退出后数据丢失)
+	Path string `mapstructure:"path"`
+	// 启动时自动执行没执行过的表结构迁移；关闭后需要先运行 server migrate up，否则拒绝启动
+	AutoMigrate bool `mapstructure:"auto_migrate"`
 }
 
 type RabbitMQConfig struct {
@@ -48,6 +162,38 @@ func LoadConfig() {
 	viper.SetDefault("server.grpc_port", "9090") // 默认 gRPC 端口
 	viper.SetDefault("server.storage_path", "./uploads")
 	viper.SetDefault("server.max_file_size", 104857600)
+	viper.SetDefault("server.storage_backend", "local")
+	viper.SetDefault("s3.bucket", "artifacts")
+	viper.SetDefault("server.scheduler_interval", "1s")
+	viper.SetDefault("server.max_batch_size", 10000)
+	viper.SetDefault("server.outbox_interval", "1s")
+	viper.SetDefault("server.outbox_retention", "24h")
+	viper.SetDefault("server.agent_offline_after", "30s")
+	viper.SetDefault("server.heartbeat_interval", "5s")
+	viper.SetDefault("server.heartbeat_jitter", "1s")
+	viper.SetDefault("server.heartbeat_rate", 200)
+	viper.SetDefault("server.webhook_timeout", "10s")
+	viper.SetDefault("server.webhook_max_attempts", 8)
+	viper.SetDefault("server.webhook_retention", "168h")
+	viper.SetDefault("server.event_retention", "72h")
+	viper.SetDefault("server.result_retention.interval", "1h")
+	viper.SetDefault("database.driver", "mysql")
+	viper.SetDefault("database.host", "127.0.0.1")
+	viper.SetDefault("database.port", "3306")
+	viper.SetDefault("database.user", "root")
+	viper.SetDefault("database.password", "root")
+	viper.SetDefault("database.dbname", "cloud_compute")
+	viper.SetDefault("database.path", "./data/gcc.db")
+	viper.SetDefault("database.auto_migrate", true)
+	viper.SetDefault("log.level", "info")
+	viper.SetDefault("log.format", "json")
+	viper.SetDefault("tracing.endpoint", "localhost:4317")
+	viper.SetDefault("tracing.insecure", true)
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+	viper.SetDefault("agent.server_addr", "127.0.0.1:9090")
+	viper.SetDefault("agent.max_concurrent_jobs", 4)
+	viper.SetDefault("agent.workspace_keep", "none")
+	viper.SetDefault("agent.workspace_retention", "24h")
 
 	// 配置文件设置
 	viper.SetConfigName("config")
@@ -59,20 +205,26 @@ func LoadConfig() {
 	viper.SetEnvPrefix("GCC")                              // 改成 GCC (Go Cloud Compute) 避免和 Storage 冲突
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_")) // server.port -> GCC_SERVER_PORT
 	viper.AutomaticEnv()
+	// 兼容早期部署用的 DB_HOST / DB_USER / DB_PASS
+	viper.BindEnv("database.host", "GCC_DATABASE_HOST", "DB_HOST")
+	viper.BindEnv("database.user", "GCC_DATABASE_USER", "DB_USER")
+	viper.BindEnv("database.password", "GCC_DATABASE_PASSWORD", "DB_PASS")
 
 	// 读取配置
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			log.Println("Warning: Config file not found, using default values or environment variables.")
+			slog.Warn("未找到配置文件，使用默认值和环境变量")
 		} else {
-			log.Fatalf("Error reading config file: %s", err)
+			slog.Error("读取配置文件失败", "err", err)
+			os.Exit(1)
 		}
 	}
 
 	// 解析到全局变量
 	if err := viper.Unmarshal(&GlobalConfig); err != nil {
-		log.Fatalf("Unable to decode into struct: %v", err)
+		slog.Error("解析配置失败", "err", err)
+		os.Exit(1)
 	}
 
-	log.Println("Config loaded successfully")
+	slog.Info("配置加载完成", "file", viper.ConfigFileUsed())
 }
@@ -0,0 +1,369 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 表结构由 migrations/<方言>/ 下带编号的 SQL 文件管理，不再使用 AutoMigrate：
+//   - 文件名为 NNNN_名称.up.sql / NNNN_名称.down.sql，编号递增，发布后不能再修改
+//   - MySQL 和 SQLite 的 DDL 写法不同，每个版本两种方言各写一份
+//   - 语句之间用行尾的 ";" 分隔，"--" 开头的行是注释
+//   - MySQL 的 DDL 不能回滚，一个版本执行到一半失败时需要手工处理，所以每个版本尽量小、能重复执行
+// 修改 internal/server 里的模型字段时，要同时新增一个迁移版本
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// schemaTable 记录已经执行过的迁移版本
+const schemaTable = "schema_migrations"
+
+// ErrSchemaTooNew 数据库已经被更新版本的 Server 迁移过，当前版本不认识其中的表结构
+var ErrSchemaTooNew = errors.New("database schema is newer than this server")
+
+// ErrLegacySchema 库里的表是没有版本记录的旧 AutoMigrate 建的，但字段比基线多，
+// 无法判断执行到了哪个版本，不能直接纳入版本管理
+var ErrLegacySchema = errors.New("database has tables created by AutoMigrate that do not match the baseline schema")
+
+// baselineColumns 0001 基线里各表的字段，用来识别引入版本化迁移之前 AutoMigrate 建的表
+var baselineColumns = map[string][]string{
+	"tasks":        {"id", "target", "status", "result", "created_at", "updated_at", "deleted_at", "cpu_usage", "mem_usage", "ai_advice"},
+	"agent_models": {"id", "created_at", "updated_at", "deleted_at", "agent_id", "hostname", "ip", "status"},
+	"job_records":  {"id", "created_at", "updated_at", "deleted_at", "job_id", "agent_id", "type", "result", "payload", "status", "executed_at"},
+}
+
+// Migration 一个版本的表结构变更
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string // 为空表示不能回滚
+}
+
+// MigrationStatus 一个版本的执行情况
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time // 为空表示还没执行
+	Unknown   bool       // 库里有记录，但当前版本的 Server 里没有这个迁移 (被更新的版本执行过)
+}
+
+type schemaMigration struct {
+	Version   int64
+	Name      string
+	AppliedAt time.Time
+}
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migrator 执行某个数据库方言的迁移
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration // 按版本升序
+}
+
+// NewMigrator 加载内置的迁移文件，方言由 db 的驱动决定
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := "migrations/" + dialect
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for database dialect %q", dialect)
+	}
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file %s/%s", dir, e.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		body, err := fs.ReadFile(migrationFiles, dir+"/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migrations, nil
+}
+
+// Latest 当前版本的 Server 认识的最新表结构版本
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version 数据库当前的表结构版本，没有执行过迁移时为 0
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	applied, err := m.applied(m.db.WithContext(ctx))
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+// Status 所有版本的执行情况，按版本升序
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int64]schemaMigration, len(applied))
+	for _, a := range applied {
+		done[a.Version] = a
+	}
+	var out []MigrationStatus
+	for _, mig := range m.migrations {
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if a, ok := done[mig.Version]; ok {
+			s.AppliedAt = &a.AppliedAt
+			delete(done, mig.Version)
+		}
+		out = append(out, s)
+	}
+	for _, a := range applied {
+		if _, ok := done[a.Version]; ok {
+			out = append(out, MigrationStatus{Version: a.Version, Name: a.Name, AppliedAt: &a.AppliedAt, Unknown: true})
+		}
+	}
+	slices.SortFunc(out, func(a, b MigrationStatus) int { return cmp.Compare(a.Version, b.Version) })
+	return out, nil
+}
+
+// Up 依次执行还没执行过的迁移，直到 target 版本 (0 表示最新)，返回这次执行的迁移
+func (m *Migrator) Up(ctx context.Context, target int64) ([]Migration, error) {
+	if target == 0 {
+		target = m.Latest()
+	}
+	var done []Migration
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		if err := m.checkNotNewer(db); err != nil {
+			return err
+		}
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			if err := checkBaseline(db); err != nil {
+				return err
+			}
+		}
+		for _, mig := range m.migrations {
+			if mig.Version > target {
+				break
+			}
+			if slices.ContainsFunc(applied, func(a schemaMigration) bool { return a.Version == mig.Version }) {
+				continue
+			}
+			if err := m.run(db, mig, true); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down 从最新的版本开始回滚 steps 个迁移，返回这次回滚的迁移
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		if err := m.checkNotNewer(db); err != nil {
+			return err
+		}
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		for i := len(applied) - 1; i >= 0 && len(done) < steps; i-- {
+			idx := slices.IndexFunc(m.migrations, func(mig Migration) bool { return mig.Version == applied[i].Version })
+			mig := m.migrations[idx]
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d_%s cannot be rolled back (no down script)", mig.Version, mig.Name)
+			}
+			if err := m.run(db, mig, false); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Prepare 启动时检查表结构：比当前版本新时拒绝启动；有没执行的迁移时，
+// auto 为 true 就直接执行，否则报错，需要先运行 server migrate up
+func (m *Migrator) Prepare(ctx context.Context, auto bool) ([]Migration, error) {
+	if err := m.checkNotNewer(m.db.WithContext(ctx)); err != nil {
+		return nil, err
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending := 0
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending == 0 {
+		return nil, nil
+	}
+	if !auto {
+		return nil, fmt.Errorf("%d pending schema migrations (latest is %d): run `server migrate up` first", pending, m.Latest())
+	}
+	return m.Up(ctx, 0)
+}
+
+// checkNotNewer 库里有当前版本不认识的迁移记录时返回 ErrSchemaTooNew
+func (m *Migrator) checkNotNewer(db *gorm.DB) error {
+	applied, err := m.applied(db)
+	if err != nil {
+		return err
+	}
+	for _, a := range applied {
+		if !slices.ContainsFunc(m.migrations, func(mig Migration) bool { return mig.Version == a.Version }) {
+			return fmt.Errorf("%w: schema has migration %d_%s, this server knows up to %d", ErrSchemaTooNew, a.Version, a.Name, m.Latest())
+		}
+	}
+	return nil
+}
+
+// checkBaseline 没有任何版本记录时检查库里已有的表：旧版本 AutoMigrate 建的基线表可以直接纳入版本管理，
+// 字段比基线多说明是中间某个构建 AutoMigrate 出来的，0001 会把它标记为已执行而后续的 ALTER 又会冲突，直接拒绝
+func checkBaseline(db *gorm.DB) error {
+	migrator := db.Session(&gorm.Session{NewDB: true}).Migrator()
+	for _, table := range slices.Sorted(maps.Keys(baselineColumns)) {
+		if !migrator.HasTable(table) {
+			continue
+		}
+		columns, err := migrator.ColumnTypes(table)
+		if err != nil {
+			return fmt.Errorf("inspect %s: %w", table, err)
+		}
+		for _, c := range columns {
+			if !slices.Contains(baselineColumns[table], c.Name()) {
+				return fmt.Errorf("%w: %s.%s is not in the baseline, migrate this database by hand or restore it from a backup", ErrLegacySchema, table, c.Name())
+			}
+		}
+	}
+	return nil
+}
+
+// applied 已经执行过的迁移，按版本升序；版本表不存在时先创建
+func (m *Migrator) applied(db *gorm.DB) ([]schemaMigration, error) {
+	err := db.Exec("CREATE TABLE IF NOT EXISTS " + schemaTable + " (" +
+		"version BIGINT NOT NULL PRIMARY KEY, " +
+		"name VARCHAR(255) NOT NULL, " +
+		"applied_at DATETIME NOT NULL)").Error
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %w", schemaTable, err)
+	}
+	var rows []schemaMigration
+	err = db.Table(schemaTable).Order("version").Find(&rows).Error
+	return rows, err
+}
+
+// run 执行一个迁移的 up 或 down 脚本，并更新版本表
+// SQLite 的 DDL 可以回滚，整个版本在一个事务里；MySQL 的 DDL 会隐式提交，事务只保证版本表的记录
+func (m *Migrator) run(db *gorm.DB, mig Migration, up bool) error {
+	script, direction := mig.Up, "up"
+	if !up {
+		script, direction = mig.Down, "down"
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range splitStatements(script) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("migration %d_%s %s: %w", mig.Version, mig.Name, direction, err)
+			}
+		}
+		if up {
+			return tx.Table(schemaTable).Create(&schemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+		}
+		return tx.Exec("DELETE FROM "+schemaTable+" WHERE version = ?", mig.Version).Error
+	})
+}
+
+// locked 在同一个数据库连接上执行 fn；MySQL 上先拿到命名锁，多个 Server 实例同时启动时只有一个在执行迁移
+func (m *Migrator) locked(ctx context.Context, fn func(db *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if conn.Dialector.Name() != DriverMySQL {
+			return fn(conn)
+		}
+		var got int
+		if err := conn.Raw("SELECT GET_LOCK(?, 60)", schemaTable).Scan(&got).Error; err != nil {
+			return err
+		}
+		if got != 1 {
+			return errors.New("timed out waiting for the schema migration lock")
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(?)", schemaTable)
+		return fn(conn)
+	})
+}
+
+// splitStatements 按行尾的 ";" 把脚本拆成单条语句，去掉 "--" 注释行
+// MySQL 驱动默认不允许一次执行多条语句
+func splitStatements(script string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteByte('\n')
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		}
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
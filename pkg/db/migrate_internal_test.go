@@ -0,0 +1,56 @@
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- 注释
+CREATE TABLE a (
+    id INTEGER,
+    name TEXT
+);
+
+  -- 缩进的注释
+CREATE INDEX idx_a ON a (name);
+DROP TABLE b`
+	want := []string{
+		"CREATE TABLE a (\n    id INTEGER,\n    name TEXT\n);",
+		"CREATE INDEX idx_a ON a (name);",
+		"DROP TABLE b",
+	}
+	if got := splitStatements(script); !slices.Equal(got, want) {
+		t.Errorf("splitStatements = %q, want %q", got, want)
+	}
+	if got := splitStatements("-- only comments\n\n"); len(got) != 0 {
+		t.Errorf("comments only = %q", got)
+	}
+}
+
+// 两种方言的迁移版本要一一对应，每个版本都能回滚
+func TestLoadMigrationsDialectsMatch(t *testing.T) {
+	if _, err := loadMigrations("postgres"); err == nil {
+		t.Error("loaded migrations for an unknown dialect")
+	}
+
+	versions := map[string][]string{}
+	for _, dialect := range []string{"mysql", "sqlite"} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, m := range migrations {
+			if m.Version != int64(i+1) {
+				t.Errorf("%s: migration %d has version %d, want contiguous versions from 1", dialect, i, m.Version)
+			}
+			if m.Down == "" || len(splitStatements(m.Up)) == 0 {
+				t.Errorf("%s: migration %d_%s has an empty up or down script", dialect, m.Version, m.Name)
+			}
+			versions[dialect] = append(versions[dialect], m.Name)
+		}
+	}
+	if !slices.Equal(versions["mysql"], versions["sqlite"]) {
+		t.Errorf("mysql migrations %v, sqlite %v", versions["mysql"], versions["sqlite"])
+	}
+}
@@ -0,0 +1,284 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/stywzn/Go-Cloud-Compute/internal/model"
+	"github.com/stywzn/Go-Cloud-Compute/internal/server"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+	gcdb "github.com/stywzn/Go-Cloud-Compute/pkg/db"
+)
+
+// legacyAgent / legacyJob 引入版本化迁移之前的模型，旧版本启动时用它们 AutoMigrate
+type legacyAgent struct {
+	gorm.Model
+	AgentID  string `gorm:"uniqueIndex;size:191"`
+	Hostname string
+	IP       string
+	Status   string
+}
+
+func (legacyAgent) TableName() string { return "agent_models" }
+
+type legacyJob struct {
+	gorm.Model
+	JobID      string `gorm:"uniqueIndex;size:191"`
+	AgentID    string `gorm:"index;size:191"`
+	Type       string
+	Result     string
+	Payload    string
+	Status     string
+	ExecutedAt time.Time
+}
+
+func (legacyJob) TableName() string { return "job_records" }
+
+// currentModels 当前版本的全部模型，迁移到最新版本后表结构要和它们 AutoMigrate 出来的一致
+var currentModels = []any{
+	&model.Task{}, &server.AgentModel{}, &server.JobRecord{}, &server.BatchRecord{},
+	&server.OutboxMessage{}, &server.AgentProfile{}, &server.ArtifactRecord{},
+	&server.FileRecord{}, &server.SecretRecord{}, &server.AuditRecord{},
+	&server.WebhookSubscription{}, &server.WebhookDelivery{}, &server.EventRecord{},
+}
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gcdb.Open(config.DatabaseConfig{Driver: gcdb.DriverSQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// schema 库里每张业务表的字段和索引名，排序后便于比较
+func schema(t *testing.T, db *gorm.DB) map[string][]string {
+	t.Helper()
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := map[string][]string{}
+	for _, table := range tables {
+		if table == "schema_migrations" || table == "sqlite_sequence" {
+			continue
+		}
+		columns, err := db.Migrator().ColumnTypes(table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, c := range columns {
+			names = append(names, c.Name())
+		}
+		indexes, err := db.Migrator().GetIndexes(table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, idx := range indexes {
+			names = append(names, "index:"+idx.Name())
+		}
+		slices.Sort(names)
+		out[table] = names
+	}
+	return out
+}
+
+func assertSchema(t *testing.T, got, want map[string][]string) {
+	t.Helper()
+	for table, columns := range want {
+		if !slices.Equal(got[table], columns) {
+			t.Errorf("table %s:\n got %v\nwant %v", table, got[table], columns)
+		}
+	}
+	for table := range got {
+		if _, ok := want[table]; !ok {
+			t.Errorf("unexpected table %s", table)
+		}
+	}
+}
+
+func TestMigrateLegacyDatabaseUpAndDown(t *testing.T) {
+	ctx := context.Background()
+
+	baselineDB := openSQLite(t)
+	if err := baselineDB.AutoMigrate(&model.Task{}, &legacyAgent{}, &legacyJob{}); err != nil {
+		t.Fatal(err)
+	}
+	baseline := schema(t, baselineDB)
+	currentDB := openSQLite(t)
+	if err := currentDB.AutoMigrate(currentModels...); err != nil {
+		t.Fatal(err)
+	}
+	current := schema(t, currentDB)
+
+	// 旧版本 AutoMigrate 建的库，里面已经有数据
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&model.Task{}, &legacyAgent{}, &legacyJob{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&legacyJob{JobID: "j1", AgentID: "a1", Status: "Success"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := gcdb.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := m.Prepare(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 3 {
+		t.Fatalf("applied %d migrations, want 3", len(applied))
+	}
+	assertSchema(t, schema(t, db), current)
+
+	var job server.JobRecord
+	if err := db.Where("job_id = ?", "j1").First(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	if job.AgentID != "a1" || job.Status != "Success" {
+		t.Fatalf("legacy row changed: %+v", job)
+	}
+
+	// 回滚到基线：新增的表和字段都删掉，原有数据保留
+	if _, err := m.Down(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	assertSchema(t, schema(t, db), baseline)
+	if v, _ := m.Version(ctx); v != 1 {
+		t.Fatalf("version after down = %d, want 1", v)
+	}
+	var count int64
+	db.Table("job_records").Where("job_id = ?", "j1").Count(&count)
+	if count != 1 {
+		t.Fatalf("legacy row lost after down")
+	}
+
+	// 可以重新升级
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	assertSchema(t, schema(t, db), current)
+
+	if _, err := m.Down(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	assertSchema(t, schema(t, db), map[string][]string{})
+}
+
+func TestMigrateEmptyDatabaseMatchesModels(t *testing.T) {
+	currentDB := openSQLite(t)
+	if err := currentDB.AutoMigrate(currentModels...); err != nil {
+		t.Fatal(err)
+	}
+
+	db := openSQLite(t)
+	m, err := gcdb.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	assertSchema(t, schema(t, db), schema(t, currentDB))
+}
+
+func TestMigrateRejectsUnversionedNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	// 引入版本化迁移之前、字段已经比基线多的中间构建 AutoMigrate 出来的库
+	db := openSQLite(t)
+	if err := db.AutoMigrate(&legacyAgent{}, &server.JobRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := gcdb.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Prepare(ctx, true); !errors.Is(err, gcdb.ErrLegacySchema) {
+		t.Fatalf("Prepare err = %v, want ErrLegacySchema", err)
+	}
+	if v, err := m.Version(ctx); err != nil || v != 0 {
+		t.Fatalf("version = %d, %v; nothing should be stamped", v, err)
+	}
+}
+
+func TestMigrateRejectsNewerVersion(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	m, err := gcdb.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Latest()+1, "future", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Prepare(ctx, true); !errors.Is(err, gcdb.ErrSchemaTooNew) {
+		t.Fatalf("Prepare err = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestMigrateStatusAndTarget(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	m, err := gcdb.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不自动迁移时，有待执行的版本就拒绝启动
+	if _, err := m.Prepare(ctx, false); err == nil {
+		t.Fatal("Prepare without auto succeeded on an empty database")
+	}
+
+	if applied, err := m.Up(ctx, 2); err != nil || len(applied) != 2 {
+		t.Fatalf("Up(2) = %d migrations, %v", len(applied), err)
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 3 || status[0].AppliedAt == nil || status[1].AppliedAt == nil || status[2].AppliedAt != nil {
+		t.Fatalf("status after Up(2) = %+v", status)
+	}
+	if _, err := m.Prepare(ctx, false); err == nil {
+		t.Error("Prepare without auto succeeded with a pending migration")
+	}
+
+	if applied, err := m.Up(ctx, 0); err != nil || len(applied) != 1 || applied[0].Version != 3 {
+		t.Fatalf("Up(0) = %+v, %v; want only version 3", applied, err)
+	}
+	if applied, err := m.Prepare(ctx, false); err != nil || len(applied) != 0 {
+		t.Fatalf("Prepare on an up-to-date schema = %+v, %v", applied, err)
+	}
+
+	// 更新版本执行过的迁移在 status 里标为 unknown
+	if err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Latest()+1, "future", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	status, err = m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := status[len(status)-1]; len(status) != 4 || !last.Unknown || last.Name != "future" {
+		t.Errorf("status = %+v", status)
+	}
+	if _, err := m.Down(ctx, 1); !errors.Is(err, gcdb.ErrSchemaTooNew) {
+		t.Errorf("Down err = %v, want ErrSchemaTooNew", err)
+	}
+}
@@ -0,0 +1,4 @@
+-- 删除基线表，数据不可恢复
+DROP TABLE IF EXISTS `job_records`;
+DROP TABLE IF EXISTS `agent_models`;
+DROP TABLE IF EXISTS `tasks`;
@@ -0,0 +1,50 @@
+-- 基线：引入版本化迁移之前 AutoMigrate 建出来的表结构，只包含当时的字段。
+-- 全部用 IF NOT EXISTS，已经由旧版本 AutoMigrate 建好表的库执行后直接纳入版本管理，
+-- 之后新增的字段和表由 0002 之后的迁移补上。
+
+CREATE TABLE IF NOT EXISTS `tasks` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `target` longtext,
+    `status` longtext,
+    `result` longtext,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `cpu_usage` double,
+    `mem_usage` double,
+    `ai_advice` text,
+    PRIMARY KEY (`id`),
+    INDEX `idx_tasks_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `agent_models` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `agent_id` varchar(191),
+    `hostname` longtext,
+    `ip` longtext,
+    `status` longtext,
+    PRIMARY KEY (`id`),
+    INDEX `idx_agent_models_deleted_at` (`deleted_at`),
+    UNIQUE INDEX `idx_agent_models_agent_id` (`agent_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `job_records` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `job_id` varchar(191),
+    `agent_id` varchar(191),
+    `type` longtext,
+    `result` longtext,
+    `payload` longtext,
+    `status` longtext,
+    `executed_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_job_records_deleted_at` (`deleted_at`),
+    UNIQUE INDEX `idx_job_records_job_id` (`job_id`),
+    INDEX `idx_job_records_agent_id` (`agent_id`)
+);
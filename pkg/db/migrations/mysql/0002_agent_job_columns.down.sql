@@ -0,0 +1,55 @@
+-- 删除新增的字段，字段里的数据不可恢复
+ALTER TABLE `job_records`
+    DROP INDEX `idx_job_records_batch_id`,
+    DROP INDEX `idx_job_records_trace_id`,
+    DROP INDEX `idx_job_records_request_id`,
+    DROP INDEX `idx_job_records_status`,
+    DROP INDEX `idx_job_records_run_at`,
+    DROP INDEX `idx_job_records_archived_at`,
+    DROP COLUMN `batch_id`,
+    DROP COLUMN `target`,
+    DROP COLUMN `selector`,
+    DROP COLUMN `artifacts`,
+    DROP COLUMN `files`,
+    DROP COLUMN `env`,
+    DROP COLUMN `workdir`,
+    DROP COLUMN `run_as`,
+    DROP COLUMN `secrets`,
+    DROP COLUMN `trace_id`,
+    DROP COLUMN `request_id`,
+    DROP COLUMN `trace_parent`,
+    DROP COLUMN `run_at`,
+    DROP COLUMN `started_at`,
+    DROP COLUMN `delivered_at`,
+    DROP COLUMN `delivery_attempts`,
+    DROP COLUMN `accepted_at`,
+    DROP COLUMN `archived_at`,
+    DROP COLUMN `archive_file`,
+    DROP COLUMN `archive_offset`,
+    DROP COLUMN `archive_size`,
+    MODIFY COLUMN `status` longtext;
+
+ALTER TABLE `agent_models`
+    DROP INDEX `idx_agent_models_last_seen_at`,
+    DROP COLUMN `drain`,
+    DROP COLUMN `tags`,
+    DROP COLUMN `os`,
+    DROP COLUMN `arch`,
+    DROP COLUMN `kernel`,
+    DROP COLUMN `agent_version`,
+    DROP COLUMN `capabilities`,
+    DROP COLUMN `ips`,
+    DROP COLUMN `os_release`,
+    DROP COLUMN `cpu_count`,
+    DROP COLUMN `cpu_model`,
+    DROP COLUMN `memory_total`,
+    DROP COLUMN `disk_total`,
+    DROP COLUMN `disk_free`,
+    DROP COLUMN `build_commit`,
+    DROP COLUMN `container`,
+    DROP COLUMN `hypervisor`,
+    DROP COLUMN `running_jobs`,
+    DROP COLUMN `max_jobs`,
+    DROP COLUMN `config_version`,
+    DROP COLUMN `last_seen_at`,
+    DROP COLUMN `lost_at`;
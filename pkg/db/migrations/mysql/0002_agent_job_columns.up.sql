@@ -0,0 +1,58 @@
+-- Agent 资产信息、排空、调度、批量、追踪、归档等功能在基线表上新增的字段和索引。
+-- 每张表只用一条 ALTER TABLE，InnoDB 上单条 DDL 要么全部生效要么不生效。
+
+ALTER TABLE `agent_models`
+    ADD COLUMN `drain` boolean,
+    ADD COLUMN `tags` varchar(1024),
+    ADD COLUMN `os` varchar(64),
+    ADD COLUMN `arch` varchar(64),
+    ADD COLUMN `kernel` varchar(191),
+    ADD COLUMN `agent_version` varchar(64),
+    ADD COLUMN `capabilities` varchar(512),
+    ADD COLUMN `ips` varchar(1024),
+    ADD COLUMN `os_release` varchar(191),
+    ADD COLUMN `cpu_count` bigint,
+    ADD COLUMN `cpu_model` varchar(191),
+    ADD COLUMN `memory_total` bigint,
+    ADD COLUMN `disk_total` bigint,
+    ADD COLUMN `disk_free` bigint,
+    ADD COLUMN `build_commit` varchar(64),
+    ADD COLUMN `container` varchar(32),
+    ADD COLUMN `hypervisor` varchar(32),
+    ADD COLUMN `running_jobs` bigint,
+    ADD COLUMN `max_jobs` bigint,
+    ADD COLUMN `config_version` varchar(255),
+    ADD COLUMN `last_seen_at` datetime(3) NULL,
+    ADD COLUMN `lost_at` datetime(3) NULL,
+    ADD INDEX `idx_agent_models_last_seen_at` (`last_seen_at`);
+
+-- status 原来是 longtext，不能建索引，先改成 varchar
+ALTER TABLE `job_records`
+    MODIFY COLUMN `status` varchar(32),
+    ADD COLUMN `batch_id` varchar(191),
+    ADD COLUMN `target` varchar(255),
+    ADD COLUMN `selector` varchar(1024),
+    ADD COLUMN `artifacts` varchar(1024),
+    ADD COLUMN `files` text,
+    ADD COLUMN `env` text,
+    ADD COLUMN `workdir` varchar(255),
+    ADD COLUMN `run_as` varchar(64),
+    ADD COLUMN `secrets` varchar(2048),
+    ADD COLUMN `trace_id` varchar(32),
+    ADD COLUMN `request_id` varchar(64),
+    ADD COLUMN `trace_parent` varchar(64),
+    ADD COLUMN `run_at` datetime(3) NULL,
+    ADD COLUMN `started_at` datetime(3) NULL,
+    ADD COLUMN `delivered_at` datetime(3) NULL,
+    ADD COLUMN `delivery_attempts` bigint,
+    ADD COLUMN `accepted_at` datetime(3) NULL,
+    ADD COLUMN `archived_at` datetime(3) NULL,
+    ADD COLUMN `archive_file` varchar(255),
+    ADD COLUMN `archive_offset` bigint,
+    ADD COLUMN `archive_size` bigint,
+    ADD INDEX `idx_job_records_batch_id` (`batch_id`),
+    ADD INDEX `idx_job_records_trace_id` (`trace_id`),
+    ADD INDEX `idx_job_records_request_id` (`request_id`),
+    ADD INDEX `idx_job_records_status` (`status`),
+    ADD INDEX `idx_job_records_run_at` (`run_at`),
+    ADD INDEX `idx_job_records_archived_at` (`archived_at`);
@@ -0,0 +1,11 @@
+-- 删除新增的表，数据不可恢复
+DROP TABLE IF EXISTS `event_records`;
+DROP TABLE IF EXISTS `webhook_deliveries`;
+DROP TABLE IF EXISTS `webhook_subscriptions`;
+DROP TABLE IF EXISTS `audit_records`;
+DROP TABLE IF EXISTS `secret_records`;
+DROP TABLE IF EXISTS `file_records`;
+DROP TABLE IF EXISTS `artifact_records`;
+DROP TABLE IF EXISTS `agent_profiles`;
+DROP TABLE IF EXISTS `outbox_messages`;
+DROP TABLE IF EXISTS `batch_records`;
@@ -0,0 +1,171 @@
+-- 调度、批量、出站消息、Webhook、审计等功能新增的表
+
+CREATE TABLE IF NOT EXISTS `batch_records` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `batch_id` varchar(191),
+    `type` longtext,
+    `template` longtext,
+    `total` bigint,
+    `completed_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_batch_records_deleted_at` (`deleted_at`),
+    UNIQUE INDEX `idx_batch_records_batch_id` (`batch_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `outbox_messages` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `job_id` varchar(191),
+    `body` text,
+    `status` varchar(16),
+    `next_attempt_at` datetime(3) NULL,
+    `attempts` bigint,
+    `last_error` varchar(512),
+    `sent_at` datetime(3) NULL,
+    `trace_parent` varchar(64),
+    PRIMARY KEY (`id`),
+    INDEX `idx_outbox_messages_deleted_at` (`deleted_at`),
+    INDEX `idx_outbox_messages_job_id` (`job_id`),
+    INDEX `idx_outbox_pending` (`status`,`next_attempt_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `agent_profiles` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `name` varchar(191),
+    `tag` varchar(191),
+    `priority` bigint,
+    `revision` bigint,
+    `heartbeat_interval` bigint,
+    `max_concurrent_jobs` bigint,
+    `allowed_executors` varchar(255),
+    `deny_patterns` text,
+    `log_level` varchar(16),
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_agent_profiles_name` (`name`)
+);
+
+CREATE TABLE IF NOT EXISTS `artifact_records` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `job_id` varchar(191),
+    `name` varchar(255),
+    `agent_id` varchar(191),
+    `size` bigint,
+    `sha256` varchar(64),
+    `storage_key` varchar(512),
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_artifact_job_name` (`job_id`,`name`)
+);
+
+CREATE TABLE IF NOT EXISTS `file_records` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `file_id` varchar(191),
+    `name` varchar(255),
+    `size` bigint,
+    `sha256` varchar(64),
+    `storage_key` varchar(512),
+    PRIMARY KEY (`id`),
+    INDEX `idx_file_records_deleted_at` (`deleted_at`),
+    UNIQUE INDEX `idx_file_records_file_id` (`file_id`),
+    INDEX `idx_file_records_sha256` (`sha256`)
+);
+
+CREATE TABLE IF NOT EXISTS `secret_records` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `namespace` varchar(64),
+    `name` varchar(64),
+    `value` longblob,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE INDEX `idx_secret_ns_name` (`namespace`,`name`)
+);
+
+CREATE TABLE IF NOT EXISTS `audit_records` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `actor` varchar(128),
+    `source_ip` varchar(64),
+    `forwarded_for` varchar(255),
+    `action` varchar(64),
+    `target` varchar(255),
+    `method` varchar(8),
+    `path` varchar(255),
+    `payload_sha256` varchar(64),
+    `status` bigint,
+    `outcome` varchar(16),
+    `detail` text,
+    `request_id` varchar(64),
+    PRIMARY KEY (`id`),
+    INDEX `idx_audit_records_created_at` (`created_at`),
+    INDEX `idx_audit_records_actor` (`actor`),
+    INDEX `idx_audit_records_action` (`action`),
+    INDEX `idx_audit_records_target` (`target`),
+    INDEX `idx_audit_records_outcome` (`outcome`),
+    INDEX `idx_audit_records_request_id` (`request_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_subscriptions` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `webhook_id` varchar(64),
+    `url` varchar(1024),
+    `events` varchar(512),
+    `secret_ref` varchar(130),
+    `description` varchar(255),
+    `enabled` boolean,
+    PRIMARY KEY (`id`),
+    INDEX `idx_webhook_subscriptions_deleted_at` (`deleted_at`),
+    UNIQUE INDEX `idx_webhook_subscriptions_webhook_id` (`webhook_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `updated_at` datetime(3) NULL,
+    `deleted_at` datetime(3) NULL,
+    `delivery_id` varchar(64),
+    `webhook_id` varchar(64),
+    `event_id` varchar(64),
+    `event` varchar(64),
+    `payload` text,
+    `status` varchar(16),
+    `next_attempt_at` datetime(3) NULL,
+    `attempts` bigint,
+    `last_status_code` bigint,
+    `last_error` varchar(512),
+    `last_response` varchar(512),
+    `delivered_at` datetime(3) NULL,
+    PRIMARY KEY (`id`),
+    INDEX `idx_webhook_deliveries_deleted_at` (`deleted_at`),
+    UNIQUE INDEX `idx_webhook_deliveries_delivery_id` (`delivery_id`),
+    INDEX `idx_webhook_deliveries_webhook_id` (`webhook_id`),
+    INDEX `idx_webhook_deliveries_event_id` (`event_id`),
+    INDEX `idx_webhook_pending` (`status`,`next_attempt_at`)
+);
+
+CREATE TABLE IF NOT EXISTS `event_records` (
+    `id` bigint unsigned AUTO_INCREMENT,
+    `created_at` datetime(3) NULL,
+    `type` varchar(64),
+    `subject` varchar(191),
+    `request_id` varchar(64),
+    `data` text,
+    PRIMARY KEY (`id`),
+    INDEX `idx_event_records_created_at` (`created_at`),
+    INDEX `idx_event_records_type` (`type`),
+    INDEX `idx_event_records_subject` (`subject`)
+);
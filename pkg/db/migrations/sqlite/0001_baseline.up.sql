@@ -0,0 +1,47 @@
+-- 基线：引入版本化迁移之前 AutoMigrate 建出来的表结构，只包含当时的字段。
+-- 全部用 IF NOT EXISTS，已经由旧版本 AutoMigrate 建好表的库执行后直接纳入版本管理，
+-- 之后新增的字段和表由 0002 之后的迁移补上。
+
+CREATE TABLE IF NOT EXISTS `tasks` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `target` text,
+    `status` text,
+    `result` text,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `cpu_usage` real,
+    `mem_usage` real,
+    `ai_advice` text
+);
+CREATE INDEX IF NOT EXISTS `idx_tasks_deleted_at` ON `tasks`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `agent_models` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `agent_id` text,
+    `hostname` text,
+    `ip` text,
+    `status` text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_agent_models_agent_id` ON `agent_models`(`agent_id`);
+CREATE INDEX IF NOT EXISTS `idx_agent_models_deleted_at` ON `agent_models`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `job_records` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `job_id` text,
+    `agent_id` text,
+    `type` text,
+    `result` text,
+    `payload` text,
+    `status` text,
+    `executed_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_job_records_agent_id` ON `job_records`(`agent_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_job_records_job_id` ON `job_records`(`job_id`);
+CREATE INDEX IF NOT EXISTS `idx_job_records_deleted_at` ON `job_records`(`deleted_at`);
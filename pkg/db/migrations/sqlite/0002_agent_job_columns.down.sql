@@ -0,0 +1,53 @@
+-- 删除新增的字段，字段里的数据不可恢复；SQLite 删除字段前要先删掉它上面的索引
+
+DROP INDEX IF EXISTS `idx_job_records_batch_id`;
+DROP INDEX IF EXISTS `idx_job_records_trace_id`;
+DROP INDEX IF EXISTS `idx_job_records_request_id`;
+DROP INDEX IF EXISTS `idx_job_records_status`;
+DROP INDEX IF EXISTS `idx_job_records_run_at`;
+DROP INDEX IF EXISTS `idx_job_records_archived_at`;
+ALTER TABLE `job_records` DROP COLUMN `batch_id`;
+ALTER TABLE `job_records` DROP COLUMN `target`;
+ALTER TABLE `job_records` DROP COLUMN `selector`;
+ALTER TABLE `job_records` DROP COLUMN `artifacts`;
+ALTER TABLE `job_records` DROP COLUMN `files`;
+ALTER TABLE `job_records` DROP COLUMN `env`;
+ALTER TABLE `job_records` DROP COLUMN `workdir`;
+ALTER TABLE `job_records` DROP COLUMN `run_as`;
+ALTER TABLE `job_records` DROP COLUMN `secrets`;
+ALTER TABLE `job_records` DROP COLUMN `trace_id`;
+ALTER TABLE `job_records` DROP COLUMN `request_id`;
+ALTER TABLE `job_records` DROP COLUMN `trace_parent`;
+ALTER TABLE `job_records` DROP COLUMN `run_at`;
+ALTER TABLE `job_records` DROP COLUMN `started_at`;
+ALTER TABLE `job_records` DROP COLUMN `delivered_at`;
+ALTER TABLE `job_records` DROP COLUMN `delivery_attempts`;
+ALTER TABLE `job_records` DROP COLUMN `accepted_at`;
+ALTER TABLE `job_records` DROP COLUMN `archived_at`;
+ALTER TABLE `job_records` DROP COLUMN `archive_file`;
+ALTER TABLE `job_records` DROP COLUMN `archive_offset`;
+ALTER TABLE `job_records` DROP COLUMN `archive_size`;
+
+DROP INDEX IF EXISTS `idx_agent_models_last_seen_at`;
+ALTER TABLE `agent_models` DROP COLUMN `drain`;
+ALTER TABLE `agent_models` DROP COLUMN `tags`;
+ALTER TABLE `agent_models` DROP COLUMN `os`;
+ALTER TABLE `agent_models` DROP COLUMN `arch`;
+ALTER TABLE `agent_models` DROP COLUMN `kernel`;
+ALTER TABLE `agent_models` DROP COLUMN `agent_version`;
+ALTER TABLE `agent_models` DROP COLUMN `capabilities`;
+ALTER TABLE `agent_models` DROP COLUMN `ips`;
+ALTER TABLE `agent_models` DROP COLUMN `os_release`;
+ALTER TABLE `agent_models` DROP COLUMN `cpu_count`;
+ALTER TABLE `agent_models` DROP COLUMN `cpu_model`;
+ALTER TABLE `agent_models` DROP COLUMN `memory_total`;
+ALTER TABLE `agent_models` DROP COLUMN `disk_total`;
+ALTER TABLE `agent_models` DROP COLUMN `disk_free`;
+ALTER TABLE `agent_models` DROP COLUMN `build_commit`;
+ALTER TABLE `agent_models` DROP COLUMN `container`;
+ALTER TABLE `agent_models` DROP COLUMN `hypervisor`;
+ALTER TABLE `agent_models` DROP COLUMN `running_jobs`;
+ALTER TABLE `agent_models` DROP COLUMN `max_jobs`;
+ALTER TABLE `agent_models` DROP COLUMN `config_version`;
+ALTER TABLE `agent_models` DROP COLUMN `last_seen_at`;
+ALTER TABLE `agent_models` DROP COLUMN `lost_at`;
@@ -0,0 +1,53 @@
+-- Agent 资产信息、排空、调度、批量、追踪、归档等功能在基线表上新增的字段和索引
+
+ALTER TABLE `agent_models` ADD COLUMN `drain` numeric;
+ALTER TABLE `agent_models` ADD COLUMN `tags` text;
+ALTER TABLE `agent_models` ADD COLUMN `os` text;
+ALTER TABLE `agent_models` ADD COLUMN `arch` text;
+ALTER TABLE `agent_models` ADD COLUMN `kernel` text;
+ALTER TABLE `agent_models` ADD COLUMN `agent_version` text;
+ALTER TABLE `agent_models` ADD COLUMN `capabilities` text;
+ALTER TABLE `agent_models` ADD COLUMN `ips` text;
+ALTER TABLE `agent_models` ADD COLUMN `os_release` text;
+ALTER TABLE `agent_models` ADD COLUMN `cpu_count` integer;
+ALTER TABLE `agent_models` ADD COLUMN `cpu_model` text;
+ALTER TABLE `agent_models` ADD COLUMN `memory_total` integer;
+ALTER TABLE `agent_models` ADD COLUMN `disk_total` integer;
+ALTER TABLE `agent_models` ADD COLUMN `disk_free` integer;
+ALTER TABLE `agent_models` ADD COLUMN `build_commit` text;
+ALTER TABLE `agent_models` ADD COLUMN `container` text;
+ALTER TABLE `agent_models` ADD COLUMN `hypervisor` text;
+ALTER TABLE `agent_models` ADD COLUMN `running_jobs` integer;
+ALTER TABLE `agent_models` ADD COLUMN `max_jobs` integer;
+ALTER TABLE `agent_models` ADD COLUMN `config_version` text;
+ALTER TABLE `agent_models` ADD COLUMN `last_seen_at` datetime;
+ALTER TABLE `agent_models` ADD COLUMN `lost_at` datetime;
+CREATE INDEX IF NOT EXISTS `idx_agent_models_last_seen_at` ON `agent_models`(`last_seen_at`);
+
+ALTER TABLE `job_records` ADD COLUMN `batch_id` text;
+ALTER TABLE `job_records` ADD COLUMN `target` text;
+ALTER TABLE `job_records` ADD COLUMN `selector` text;
+ALTER TABLE `job_records` ADD COLUMN `artifacts` text;
+ALTER TABLE `job_records` ADD COLUMN `files` text;
+ALTER TABLE `job_records` ADD COLUMN `env` text;
+ALTER TABLE `job_records` ADD COLUMN `workdir` text;
+ALTER TABLE `job_records` ADD COLUMN `run_as` text;
+ALTER TABLE `job_records` ADD COLUMN `secrets` text;
+ALTER TABLE `job_records` ADD COLUMN `trace_id` text;
+ALTER TABLE `job_records` ADD COLUMN `request_id` text;
+ALTER TABLE `job_records` ADD COLUMN `trace_parent` text;
+ALTER TABLE `job_records` ADD COLUMN `run_at` datetime;
+ALTER TABLE `job_records` ADD COLUMN `started_at` datetime;
+ALTER TABLE `job_records` ADD COLUMN `delivered_at` datetime;
+ALTER TABLE `job_records` ADD COLUMN `delivery_attempts` integer;
+ALTER TABLE `job_records` ADD COLUMN `accepted_at` datetime;
+ALTER TABLE `job_records` ADD COLUMN `archived_at` datetime;
+ALTER TABLE `job_records` ADD COLUMN `archive_file` text;
+ALTER TABLE `job_records` ADD COLUMN `archive_offset` integer;
+ALTER TABLE `job_records` ADD COLUMN `archive_size` integer;
+CREATE INDEX IF NOT EXISTS `idx_job_records_batch_id` ON `job_records`(`batch_id`);
+CREATE INDEX IF NOT EXISTS `idx_job_records_trace_id` ON `job_records`(`trace_id`);
+CREATE INDEX IF NOT EXISTS `idx_job_records_request_id` ON `job_records`(`request_id`);
+CREATE INDEX IF NOT EXISTS `idx_job_records_status` ON `job_records`(`status`);
+CREATE INDEX IF NOT EXISTS `idx_job_records_run_at` ON `job_records`(`run_at`);
+CREATE INDEX IF NOT EXISTS `idx_job_records_archived_at` ON `job_records`(`archived_at`);
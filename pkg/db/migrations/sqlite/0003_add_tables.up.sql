@@ -0,0 +1,161 @@
+-- 调度、批量、出站消息、Webhook、审计等功能新增的表
+
+CREATE TABLE IF NOT EXISTS `batch_records` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `batch_id` text,
+    `type` text,
+    `template` text,
+    `total` integer,
+    `completed_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_batch_records_batch_id` ON `batch_records`(`batch_id`);
+CREATE INDEX IF NOT EXISTS `idx_batch_records_deleted_at` ON `batch_records`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `outbox_messages` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `job_id` text,
+    `body` text,
+    `status` text,
+    `next_attempt_at` datetime,
+    `attempts` integer,
+    `last_error` text,
+    `sent_at` datetime,
+    `trace_parent` text
+);
+CREATE INDEX IF NOT EXISTS `idx_outbox_pending` ON `outbox_messages`(`status`,`next_attempt_at`);
+CREATE INDEX IF NOT EXISTS `idx_outbox_messages_job_id` ON `outbox_messages`(`job_id`);
+CREATE INDEX IF NOT EXISTS `idx_outbox_messages_deleted_at` ON `outbox_messages`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `agent_profiles` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `name` text,
+    `tag` text,
+    `priority` integer,
+    `revision` integer,
+    `heartbeat_interval` integer,
+    `max_concurrent_jobs` integer,
+    `allowed_executors` text,
+    `deny_patterns` text,
+    `log_level` text,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_agent_profiles_name` ON `agent_profiles`(`name`);
+
+CREATE TABLE IF NOT EXISTS `artifact_records` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `job_id` text,
+    `name` text,
+    `agent_id` text,
+    `size` integer,
+    `sha256` text,
+    `storage_key` text,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_artifact_job_name` ON `artifact_records`(`job_id`,`name`);
+
+CREATE TABLE IF NOT EXISTS `file_records` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `file_id` text,
+    `name` text,
+    `size` integer,
+    `sha256` text,
+    `storage_key` text
+);
+CREATE INDEX IF NOT EXISTS `idx_file_records_sha256` ON `file_records`(`sha256`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_file_records_file_id` ON `file_records`(`file_id`);
+CREATE INDEX IF NOT EXISTS `idx_file_records_deleted_at` ON `file_records`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `secret_records` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `namespace` text,
+    `name` text,
+    `value` blob,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_secret_ns_name` ON `secret_records`(`namespace`,`name`);
+
+CREATE TABLE IF NOT EXISTS `audit_records` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `actor` text,
+    `source_ip` text,
+    `forwarded_for` text,
+    `action` text,
+    `target` text,
+    `method` text,
+    `path` text,
+    `payload_sha256` text,
+    `status` integer,
+    `outcome` text,
+    `detail` text,
+    `request_id` text
+);
+CREATE INDEX IF NOT EXISTS `idx_audit_records_request_id` ON `audit_records`(`request_id`);
+CREATE INDEX IF NOT EXISTS `idx_audit_records_outcome` ON `audit_records`(`outcome`);
+CREATE INDEX IF NOT EXISTS `idx_audit_records_target` ON `audit_records`(`target`);
+CREATE INDEX IF NOT EXISTS `idx_audit_records_action` ON `audit_records`(`action`);
+CREATE INDEX IF NOT EXISTS `idx_audit_records_actor` ON `audit_records`(`actor`);
+CREATE INDEX IF NOT EXISTS `idx_audit_records_created_at` ON `audit_records`(`created_at`);
+
+CREATE TABLE IF NOT EXISTS `webhook_subscriptions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `webhook_id` text,
+    `url` text,
+    `events` text,
+    `secret_ref` text,
+    `description` text,
+    `enabled` numeric
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_webhook_subscriptions_webhook_id` ON `webhook_subscriptions`(`webhook_id`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_subscriptions_deleted_at` ON `webhook_subscriptions`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime,
+    `delivery_id` text,
+    `webhook_id` text,
+    `event_id` text,
+    `event` text,
+    `payload` text,
+    `status` text,
+    `next_attempt_at` datetime,
+    `attempts` integer,
+    `last_status_code` integer,
+    `last_error` text,
+    `last_response` text,
+    `delivered_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_webhook_pending` ON `webhook_deliveries`(`status`,`next_attempt_at`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_event_id` ON `webhook_deliveries`(`event_id`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_webhook_id` ON `webhook_deliveries`(`webhook_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_webhook_deliveries_delivery_id` ON `webhook_deliveries`(`delivery_id`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_deleted_at` ON `webhook_deliveries`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `event_records` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `created_at` datetime,
+    `type` text,
+    `subject` text,
+    `request_id` text,
+    `data` text
+);
+CREATE INDEX IF NOT EXISTS `idx_event_records_subject` ON `event_records`(`subject`);
+CREATE INDEX IF NOT EXISTS `idx_event_records_type` ON `event_records`(`type`);
+CREATE INDEX IF NOT EXISTS `idx_event_records_created_at` ON `event_records`(`created_at`);
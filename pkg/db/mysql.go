@@ -1,34 +1,34 @@
 package db
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
+	"os"
 
-	"github.com/stywzn/Go-Cloud-Compute/internal/model"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
 
-	"github.com/spf13/viper"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
 func Init() {
-	// 拼接 DSN (Data Source Name)
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		viper.GetString("database.user"),
-		viper.GetString("database.password"),
-		viper.GetString("database.host"),
-		viper.GetString("database.port"),
-		viper.GetString("database.dbname"),
-	)
-
 	var err error
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	DB, err = Open(config.GlobalConfig.Database)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		slog.Error("连接数据库失败", "err", err)
+		os.Exit(1)
 	}
 
-	DB.AutoMigrate(&model.Task{})
-	log.Println("Database connected and migrated.")
+	// 表结构 (包括 tasks 表) 由 migrations 下的版本化迁移管理，见 migrate.go
+	migrator, err := NewMigrator(DB)
+	if err != nil {
+		slog.Error("加载表结构迁移失败", "err", err)
+		os.Exit(1)
+	}
+	if _, err := migrator.Prepare(context.Background(), config.GlobalConfig.Database.AutoMigrate); err != nil {
+		slog.Error("表结构迁移失败", "err", err)
+		os.Exit(1)
+	}
+	slog.Info("数据库已连接并完成迁移")
 }
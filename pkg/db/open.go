@@ -0,0 +1,79 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// 支持的数据库驱动
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite" // 纯 Go 实现，不需要 cgo
+)
+
+// Open 按配置连接数据库
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	gormCfg := &gorm.Config{
+		// SQL 报错和慢查询也走结构化日志；查不到记录是正常的业务分支，不打印
+		Logger: gormlogger.NewSlogLogger(slog.Default(), gormlogger.Config{
+			SlowThreshold:             200 * time.Millisecond,
+			LogLevel:                  gormlogger.Warn,
+			IgnoreRecordNotFoundError: true,
+		}),
+	}
+
+	switch strings.ToLower(cfg.Driver) {
+	case "", DriverMySQL:
+		return gorm.Open(mysql.Open(mysqlDSN(cfg)), gormCfg)
+	case DriverSQLite:
+		return openSQLite(cfg.Path, gormCfg)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q (want mysql or sqlite)", cfg.Driver)
+	}
+}
+
+func mysqlDSN(cfg config.DatabaseConfig) string {
+	if cfg.DSN != "" {
+		return cfg.DSN
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
+}
+
+func openSQLite(path string, gormCfg *gorm.Config) (*gorm.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("database.path is required for the sqlite driver")
+	}
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	// busy_timeout：另一个连接在写时等一会儿，而不是直接报 database is locked
+	dsn := path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	if path != ":memory:" {
+		dsn += "&_pragma=journal_mode(WAL)"
+	}
+	db, err := gorm.Open(sqlite.Open(dsn), gormCfg)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	// SQLite 同一时间只有一个写者；只用一个连接，写操作在连接池里排队，
+	// 内存库也只有这样才能让所有查询看到同一个库
+	sqlDB.SetMaxOpenConns(1)
+	return db, nil
+}
@@ -2,7 +2,8 @@ package db
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -21,9 +22,10 @@ func InitRedis() {
 
 	_, err := RDB.Ping(context.Background()).Result()
 	if err != nil {
-		log.Fatal("Redis connect failed: %v", err)
+		slog.Error("连接 Redis 失败", "addr", cfg.Redis.Addr, "err", err)
+		os.Exit(1)
 	}
-	log.Println("Redis connected")
+	slog.Info("Redis 已连接", "addr", cfg.Redis.Addr)
 
 }
 
@@ -31,7 +33,7 @@ func LockTask(taskKey string, ttl time.Duration) bool {
 	ctx := context.Background()
 	success, err := RDB.SetNX(ctx, taskKey, "processing", ttl).Result()
 	if err != nil {
-		log.Printf("Redis error: %v", err)
+		slog.Warn("Redis 加锁失败", "key", taskKey, "err", err)
 		return false
 	}
 	return success
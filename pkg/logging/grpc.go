@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// MetadataKey 请求 ID 在 gRPC metadata 和 HTTP 头里的名字
+const MetadataKey = "x-request-id"
+
+// requestIDFromMetadata 调用方带了请求 ID 就沿用 (Agent 汇报任务时带的是提交任务时的 ID)，否则新生成一个
+func requestIDFromMetadata(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := ""
+	if v := md.Get(MetadataKey); len(v) > 0 && validRequestID(v[0]) {
+		id = v[0]
+	}
+	if id == "" {
+		id = NewRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, id))
+	return WithRequestID(ctx, id)
+}
+
+// UnaryServerInterceptor 为每次调用分配请求 ID
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(requestIDFromMetadata(ctx), req)
+}
+
+// StreamServerInterceptor 为每条流分配请求 ID (心跳流整条流共用一个)
+func StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: ss, ctx: requestIDFromMetadata(ss.Context())})
+}
+
+// UnaryClientInterceptor 把 ctx 里的请求 ID 传给 Server
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if id := RequestID(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, id)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// contextStream 替换 ServerStream 的 ctx
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// validRequestID 外部传入的请求 ID 会原样写进日志和数据库，限制长度和字符
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Agent 汇报时带的请求 ID 沿用，非法的换成新 ID
+func TestUnaryServerInterceptorRequestID(t *testing.T) {
+	var got string
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = RequestID(ctx)
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/m"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "req-1"))
+	UnaryServerInterceptor(ctx, nil, info, handler)
+	if got != "req-1" {
+		t.Errorf("request id = %q, want req-1", got)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "bad id!"))
+	UnaryServerInterceptor(ctx, nil, info, handler)
+	if got == "" || got == "bad id!" {
+		t.Errorf("invalid id: got %q, want a new one", got)
+	}
+
+	UnaryServerInterceptor(context.Background(), nil, info, handler)
+	if got == "" {
+		t.Error("no request id without metadata")
+	}
+}
+
+func TestUnaryClientInterceptorRequestID(t *testing.T) {
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	UnaryClientInterceptor(context.Background(), "/m", nil, nil, nil, invoker)
+	if len(sent.Get(MetadataKey)) != 0 {
+		t.Errorf("sent %v without a request id", sent)
+	}
+	UnaryClientInterceptor(WithRequestID(context.Background(), "req-1"), "/m", nil, nil, nil, invoker)
+	if v := sent.Get(MetadataKey); len(v) != 1 || v[0] != "req-1" {
+		t.Errorf("sent %v", sent)
+	}
+}
@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDFromHeader 调用方在 X-Request-ID 里带了合法的 ID 就沿用，否则新生成一个
+func RequestIDFromHeader(r *http.Request) string {
+	if id := r.Header.Get(MetadataKey); validRequestID(id) {
+		return id
+	}
+	return NewRequestID()
+}
+
+// LevelHandler 日志级别管理接口：GET 返回当前级别，PUT {"level": "debug"} 立即生效 (进程重启后恢复配置值)
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req struct {
+				Level string `json:"level"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Level == "" {
+				http.Error(w, "Bad Request: 请求体应为 {\"level\": \"debug|info|warn|error\"}", http.StatusBadRequest)
+				return
+			}
+			old := Level()
+			if err := SetLevel(req.Level); err != nil {
+				http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			slog.WarnContext(r.Context(), "日志级别已调整", "from", old, "to", Level(), "remote_addr", r.RemoteAddr)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"level": Level()})
+	})
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDFromHeader(t *testing.T) {
+	for header, keep := range map[string]bool{
+		"abc-123_X.y":           true,
+		"":                      false,
+		"has space":             false,
+		"line\nbreak":           false,
+		strings.Repeat("a", 65): false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(MetadataKey, header)
+		got := RequestIDFromHeader(r)
+		if keep && got != header {
+			t.Errorf("header %q: got %q, want it kept", header, got)
+		}
+		if !keep && (got == header || !validRequestID(got)) {
+			t.Errorf("header %q: got %q, want a new id", header, got)
+		}
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	restoreLevel(t)
+	SetLevel("info")
+	h := LevelHandler()
+
+	do := func(method, body string) (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/admin/log-level", strings.NewReader(body)))
+		var resp struct {
+			Level string `json:"level"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.Level
+	}
+
+	if code, lvl := do(http.MethodGet, ""); code != http.StatusOK || lvl != "info" {
+		t.Errorf("GET = %d %q", code, lvl)
+	}
+	if code, lvl := do(http.MethodPut, `{"level":"debug"}`); code != http.StatusOK || lvl != "debug" || Level() != "debug" {
+		t.Errorf("PUT debug = %d %q, level %q", code, lvl, Level())
+	}
+	for _, body := range []string{`{"level":"loud"}`, `{}`, `not json`} {
+		if code, _ := do(http.MethodPut, body); code != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d, want 400", body, code)
+		}
+	}
+	if Level() != "debug" {
+		t.Errorf("level changed to %q by a bad request", Level())
+	}
+	if code, _ := do(http.MethodPost, `{"level":"error"}`); code != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d, want 405", code)
+	}
+}
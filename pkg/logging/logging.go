@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+)
+
+// 日志格式 (log.format)
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// level 所有日志共用的级别，运行中可以通过 SetLevel 调整 (管理接口、Agent 配置档)
+var level = new(slog.LevelVar)
+
+// Init 按配置设置全局 slog，标准库 log 的输出也会转成 Info 级别的结构化日志
+func Init(cfg config.LogConfig, service string) error {
+	if err := SetLevel(cfg.Level); err != nil {
+		return err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatJSON:
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	case FormatText:
+		h = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("log.format %q 不支持，可选 json / text", cfg.Format)
+	}
+	slog.SetDefault(slog.New(contextHandler{h}).With("service", service))
+	return nil
+}
+
+// ParseLevel 解析 debug / info / warn / error，空字符串按 info 处理
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return l, fmt.Errorf("日志级别 %q 不合法，可选 debug / info / warn / error", s)
+	}
+	return l, nil
+}
+
+// SetLevel 立即调整全局日志级别
+func SetLevel(s string) error {
+	l, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// Level 当前日志级别 (小写)
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// Fatal 记录错误后退出进程，替代 log.Fatalf
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	attrsKey
+)
+
+// NewRequestID 生成随机请求 ID
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID 把请求 ID 放进 ctx，之后用 slog.XxxContext(ctx, ...) 打的日志都会带上 request_id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID 取出 ctx 里的请求 ID，没有时返回空字符串
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// With 给 ctx 附加日志属性 (如 "job_id", id)，用这个 ctx 打的日志都会带上
+func With(ctx context.Context, args ...any) context.Context {
+	var r slog.Record
+	r.Add(args...)
+	attrs := append([]slog.Attr(nil), contextAttrs(ctx)...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey, attrs)
+}
+
+func contextAttrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey).([]slog.Attr)
+	return attrs
+}
+
+// contextHandler 从 ctx 里取出 request_id、trace_id 和 With 附加的属性写进每条日志
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	r.AddAttrs(contextAttrs(ctx)...)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
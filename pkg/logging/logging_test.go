@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+	"github.com/stywzn/Go-Cloud-Compute/pkg/tracing"
+)
+
+// restoreLevel 测试结束后把全局级别改回去
+func restoreLevel(t *testing.T) {
+	old := Level()
+	t.Cleanup(func() { SetLevel(old) })
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{
+		"":      slog.LevelInfo,
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	} {
+		if got, err := ParseLevel(in); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) succeeded")
+	}
+
+	restoreLevel(t)
+	if err := SetLevel("warn"); err != nil || Level() != "warn" {
+		t.Errorf("SetLevel(warn): %v, level %q", err, Level())
+	}
+	if err := SetLevel("verbose"); err == nil || Level() != "warn" {
+		t.Errorf("invalid SetLevel: %v, level %q", err, Level())
+	}
+}
+
+func TestInitRejectsUnknownFormat(t *testing.T) {
+	restoreLevel(t)
+	if err := Init(config.LogConfig{Format: "xml"}, "test"); err == nil {
+		t.Error("Init accepted format xml")
+	}
+	if err := Init(config.LogConfig{Level: "loud"}, "test"); err == nil {
+		t.Error("Init accepted level loud")
+	}
+}
+
+// ctx 里的请求 ID、trace ID 和 With 附加的属性写进每条日志
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(contextHandler{slog.NewJSONHandler(&buf, nil)})
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	ctx = tracing.WithTraceParent(ctx, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx = With(ctx, "job_id", "j1")
+	child := With(ctx, "agent_id", "n1")
+	logger.InfoContext(child, "hello")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"request_id": "req-1",
+		"trace_id":   "4bf92f3577b34da6a3ce929d0e0e4736",
+		"job_id":     "j1",
+		"agent_id":   "n1",
+	} {
+		if line[k] != want {
+			t.Errorf("%s = %v, want %q", k, line[k], want)
+		}
+	}
+
+	// 子 ctx 的属性不会影响父 ctx
+	buf.Reset()
+	logger.InfoContext(ctx, "parent")
+	if bytes.Contains(buf.Bytes(), []byte("agent_id")) {
+		t.Errorf("parent ctx picked up child attrs: %s", buf.Bytes())
+	}
+
+	buf.Reset()
+	logger.Info("plain")
+	if bytes.Contains(buf.Bytes(), []byte("request_id")) || bytes.Contains(buf.Bytes(), []byte("trace_id")) {
+		t.Errorf("log without ctx: %s", buf.Bytes())
+	}
+}
+
+func TestWithRequestID(t *testing.T) {
+	ctx := context.Background()
+	if WithRequestID(ctx, "") != ctx || RequestID(ctx) != "" {
+		t.Error("empty request id changed the ctx")
+	}
+	if got := RequestID(WithRequestID(ctx, "abc")); got != "abc" {
+		t.Errorf("RequestID = %q", got)
+	}
+	if a, b := NewRequestID(), NewRequestID(); len(a) != 16 || a == b {
+		t.Errorf("NewRequestID = %q, %q", a, b)
+	}
+}
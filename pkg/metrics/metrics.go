@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 指标名统一以 gcc_ (Go Cloud Compute) 开头
+const namespace = "gcc"
+
+// Handler 暴露 Prometheus 格式的指标 (含 Go 运行时和进程指标)
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ---------------- Server ----------------
+
+var (
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP 请求耗时，route 是匹配到的路由模板",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+
+	GRPCRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "request_duration_seconds",
+		Help:      "gRPC unary 调用耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	GRPCStreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "stream_duration_seconds",
+		Help:      "gRPC 流从建立到关闭的时长",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 4, 12),
+	}, []string{"method", "code"})
+
+	GRPCStreamsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "streams_active",
+		Help:      "当前打开的 gRPC 流",
+	}, []string{"method"})
+
+	GRPCStreamMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "stream_messages_total",
+		Help:      "gRPC 流上收发的消息数，direction 为 recv / sent",
+	}, []string{"method", "direction"})
+
+	GRPCPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "grpc",
+		Name:      "panics_recovered_total",
+		Help:      "gRPC 处理函数里被恢复的 panic 次数",
+	}, []string{"method"})
+
+	JobsSubmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_submitted_total",
+		Help:      "提交的任务数",
+	}, []string{"type"})
+
+	JobsCompleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_completed_total",
+		Help:      "结束的任务数，status 为 Success / Failed / Cancelled",
+	}, []string{"type", "status"})
+
+	DispatchLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_dispatch_latency_seconds",
+		Help:      "任务从提交 (延时任务从释放) 到 Agent 开始执行的时间",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 14),
+	}, []string{"type"})
+
+	ResultsArchived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_results_archived_total",
+		Help:      "按保留策略压缩归档的任务输出数",
+	}, []string{"type"})
+
+	ResultsArchivedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_results_archived_bytes_total",
+		Help:      "归档的任务输出原始字节数 (压缩前)",
+	})
+)
+
+var serverOnce sync.Once
+
+// RegisterServer 注册 Server 的指标；extra 是需要访问数据库、会话等状态的采集器 (队列深度、在线节点)
+func RegisterServer(extra ...prometheus.Collector) {
+	serverOnce.Do(func() {
+		prometheus.MustRegister(HTTPRequestDuration, GRPCRequestDuration, JobsSubmitted, JobsCompleted, DispatchLatency,
+			GRPCStreamDuration, GRPCStreamsActive, GRPCStreamMessages, GRPCPanics, ResultsArchived, ResultsArchivedBytes)
+		prometheus.MustRegister(extra...)
+	})
+}
+
+// ---------------- Agent ----------------
+
+var (
+	AgentJobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "agent",
+		Name:      "job_duration_seconds",
+		Help:      "任务在 Agent 上的执行耗时 (含准备工作区、上传产物)",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 3, 12),
+	}, []string{"status"})
+
+	AgentExecutorErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "agent",
+		Name:      "executor_errors_total",
+		Help:      "执行器自身的错误 (不含命令返回非 0)，stage 为出错的阶段",
+	}, []string{"stage"})
+
+	AgentHeartbeatRTT = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "agent",
+		Name:      "heartbeat_rtt_seconds",
+		Help:      "心跳往返时间",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	})
+)
+
+var agentOnce sync.Once
+
+// RegisterAgent 注册 Agent 的指标；running 返回正在执行的任务数
+func RegisterAgent(running func() float64) {
+	agentOnce.Do(func() {
+		prometheus.MustRegister(AgentJobDuration, AgentExecutorErrors, AgentHeartbeatRTT,
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: "agent",
+				Name:      "jobs_running",
+				Help:      "正在执行的任务数",
+			}, running))
+	})
+}
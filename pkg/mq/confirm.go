@@ -0,0 +1,112 @@
+package mq
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// 每轮最多投递多少条再等待确认，同时也是确认通道的缓冲大小
+const confirmBatchSize = 500
+
+// 批量投递专用的 confirm 模式通道，和普通的 Channel 分开，避免影响消费者
+var (
+	confirmMu sync.Mutex
+	confirmCh *amqp.Channel
+	confirms  chan amqp.Confirmation
+)
+
+// Message 一条待投递的消息，Headers 用来携带 trace context 等元数据，可以为空
+type Message struct {
+	Body    []byte
+	Headers amqp.Table
+}
+
+// PublishConfirmed 在 confirm 模式下批量投递已编码的任务 (见 EncodeJob)，并等待 Broker 逐条确认
+// 返回值与 msgs 一一对应，true 表示该消息已被 Broker 接收并持久化
+func PublishConfirmed(msgs []Message, timeout time.Duration) ([]bool, error) {
+	confirmMu.Lock()
+	defer confirmMu.Unlock()
+
+	acked := make([]bool, len(msgs))
+	for start := 0; start < len(msgs); start += confirmBatchSize {
+		end := min(start+confirmBatchSize, len(msgs))
+		if err := publishChunk(msgs[start:end], acked[start:end], timeout); err != nil {
+			// 通道里可能还残留着未读的确认，直接丢掉重建
+			resetConfirmChannel()
+			return acked, err
+		}
+	}
+	return acked, nil
+}
+
+func publishChunk(msgs []Message, acked []bool, timeout time.Duration) error {
+	ch, err := confirmChannel()
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		err = ch.Publish("", QueueName, false, false, amqp.Publishing{
+			Headers:      msg.Headers,
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Body:         msg.Body,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// 确认按投递顺序到达，第 i 个确认对应第 i 条消息
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for i := range msgs {
+		select {
+		case c, ok := <-confirms:
+			if !ok {
+				return errors.New("mq: confirm channel closed")
+			}
+			acked[i] = c.Ack
+		case <-timer.C:
+			return errors.New("mq: timed out waiting for publisher confirms")
+		}
+	}
+	return nil
+}
+
+func confirmChannel() (*amqp.Channel, error) {
+	if confirmCh != nil {
+		return confirmCh, nil
+	}
+
+	mu.RLock()
+	c := conn
+	mu.RUnlock()
+	if c == nil {
+		return nil, ErrNotConnected
+	}
+
+	ch, err := c.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	confirmCh = ch
+	confirms = ch.NotifyPublish(make(chan amqp.Confirmation, confirmBatchSize))
+	return confirmCh, nil
+}
+
+// resetConfirmChannel 丢弃当前的 confirm 通道，调用方需持有 confirmMu
+func resetConfirmChannel() {
+	if confirmCh != nil {
+		confirmCh.Close()
+	}
+	confirmCh = nil
+	confirms = nil
+}
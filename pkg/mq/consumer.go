@@ -0,0 +1,129 @@
+package mq
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/streadway/amqp"
+)
+
+// consumer 对调用方暴露一个稳定的输出通道，断线重连后在新通道上重新订阅，
+// 调用方的 range 循环不会因为重连而结束
+type consumer struct {
+	out chan amqp.Delivery
+
+	tagMu sync.Mutex
+	tag   string // 当前订阅的 consumer tag，暂停时用它取消订阅
+}
+
+// 暂停消费时为 true，重连后也不会重新订阅 (受 mu 保护)
+var paused bool
+
+var consumerSeq uint64
+
+// 👇👇👇【新增关键点 2】封装消费者方法 👇👇👇
+// 返回一个只读通道，让 Agent 去 range 遍历；该通道在整个进程生命周期内有效
+func Consume() (<-chan amqp.Delivery, error) {
+	c := &consumer{out: make(chan amqp.Delivery)}
+
+	mu.Lock()
+	consumers = append(consumers, c)
+	ch := channel
+	if paused {
+		ch = nil
+	}
+	mu.Unlock()
+
+	// 还没连上的话，等 connect() 成功后会统一订阅
+	if ch != nil {
+		if err := c.subscribe(ch); err != nil {
+			return nil, err
+		}
+	}
+	return c.out, nil
+}
+
+// PauseConsume 取消所有订阅，不再从队列接收新消息
+// 已经收到的消息仍然可以正常 Ack/Nack，用于 Agent 维护模式 (drain)
+func PauseConsume() {
+	mu.Lock()
+	paused = true
+	ch := channel
+	subs := append([]*consumer(nil), consumers...)
+	mu.Unlock()
+
+	if ch == nil {
+		return
+	}
+	for _, c := range subs {
+		c.cancel(ch)
+	}
+}
+
+// ResumeConsume 恢复订阅
+func ResumeConsume() {
+	mu.Lock()
+	if !paused {
+		mu.Unlock()
+		return
+	}
+	paused = false
+	ch := channel
+	subs := append([]*consumer(nil), consumers...)
+	mu.Unlock()
+
+	// 断线期间恢复的话，等 connect() 成功后会统一订阅
+	if ch == nil {
+		return
+	}
+	for _, c := range subs {
+		// 订阅失败一般意味着通道出了问题，重连后会再订阅
+		c.subscribe(ch)
+	}
+}
+
+// subscribe 在指定通道上订阅队列，并把消息转发到稳定的输出通道
+func (c *consumer) subscribe(ch *amqp.Channel) error {
+	tag := fmt.Sprintf("%s-%d", QueueName, atomic.AddUint64(&consumerSeq, 1))
+	msgs, err := ch.Consume(
+		QueueName, // queue
+		tag,       // consumer
+		false,     // 👈 auto-ack = false (关键！必须手动 Ack)
+		false,     // exclusive
+		false,     // no-local
+		false,     // no-wait
+		nil,       // args
+	)
+	if err != nil {
+		return err
+	}
+
+	c.tagMu.Lock()
+	c.tag = tag
+	c.tagMu.Unlock()
+
+	// 通道关闭或订阅被取消时 msgs 会被关闭，转发协程随之退出，
+	// 取消前已经推到本地缓冲的消息仍会转发出去
+	go func() {
+		for d := range msgs {
+			select {
+			case c.out <- d:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *consumer) cancel(ch *amqp.Channel) {
+	c.tagMu.Lock()
+	tag := c.tag
+	c.tag = ""
+	c.tagMu.Unlock()
+
+	if tag != "" {
+		ch.Cancel(tag, false)
+	}
+}
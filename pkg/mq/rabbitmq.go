@@ -1,44 +1,150 @@
 package mq
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/streadway/amqp"
 )
 
-var Conn *amqp.Connection
-var Channel *amqp.Channel
+// 连接状态，通过 State() 暴露给健康检查
+const (
+	StateConnecting   = "connecting"
+	StateConnected    = "connected"
+	StateReconnecting = "reconnecting"
+	StateClosed       = "closed"
+)
+
+// ErrNotConnected 断线期间直接拒绝投递，由调用方 (发件箱) 负责重试
+var ErrNotConnected = errors.New("mq: not connected")
+
+// 重连退避
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
 var QueueName string
 
+// 连接管理器的状态，conn/channel 在重连时会被整体替换，读写都要加锁
+var (
+	mu        sync.RWMutex
+	conn      *amqp.Connection
+	channel   *amqp.Channel
+	state     = StateConnecting
+	url       string
+	consumers []*consumer
+	prefetch  = 1
+
+	done      = make(chan struct{}) // Close 时关闭，通知所有后台协程退出
+	closeOnce sync.Once
+)
+
+// Init 建立连接并启动断线重连；首次连接失败不再退出进程，而是在后台持续重试
 func Init() {
 	// 1. 读取配置
 	// 建议：生产环境这里应该加个默认值兜底，或者检查配置是否存在
-	url := fmt.Sprintf("amqp://%s:%s@%s:%s/",
+	url = fmt.Sprintf("amqp://%s:%s@%s:%s/",
 		viper.GetString("rabbitmq.user"),
 		viper.GetString("rabbitmq.password"),
 		viper.GetString("rabbitmq.host"),
 		viper.GetString("rabbitmq.port"),
 	)
+	QueueName = viper.GetString("rabbitmq.queue_name")
+
+	if err := connect(); err != nil {
+		slog.Error("连接 RabbitMQ 失败，后台重试", "err", err)
+		setState(StateReconnecting)
+		go reconnectLoop()
+	}
+}
+
+// State 返回当前连接状态
+func State() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return state
+}
+
+// Close 主动关闭连接并停止重连，用于优雅停机
+func Close() {
+	closeOnce.Do(func() {
+		close(done)
+		mu.Lock()
+		defer mu.Unlock()
+		state = StateClosed
+		if channel != nil {
+			channel.Close()
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	})
+}
 
-	var err error
+// connect 建立连接、声明拓扑、重新订阅消费者，并启动断线监听
+func connect() error {
 	// 建立连接
-	Conn, err = amqp.Dial(url)
+	c, err := amqp.Dial(url)
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to RabbitMQ: %v", err)
+		return err
 	}
 
 	// 建立通道
-	Channel, err = Conn.Channel()
+	ch, err := c.Channel()
 	if err != nil {
-		log.Fatalf("❌ Failed to open a channel: %v", err)
+		c.Close()
+		return err
 	}
 
-	QueueName = viper.GetString("rabbitmq.queue_name")
+	if err := setupTopology(ch); err != nil {
+		c.Close()
+		return err
+	}
+
+	// 先注册关闭通知再发布新连接，避免漏掉刚连上就断开的情况
+	connClosed := c.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	mu.Lock()
+	select {
+	case <-done:
+		// 重连过程中被 Close 了
+		mu.Unlock()
+		c.Close()
+		return nil
+	default:
+	}
+	conn, channel = c, ch
+	state = StateConnected
+	var subs []*consumer
+	if !paused {
+		subs = append(subs, consumers...)
+	}
+	mu.Unlock()
+
+	// 消费者的输出通道保持不变，只需要在新通道上重新订阅
+	for _, sub := range subs {
+		if err := sub.subscribe(ch); err != nil {
+			slog.Warn("重新订阅 MQ 消费者失败", "err", err)
+		}
+	}
+
+	go watch(c, connClosed, chClosed)
+	slog.Info("RabbitMQ 已连接", "prefetch", prefetchCount())
+	return nil
+}
 
+// setupTopology 声明队列和 QoS，每次重连后都要重新执行
+func setupTopology(ch *amqp.Channel) error {
 	// 2. 声明队列 (即使队列已存在也没关系，确保属性一致)
-	_, err = Channel.QueueDeclare(
+	_, err := ch.QueueDeclare(
 		QueueName, // name
 		true,      // durable (持久化：MQ 重启后队列还在)
 		false,     // delete when unused
@@ -47,50 +153,208 @@ func Init() {
 		nil,       // arguments
 	)
 	if err != nil {
-		log.Fatalf("❌ Failed to declare a queue: %v", err)
+		return fmt.Errorf("declare queue: %w", err)
 	}
 
 	// 👇👇👇【新增关键点 1】设置 QoS (公平分发) 👇👇👇
-	// prefetchCount = 1: 告诉 MQ，在我 Ack 之前，最多只给我发 1 条消息。
+	// prefetchCount = N: 告诉 MQ，在我 Ack 之前，最多只给我发 N 条消息 (N = Agent 的最大并发数)。
 	// 这样能保证能者多劳，不会让处理慢的 Agent 堆积任务。
-	err = Channel.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
+	err = ch.Qos(
+		prefetchCount(), // prefetch count
+		0,               // prefetch size
+		false,           // global
 	)
 	if err != nil {
-		log.Fatalf("❌ Failed to set QoS: %v", err)
+		return fmt.Errorf("set QoS: %w", err)
+	}
+	return nil
+}
+
+// SetPrefetch 设置消费者的预取数量，需要在 Init 之前调用，重连后同样生效 (运行中调整用 UpdatePrefetch)
+// Agent 会把它设成自己的最大并发数
+func SetPrefetch(n int) {
+	mu.Lock()
+	defer mu.Unlock()
+	if n < 1 {
+		n = 1
+	}
+	prefetch = n
+}
+
+// UpdatePrefetch 运行中调整预取数量：更新通道 QoS 后重新订阅，新的上限才会对消费者生效
+// (QoS 只作用于之后创建的消费者)；断线期间调用的话，重连时自然会用上新值
+func UpdatePrefetch(n int) error {
+	SetPrefetch(n)
+
+	mu.RLock()
+	ch := channel
+	resubscribe := !paused
+	subs := append([]*consumer(nil), consumers...)
+	mu.RUnlock()
+
+	if ch == nil {
+		return nil
+	}
+	if err := ch.Qos(prefetchCount(), 0, false); err != nil {
+		return fmt.Errorf("set QoS: %w", err)
+	}
+	if !resubscribe {
+		return nil // 暂停期间 ResumeConsume 会用新的 QoS 订阅
+	}
+	for _, c := range subs {
+		c.cancel(ch)
+		if err := c.subscribe(ch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefetchCount 消费者的预取数量
+func prefetchCount() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return prefetch
+}
+
+// watch 监听连接/通道关闭，断开后进入重连
+func watch(c *amqp.Connection, connClosed, chClosed chan *amqp.Error) {
+	select {
+	case <-done:
+		return
+	case err := <-connClosed:
+		slog.Warn("RabbitMQ 连接已断开", "err", err)
+	case err := <-chClosed:
+		// 通道级别的异常也整体重连，保证拓扑和消费者一致
+		slog.Warn("RabbitMQ 通道已关闭", "err", err)
+		c.Close()
+	}
+
+	select {
+	case <-done:
+		return // 主动 Close 触发的关闭
+	default:
+	}
+
+	mu.Lock()
+	conn, channel = nil, nil
+	state = StateReconnecting
+	mu.Unlock()
+
+	confirmMu.Lock()
+	resetConfirmChannel()
+	confirmMu.Unlock()
+
+	reconnectLoop()
+}
+
+// reconnectLoop 指数退避重连，直到成功或被 Close
+func reconnectLoop() {
+	delay := minReconnectDelay
+	for {
+		wait := reconnectWait(delay)
+		slog.Info("稍后尝试重连 RabbitMQ", "wait", wait.Round(time.Millisecond))
+		select {
+		case <-done:
+			return
+		case <-time.After(wait):
+		}
+
+		if err := connect(); err != nil {
+			slog.Error("重连 RabbitMQ 失败", "err", err)
+			delay = min(delay*2, maxReconnectDelay)
+			continue
+		}
+		return
+	}
+}
+
+// reconnectWait 在退避时间上加最多一半的随机抖动，避免大量 Agent 在 Broker 重启后同时重连
+func reconnectWait(delay time.Duration) time.Duration {
+	return delay + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// currentChannel 返回当前可用的通道，断线期间返回 ErrNotConnected
+func currentChannel() (*amqp.Channel, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if channel == nil {
+		return nil, ErrNotConnected
 	}
+	return channel, nil
+}
+
+func setState(s string) {
+	mu.Lock()
+	defer mu.Unlock()
+	state = s
+}
+
+// JobMessage 是投递到队列里的任务信封，Agent 靠 JobID 回报执行结果
+type JobMessage struct {
+	JobID     string            `json:"job_id"`
+	Type      string            `json:"type"`
+	Payload   string            `json:"payload"`
+	Artifacts []string          `json:"artifacts,omitempty"` // 执行结束后要上传的产物 glob
+	Files     []InputFile       `json:"files,omitempty"`     // 执行前要下载到工作目录的输入文件
+	Env       map[string]string `json:"env,omitempty"`
+	Workdir   string            `json:"workdir,omitempty"`    // 相对路径在任务的临时工作区内
+	User      string            `json:"user,omitempty"`       // 以哪个系统用户执行
+	SecretEnv []string          `json:"secret_env,omitempty"` // 要注入秘密值的环境变量名，值在执行前单独获取
+	RequestID string            `json:"request_id,omitempty"` // 提交任务的请求 ID，用于串联日志
+}
 
-	log.Println("✅ RabbitMQ connected (QoS=1).")
+// InputFile 任务引用的输入文件 (通过 POST /files 上传)，Agent 按 SHA256 校验并缓存
+type InputFile struct {
+	FileID string `json:"file_id"`
+	Path   string `json:"path"` // 工作目录下的相对路径
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
 }
 
 func Publish(body string) error {
+	return publish("text/plain", []byte(body))
+}
+
+// PublishJob 以 JSON 信封的形式投递任务
+func PublishJob(msg JobMessage) error {
+	body, err := EncodeJob(msg)
+	if err != nil {
+		return err
+	}
+	return publish("application/json", body)
+}
+
+// EncodeJob 把任务编码成队列消息体，发件箱里存的就是这个
+func EncodeJob(msg JobMessage) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// DecodeJob 解析队列里的消息；兼容旧版直接投递命令字符串的格式
+func DecodeJob(d amqp.Delivery) JobMessage {
+	var msg JobMessage
+	if d.ContentType == "application/json" && json.Unmarshal(d.Body, &msg) == nil {
+		return msg
+	}
+	return JobMessage{Payload: string(d.Body)}
+}
+
+func publish(contentType string, body []byte) error {
+	ch, err := currentChannel()
+	if err != nil {
+		return err
+	}
+
 	// 消息持久化 (Persistent)
 	// 只有队列持久化 + 消息持久化，MQ 挂了数据才不丢
-	return Channel.Publish(
+	return ch.Publish(
 		"",        // exchange
 		QueueName, // routing key
 		false,     // mandatory
 		false,     // immediate
 		amqp.Publishing{
-			ContentType:  "text/plain",
+			ContentType:  contentType,
 			DeliveryMode: amqp.Persistent, // 👈 记得加上这个，消息持久化
-			Body:         []byte(body),
+			Body:         body,
 		})
 }
-
-// 👇👇👇【新增关键点 2】封装消费者方法 👇👇👇
-// 返回一个只读通道，让 Agent 去 range 遍历
-func Consume() (<-chan amqp.Delivery, error) {
-	msgs, err := Channel.Consume(
-		QueueName, // queue
-		"",        // consumer
-		false,     // 👈 auto-ack = false (关键！必须手动 Ack)
-		false,     // exclusive
-		false,     // no-local
-		false,     // no-wait
-		nil,       // args
-	)
-	return msgs, err
-}
@@ -0,0 +1,87 @@
+package mq
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestReconnectWait(t *testing.T) {
+	for _, delay := range []time.Duration{minReconnectDelay, 4 * time.Second, maxReconnectDelay} {
+		for range 100 {
+			if got := reconnectWait(delay); got < delay || got > delay+delay/2 {
+				t.Fatalf("reconnectWait(%s) = %s, want within [%s, %s]", delay, got, delay, delay+delay/2)
+			}
+		}
+	}
+}
+
+// Broker 不可用时 Init 不退出：进入重连状态并在后台重试，投递直接返回 ErrNotConnected，
+// Close 之后停止重试
+func TestInitRetriesUntilClosed(t *testing.T) {
+	// 接受连接后立即关闭，AMQP 握手失败，用来统计拨号次数
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	var dials atomic.Int32
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			dials.Add(1)
+			c.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	viper.Set("rabbitmq.host", host)
+	viper.Set("rabbitmq.port", port)
+	viper.Set("rabbitmq.queue_name", "test")
+	Init()
+
+	if s := State(); s != StateReconnecting {
+		t.Fatalf("state = %s, want %s", s, StateReconnecting)
+	}
+	if err := PublishJob(JobMessage{JobID: "j1"}); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("PublishJob err = %v, want ErrNotConnected", err)
+	}
+	if _, err := PublishConfirmed([]Message{{Body: []byte("{}")}}, time.Second); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("PublishConfirmed err = %v, want ErrNotConnected", err)
+	}
+	// 断线期间也能拿到消费通道，连上后统一订阅
+	if out, err := Consume(); err != nil || out == nil {
+		t.Errorf("Consume = %v, %v", out, err)
+	}
+	PauseConsume()
+	ResumeConsume()
+
+	deadline := time.Now().Add(minReconnectDelay*3/2 + time.Second)
+	for dials.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if n := dials.Load(); n < 2 {
+		t.Fatalf("%d dial attempts, want a retry after the first failure", n)
+	}
+	if s := State(); s != StateReconnecting {
+		t.Errorf("state after failed retry = %s, want %s", s, StateReconnecting)
+	}
+
+	Close()
+	Close() // 重复调用不会 panic
+	if s := State(); s != StateClosed {
+		t.Errorf("state after Close = %s, want %s", s, StateClosed)
+	}
+	n := dials.Load()
+	time.Sleep(3 * minReconnectDelay)
+	if got := dials.Load(); got != n {
+		t.Errorf("%d more dial attempts after Close", got-n)
+	}
+}
@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Box 用主密钥 (AES-256-GCM) 加解密秘密值，密文格式为 nonce || ciphertext
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox 主密钥是 32 字节，用 base64 或 hex 编码，如 `openssl rand -base64 32` 的输出
+func NewBox(key string) (*Box, error) {
+	raw, err := decodeKey(strings.TrimSpace(key))
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+func decodeKey(key string) ([]byte, error) {
+	if raw, err := base64.StdEncoding.DecodeString(key); err == nil && len(raw) == 32 {
+		return raw, nil
+	}
+	if raw, err := hex.DecodeString(key); err == nil && len(raw) == 32 {
+		return raw, nil
+	}
+	return nil, fmt.Errorf("secrets: master key must be 32 bytes encoded as base64 or hex")
+}
+
+// Seal 加密；aad 绑定密文的归属 (如 namespace/name)，密文被挪到别的记录上会解密失败
+func (b *Box) Seal(plaintext, aad []byte) []byte {
+	nonce := make([]byte, b.aead.NonceSize(), b.aead.NonceSize()+len(plaintext)+b.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err) // crypto/rand 不会失败
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, aad)
+}
+
+// Open 解密 Seal 的结果
+func (b *Box) Open(data, aad []byte) ([]byte, error) {
+	n := b.aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("secrets: ciphertext too short")
+	}
+	return b.aead.Open(nil, data[:n], data[n:], aad)
+}
+
+// Redacted 替换秘密值的占位符
+const Redacted = "******"
+
+// 太短的值不替换，否则 "1"、"on" 之类的值会把整段输出都打码
+const minMaskLen = 4
+
+// Mask 把 s 里出现的秘密值替换成 Redacted，长的值先替换 (一个值可能包含另一个值)
+func Mask(s string, values []string) string {
+	vals := make([]string, 0, len(values))
+	for _, v := range values {
+		if len(v) >= minMaskLen {
+			vals = append(vals, v)
+		}
+	}
+	if len(vals) == 0 {
+		return s
+	}
+	sort.Slice(vals, func(i, j int) bool { return len(vals[i]) > len(vals[j]) })
+	pairs := make([]string, 0, len(vals)*2)
+	for _, v := range vals {
+		pairs = append(pairs, v, Redacted)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
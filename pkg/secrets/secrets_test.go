@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+var testKey = bytes.Repeat([]byte{7}, 32)
+
+func TestNewBoxKeyEncodings(t *testing.T) {
+	for _, key := range []string{
+		base64.StdEncoding.EncodeToString(testKey),
+		hex.EncodeToString(testKey),
+		" " + base64.StdEncoding.EncodeToString(testKey) + "\n",
+	} {
+		if _, err := NewBox(key); err != nil {
+			t.Errorf("NewBox(%q): %v", key, err)
+		}
+	}
+	for _, key := range []string{"", "short", base64.StdEncoding.EncodeToString(testKey[:16]), hex.EncodeToString(testKey[:31])} {
+		if _, err := NewBox(key); err == nil {
+			t.Errorf("NewBox(%q) accepted a key that is not 32 bytes", key)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	box, err := NewBox(hex.EncodeToString(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, aad := []byte("hunter2"), []byte("prod/db")
+
+	sealed := box.Seal(plain, aad)
+	if bytes.Contains(sealed, plain) {
+		t.Fatal("ciphertext contains the plaintext")
+	}
+	if again := box.Seal(plain, aad); bytes.Equal(again, sealed) {
+		t.Error("sealing twice produced the same ciphertext (nonce reused)")
+	}
+	got, err := box.Open(sealed, aad)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("Open = %q, %v", got, err)
+	}
+
+	// 密文挪到别的记录上、被篡改、被截断或换了主密钥都无法解密
+	if _, err := box.Open(sealed, []byte("prod/other")); err == nil {
+		t.Error("opened with a different aad")
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := box.Open(tampered, aad); err == nil {
+		t.Error("opened tampered ciphertext")
+	}
+	if _, err := box.Open(sealed[:5], aad); err == nil {
+		t.Error("opened truncated ciphertext")
+	}
+	other, _ := NewBox(hex.EncodeToString(bytes.Repeat([]byte{8}, 32)))
+	if _, err := other.Open(sealed, aad); err == nil {
+		t.Error("opened with a different master key")
+	}
+}
+
+func TestMask(t *testing.T) {
+	for _, c := range []struct {
+		in     string
+		values []string
+		want   string
+	}{
+		{"password=hunter2", []string{"hunter2"}, "password=" + Redacted},
+		{"a hunter2 b hunter2", []string{"hunter2"}, "a " + Redacted + " b " + Redacted},
+		// 长的值先替换，不会只打掉一半
+		{"token=abcd1234", []string{"abcd", "abcd1234"}, "token=" + Redacted},
+		// 太短的值不替换
+		{"on and on", []string{"on"}, "on and on"},
+		{"nothing here", nil, "nothing here"},
+		{"multi line\nsecret-value\n", []string{"secret-value"}, "multi line\n" + Redacted + "\n"},
+	} {
+		if got := Mask(c.in, c.values); got != c.want {
+			t.Errorf("Mask(%q, %q) = %q, want %q", c.in, c.values, got, c.want)
+		}
+	}
+	if got, want := Mask(strings.Repeat("x", 10), []string{"xxxx"}), Redacted+Redacted+"xx"; got != want {
+		t.Errorf("repeated value: Mask = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+)
+
+// S3 兼容 AWS S3 以及 MinIO 等 S3 协议的对象存储 (docker-compose 里的 minio 可以用来本地调试)
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(cfg config.S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage: s3 client: %w", err)
+	}
+
+	// 本地调试用的 MinIO 通常没有预先建好 bucket
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("storage: check bucket %s: %w", cfg.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("storage: create bucket %s: %w", cfg.Bucket, err)
+		}
+	}
+	return &S3{client: client, bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+func (s *S3) object(key string) (string, error) {
+	clean, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return s.prefix + clean, nil
+}
+
+// s3PartSize 分片上传的分片大小，minio-go 每个上传都要分配这么大的缓冲区；
+// 不指定时按 5TiB 的上限算出来是 500 多 MB。最多 10000 个分片，单个对象上限约 160GB
+const s3PartSize = 16 << 20
+
+// Put size 为 -1 时 minio-go 会自动走分片上传
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	obj, err := s.object(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, s.bucket, obj, r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    s3PartSize,
+	})
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	o, err := s.client.GetObject(ctx, s.bucket, obj, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	// GetObject 是懒请求，Stat 才会真正访问服务端
+	st, err := o.Stat()
+	if err != nil {
+		o.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, 0, ErrNotFound
+		}
+		return nil, 0, err
+	}
+	return o, st.Size, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	obj, err := s.object(key)
+	if err != nil {
+		return err
+	}
+	return s.client.RemoveObject(ctx, s.bucket, obj, minio.RemoveObjectOptions{})
+}
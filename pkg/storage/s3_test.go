@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+)
+
+// fakeS3 只实现 S3 存储后端用到的接口：HEAD/PUT bucket、分片上传、GET/DELETE 对象
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	objects map[string][]byte // "bucket/key" -> 内容
+	uploads map[string][]byte // uploadID -> 已上传的内容 (只支持按顺序上传)
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{buckets: map[string]bool{}, objects: map[string][]byte{}, uploads: map[string][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		if !f.buckets[bucket] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case key == "" && r.Method == http.MethodPut:
+		f.buckets[bucket] = true
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = nil
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", bucket, key, id)
+	case r.Method == http.MethodPut && q.Has("partNumber"):
+		body, err := readBody(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.uploads[q.Get("uploadId")] = append(f.uploads[q.Get("uploadId")], body...)
+		w.Header().Set("ETag", `"etag-`+q.Get("partNumber")+`"`)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		f.objects[bucket+"/"+key] = f.uploads[q.Get("uploadId")]
+		delete(f.uploads, q.Get("uploadId"))
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`, bucket, key)
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		delete(f.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[bucket+"/"+key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message><Key>%s</Key><BucketName>%s</BucketName></Error>", key, bucket)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", "Mon, 19 Oct 2026 00:00:00 GMT")
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, bucket+"/"+key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported: "+r.Method+" "+r.URL.String(), http.StatusNotImplemented)
+	}
+}
+
+// readBody 解开 minio-go 在 http 上使用的分块签名格式 (aws-chunked)：
+// "<十六进制长度>;chunk-signature=...\r\n<数据>\r\n"，以长度 0 的块结束
+func readBody(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+	var out []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad chunk header %q", line)
+		}
+		if n == 0 {
+			return out, nil
+		}
+		chunk := make([]byte, n+2) // 数据后面跟着 \r\n
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		out = append(out, chunk[:n]...)
+	}
+}
+
+func newTestS3(t *testing.T) (*S3, *fakeS3) {
+	t.Helper()
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	s, err := NewS3(config.S3Config{
+		Endpoint:  u.Host,
+		Bucket:    "artifacts",
+		Prefix:    "gcc/",
+		Region:    "us-east-1",
+		AccessKey: "test",
+		SecretKey: "test-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, fake
+}
+
+func TestS3PutGet(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+	if !fake.buckets["artifacts"] {
+		t.Fatal("NewS3 did not create the missing bucket")
+	}
+
+	const content = "hello artifact"
+	if err := s.Put(ctx, "artifacts/job-1/out.log", strings.NewReader(content), -1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.objects["artifacts/gcc/artifacts/job-1/out.log"]; !ok {
+		t.Fatalf("object not stored under the prefix, have %v", fake.objects)
+	}
+
+	rc, size, err := s.Get(ctx, "artifacts/job-1/out.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content || size != int64(len(content)) {
+		t.Errorf("Get = %q (%d bytes), want %q", got, size, content)
+	}
+}
+
+func TestS3GetNotFound(t *testing.T) {
+	s, _ := newTestS3(t)
+	if _, _, err := s.Get(context.Background(), "artifacts/job-1/missing.log"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get missing object: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3RejectsInvalidKey(t *testing.T) {
+	s, _ := newTestS3(t)
+	if err := s.Put(context.Background(), "../escape", strings.NewReader("x"), -1); err == nil {
+		t.Fatal("Put with .. in the key succeeded")
+	}
+}
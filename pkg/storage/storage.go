@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("storage: object not found")
+
+// Backend 产物存储后端，key 是以 / 分隔的相对路径，如 "artifacts/job-xxx/out.log"
+type Backend interface {
+	// Put 写入对象，size 未知时传 -1；同名对象会被覆盖
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get 读取对象，返回内容和大小，对象不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New 按配置创建存储后端：local (默认，写到 server.storage_path) 或 s3
+func New(cfg config.Config) (Backend, error) {
+	switch cfg.Server.StorageBackend {
+	case "", "local":
+		return NewLocal(cfg.Server.StoragePath)
+	case "s3":
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("storage: unknown backend %q", cfg.Server.StorageBackend)
+	}
+}
+
+// CleanKey 校验 key，拒绝绝对路径和 ..，防止写到存储目录外面
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	clean := path.Clean(key)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return clean, nil
+}
@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestCarriersRoundTrip(t *testing.T) {
+	ctx := WithTraceParent(context.Background(), testTraceParent)
+
+	headers := amqp.Table{"other": 1}
+	Inject(ctx, AMQPCarrier(headers))
+	if headers["traceparent"] != testTraceParent {
+		t.Errorf("AMQP headers = %v", headers)
+	}
+	if got := AMQPCarrier(headers).Get("other"); got != "" {
+		t.Errorf("non-string header read as %q", got)
+	}
+	if got := TraceParent(Extract(context.Background(), AMQPCarrier(headers))); got != testTraceParent {
+		t.Errorf("from AMQP: %q", got)
+	}
+
+	md := metadata.MD{}
+	Inject(ctx, MetadataCarrier(md))
+	if got := TraceParent(Extract(context.Background(), MetadataCarrier(md))); got != testTraceParent {
+		t.Errorf("from metadata: %q", got)
+	}
+	if keys := MetadataCarrier(md).Keys(); len(keys) != 1 || keys[0] != "traceparent" {
+		t.Errorf("metadata keys = %v", keys)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	var sent metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		sent, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	// 没有 trace 的调用不加 metadata
+	UnaryClientInterceptor(context.Background(), "/m", nil, nil, nil, invoker)
+	if len(sent.Get("traceparent")) != 0 {
+		t.Errorf("untraced call sent %v", sent)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(WithTraceParent(context.Background(), testTraceParent), "x-agent", "n1")
+	UnaryClientInterceptor(ctx, "/m", nil, nil, nil, invoker)
+	if got := sent.Get("traceparent"); len(got) != 1 || got[0] != testTraceParent {
+		t.Errorf("traceparent = %v", got)
+	}
+	if got := sent.Get("x-agent"); len(got) != 1 {
+		t.Errorf("existing metadata lost: %v", sent)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/sentinel.SentinelService/ReportJobStatus"}
+	var got trace.SpanContext
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = trace.SpanContextFromContext(ctx)
+		return nil, nil
+	}
+
+	UnaryServerInterceptor(context.Background(), nil, info, handler)
+	if got.IsValid() {
+		t.Errorf("untraced call got span %v", got)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", testTraceParent))
+	UnaryServerInterceptor(ctx, nil, info, handler)
+	if got.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("handler trace id = %s", got.TraceID())
+	}
+}
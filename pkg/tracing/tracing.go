@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+)
+
+// 所有 span 都用同一个 tracer
+const instrumentationName = "github.com/stywzn/Go-Cloud-Compute"
+
+// propagator 任务链路统一用 W3C traceparent 传递
+var propagator = propagation.TraceContext{}
+
+// Init 初始化全局 TracerProvider，返回停机时调用的 shutdown (会把缓冲的 span 发出去)
+// tracing.enabled 为 false 时不导出 span，但仍然生成 trace ID 并在各环节间传递，
+// 任务记录里的 trace_id 照样可以用来串联日志
+func Init(cfg config.TracingConfig, service string) (func(context.Context) error, error) {
+	ratio := cfg.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", service)))
+	if err != nil {
+		return nil, err
+	}
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		// 上游 (HTTP 调用方) 已经决定了是否采样的话跟随上游
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	}
+
+	if cfg.Enabled {
+		exporterOpts := []otlptracegrpc.Option{}
+		if cfg.Endpoint != "" {
+			exporterOpts = append(exporterOpts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+		}
+		// 不会阻塞等待连接，Collector 不在线时 span 在后台重试后丢弃
+		exporter, err := otlptracegrpc.New(context.Background(), exporterOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("create OTLP exporter: %w", err)
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+		slog.Info("链路追踪已启用", "endpoint", cfg.Endpoint, "sample_ratio", ratio)
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator)
+	return tp.Shutdown, nil
+}
+
+// Tracer 返回全局 tracer；没调用 Init 时是 no-op 实现
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// TraceID 当前 span 的 trace ID，没有时返回空字符串
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// TraceParent 把当前 span 编码成 W3C traceparent，用于存库或放进消息体
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// WithTraceParent 把存下来的 traceparent 还原成 ctx，后续的 span 都挂在它下面
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
+
+// Inject / Extract 在任意载体 (HTTP header、AMQP header、gRPC metadata) 上传递 trace context
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	propagator.Inject(ctx, carrier)
+}
+
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return propagator.Extract(ctx, carrier)
+}
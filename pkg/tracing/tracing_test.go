@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/stywzn/Go-Cloud-Compute/pkg/config"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	if TraceID(ctx) != "" || TraceParent(ctx) != "" {
+		t.Errorf("empty ctx: trace id %q, traceparent %q", TraceID(ctx), TraceParent(ctx))
+	}
+	if WithTraceParent(ctx, "") != ctx {
+		t.Error("empty traceparent changed the ctx")
+	}
+	if sc := trace.SpanContextFromContext(WithTraceParent(ctx, "garbage")); sc.IsValid() {
+		t.Errorf("invalid traceparent restored %v", sc)
+	}
+
+	restored := WithTraceParent(ctx, testTraceParent)
+	if got := TraceID(restored); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("TraceID = %q", got)
+	}
+	if got := TraceParent(restored); got != testTraceParent {
+		t.Errorf("TraceParent = %q, want %q", got, testTraceParent)
+	}
+	if !trace.SpanContextFromContext(restored).IsRemote() {
+		t.Error("restored span context should be remote")
+	}
+}
+
+// 不导出 span 时仍然生成 trace ID，子 span 继承存下来的 traceparent
+func TestInitDisabledStillTraces(t *testing.T) {
+	shutdown, err := Init(config.TracingConfig{}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	ctx, span := Tracer().Start(context.Background(), "root")
+	defer span.End()
+	if TraceID(ctx) == "" || TraceParent(ctx) == "" {
+		t.Fatal("root span has no trace id")
+	}
+
+	child, childSpan := Tracer().Start(WithTraceParent(context.Background(), TraceParent(ctx)), "child")
+	defer childSpan.End()
+	if TraceID(child) != TraceID(ctx) {
+		t.Errorf("child trace id %q, want %q", TraceID(child), TraceID(ctx))
+	}
+	if TraceParent(child) == TraceParent(ctx) {
+		t.Error("child span reused the parent span id")
+	}
+}